@@ -1,7 +1,11 @@
 package api
 
 import (
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/Trendyol/go-dcp/metric"
 	"github.com/ansrivas/fiberprometheus/v2"
@@ -13,10 +17,13 @@ import (
 
 	"github.com/Trendyol/go-dcp/couchbase"
 	"github.com/Trendyol/go-dcp/logger"
+	"github.com/Trendyol/go-dcp/models"
 	"github.com/Trendyol/go-dcp/servicediscovery"
 	"github.com/Trendyol/go-dcp/stream"
 
 	"github.com/gofiber/fiber/v2"
+
+	"google.golang.org/grpc"
 )
 
 type API interface {
@@ -30,11 +37,19 @@ type api struct {
 	stream           stream.Stream
 	serviceDiscovery servicediscovery.ServiceDiscovery
 	app              *fiber.App
+	grpcServer       *grpc.Server
 	config           *dcp.Dcp
 	registerer       *metric.Registerer
+	health           *models.HealthCheckResult
+	healthAt         time.Time
+	healthLock       sync.Mutex
 }
 
 func (s *api) Listen() {
+	if s.grpcServer != nil {
+		go s.listenGRPC()
+	}
+
 	logger.Log.Info("api starting on port %d", s.config.API.Port)
 
 	err := s.app.Listen(fmt.Sprintf(":%d", s.config.API.Port))
@@ -47,6 +62,10 @@ func (s *api) Listen() {
 }
 
 func (s *api) Shutdown() {
+	if s.grpcServer != nil {
+		s.grpcServer.GracefulStop()
+	}
+
 	err := s.app.Shutdown()
 	if err != nil {
 		logger.Log.Error("error while api cannot be shutdown, err: %v", err)
@@ -58,9 +77,67 @@ func (s *api) UnregisterMetricCollectors() {
 	s.registerer.UnregisterAll()
 }
 
+func (s *api) checkHealth() *models.HealthCheckResult {
+	result := s.client.CheckHealth()
+
+	_, activeStreams := s.stream.GetMetric()
+	failedStreams := s.stream.GetFailedStreamCount()
+
+	if failedStreams > 0 && activeStreams == 0 {
+		result.Fail("no stream could be opened")
+	} else if failedStreams > 0 {
+		result.Degrade(fmt.Sprintf("%v streams could not be opened", failedStreams))
+	}
+
+	return result
+}
+
+// cachedHealth returns the last health check while it is younger than healthCheck.interval, so probes do not
+// ping the cluster every time. Concurrent probes wait for the same check.
+func (s *api) cachedHealth() *models.HealthCheckResult {
+	s.healthLock.Lock()
+	defer s.healthLock.Unlock()
+
+	if s.health == nil || time.Since(s.healthAt) >= s.config.HealthCheck.Interval {
+		s.health, s.healthAt = s.checkHealth(), time.Now()
+	}
+
+	return s.health
+}
+
 func (s *api) status(c *fiber.Ctx) error {
-	if _, err := s.client.Ping(); err != nil {
-		return err
+	result := s.cachedHealth()
+
+	switch result.State {
+	case models.HealthStateFailed:
+		return fiber.NewError(fiber.StatusServiceUnavailable, strings.Join(result.Reasons, ", "))
+	case models.HealthStateDegraded:
+		return c.SendString("DEGRADED")
+	default:
+		return c.SendString("OK")
+	}
+}
+
+func (s *api) healthCheck(c *fiber.Ctx) error {
+	result := s.checkHealth()
+
+	s.healthLock.Lock()
+	s.health, s.healthAt = result, time.Now()
+	s.healthLock.Unlock()
+	if result.State == models.HealthStateFailed {
+		c.Status(fiber.StatusServiceUnavailable)
+	}
+
+	return c.JSON(result)
+}
+
+func (s *api) live(c *fiber.Ctx) error {
+	return c.SendString("OK")
+}
+
+func (s *api) ready(c *fiber.Ctx) error {
+	if err := s.stream.Readiness(); err != nil {
+		return fiber.NewError(fiber.StatusServiceUnavailable, err.Error())
 	}
 
 	return c.SendString("OK")
@@ -77,6 +154,67 @@ func (s *api) rebalance(c *fiber.Ctx) error {
 	return c.SendString("OK")
 }
 
+type offsetResetRequest struct {
+	Target string   `json:"target"`
+	VbIDs  []uint16 `json:"vbIds"`
+	SeqNo  uint64   `json:"seqNo"`
+}
+
+func (s *api) resetOffsets(c *fiber.Ctx) error {
+	var request offsetResetRequest
+	if err := c.BodyParser(&request); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	if len(request.VbIDs) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "vbIds must not be empty")
+	}
+
+	err := s.stream.ResetOffsets(request.VbIDs, request.Target, request.SeqNo)
+
+	switch {
+	case err == nil:
+		return c.SendString("OK")
+	case errors.Is(err, stream.ErrVBucketNotOwned), errors.Is(err, stream.ErrOffsetResetWhileBalancing),
+		errors.Is(err, stream.ErrOffsetResetAlreadyInFlight):
+		return fiber.NewError(fiber.StatusConflict, err.Error())
+	case errors.Is(err, stream.ErrUnknownOffsetResetTarget), errors.Is(err, stream.ErrOffsetResetAheadOfVBucket),
+		errors.Is(err, stream.ErrOffsetResetNotSupported):
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	default:
+		return err
+	}
+}
+
+func (s *api) pauseCollection(c *fiber.Ctx) error {
+	if err := s.stream.PauseCollection(c.Params("name")); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	return c.SendString("OK")
+}
+
+func (s *api) resumeCollection(c *fiber.Ctx) error {
+	if !s.stream.ResumeCollection(c.Params("name")) {
+		return fiber.NewError(fiber.StatusNotFound, "collection is not paused")
+	}
+
+	return c.SendString("OK")
+}
+
+func (s *api) pausedCollections(c *fiber.Ctx) error {
+	return c.JSON(s.stream.GetPausedCollections())
+}
+
+func (s *api) vBucketMap(c *fiber.Ctx) error {
+	nodeMap, err := s.client.GetVBucketNodeMap()
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(nodeMap)
+}
+
 func (s *api) followers(c *fiber.Ctx) error {
 	if s.serviceDiscovery == nil {
 		return c.SendString("service discovery is not enabled")
@@ -88,6 +226,7 @@ func (s *api) followers(c *fiber.Ctx) error {
 func NewAPI(config *dcp.Dcp,
 	client couchbase.Client,
 	stream stream.Stream,
+	vBucketDiscovery stream.VBucketDiscovery,
 	serviceDiscovery servicediscovery.ServiceDiscovery,
 	collectors []prometheus.Collector,
 ) API {
@@ -99,27 +238,46 @@ func NewAPI(config *dcp.Dcp,
 		client:           client,
 		stream:           stream,
 		serviceDiscovery: serviceDiscovery,
-		registerer:       metric.WrapWithRegisterer(prometheus.DefaultRegisterer),
+		registerer: metric.WrapWithRegisterer(
+			prometheus.WrapRegistererWith(config.Metric.Labels, prometheus.DefaultRegisterer),
+		),
 	}
 
-	err := api.registerer.RegisterAll(collectors)
-	if err == nil {
-		app.Use(newMetricMiddleware(app, config))
-	} else {
-		logger.Log.Error("metric middleware cannot be initialized: %v", err)
+	if !config.Metric.PrometheusDisabled {
+		err := api.registerer.RegisterAll(collectors)
+		if err == nil {
+			app.Use(newMetricMiddleware(app, config))
+		} else {
+			logger.Log.Error("metric middleware cannot be initialized: %v", err)
+		}
 	}
 
-	if config.Debug {
+	if config.API.GRPC.Enabled {
+		api.grpcServer = newGRPCServer(stream, vBucketDiscovery, serviceDiscovery)
+	}
+
+	if config.Debug || config.API.Pprof {
 		app.Use(pprof.New())
+	}
+
+	if config.Debug {
 		app.Get("/states/offset", api.offset)
 		app.Get("/states/followers", api.followers)
 	}
 
 	if !config.HealthCheck.Disabled {
 		app.Get("/status", api.status)
+		app.Post("/healthcheck", api.healthCheck)
 	}
 
+	app.Get("/health/live", api.live)
+	app.Get("/health/ready", api.ready)
 	app.Get("/rebalance", api.rebalance)
+	app.Get("/vbucketmap", api.vBucketMap)
+	app.Post("/collections/:name/pause", api.pauseCollection)
+	app.Post("/collections/:name/resume", api.resumeCollection)
+	app.Get("/collections/paused", api.pausedCollections)
+	app.Post("/offsets/reset", api.resetOffsets)
 
 	return api
 }
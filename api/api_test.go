@@ -0,0 +1,162 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Trendyol/go-dcp/config"
+	"github.com/Trendyol/go-dcp/couchbase"
+	"github.com/Trendyol/go-dcp/logger"
+	"github.com/Trendyol/go-dcp/models"
+	"github.com/Trendyol/go-dcp/stream"
+)
+
+func TestAPIPprofDoesNotShadowMetrics(t *testing.T) {
+	logger.InitDefaultLogger("error")
+
+	c := &config.Dcp{API: config.API{Pprof: true}}
+	c.ApplyDefaults()
+
+	a := NewAPI(c, nil, &fakeStream{}, &fakeVBucketDiscovery{}, nil, nil).(*api)
+
+	for _, path := range []string{"/debug/pprof/", c.Metric.Path} {
+		resp, err := a.app.Test(httptest.NewRequest("GET", path, nil))
+		if err != nil {
+			t.Fatalf("Unexpected error for %v, err: %v", path, err)
+		}
+
+		if resp.StatusCode != 200 {
+			t.Errorf("Unexpected status for %v, got: %v", path, resp.StatusCode)
+		}
+	}
+}
+
+func TestAPIHealthProbes(t *testing.T) {
+	logger.InitDefaultLogger("error")
+
+	c := &config.Dcp{}
+	c.ApplyDefaults()
+	c.Metric.PrometheusDisabled = true
+
+	s := &fakeStream{readiness: stream.ErrStreamBalancing}
+	a := NewAPI(c, nil, s, &fakeVBucketDiscovery{}, nil, nil).(*api)
+
+	status := func(path string) int {
+		resp, err := a.app.Test(httptest.NewRequest("GET", path, nil))
+		if err != nil {
+			t.Fatalf("Unexpected error for %v, err: %v", path, err)
+		}
+
+		return resp.StatusCode
+	}
+
+	if code := status("/health/live"); code != 200 {
+		t.Errorf("Unexpected liveness status, got: %v", code)
+	}
+
+	if code := status("/health/ready"); code != 503 {
+		t.Errorf("Unexpected readiness status while balancing, got: %v", code)
+	}
+
+	s.readiness = stream.ErrStreamPaused
+
+	if code := status("/health/ready"); code != 503 {
+		t.Errorf("Unexpected readiness status while paused, got: %v", code)
+	}
+
+	s.readiness = nil
+
+	if code := status("/health/ready"); code != 200 {
+		t.Errorf("Unexpected readiness status, got: %v", code)
+	}
+}
+
+type fakeHealthClient struct {
+	couchbase.Client
+	checks atomic.Int32
+}
+
+func (c *fakeHealthClient) CheckHealth() *models.HealthCheckResult {
+	c.checks.Add(1)
+
+	result := models.NewHealthCheckResult()
+	result.Services["memd"] = []models.ServiceHealth{{Endpoint: "node-1", State: "ok"}}
+
+	return result
+}
+
+type healthStream struct {
+	fakeStream
+	activeStreams int
+	failedStreams int
+}
+
+func (s *healthStream) GetMetric() (*stream.Metric, int) {
+	return &stream.Metric{}, s.activeStreams
+}
+
+func (s *healthStream) GetFailedStreamCount() int {
+	return s.failedStreams
+}
+
+func TestAPIStatusUsesCachedHealth(t *testing.T) {
+	logger.InitDefaultLogger("error")
+
+	c := &config.Dcp{}
+	c.ApplyDefaults()
+	c.Metric.PrometheusDisabled = true
+	c.HealthCheck.Interval = time.Hour
+
+	client := &fakeHealthClient{}
+	s := &healthStream{activeStreams: 2}
+	a := NewAPI(c, client, s, &fakeVBucketDiscovery{}, nil, nil).(*api)
+
+	request := func(method string, path string) (int, string) {
+		resp, err := a.app.Test(httptest.NewRequest(method, path, nil))
+		if err != nil {
+			t.Fatalf("Unexpected error for %v, err: %v", path, err)
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+
+		return resp.StatusCode, string(body)
+	}
+
+	for i := 0; i < 3; i++ {
+		if code, body := request("GET", "/status"); code != 200 || body != "OK" {
+			t.Fatalf("Unexpected status, got: %v, body: %v", code, body)
+		}
+	}
+
+	if checks := client.checks.Load(); checks != 1 {
+		t.Errorf("Unexpected health checks for cached status, got: %v", checks)
+	}
+
+	s.failedStreams = 1
+
+	code, body := request("POST", "/healthcheck")
+
+	var result models.HealthCheckResult
+	if err := json.Unmarshal([]byte(body), &result); err != nil {
+		t.Fatalf("Unexpected health check body, got: %v, err: %v", body, err)
+	}
+
+	if code != 200 || result.State != models.HealthStateDegraded || result.Healthy || client.checks.Load() != 2 {
+		t.Errorf("Unexpected health check, code: %v, state: %v, healthy: %v, checks: %v",
+			code, result.State, result.Healthy, client.checks.Load())
+	}
+
+	if code, body := request("GET", "/status"); code != 200 || body != "DEGRADED" {
+		t.Errorf("Unexpected status after health check, got: %v, body: %v", code, body)
+	}
+
+	s.activeStreams = 0
+
+	if code, _ := request("POST", "/healthcheck"); code != 503 {
+		t.Errorf("Unexpected health check status without active streams, got: %v", code)
+	}
+}
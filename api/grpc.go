@@ -0,0 +1,140 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/Trendyol/go-dcp/logger"
+	"github.com/Trendyol/go-dcp/models"
+	"github.com/Trendyol/go-dcp/servicediscovery"
+	"github.com/Trendyol/go-dcp/stream"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const managementServiceName = "godcp.management.v1.Management"
+
+// managementServer implements the service of management.proto over the handles of the HTTP API.
+type managementServer struct {
+	stream           stream.Stream
+	vBucketDiscovery stream.VBucketDiscovery
+	serviceDiscovery servicediscovery.ServiceDiscovery
+}
+
+func (s *managementServer) GetOffsets(_ context.Context, _ *emptypb.Empty) (*structpb.Struct, error) {
+	offsets, _, _ := s.stream.GetOffsets()
+
+	fields := map[string]interface{}{}
+
+	offsets.Range(func(vbID uint16, offset *models.Offset) bool {
+		fields[strconv.Itoa(int(vbID))] = map[string]interface{}{
+			"seqNo":      strconv.FormatUint(offset.SeqNo, 10),
+			"vbUUID":     strconv.FormatUint(uint64(offset.VbUUID), 10),
+			"startSeqNo": strconv.FormatUint(offset.StartSeqNo, 10),
+			"endSeqNo":   strconv.FormatUint(offset.EndSeqNo, 10),
+		}
+
+		return true
+	})
+
+	return structpb.NewStruct(fields)
+}
+
+func (s *managementServer) Rebalance(_ context.Context, _ *emptypb.Empty) (*emptypb.Empty, error) {
+	s.stream.Rebalance()
+
+	return &emptypb.Empty{}, nil
+}
+
+func (s *managementServer) GetMembership(_ context.Context, _ *emptypb.Empty) (*structpb.Struct, error) {
+	metric := s.vBucketDiscovery.GetMetric()
+
+	fields := map[string]interface{}{
+		"type":              metric.Type,
+		"memberNumber":      metric.MemberNumber,
+		"totalMembers":      metric.TotalMembers,
+		"vBucketCount":      metric.VBucketCount,
+		"vBucketRangeStart": int(metric.VBucketRangeStart),
+		"vBucketRangeEnd":   int(metric.VBucketRangeEnd),
+	}
+
+	if s.serviceDiscovery != nil {
+		followers := []interface{}{}
+		for _, name := range s.serviceDiscovery.GetAll() {
+			followers = append(followers, name)
+		}
+
+		fields["followers"] = followers
+	}
+
+	return structpb.NewStruct(fields)
+}
+
+func unaryHandler[T any](
+	call func(s *managementServer, ctx context.Context, in *emptypb.Empty) (T, error),
+	method string,
+) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		in := new(emptypb.Empty)
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			return call(srv.(*managementServer), ctx, req.(*emptypb.Empty))
+		}
+
+		if interceptor == nil {
+			return handler(ctx, in)
+		}
+
+		return interceptor(ctx, in, &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + managementServiceName + "/" + method}, handler)
+	}
+}
+
+var managementServiceDesc = grpc.ServiceDesc{
+	ServiceName: managementServiceName,
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "GetOffsets", Handler: unaryHandler((*managementServer).GetOffsets, "GetOffsets")},
+		{MethodName: "Rebalance", Handler: unaryHandler((*managementServer).Rebalance, "Rebalance")},
+		{MethodName: "GetMembership", Handler: unaryHandler((*managementServer).GetMembership, "GetMembership")},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "management.proto",
+}
+
+func newGRPCServer(
+	stream stream.Stream,
+	vBucketDiscovery stream.VBucketDiscovery,
+	serviceDiscovery servicediscovery.ServiceDiscovery,
+) *grpc.Server {
+	server := grpc.NewServer()
+	server.RegisterService(&managementServiceDesc, &managementServer{
+		stream:           stream,
+		vBucketDiscovery: vBucketDiscovery,
+		serviceDiscovery: serviceDiscovery,
+	})
+
+	return server
+}
+
+func (s *api) listenGRPC() {
+	logger.Log.Info("grpc api starting on port %d", s.config.API.GRPC.Port)
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.config.API.GRPC.Port))
+	if err != nil {
+		logger.Log.Error("grpc api cannot start on port %d, err: %v", s.config.API.GRPC.Port, err)
+		return
+	}
+
+	if err = s.grpcServer.Serve(listener); err != nil {
+		logger.Log.Error("grpc api stopped with err: %v", err)
+	} else {
+		logger.Log.Info("grpc api stopped")
+	}
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/Trendyol/go-dcp/models"
+	"github.com/Trendyol/go-dcp/stream"
+	"github.com/Trendyol/go-dcp/wrapper"
+	"github.com/couchbase/gocbcore/v10"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type fakeStream struct {
+	stream.Stream
+	readiness  error
+	rebalanced bool
+}
+
+func (s *fakeStream) Readiness() error {
+	return s.readiness
+}
+
+func (s *fakeStream) GetOffsets() (*wrapper.ConcurrentSwissMap[uint16, *models.Offset], *wrapper.ConcurrentSwissMap[uint16, bool], bool) { //nolint:lll
+	offsets := wrapper.CreateConcurrentSwissMap[uint16, *models.Offset](1024)
+	offsets.Store(3, &models.Offset{SnapshotMarker: &models.SnapshotMarker{StartSeqNo: 1, EndSeqNo: 9}, VbUUID: gocbcore.VbUUID(42), SeqNo: 5})
+
+	return offsets, wrapper.CreateConcurrentSwissMap[uint16, bool](1024), false
+}
+
+func (s *fakeStream) Rebalance() {
+	s.rebalanced = true
+}
+
+type fakeVBucketDiscovery struct {
+	stream.VBucketDiscovery
+}
+
+func (d *fakeVBucketDiscovery) GetMetric() *stream.VBucketDiscoveryMetric {
+	return &stream.VBucketDiscoveryMetric{Type: "static", MemberNumber: 1, TotalMembers: 2, VBucketCount: 512, VBucketRangeEnd: 511}
+}
+
+func TestManagementServer(t *testing.T) {
+	s := &fakeStream{}
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := newGRPCServer(s, &fakeVBucketDiscovery{}, nil)
+
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer server.Stop()
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error while dialing, err: %v", err)
+	}
+	defer conn.Close()
+
+	offsets := &structpb.Struct{}
+	if err = conn.Invoke(context.Background(), "/"+managementServiceName+"/GetOffsets", &emptypb.Empty{}, offsets); err != nil {
+		t.Fatalf("Unexpected error on GetOffsets, err: %v", err)
+	}
+
+	offset := offsets.GetFields()["3"].GetStructValue().GetFields()
+	if offset["seqNo"].GetStringValue() != "5" || offset["vbUUID"].GetStringValue() != "42" || offset["endSeqNo"].GetStringValue() != "9" {
+		t.Errorf("Unexpected offset, got: %v", offset)
+	}
+
+	if err = conn.Invoke(context.Background(), "/"+managementServiceName+"/Rebalance", &emptypb.Empty{}, &emptypb.Empty{}); err != nil {
+		t.Fatalf("Unexpected error on Rebalance, err: %v", err)
+	}
+
+	if !s.rebalanced {
+		t.Errorf("Rebalance was not triggered")
+	}
+
+	membership := &structpb.Struct{}
+	if err = conn.Invoke(context.Background(), "/"+managementServiceName+"/GetMembership", &emptypb.Empty{}, membership); err != nil {
+		t.Fatalf("Unexpected error on GetMembership, err: %v", err)
+	}
+
+	if membership.GetFields()["totalMembers"].GetNumberValue() != 2 || membership.GetFields()["type"].GetStringValue() != "static" {
+		t.Errorf("Unexpected membership, got: %v", membership)
+	}
+
+	if _, ok := membership.GetFields()["followers"]; ok {
+		t.Errorf("Followers should not be set without service discovery")
+	}
+}
@@ -2,8 +2,14 @@ package config
 
 import (
 	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
 	"os"
+	"regexp"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Trendyol/go-dcp/helpers"
@@ -14,16 +20,43 @@ import (
 const (
 	DefaultScopeName                                = "_default"
 	DefaultCollectionName                           = "_default"
+	CollectionNameWildcard                          = "*"
 	FileMetadataFileNameConfig                      = "fileName"
 	MetadataTypeCouchbase                           = "couchbase"
 	MetadataTypeFile                                = "file"
+	MetadataTypeRedis                               = "redis"
+	RedisMetadataAddressConfig                      = "address"
+	RedisMetadataUsernameConfig                     = "username"
+	RedisMetadataPasswordConfig                     = "password"
+	RedisMetadataDBConfig                           = "db"
+	RedisMetadataTLSConfig                          = "tls"
+	RedisMetadataClusterConfig                      = "cluster"
+	RedisMetadataRootCAPathConfig                   = "rootCAPath"
+	RedisMetadataClientCertPathConfig               = "clientCertPath"
+	RedisMetadataClientKeyPathConfig                = "clientKeyPath"
+	RedisMetadataServerNameConfig                   = "serverName"
+	RedisMetadataInsecureSkipVerifyConfig           = "insecureSkipVerify"
+	MetadataTypeDynamoDB                            = "dynamodb"
+	DynamoDBMetadataTableConfig                     = "table"
+	DynamoDBMetadataRegionConfig                    = "region"
+	DynamoDBMetadataEndpointConfig                  = "endpoint"
 	MembershipTypeCouchbase                         = "couchbase"
 	CouchbaseMetadataBucketConfig                   = "bucket"
 	CouchbaseMetadataScopeConfig                    = "scope"
 	CouchbaseMetadataCollectionConfig               = "collection"
 	CouchbaseMetadataConnectionBufferSizeConfig     = "connectionBufferSize"
 	CouchbaseMetadataConnectionTimeoutConfig        = "connectionTimeout"
+	CouchbaseMetadataDurabilityLevelConfig          = "durabilityLevel"
+	CouchbaseMetadataDurabilityTimeoutConfig        = "durabilityTimeout"
+	CouchbaseMetadataSaveConcurrencyConfig          = "saveConcurrency"
+	DurabilityLevelNone                             = "none"
+	DurabilityLevelMajority                         = "majority"
+	DurabilityLevelMajorityAndPersistOnMaster       = "majorityAndPersistOnMaster"
+	DurabilityLevelPersistToMajority                = "persistToMajority"
 	CheckpointTypeAuto                              = "auto"
+	CheckpointTypeManual                            = "manual"
+	CheckpointAutoResetTypeEarliest                 = "earliest"
+	CheckpointAutoResetTypeLatest                   = "latest"
 	CouchbaseMembershipExpirySecondsConfig          = "expirySeconds"
 	CouchbaseMembershipHeartbeatIntervalConfig      = "heartbeatInterval"
 	CouchbaseMembershipHeartbeatToleranceConfig     = "heartbeatToleranceDuration"
@@ -34,6 +67,22 @@ const (
 	KubernetesLeaderElectorLeaseDurationConfig      = "leaseDuration"
 	KubernetesLeaderElectorRenewDeadlineConfig      = "renewDeadline"
 	KubernetesLeaderElectorRetryPeriodConfig        = "retryPeriod"
+	SnapshotGapStrategyProceed                      = "proceed"
+	SnapshotGapStrategySkip                         = "skip"
+	FilterEmptyStrategyClose                        = "close"
+	FilterEmptyStrategyReopen                       = "reopen"
+	NetworkTypeAuto                                 = "auto"
+	NetworkTypeDefault                              = "default"
+	NetworkTypeExternal                             = "external"
+	PausedCollectionStrategyBuffer                  = "buffer"
+	PausedCollectionStrategyDrop                    = "drop"
+	VbUUIDStrategyStored                            = "stored"
+	VbUUIDStrategyFailoverLog                       = "failoverLog"
+	ListenerOnErrorSkip                             = "skip"
+	ListenerOnErrorBlock                            = "block"
+	ListenerOnErrorDLQ                              = "dlq"
+	DcpModeStream                                   = "stream"
+	DcpModeSnapshot                                 = "snapshot"
 )
 
 type DCPGroupMembership struct {
@@ -49,30 +98,160 @@ type DCPGroup struct {
 	Membership DCPGroupMembership `yaml:"membership"`
 }
 
+type DCPPausedCollection struct {
+	Strategy   string `yaml:"strategy"`
+	BufferSize int    `yaml:"bufferSize"`
+}
+
+type DCPDedup struct {
+	Window  uint64 `yaml:"window"`
+	Enabled bool   `yaml:"enabled"`
+}
+
+type DCPListenerRetry struct {
+	Attempts   int           `yaml:"attempts"`
+	Backoff    time.Duration `yaml:"backoff"`
+	MaxBackoff time.Duration `yaml:"maxBackoff"`
+}
+
+type DCPListenerBatch struct {
+	Size          int           `yaml:"size"`
+	FlushInterval time.Duration `yaml:"flushInterval"`
+}
+
 type DCPListener struct {
-	BufferSize uint `yaml:"bufferSize"`
+	PausedCollection  DCPPausedCollection `yaml:"pausedCollection"`
+	Retry             DCPListenerRetry    `yaml:"retry"`
+	Dedup             DCPDedup            `yaml:"dedup"`
+	Batch             DCPListenerBatch    `yaml:"batch"`
+	OnError           string              `yaml:"onError"`
+	BufferSize        uint                `yaml:"bufferSize"`
+	HeartbeatInterval time.Duration       `yaml:"heartbeatInterval"`
+	Parallelism       int                 `yaml:"parallelism"`
+	MaxInFlight       int                 `yaml:"maxInFlight"`
+	Concurrency       int                 `yaml:"concurrency"`
+	QueueSize         int                 `yaml:"queueSize"`
+	SystemEvents      bool                `yaml:"systemEvents"`
+}
+
+type DCPOpenStream struct {
+	VbUUIDStrategy      string        `yaml:"vbUuidStrategy"`
+	RetryAttempts       int           `yaml:"retryAttempts"`
+	RetryBackoff        time.Duration `yaml:"retryBackoff"`
+	FailedRetryInterval time.Duration `yaml:"failedRetryInterval"`
+}
+
+type DCPCloseStream struct {
+	RetryAttempts int           `yaml:"retryAttempts"`
+	RetryInterval time.Duration `yaml:"retryInterval"`
+}
+
+// DCPReconnect configures how often a dead dcp agent is reconnected before dcp gives up.
+type DCPReconnect struct {
+	Attempts   int           `yaml:"attempts"`
+	Backoff    time.Duration `yaml:"backoff"`
+	MaxBackoff time.Duration `yaml:"maxBackoff"`
+}
+
+type DCPVBuckets struct {
+	ValidCounts           []int         `yaml:"validCounts"`
+	RetryAttempts         int           `yaml:"retryAttempts"`
+	RetryInterval         time.Duration `yaml:"retryInterval"`
+	TopologyWatchInterval time.Duration `yaml:"topologyWatchInterval"`
+}
+
+type DCPFilter struct {
+	KeyRegex    string   `yaml:"keyRegex"`
+	KeyPrefixes []string `yaml:"keyPrefixes"`
 }
 
 type ExternalDcpConfig struct {
-	DisableChangeStreams bool `yaml:"disableChangeStreams"`
+	FilterEmptyStrategy  string `yaml:"filterEmptyStrategy"`
+	DisableChangeStreams bool   `yaml:"disableChangeStreams"`
 }
 
 type ExternalDcp struct {
 	BufferSize           any               `yaml:"bufferSize"`
 	ConnectionBufferSize any               `yaml:"connectionBufferSize"`
+	UseExpiryOpcode      *bool             `yaml:"useExpiryOpcode"`
 	Group                DCPGroup          `yaml:"group"`
 	ConnectionTimeout    time.Duration     `yaml:"connectionTimeout"`
+	NoopInterval         time.Duration     `yaml:"noopInterval"`
 	Listener             DCPListener       `yaml:"listener"`
 	Config               ExternalDcpConfig `yaml:"config"`
+	OpenStream           DCPOpenStream     `yaml:"openStream"`
+	CloseStream          DCPCloseStream    `yaml:"closeStream"`
+	Reconnect            DCPReconnect      `yaml:"reconnect"`
+	VBuckets             DCPVBuckets       `yaml:"vBuckets"`
+	Filter               DCPFilter         `yaml:"filter"`
+	Mode                 string            `yaml:"mode"`
+}
+
+type Proxy struct {
+	URL string `yaml:"url"`
+}
+
+// Parse returns the proxy url, only http and socks5 proxies are supported.
+func (p Proxy) Parse() (*url.URL, error) {
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "socks5" {
+		return nil, fmt.Errorf("unsupported proxy scheme: %s", u.Scheme)
+	}
+
+	return u, nil
+}
+
+// ProxyFunc returns the proxy for a net/http transport, it is nil when no proxy url is set.
+func (p Proxy) ProxyFunc() (func(*http.Request) (*url.URL, error), error) {
+	if p.URL == "" {
+		return nil, nil
+	}
+
+	u, err := p.Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	return http.ProxyURL(u), nil
+}
+
+// HTTP configures the management http client used for the version and bucket info requests.
+type HTTP struct {
+	Timeout         time.Duration `yaml:"timeout"`
+	MaxConnsPerHost int           `yaml:"maxConnsPerHost"`
+	SecurePort      int           `yaml:"securePort"`
 }
 
 type API struct {
-	Disabled bool `yaml:"disabled"`
-	Port     int  `yaml:"port"`
+	GRPC     APIGRPC `yaml:"grpc"`
+	Disabled bool    `yaml:"disabled"`
+	Pprof    bool    `yaml:"pprof"`
+	Port     int     `yaml:"port"`
+}
+
+type APIGRPC struct {
+	Enabled bool `yaml:"enabled"`
+	Port    int  `yaml:"port"`
+}
+
+type MetricStatsd struct {
+	Address   string        `yaml:"address"`
+	Prefix    string        `yaml:"prefix"`
+	Interval  time.Duration `yaml:"interval"`
+	Enabled   bool          `yaml:"enabled"`
+	DogStatsd bool          `yaml:"dogStatsd"`
 }
 
 type Metric struct {
-	Path string `yaml:"path"`
+	Labels                map[string]string `yaml:"labels"`
+	Path                  string            `yaml:"path"`
+	Statsd                MetricStatsd      `yaml:"statsd"`
+	CheckpointLagInterval time.Duration     `yaml:"checkpointLagInterval"`
+	PrometheusDisabled    bool              `yaml:"prometheusDisabled"`
 }
 
 type LeaderElection struct {
@@ -86,11 +265,69 @@ type RPC struct {
 	Port int `yaml:"port"`
 }
 
+type CheckpointWriteBehind struct {
+	MaxPending      int           `yaml:"maxPending"`
+	MaxPendingBytes int           `yaml:"maxPendingBytes"`
+	MaxLatency      time.Duration `yaml:"maxLatency"`
+	Enabled         bool          `yaml:"enabled"`
+}
+
+type CheckpointAdaptive struct {
+	LatencyThreshold time.Duration `yaml:"latencyThreshold"`
+	MaxInterval      time.Duration `yaml:"maxInterval"`
+	Window           int           `yaml:"window"`
+	Enabled          bool          `yaml:"enabled"`
+}
+
+type CheckpointSnapshotGap struct {
+	Strategy  string `yaml:"strategy"`
+	Threshold uint64 `yaml:"threshold"`
+}
+
 type Checkpoint struct {
-	Type      string        `yaml:"type"`
-	AutoReset string        `yaml:"autoReset"`
-	Interval  time.Duration `yaml:"interval"`
-	Timeout   time.Duration `yaml:"timeout"`
+	Type        string                `yaml:"type"`
+	AutoReset   string                `yaml:"autoReset"`
+	SnapshotGap CheckpointSnapshotGap `yaml:"snapshotGap"`
+	WriteBehind CheckpointWriteBehind `yaml:"writeBehind"`
+	Adaptive    CheckpointAdaptive    `yaml:"adaptive"`
+	Interval    time.Duration         `yaml:"interval"`
+	Timeout     time.Duration         `yaml:"timeout"`
+	LoadRetry   CheckpointLoadRetry   `yaml:"loadRetry"`
+	SaveOnClose bool                  `yaml:"saveOnClose"`
+}
+
+type CheckpointLoadRetry struct {
+	Attempts int           `yaml:"attempts"`
+	Backoff  time.Duration `yaml:"backoff"`
+}
+
+// ShouldSaveOnClose reports whether closing the stream saves the checkpoint, manual checkpoints
+// are only saved on close when the application opted in.
+func (c *Checkpoint) ShouldSaveOnClose() bool {
+	return c.Type == CheckpointTypeAuto || c.SaveOnClose
+}
+
+type MemoryPressure struct {
+	SoftLimit     any           `yaml:"softLimit"`
+	CheckInterval time.Duration `yaml:"checkInterval"`
+	Enabled       bool          `yaml:"enabled"`
+}
+
+type ConnectionRetry struct {
+	Attempts     int           `yaml:"attempts"`
+	InitialDelay time.Duration `yaml:"initialDelay"`
+	MaxDelay     time.Duration `yaml:"maxDelay"`
+}
+
+type Compression struct {
+	Enabled              *bool   `yaml:"enabled"`
+	MinSize              int     `yaml:"minSize"`
+	MinRatio             float64 `yaml:"minRatio"`
+	DisableDecompression bool    `yaml:"disableDecompression"`
+}
+
+type BulkGet struct {
+	Parallelism int `yaml:"parallelism"`
 }
 
 type HealthCheck struct {
@@ -106,9 +343,31 @@ type RollbackMitigation struct {
 }
 
 type Metadata struct {
-	Config   map[string]string `yaml:"config"`
-	Type     string            `yaml:"type"`
-	ReadOnly bool              `yaml:"readOnly"`
+	Config      map[string]string   `yaml:"config"`
+	Type        string              `yaml:"type"`
+	Prefix      string              `yaml:"prefix"`
+	Secondaries []SecondaryMetadata `yaml:"secondaries"`
+	ReadOnly    bool                `yaml:"readOnly"`
+	Compression bool                `yaml:"compression"`
+}
+
+// SecondaryMetadata is a best-effort backup of the checkpoints, it shares the prefix and compression of the primary.
+type SecondaryMetadata struct {
+	Config map[string]string `yaml:"config"`
+	Type   string            `yaml:"type"`
+}
+
+// GetSecondaryMetadataConfig returns a copy of the config whose metadata is the secondary at index i.
+func (c *Dcp) GetSecondaryMetadataConfig(i int) *Dcp {
+	secondaryConfig := *c
+	secondaryConfig.Metadata = Metadata{
+		Config:      c.Metadata.Secondaries[i].Config,
+		Type:        c.Metadata.Secondaries[i].Type,
+		Prefix:      c.Metadata.Prefix,
+		Compression: c.Metadata.Compression,
+	}
+
+	return &secondaryConfig
 }
 
 type Logging struct {
@@ -118,6 +377,11 @@ type Logging struct {
 type Dcp struct {
 	ConnectionBufferSize any                `yaml:"connectionBufferSize"`
 	BucketName           string             `yaml:"bucketName"`
+	ClientIdentifier     string             `yaml:"clientIdentifier"`
+	ClientCertPath       string             `yaml:"clientCertPath"`
+	ClientKeyPath        string             `yaml:"clientKeyPath"`
+	ConnectionString     string             `yaml:"connectionString"`
+	NetworkType          string             `yaml:"networkType"`
 	ScopeName            string             `yaml:"scopeName"`
 	Password             string             `yaml:"password"`
 	RootCAPath           string             `yaml:"rootCAPath"`
@@ -130,10 +394,21 @@ type Dcp struct {
 	Checkpoint           Checkpoint         `yaml:"checkpoint"`
 	LeaderElection       LeaderElection     `yaml:"leaderElection"`
 	Dcp                  ExternalDcp        `yaml:"dcp"`
+	Proxy                Proxy              `yaml:"proxy"`
+	HTTP                 HTTP               `yaml:"http"`
+	MemoryPressure       MemoryPressure     `yaml:"memoryPressure"`
 	HealthCheck          HealthCheck        `yaml:"healthCheck"`
+	ConnectionRetry      ConnectionRetry    `yaml:"connectionRetry"`
+	BulkGet              BulkGet            `yaml:"bulkGet"`
+	Compression          Compression        `yaml:"compression"`
 	RollbackMitigation   RollbackMitigation `yaml:"rollbackMitigation"`
 	API                  API                `yaml:"api"`
 	ConnectionTimeout    time.Duration      `yaml:"connectionTimeout"`
+	DataConnectTimeout   time.Duration      `yaml:"dataConnectTimeout"`
+	MetaConnectTimeout   time.Duration      `yaml:"metaConnectTimeout"`
+	DcpConnectTimeout    time.Duration      `yaml:"dcpConnectTimeout"`
+	PendingOpsTimeout    time.Duration      `yaml:"pendingOpsTimeout"`
+	StartTimeout         time.Duration      `yaml:"startTimeout"`
 	SecureConnection     bool               `yaml:"secureConnection"`
 	Debug                bool               `yaml:"debug"`
 }
@@ -146,6 +421,120 @@ func (c *Dcp) IsFileMetadata() bool {
 	return c.Metadata.Type == MetadataTypeFile
 }
 
+func (c *Dcp) IsRedisMetadata() bool {
+	return c.Metadata.Type == MetadataTypeRedis
+}
+
+// RedisMetadata is the redis metadata config, Address holds comma separated addresses for clusters. The tls options
+// follow the couchbase security config and need TLS to be set.
+type RedisMetadata struct {
+	Address            string
+	Username           string
+	Password           string
+	RootCAPath         string
+	ClientCertPath     string
+	ClientKeyPath      string
+	ServerName         string
+	DB                 int
+	TLS                bool
+	Cluster            bool
+	InsecureSkipVerify bool
+}
+
+func (c *Dcp) parseRedisMetadataBool(key string) bool {
+	value, ok := c.Metadata.Config[key]
+	if !ok {
+		return false
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		logger.Log.Error("error while parse redis metadata %v, err: %v", key, err)
+		panic(err)
+	}
+
+	return parsed
+}
+
+func (c *Dcp) GetRedisMetadata() *RedisMetadata {
+	redisMetadata := RedisMetadata{
+		Address:            c.Metadata.Config[RedisMetadataAddressConfig],
+		Username:           c.Metadata.Config[RedisMetadataUsernameConfig],
+		Password:           c.Metadata.Config[RedisMetadataPasswordConfig],
+		RootCAPath:         c.Metadata.Config[RedisMetadataRootCAPathConfig],
+		ClientCertPath:     c.Metadata.Config[RedisMetadataClientCertPathConfig],
+		ClientKeyPath:      c.Metadata.Config[RedisMetadataClientKeyPathConfig],
+		ServerName:         c.Metadata.Config[RedisMetadataServerNameConfig],
+		TLS:                c.parseRedisMetadataBool(RedisMetadataTLSConfig),
+		Cluster:            c.parseRedisMetadataBool(RedisMetadataClusterConfig),
+		InsecureSkipVerify: c.parseRedisMetadataBool(RedisMetadataInsecureSkipVerifyConfig),
+	}
+
+	if redisMetadata.Address == "" {
+		err := errors.New("redis metadata address is not set")
+		logger.Log.Error("error while get redis metadata, err: %v", err)
+		panic(err)
+	}
+
+	if db, ok := c.Metadata.Config[RedisMetadataDBConfig]; ok {
+		parsedDB, err := strconv.Atoi(db)
+		if err != nil {
+			logger.Log.Error("error while parse redis metadata db, err: %v", err)
+			panic(err)
+		}
+
+		redisMetadata.DB = parsedDB
+	}
+
+	tlsOptions := redisMetadata.RootCAPath != "" || redisMetadata.ClientCertPath != "" || redisMetadata.ClientKeyPath != "" ||
+		redisMetadata.ServerName != "" || redisMetadata.InsecureSkipVerify
+	if tlsOptions && !redisMetadata.TLS {
+		err := errors.New("redis metadata tls options require tls")
+		logger.Log.Error("error while get redis metadata, err: %v", err)
+		panic(err)
+	}
+
+	if (redisMetadata.ClientCertPath == "") != (redisMetadata.ClientKeyPath == "") {
+		err := errors.New("redis metadata clientCertPath and clientKeyPath must be set together")
+		logger.Log.Error("error while get redis metadata, err: %v", err)
+		panic(err)
+	}
+
+	return &redisMetadata
+}
+
+func (c *Dcp) IsDynamoDBMetadata() bool {
+	return c.Metadata.Type == MetadataTypeDynamoDB
+}
+
+type DynamoDBMetadata struct {
+	Table    string
+	Region   string
+	Endpoint string
+}
+
+func (c *Dcp) GetDynamoDBMetadata() *DynamoDBMetadata {
+	dynamoDBMetadata := DynamoDBMetadata{
+		Table:    c.Metadata.Config[DynamoDBMetadataTableConfig],
+		Region:   c.Metadata.Config[DynamoDBMetadataRegionConfig],
+		Endpoint: c.Metadata.Config[DynamoDBMetadataEndpointConfig],
+	}
+
+	if dynamoDBMetadata.Table == "" {
+		err := errors.New("dynamodb metadata table is not set")
+		logger.Log.Error("error while get dynamodb metadata, err: %v", err)
+		panic(err)
+	}
+
+	if dynamoDBMetadata.Region == "" {
+		err := errors.New("dynamodb metadata region is not set")
+		logger.Log.Error("error while get dynamodb metadata, err: %v", err)
+		panic(err)
+	}
+
+	return &dynamoDBMetadata
+}
+
 func (c *Dcp) GetFileMetadata() string {
 	var fileName string
 
@@ -244,7 +633,20 @@ type KubernetesLeaderElector struct {
 	RetryPeriod        time.Duration `yaml:"retryPeriod"`
 }
 
+// kubernetesLeaderElectorJitterFactor is the retry jitter of client-go leaderelection.
+const kubernetesLeaderElectorJitterFactor = 1.2
+
 func (c *Dcp) GetKubernetesLeaderElector() *KubernetesLeaderElector {
+	kubernetesLeaderElector, err := c.kubernetesLeaderElector()
+	if err != nil {
+		logger.Log.Error("error while creating leader elector, err: %v", err)
+		panic(err)
+	}
+
+	return kubernetesLeaderElector
+}
+
+func (c *Dcp) kubernetesLeaderElector() (*KubernetesLeaderElector, error) {
 	kubernetesLeaderElector := KubernetesLeaderElector{
 		LeaseDuration: 8 * time.Second,
 		RenewDeadline: 5 * time.Second,
@@ -254,24 +656,19 @@ func (c *Dcp) GetKubernetesLeaderElector() *KubernetesLeaderElector {
 	if leaseLockName, ok := c.LeaderElection.Config[KubernetesLeaderElectorLeaseLockNameConfig]; ok {
 		kubernetesLeaderElector.LeaseLockName = leaseLockName
 	} else {
-		err := errors.New("leaseLockName is not defined")
-		logger.Log.Error("error while creating leader elector, err: %v", err)
-		panic(err)
+		return nil, errors.New("leaseLockName is not defined")
 	}
 
 	if leaseLockNamespace, ok := c.LeaderElection.Config[KubernetesLeaderElectorLeaseLockNamespaceConfig]; ok {
 		kubernetesLeaderElector.LeaseLockNamespace = leaseLockNamespace
 	} else {
-		err := errors.New("leaseLockNamespace is not defined")
-		logger.Log.Error("error while creating leader elector, err: %v", err)
-		panic(err)
+		return nil, errors.New("leaseLockNamespace is not defined")
 	}
 
 	if leaseDuration, ok := c.LeaderElection.Config[KubernetesLeaderElectorLeaseDurationConfig]; ok {
 		parsedLeaseDuration, err := time.ParseDuration(leaseDuration)
 		if err != nil {
-			logger.Log.Error("error while parse leader election lease duration, err: %v", err)
-			panic(err)
+			return nil, fmt.Errorf("leaseDuration is invalid, err: %w", err)
 		}
 
 		kubernetesLeaderElector.LeaseDuration = parsedLeaseDuration
@@ -280,8 +677,7 @@ func (c *Dcp) GetKubernetesLeaderElector() *KubernetesLeaderElector {
 	if renewDeadline, ok := c.LeaderElection.Config[KubernetesLeaderElectorRenewDeadlineConfig]; ok {
 		parsedRenewDeadline, err := time.ParseDuration(renewDeadline)
 		if err != nil {
-			logger.Log.Error("error while parse leader election renew deadline, err: %v", err)
-			panic(err)
+			return nil, fmt.Errorf("renewDeadline is invalid, err: %w", err)
 		}
 
 		kubernetesLeaderElector.RenewDeadline = parsedRenewDeadline
@@ -290,22 +686,33 @@ func (c *Dcp) GetKubernetesLeaderElector() *KubernetesLeaderElector {
 	if retryPeriod, ok := c.LeaderElection.Config[KubernetesLeaderElectorRetryPeriodConfig]; ok {
 		parsedRetryPeriod, err := time.ParseDuration(retryPeriod)
 		if err != nil {
-			logger.Log.Error("error while parse leader election retry period, err: %v", err)
-			panic(err)
+			return nil, fmt.Errorf("retryPeriod is invalid, err: %w", err)
 		}
 
 		kubernetesLeaderElector.RetryPeriod = parsedRetryPeriod
 	}
 
-	return &kubernetesLeaderElector
+	// client-go panics in the elector goroutine for these, so they are reported before it is created.
+	if kubernetesLeaderElector.LeaseDuration <= kubernetesLeaderElector.RenewDeadline {
+		return nil, errors.New("leaseDuration must be greater than renewDeadline")
+	}
+
+	if float64(kubernetesLeaderElector.RenewDeadline) <= kubernetesLeaderElectorJitterFactor*float64(kubernetesLeaderElector.RetryPeriod) {
+		return nil, fmt.Errorf("renewDeadline must be greater than retryPeriod*%v", kubernetesLeaderElectorJitterFactor)
+	}
+
+	return &kubernetesLeaderElector, nil
 }
 
 type CouchbaseMetadata struct {
 	Bucket               string        `yaml:"bucket"`
 	Scope                string        `yaml:"scope"`
 	Collection           string        `yaml:"collection"`
+	DurabilityLevel      string        `yaml:"durabilityLevel"`
 	ConnectionBufferSize uint          `yaml:"connectionBufferSize"`
 	ConnectionTimeout    time.Duration `yaml:"connectionTimeout"`
+	DurabilityTimeout    time.Duration `yaml:"durabilityTimeout"`
+	SaveConcurrency      int           `yaml:"saveConcurrency"`
 }
 
 func (c *Dcp) GetCouchbaseMetadata() *CouchbaseMetadata {
@@ -315,6 +722,12 @@ func (c *Dcp) GetCouchbaseMetadata() *CouchbaseMetadata {
 		Collection:           DefaultCollectionName,
 		ConnectionBufferSize: 5242880, // 5 MB
 		ConnectionTimeout:    5 * time.Second,
+		DurabilityLevel:      DurabilityLevelNone,
+		SaveConcurrency:      64,
+	}
+
+	if c.MetaConnectTimeout != 0 {
+		couchbaseMetadata.ConnectionTimeout = c.MetaConnectTimeout
 	}
 
 	if bucket, ok := c.Metadata.Config[CouchbaseMetadataBucketConfig]; ok {
@@ -343,6 +756,33 @@ func (c *Dcp) GetCouchbaseMetadata() *CouchbaseMetadata {
 		couchbaseMetadata.ConnectionTimeout = parsedConnectionTimeout
 	}
 
+	if durabilityLevel, ok := c.Metadata.Config[CouchbaseMetadataDurabilityLevelConfig]; ok {
+		couchbaseMetadata.DurabilityLevel = durabilityLevel
+	}
+
+	if durabilityTimeout, ok := c.Metadata.Config[CouchbaseMetadataDurabilityTimeoutConfig]; ok {
+		parsedDurabilityTimeout, err := time.ParseDuration(durabilityTimeout)
+		if err != nil {
+			logger.Log.Error("error while parse metadata durability timeout, err: %v", err)
+			panic(err)
+		}
+
+		couchbaseMetadata.DurabilityTimeout = parsedDurabilityTimeout
+	}
+
+	if saveConcurrency, ok := c.Metadata.Config[CouchbaseMetadataSaveConcurrencyConfig]; ok {
+		parsedSaveConcurrency, err := strconv.Atoi(saveConcurrency)
+		if err == nil && parsedSaveConcurrency <= 0 {
+			err = errors.New("metadata save concurrency must be positive")
+		}
+		if err != nil {
+			logger.Log.Error("error while parse metadata save concurrency, err: %v", err)
+			panic(err)
+		}
+
+		couchbaseMetadata.SaveConcurrency = parsedSaveConcurrency
+	}
+
 	return &couchbaseMetadata
 }
 
@@ -350,11 +790,18 @@ func (c *Dcp) ApplyDefaults() {
 	c.applyDefaultRollbackMitigation()
 	c.applyDefaultCheckpoint()
 	c.applyDefaultHealthCheck()
+	c.applyDefaultMemoryPressure()
 	c.applyDefaultGroupMembership()
 	c.applyDefaultConnectionTimeout()
+	c.applyDefaultConnectionRetry()
+	c.applyDefaultHTTP()
+	c.applyDefaultNetworkType()
+	c.applyDefaultBulkGet()
+	c.applyDefaultCompression()
 	c.applyDefaultCollections()
 	c.applyDefaultScopeName()
 	c.applyDefaultConnectionBufferSize()
+	c.applyDefaultClientIdentifier()
 	c.applyDefaultMetrics()
 	c.applyDefaultAPI()
 	c.applyDefaultLeaderElection()
@@ -363,6 +810,142 @@ func (c *Dcp) ApplyDefaults() {
 	c.applyLogging()
 }
 
+// Validate checks the required fields and the value ranges before the defaults are applied, so values the
+// defaults would replace are reported too. Zero values are left to the defaults. It returns every problem
+// joined in a single error.
+func (c *Dcp) Validate() error {
+	var errs []error
+
+	if len(c.Hosts) == 0 && c.ConnectionString == "" {
+		errs = append(errs, errors.New("hosts or connectionString is required"))
+	}
+
+	if c.BucketName == "" {
+		errs = append(errs, errors.New("bucketName is required"))
+	}
+
+	if c.Dcp.Group.Name == "" {
+		errs = append(errs, errors.New("dcp.group.name is required"))
+	}
+
+	if len(c.CollectionNames) > 1 && slices.Contains(c.CollectionNames, CollectionNameWildcard) {
+		errs = append(errs, errors.New("collection wildcard can not be combined with other collection names"))
+	}
+
+	if c.Checkpoint.Type != "" && c.Checkpoint.Type != CheckpointTypeAuto && c.Checkpoint.Type != CheckpointTypeManual {
+		errs = append(errs, fmt.Errorf("checkpoint.type must be auto or manual, got: %v", c.Checkpoint.Type))
+	}
+
+	if c.Checkpoint.Interval < 0 {
+		errs = append(errs, fmt.Errorf("checkpoint.interval can not be negative, got: %v", c.Checkpoint.Interval))
+	}
+
+	if c.Checkpoint.Timeout < 0 {
+		errs = append(errs, fmt.Errorf("checkpoint.timeout can not be negative, got: %v", c.Checkpoint.Timeout))
+	}
+
+	switch c.Checkpoint.AutoReset {
+	case "", CheckpointAutoResetTypeEarliest, CheckpointAutoResetTypeLatest:
+	default:
+		errs = append(errs, fmt.Errorf("checkpoint.autoReset must be earliest or latest, got: %v", c.Checkpoint.AutoReset))
+	}
+
+	if c.Checkpoint.Adaptive.Enabled && c.Checkpoint.WriteBehind.Enabled {
+		errs = append(errs, errors.New("checkpoint.adaptive and checkpoint.writeBehind can not be enabled together"))
+	}
+
+	if c.Metadata.Type != "" && !isMetadataType(c.Metadata.Type) {
+		errs = append(errs, fmt.Errorf("metadata.type must be couchbase, file, redis or dynamodb, got: %v", c.Metadata.Type))
+	}
+
+	for i, secondary := range c.Metadata.Secondaries {
+		if !isMetadataType(secondary.Type) {
+			errs = append(errs, fmt.Errorf(
+				"metadata.secondaries[%v].type must be couchbase, file, redis or dynamodb, got: %v", i, secondary.Type,
+			))
+		}
+	}
+
+	if c.Metadata.Prefix != "" && strings.TrimSpace(c.Metadata.Prefix) == "" {
+		errs = append(errs, errors.New("metadata.prefix can not be blank"))
+	}
+
+	memberNumber, totalMembers, err := c.groupMembershipNumbers()
+	switch {
+	case err != nil:
+		errs = append(errs, err)
+	case totalMembers < 1 || memberNumber < 1 || memberNumber > totalMembers:
+		errs = append(errs, fmt.Errorf(
+			"dcp.group.membership.memberNumber must be between 1 and totalMembers, got: %v of %v", memberNumber, totalMembers,
+		))
+	}
+
+	if c.LeaderElection.Enabled && (c.LeaderElection.Type == "" || c.LeaderElection.Type == "kubernetes") {
+		if _, err := c.kubernetesLeaderElector(); err != nil {
+			errs = append(errs, fmt.Errorf("leaderElection.config is invalid, err: %w", err))
+		}
+	}
+
+	errs = append(errs, c.validateListener()...)
+
+	if c.Dcp.Filter.KeyRegex != "" {
+		if _, err := regexp.Compile(c.Dcp.Filter.KeyRegex); err != nil {
+			errs = append(errs, fmt.Errorf("dcp.filter.keyRegex is invalid, err: %w", err))
+		}
+	}
+
+	if c.Dcp.Mode != "" && c.Dcp.Mode != DcpModeStream && c.Dcp.Mode != DcpModeSnapshot {
+		errs = append(errs, fmt.Errorf("dcp.mode must be stream or snapshot, got: %v", c.Dcp.Mode))
+	}
+
+	if c.Proxy.URL != "" {
+		if _, err := c.Proxy.Parse(); err != nil {
+			errs = append(errs, fmt.Errorf("proxy.url is invalid, err: %w", err))
+		}
+	}
+
+	if c.Dcp.NoopInterval < 0 {
+		errs = append(errs, fmt.Errorf("dcp.noopInterval can not be negative, got: %v", c.Dcp.NoopInterval))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c *Dcp) validateListener() []error {
+	var errs []error
+
+	listener := c.Dcp.Listener
+
+	if listener.Parallelism < 0 {
+		errs = append(errs, fmt.Errorf("dcp.listener.parallelism can not be negative, got: %v", listener.Parallelism))
+	}
+
+	if listener.Concurrency < 0 {
+		errs = append(errs, fmt.Errorf("dcp.listener.concurrency can not be negative, got: %v", listener.Concurrency))
+	}
+
+	if listener.Parallelism > 1 && listener.Concurrency > 1 {
+		errs = append(errs, errors.New("dcp.listener.parallelism and dcp.listener.concurrency can not be used together"))
+	}
+
+	switch listener.OnError {
+	case "", ListenerOnErrorSkip, ListenerOnErrorBlock, ListenerOnErrorDLQ:
+	default:
+		errs = append(errs, fmt.Errorf("dcp.listener.onError must be skip, block or dlq, got: %v", listener.OnError))
+	}
+
+	return errs
+}
+
+func isMetadataType(metadataType string) bool {
+	switch metadataType {
+	case MetadataTypeCouchbase, MetadataTypeFile, MetadataTypeRedis, MetadataTypeDynamoDB:
+		return true
+	default:
+		return false
+	}
+}
+
 func (c *Dcp) applyDefaultRollbackMitigation() {
 	if c.RollbackMitigation.Interval == 0 {
 		c.RollbackMitigation.Interval = 500 * time.Millisecond
@@ -386,8 +969,44 @@ func (c *Dcp) applyDefaultCheckpoint() {
 		c.Checkpoint.Type = "auto"
 	}
 
+	if c.Checkpoint.LoadRetry.Attempts == 0 {
+		c.Checkpoint.LoadRetry.Attempts = 3
+	}
+
+	if c.Checkpoint.LoadRetry.Backoff == 0 {
+		c.Checkpoint.LoadRetry.Backoff = time.Second
+	}
+
 	if c.Checkpoint.AutoReset == "" {
-		c.Checkpoint.AutoReset = "earliest"
+		c.Checkpoint.AutoReset = CheckpointAutoResetTypeEarliest
+	}
+
+	if c.Checkpoint.WriteBehind.MaxPending == 0 {
+		c.Checkpoint.WriteBehind.MaxPending = 10000
+	}
+
+	if c.Checkpoint.WriteBehind.MaxLatency == 0 {
+		c.Checkpoint.WriteBehind.MaxLatency = c.Checkpoint.Interval
+	}
+
+	if c.Checkpoint.Adaptive.LatencyThreshold == 0 {
+		c.Checkpoint.Adaptive.LatencyThreshold = time.Second
+	}
+
+	if c.Checkpoint.Adaptive.MaxInterval == 0 {
+		c.Checkpoint.Adaptive.MaxInterval = 5 * c.Checkpoint.Interval
+	}
+
+	if c.Checkpoint.Adaptive.Window == 0 {
+		c.Checkpoint.Adaptive.Window = 5
+	}
+
+	if c.Checkpoint.SnapshotGap.Strategy == "" {
+		c.Checkpoint.SnapshotGap.Strategy = SnapshotGapStrategyProceed
+	}
+
+	if c.Checkpoint.SnapshotGap.Threshold == 0 {
+		c.Checkpoint.SnapshotGap.Threshold = 100000
 	}
 }
 
@@ -401,42 +1020,58 @@ func (c *Dcp) applyDefaultHealthCheck() {
 	}
 }
 
+func (c *Dcp) applyDefaultMemoryPressure() {
+	if c.MemoryPressure.CheckInterval == 0 {
+		c.MemoryPressure.CheckInterval = time.Second
+	}
+}
+
 func (c *Dcp) applyDefaultGroupMembership() {
 	if c.Dcp.Group.Membership.RebalanceDelay == 0 {
 		c.Dcp.Group.Membership.RebalanceDelay = 20 * time.Second
 	}
 
-	if c.Dcp.Group.Membership.TotalMembers == 0 {
-		c.Dcp.Group.Membership.TotalMembers = 1
+	if c.Dcp.Group.Membership.Type == "" {
+		c.Dcp.Group.Membership.Type = MembershipTypeCouchbase
 	}
 
-	if c.Dcp.Group.Membership.MemberNumber == 0 {
-		c.Dcp.Group.Membership.MemberNumber = 1
+	// an invalid environment variable is reported by Validate, the configured numbers are kept then
+	memberNumber, totalMembers, err := c.groupMembershipNumbers()
+	if err == nil {
+		c.Dcp.Group.Membership.MemberNumber, c.Dcp.Group.Membership.TotalMembers = memberNumber, totalMembers
 	}
+}
 
-	if c.Dcp.Group.Membership.Type == "" {
-		c.Dcp.Group.Membership.Type = MembershipTypeCouchbase
+// groupMembershipNumbers returns the member number and the total members with the defaults and the
+// GO_DCP__DCP_GROUP_MEMBERSHIP_* environment variables applied.
+func (c *Dcp) groupMembershipNumbers() (int, int, error) {
+	memberNumber, totalMembers := c.Dcp.Group.Membership.MemberNumber, c.Dcp.Group.Membership.TotalMembers
+
+	if totalMembers == 0 {
+		totalMembers = 1
+	}
+
+	if memberNumber == 0 {
+		memberNumber = 1
 	}
 
 	if totalMembersFromEnvVariable := os.Getenv("GO_DCP__DCP_GROUP_MEMBERSHIP_TOTALMEMBERS"); totalMembersFromEnvVariable != "" {
 		t, err := strconv.Atoi(totalMembersFromEnvVariable)
 		if err != nil {
-			err := errors.New("a non-integer environment variable was entered for 'totalMembers'")
-			logger.Log.Error("error while membership configuration, err: %v", err)
-			panic(err)
+			return 0, 0, errors.New("a non-integer environment variable was entered for 'totalMembers'")
 		}
-		c.Dcp.Group.Membership.TotalMembers = t
+		totalMembers = t
 	}
 
 	if memberNumberFromEnvVariable := os.Getenv("GO_DCP__DCP_GROUP_MEMBERSHIP_MEMBERNUMBER"); memberNumberFromEnvVariable != "" {
 		t, err := strconv.Atoi(memberNumberFromEnvVariable)
 		if err != nil {
-			err := errors.New("a non-integer environment variable was entered for 'memberNumber'")
-			logger.Log.Error("error while membership configuration, err: %v", err)
-			panic(err)
+			return 0, 0, errors.New("a non-integer environment variable was entered for 'memberNumber'")
 		}
-		c.Dcp.Group.Membership.MemberNumber = t
+		memberNumber = t
 	}
+
+	return memberNumber, totalMembers, nil
 }
 
 func (c *Dcp) applyDefaultConnectionTimeout() {
@@ -447,6 +1082,79 @@ func (c *Dcp) applyDefaultConnectionTimeout() {
 	if c.ConnectionTimeout == 0 {
 		c.ConnectionTimeout = 5 * time.Second
 	}
+
+	if c.DataConnectTimeout == 0 {
+		c.DataConnectTimeout = c.ConnectionTimeout
+	}
+
+	if c.MetaConnectTimeout == 0 {
+		c.MetaConnectTimeout = 5 * time.Second
+	}
+
+	if c.DcpConnectTimeout == 0 {
+		c.DcpConnectTimeout = c.Dcp.ConnectionTimeout
+	}
+
+	if c.PendingOpsTimeout == 0 {
+		c.PendingOpsTimeout = 10 * time.Second
+	}
+}
+
+func (c *Dcp) applyDefaultHTTP() {
+	if c.HTTP.Timeout == 0 {
+		c.HTTP.Timeout = 10 * time.Second
+	}
+
+	if c.HTTP.MaxConnsPerHost == 0 {
+		c.HTTP.MaxConnsPerHost = 512
+	}
+}
+
+func (c *Dcp) applyDefaultNetworkType() {
+	if c.NetworkType == "" {
+		c.NetworkType = NetworkTypeAuto
+	}
+}
+
+func (c *Dcp) applyDefaultConnectionRetry() {
+	if c.ConnectionRetry.Attempts == 0 {
+		c.ConnectionRetry.Attempts = 3
+	}
+
+	if c.ConnectionRetry.InitialDelay == 0 {
+		c.ConnectionRetry.InitialDelay = time.Second
+	}
+
+	if c.ConnectionRetry.MaxDelay == 0 {
+		c.ConnectionRetry.MaxDelay = 10 * time.Second
+	}
+}
+
+func (c *Dcp) applyDefaultBulkGet() {
+	if c.BulkGet.Parallelism == 0 {
+		c.BulkGet.Parallelism = 16
+	}
+}
+
+func (c *Dcp) applyDefaultCompression() {
+	if c.Compression.Enabled == nil {
+		enabled := true
+		c.Compression.Enabled = &enabled
+	}
+
+	if c.Compression.MinSize == 0 {
+		c.Compression.MinSize = 32
+	}
+
+	if c.Compression.MinRatio == 0 {
+		c.Compression.MinRatio = 0.83
+	}
+}
+
+func (c *Dcp) applyDefaultClientIdentifier() {
+	if c.ClientIdentifier == "" {
+		c.ClientIdentifier = helpers.DefaultClientIdentifier()
+	}
 }
 
 func (c *Dcp) applyDefaultCollections() {
@@ -455,6 +1163,16 @@ func (c *Dcp) applyDefaultCollections() {
 	}
 }
 
+// IsCollectionWildcard reports whether all collections of the scope are streamed,
+// including the ones created after the stream is opened.
+func (c *Dcp) IsCollectionWildcard() bool {
+	return IsCollectionWildcard(c.CollectionNames)
+}
+
+func IsCollectionWildcard(collectionNames []string) bool {
+	return len(collectionNames) == 1 && collectionNames[0] == CollectionNameWildcard
+}
+
 func (c *Dcp) applyDefaultScopeName() {
 	if c.ScopeName == "" {
 		c.ScopeName = DefaultScopeName
@@ -471,12 +1189,30 @@ func (c *Dcp) applyDefaultMetrics() {
 	if c.Metric.Path == "" {
 		c.Metric.Path = "/metrics"
 	}
+
+	if c.Metric.CheckpointLagInterval == 0 {
+		c.Metric.CheckpointLagInterval = 10 * time.Second
+	}
+
+	if c.Metric.Statsd.Enabled {
+		if c.Metric.Statsd.Address == "" {
+			c.Metric.Statsd.Address = "127.0.0.1:8125"
+		}
+
+		if c.Metric.Statsd.Interval == 0 {
+			c.Metric.Statsd.Interval = 10 * time.Second
+		}
+	}
 }
 
 func (c *Dcp) applyDefaultAPI() {
 	if c.API.Port == 0 {
 		c.API.Port = 8080
 	}
+
+	if c.API.GRPC.Port == 0 {
+		c.API.GRPC.Port = 8082
+	}
 }
 
 func (c *Dcp) applyDefaultLeaderElection() {
@@ -490,6 +1226,11 @@ func (c *Dcp) applyDefaultLeaderElection() {
 }
 
 func (c *Dcp) applyDefaultDcp() {
+	if c.Dcp.UseExpiryOpcode == nil {
+		useExpiryOpcode := true
+		c.Dcp.UseExpiryOpcode = &useExpiryOpcode
+	}
+
 	if c.Dcp.BufferSize == nil {
 		c.Dcp.BufferSize = helpers.ResolveUnionIntOrStringValue("16mb")
 	}
@@ -501,22 +1242,155 @@ func (c *Dcp) applyDefaultDcp() {
 	if c.Dcp.Listener.BufferSize == 0 {
 		c.Dcp.Listener.BufferSize = 1000
 	}
+
+	if c.Dcp.Listener.Parallelism == 0 {
+		c.Dcp.Listener.Parallelism = 1
+	}
+
+	if c.Dcp.Listener.MaxInFlight == 0 {
+		c.Dcp.Listener.MaxInFlight = 1000
+	}
+
+	if c.Dcp.Listener.PausedCollection.Strategy == "" {
+		c.Dcp.Listener.PausedCollection.Strategy = PausedCollectionStrategyBuffer
+	}
+
+	if c.Dcp.Listener.PausedCollection.BufferSize == 0 {
+		c.Dcp.Listener.PausedCollection.BufferSize = 10000
+	}
+
+	if c.Dcp.Listener.Concurrency == 0 {
+		c.Dcp.Listener.Concurrency = 1
+	}
+
+	if c.Dcp.Listener.QueueSize == 0 {
+		c.Dcp.Listener.QueueSize = 1000
+	}
+
+	if c.Dcp.Listener.Batch.Size == 0 {
+		c.Dcp.Listener.Batch.Size = 1000
+	}
+
+	if c.Dcp.Listener.Batch.FlushInterval == 0 {
+		c.Dcp.Listener.Batch.FlushInterval = time.Second
+	}
+
+	c.applyDefaultListenerRetry()
+
+	if c.Dcp.Config.FilterEmptyStrategy == "" {
+		c.Dcp.Config.FilterEmptyStrategy = FilterEmptyStrategyClose
+	}
+
+	if c.Dcp.OpenStream.RetryAttempts == 0 {
+		c.Dcp.OpenStream.RetryAttempts = 3
+	}
+
+	if c.Dcp.OpenStream.RetryBackoff == 0 {
+		c.Dcp.OpenStream.RetryBackoff = time.Second
+	}
+
+	if c.Dcp.OpenStream.FailedRetryInterval == 0 {
+		c.Dcp.OpenStream.FailedRetryInterval = 30 * time.Second
+	}
+
+	if c.Dcp.OpenStream.VbUUIDStrategy == "" {
+		c.Dcp.OpenStream.VbUUIDStrategy = VbUUIDStrategyStored
+	}
+
+	if c.Dcp.CloseStream.RetryAttempts == 0 {
+		c.Dcp.CloseStream.RetryAttempts = 3
+	}
+
+	if c.Dcp.CloseStream.RetryInterval == 0 {
+		c.Dcp.CloseStream.RetryInterval = time.Second
+	}
+
+	if c.Dcp.Reconnect.Attempts == 0 {
+		c.Dcp.Reconnect.Attempts = 5
+	}
+
+	if c.Dcp.Reconnect.Backoff == 0 {
+		c.Dcp.Reconnect.Backoff = time.Second
+	}
+
+	if c.Dcp.Reconnect.MaxBackoff == 0 {
+		c.Dcp.Reconnect.MaxBackoff = 30 * time.Second
+	}
+
+	if len(c.Dcp.VBuckets.ValidCounts) == 0 {
+		c.Dcp.VBuckets.ValidCounts = []int{64, 128, 1024}
+	}
+
+	if c.Dcp.VBuckets.RetryAttempts == 0 {
+		c.Dcp.VBuckets.RetryAttempts = 5
+	}
+
+	if c.Dcp.VBuckets.RetryInterval == 0 {
+		c.Dcp.VBuckets.RetryInterval = time.Second
+	}
+
+	if c.Dcp.VBuckets.TopologyWatchInterval == 0 {
+		c.Dcp.VBuckets.TopologyWatchInterval = 10 * time.Second
+	}
+
+	c.applyDefaultMode()
+}
+
+func (c *Dcp) applyDefaultMode() {
+	if c.Dcp.Mode == "" {
+		c.Dcp.Mode = DcpModeStream
+	}
+}
+
+// IsSnapshotMode reports whether the streams end at the seqNos recorded at startup instead of following the tail.
+func (c *Dcp) IsSnapshotMode() bool {
+	return c.Dcp.Mode == DcpModeSnapshot
+}
+
+func (c *Dcp) applyDefaultListenerRetry() {
+	if c.Dcp.Listener.OnError == "" {
+		c.Dcp.Listener.OnError = ListenerOnErrorBlock
+	}
+
+	if c.Dcp.Listener.Retry.Attempts == 0 {
+		c.Dcp.Listener.Retry.Attempts = 3
+	}
+
+	if c.Dcp.Listener.Retry.Backoff == 0 {
+		c.Dcp.Listener.Retry.Backoff = 100 * time.Millisecond
+	}
+
+	if c.Dcp.Listener.Retry.MaxBackoff == 0 {
+		c.Dcp.Listener.Retry.MaxBackoff = 5 * time.Second
+	}
 }
 
 func (c *Dcp) applyDefaultMetadata() {
 	if c.Metadata.Type == "" {
 		c.Metadata.Type = MetadataTypeCouchbase
 	}
+
+	if c.Metadata.Prefix == "" {
+		c.Metadata.Prefix = helpers.Prefix
+	}
+}
+
+// GetMetadataOwner identifies the pipeline writing the checkpoints, checkpoints of another owner under
+// the same keys mean two pipelines share the metadata prefix and group name.
+func (c *Dcp) GetMetadataOwner() string {
+	collectionNames := slices.Clone(c.CollectionNames)
+	slices.Sort(collectionNames)
+
+	return c.BucketName + "." + c.ScopeName + "." + strings.Join(collectionNames, ",")
 }
 
 func (c *Dcp) applyLogging() {
-	if logger.Log != nil {
-		return
+	if c.Logging.Level == "" {
+		c.Logging.Level = logger.INFO
 	}
 
-	loggingLevel := c.Logging.Level
-	if loggingLevel == "" {
-		c.Logging.Level = logger.INFO
+	if logger.Log != nil {
+		return
 	}
 
 	logger.InitDefaultLogger(c.Logging.Level)
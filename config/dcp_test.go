@@ -1,10 +1,12 @@
 package config
 
 import (
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/Trendyol/go-dcp/helpers"
+	"github.com/Trendyol/go-dcp/logger"
 )
 
 func TestDefaultConfig(t *testing.T) {
@@ -74,6 +76,96 @@ func TestGetCouchbaseMetadata(t *testing.T) {
 	if couchbaseMetadata.ConnectionTimeout != expectedConnectionTimeout {
 		t.Errorf("ConnectionTimeout is not set to expected value")
 	}
+
+	if couchbaseMetadata.SaveConcurrency != 64 {
+		t.Errorf("SaveConcurrency is not set to expected value")
+	}
+}
+
+func TestGetCouchbaseMetadataSaveConcurrency(t *testing.T) {
+	dcp := &Dcp{
+		Metadata: Metadata{
+			Config: map[string]string{
+				CouchbaseMetadataSaveConcurrencyConfig: "8",
+			},
+		},
+	}
+
+	if dcp.GetCouchbaseMetadata().SaveConcurrency != 8 {
+		t.Errorf("SaveConcurrency is not set to expected value")
+	}
+}
+
+func TestGetCouchbaseMetadataDurability(t *testing.T) {
+	dcp := &Dcp{
+		Metadata: Metadata{
+			Config: map[string]string{
+				CouchbaseMetadataDurabilityLevelConfig:   DurabilityLevelMajority,
+				CouchbaseMetadataDurabilityTimeoutConfig: "3s",
+			},
+		},
+	}
+
+	couchbaseMetadata := dcp.GetCouchbaseMetadata()
+
+	if couchbaseMetadata.DurabilityLevel != DurabilityLevelMajority {
+		t.Errorf("DurabilityLevel is not set to expected value")
+	}
+
+	if couchbaseMetadata.DurabilityTimeout != 3*time.Second {
+		t.Errorf("DurabilityTimeout is not set to expected value")
+	}
+
+	if (&Dcp{}).GetCouchbaseMetadata().DurabilityLevel != DurabilityLevelNone {
+		t.Errorf("DurabilityLevel default is not set to expected value")
+	}
+}
+
+func TestGetRedisMetadataTLS(t *testing.T) {
+	dcp := &Dcp{
+		Metadata: Metadata{
+			Config: map[string]string{
+				RedisMetadataAddressConfig:            "redis-1:6379,redis-2:6379",
+				RedisMetadataTLSConfig:                "true",
+				RedisMetadataRootCAPathConfig:         "/certs/ca.pem",
+				RedisMetadataClientCertPathConfig:     "/certs/client.pem",
+				RedisMetadataClientKeyPathConfig:      "/certs/client.key",
+				RedisMetadataServerNameConfig:         "redis.internal",
+				RedisMetadataInsecureSkipVerifyConfig: "false",
+			},
+		},
+	}
+
+	expected := RedisMetadata{
+		Address:        "redis-1:6379,redis-2:6379",
+		RootCAPath:     "/certs/ca.pem",
+		ClientCertPath: "/certs/client.pem",
+		ClientKeyPath:  "/certs/client.key",
+		ServerName:     "redis.internal",
+		TLS:            true,
+	}
+
+	if actual := dcp.GetRedisMetadata(); *actual != expected {
+		t.Errorf("Unexpected result. got %+v want %+v", *actual, expected)
+	}
+
+	for name, redisConfig := range map[string]map[string]string{
+		"tls options without tls": {RedisMetadataAddressConfig: "redis:6379", RedisMetadataRootCAPathConfig: "/certs/ca.pem"},
+		"client cert without key": {
+			RedisMetadataAddressConfig: "redis:6379", RedisMetadataTLSConfig: "true", RedisMetadataClientCertPathConfig: "/c",
+		},
+		"invalid insecure skip": {RedisMetadataAddressConfig: "redis:6379", RedisMetadataInsecureSkipVerifyConfig: "maybe"},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected panic for %v", name)
+				}
+			}()
+
+			(&Dcp{Metadata: Metadata{Config: redisConfig}}).GetRedisMetadata()
+		}()
+	}
 }
 
 func TestGetCouchbaseMembership(t *testing.T) {
@@ -171,6 +263,38 @@ func TestDcpApplyDefaultCheckpoint(t *testing.T) {
 	if c.Checkpoint.AutoReset != "earliest" {
 		t.Errorf("Checkpoint.AutoReset is not set to expected value")
 	}
+
+	if c.Checkpoint.LoadRetry.Attempts != 3 || c.Checkpoint.LoadRetry.Backoff != time.Second {
+		t.Errorf("Checkpoint.LoadRetry is not set to expected value")
+	}
+
+	if c.Checkpoint.WriteBehind.Enabled {
+		t.Errorf("Checkpoint.WriteBehind.Enabled is not set to expected value")
+	}
+
+	if c.Checkpoint.WriteBehind.MaxPending != 10000 {
+		t.Errorf("Checkpoint.WriteBehind.MaxPending is not set to expected value")
+	}
+
+	if c.Checkpoint.WriteBehind.MaxLatency != 30*time.Second {
+		t.Errorf("Checkpoint.WriteBehind.MaxLatency is not set to expected value")
+	}
+
+	if c.Checkpoint.Adaptive.LatencyThreshold != time.Second {
+		t.Errorf("Checkpoint.Adaptive.LatencyThreshold is not set to expected value")
+	}
+
+	if c.Checkpoint.Adaptive.MaxInterval != 150*time.Second {
+		t.Errorf("Checkpoint.Adaptive.MaxInterval is not set to expected value")
+	}
+
+	if c.Checkpoint.SnapshotGap.Strategy != SnapshotGapStrategyProceed {
+		t.Errorf("Checkpoint.SnapshotGap.Strategy is not set to expected value")
+	}
+
+	if c.Checkpoint.SnapshotGap.Threshold != 100000 {
+		t.Errorf("Checkpoint.SnapshotGap.Threshold is not set to expected value")
+	}
 }
 
 func TestDcpApplyDefaultHealthCheck(t *testing.T) {
@@ -190,6 +314,19 @@ func TestDcpApplyDefaultHealthCheck(t *testing.T) {
 	}
 }
 
+func TestDcpApplyDefaultMemoryPressure(t *testing.T) {
+	c := &Dcp{}
+	c.applyDefaultMemoryPressure()
+
+	if c.MemoryPressure.CheckInterval != time.Second {
+		t.Errorf("MemoryPressure.CheckInterval is not set to expected value")
+	}
+
+	if c.MemoryPressure.Enabled {
+		t.Errorf("MemoryPressure.Enabled is not set to expected value")
+	}
+}
+
 func TestDcpApplyDefaultGroupMembership(t *testing.T) {
 	c := &Dcp{}
 	c.applyDefaultGroupMembership()
@@ -222,6 +359,54 @@ func TestDcpApplyDefaultConnectionTimeout(t *testing.T) {
 	if c.ConnectionTimeout != 5*time.Second {
 		t.Errorf("ConnectionTimeout is not set to expected value")
 	}
+
+	if c.DataConnectTimeout != 5*time.Second {
+		t.Errorf("DataConnectTimeout is not set to expected value")
+	}
+
+	if c.MetaConnectTimeout != 5*time.Second {
+		t.Errorf("MetaConnectTimeout is not set to expected value")
+	}
+
+	if c.DcpConnectTimeout != 5*time.Second {
+		t.Errorf("DcpConnectTimeout is not set to expected value")
+	}
+
+	if c.PendingOpsTimeout != 10*time.Second {
+		t.Errorf("PendingOpsTimeout is not set to expected value")
+	}
+}
+
+func TestDcpApplyDefaultConnectionTimeoutFromLegacy(t *testing.T) {
+	c := &Dcp{
+		ConnectionTimeout: 10 * time.Second,
+		Dcp:               ExternalDcp{ConnectionTimeout: 30 * time.Second},
+	}
+	c.applyDefaultConnectionTimeout()
+
+	if c.DataConnectTimeout != 10*time.Second {
+		t.Errorf("DataConnectTimeout is not set to expected value")
+	}
+
+	if c.DcpConnectTimeout != 30*time.Second {
+		t.Errorf("DcpConnectTimeout is not set to expected value")
+	}
+}
+
+func TestDcpApplyDefaultClientIdentifier(t *testing.T) {
+	c := &Dcp{}
+	c.applyDefaultClientIdentifier()
+
+	if !strings.HasPrefix(c.ClientIdentifier, "go-dcp/") {
+		t.Errorf("ClientIdentifier is not set to expected value")
+	}
+
+	c = &Dcp{ClientIdentifier: "my-app/1.0.0"}
+	c.applyDefaultClientIdentifier()
+
+	if c.ClientIdentifier != "my-app/1.0.0" {
+		t.Errorf("ClientIdentifier is overridden")
+	}
 }
 
 func TestDcpApplyDefaultCollections(t *testing.T) {
@@ -258,6 +443,23 @@ func TestDcpApplyDefaultMetrics(t *testing.T) {
 	if c.Metric.Path != "/metrics" {
 		t.Errorf("Metric.Path is not set to expected value")
 	}
+
+	if c.Metric.Statsd.Address != "" {
+		t.Errorf("Metric.Statsd.Address is not set to expected value")
+	}
+}
+
+func TestDcpApplyDefaultMetricsStatsd(t *testing.T) {
+	c := &Dcp{Metric: Metric{Statsd: MetricStatsd{Enabled: true}}}
+	c.applyDefaultMetrics()
+
+	if c.Metric.Statsd.Address != "127.0.0.1:8125" {
+		t.Errorf("Metric.Statsd.Address is not set to expected value")
+	}
+
+	if c.Metric.Statsd.Interval != 10*time.Second {
+		t.Errorf("Metric.Statsd.Interval is not set to expected value")
+	}
 }
 
 func TestDcpApplyDefaultAPI(t *testing.T) {
@@ -290,10 +492,205 @@ func TestDcpApplyDefaultLeaderElection(t *testing.T) {
 	}
 }
 
+func TestGetKubernetesLeaderElectorRejectsInvalidTimings(t *testing.T) {
+	logger.InitDefaultLogger("error")
+
+	for name, leaderElectionConfig := range map[string]map[string]string{
+		"lease duration": {"leaseDuration": "5s", "renewDeadline": "5s"},
+		"renew deadline": {"renewDeadline": "1s", "retryPeriod": "1s"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("GetKubernetesLeaderElector is expected to panic")
+				}
+			}()
+
+			leaderElectionConfig["leaseLockName"] = "lock"
+			leaderElectionConfig["leaseLockNamespace"] = "default"
+
+			c := &Dcp{LeaderElection: LeaderElection{Config: leaderElectionConfig}}
+			c.GetKubernetesLeaderElector()
+		})
+	}
+}
+
+func TestDcpValidate(t *testing.T) {
+	logger.InitDefaultLogger("error")
+
+	validConfig := func() *Dcp {
+		c := &Dcp{Hosts: []string{"localhost:8091"}, BucketName: "dcp-test"}
+		c.Dcp.Group.Name = "group"
+		return c
+	}
+
+	if err := validConfig().Validate(); err != nil {
+		t.Fatalf("valid config is expected to pass, err: %v", err)
+	}
+
+	defaulted := validConfig()
+	defaulted.ApplyDefaults()
+
+	if err := defaulted.Validate(); err != nil {
+		t.Fatalf("config with defaults is expected to pass, err: %v", err)
+	}
+
+	tests := []struct {
+		modify   func(c *Dcp)
+		name     string
+		expected []string
+	}{
+		{
+			name:     "missing hosts and bucket",
+			modify:   func(c *Dcp) { c.Hosts, c.BucketName = nil, "" },
+			expected: []string{"hosts or connectionString is required", "bucketName is required"},
+		},
+		{
+			name:     "connection string instead of hosts",
+			modify:   func(c *Dcp) { c.Hosts, c.ConnectionString = nil, "couchbase://localhost" },
+			expected: nil,
+		},
+		{
+			name:     "missing group name",
+			modify:   func(c *Dcp) { c.Dcp.Group.Name = "" },
+			expected: []string{"dcp.group.name is required"},
+		},
+		{
+			name: "invalid checkpoint",
+			modify: func(c *Dcp) {
+				c.Checkpoint.Type = "none"
+				c.Checkpoint.Interval = -time.Second
+			},
+			expected: []string{"checkpoint.type must be auto or manual, got: none", "checkpoint.interval can not be negative, got: -1s"},
+		},
+		{
+			name:     "unknown checkpoint auto reset",
+			modify:   func(c *Dcp) { c.Checkpoint.AutoReset = "oldest" },
+			expected: []string{"checkpoint.autoReset must be earliest or latest, got: oldest"},
+		},
+		{
+			name:     "blank metadata prefix",
+			modify:   func(c *Dcp) { c.Metadata.Prefix = "  " },
+			expected: []string{"metadata.prefix can not be blank"},
+		},
+		{
+			name:     "collection wildcard with other collections",
+			modify:   func(c *Dcp) { c.CollectionNames = []string{CollectionNameWildcard, "products"} },
+			expected: []string{"collection wildcard can not be combined with other collection names"},
+		},
+		{
+			name: "invalid listener",
+			modify: func(c *Dcp) {
+				c.Dcp.Listener.Parallelism, c.Dcp.Listener.Concurrency = 2, 2
+				c.Dcp.Listener.OnError = "retry"
+			},
+			expected: []string{
+				"dcp.listener.parallelism and dcp.listener.concurrency can not be used together",
+				"dcp.listener.onError must be skip, block or dlq, got: retry",
+			},
+		},
+		{
+			name: "invalid key regex and mode",
+			modify: func(c *Dcp) {
+				c.Dcp.Filter.KeyRegex = "user::("
+				c.Dcp.Mode = "backfill"
+			},
+			expected: []string{
+				"dcp.filter.keyRegex is invalid, err: error parsing regexp: missing closing ): `user::(`",
+				"dcp.mode must be stream or snapshot, got: backfill",
+			},
+		},
+		{
+			name: "invalid kubernetes leader election",
+			modify: func(c *Dcp) {
+				c.LeaderElection.Enabled = true
+				c.LeaderElection.Config = map[string]string{
+					"leaseLockName": "lock", "leaseLockNamespace": "default", "leaseDuration": "5s", "renewDeadline": "5s",
+				}
+			},
+			expected: []string{"leaderElection.config is invalid, err: leaseDuration must be greater than renewDeadline"},
+		},
+		{
+			name: "adaptive checkpoint with write-behind",
+			modify: func(c *Dcp) {
+				c.Checkpoint.Adaptive.Enabled = true
+				c.Checkpoint.WriteBehind.Enabled = true
+			},
+			expected: []string{"checkpoint.adaptive and checkpoint.writeBehind can not be enabled together"},
+		},
+		{
+			name: "unknown secondary metadata type",
+			modify: func(c *Dcp) {
+				c.Metadata.Secondaries = []SecondaryMetadata{{Type: MetadataTypeRedis}, {Type: "mongo"}}
+			},
+			expected: []string{"metadata.secondaries[1].type must be couchbase, file, redis or dynamodb, got: mongo"},
+		},
+		{
+			name:     "unsupported proxy scheme",
+			modify:   func(c *Dcp) { c.Proxy.URL = "ftp://localhost:21" },
+			expected: []string{"proxy.url is invalid, err: unsupported proxy scheme: ftp"},
+		},
+		{
+			name:     "invalid metadata type",
+			modify:   func(c *Dcp) { c.Metadata.Type = "memory" },
+			expected: []string{"metadata.type must be couchbase, file, redis or dynamodb, got: memory"},
+		},
+		{
+			name:     "member number out of range",
+			modify:   func(c *Dcp) { c.Dcp.Group.Membership.MemberNumber = 3 },
+			expected: []string{"dcp.group.membership.memberNumber must be between 1 and totalMembers, got: 3 of 1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validConfig()
+			tt.modify(c)
+
+			err := c.Validate()
+			if len(tt.expected) == 0 {
+				if err != nil {
+					t.Errorf("config is expected to pass, err: %v", err)
+				}
+				return
+			}
+
+			if err == nil || err.Error() != strings.Join(tt.expected, "\n") {
+				t.Errorf("expected: %q, got: %v", strings.Join(tt.expected, "\n"), err)
+			}
+		})
+	}
+}
+
+func TestDcpApplyDefaultCompression(t *testing.T) {
+	c := &Dcp{}
+	c.applyDefaultCompression()
+
+	if c.Compression.Enabled == nil || !*c.Compression.Enabled {
+		t.Errorf("Compression.Enabled is not set to expected value")
+	}
+
+	if c.Compression.MinSize != 32 || c.Compression.MinRatio != 0.83 {
+		t.Errorf("Compression thresholds are not set to expected value")
+	}
+
+	disabled := false
+	c = &Dcp{Compression: Compression{Enabled: &disabled}}
+	c.applyDefaultCompression()
+
+	if *c.Compression.Enabled {
+		t.Errorf("Compression.Enabled is overridden")
+	}
+}
+
 func TestDcpApplyDefaultDcp(t *testing.T) {
 	c := &Dcp{}
 	c.applyDefaultDcp()
 
+	if c.Dcp.UseExpiryOpcode == nil || !*c.Dcp.UseExpiryOpcode {
+		t.Errorf("Dcp.UseExpiryOpcode is not set to expected value")
+	}
+
 	if c.Dcp.BufferSize.(int) != 16777216 {
 		t.Errorf("Dcp.BufferSize is not set to expected value")
 	}
@@ -305,6 +702,82 @@ func TestDcpApplyDefaultDcp(t *testing.T) {
 	if c.Dcp.Listener.BufferSize != 1000 {
 		t.Errorf("Dcp.Listener.BufferSize is not set to expected value")
 	}
+
+	if c.Dcp.Listener.Parallelism != 1 {
+		t.Errorf("Dcp.Listener.Parallelism is not set to expected value")
+	}
+
+	if c.Dcp.Listener.MaxInFlight != 1000 {
+		t.Errorf("Dcp.Listener.MaxInFlight is not set to expected value")
+	}
+
+	if c.Dcp.Listener.Concurrency != 1 {
+		t.Errorf("Dcp.Listener.Concurrency is not set to expected value")
+	}
+
+	if c.Dcp.Listener.QueueSize != 1000 {
+		t.Errorf("Dcp.Listener.QueueSize is not set to expected value")
+	}
+
+	if c.Dcp.Listener.Batch.Size != 1000 {
+		t.Errorf("Dcp.Listener.Batch.Size is not set to expected value")
+	}
+
+	if c.Dcp.Listener.Batch.FlushInterval != time.Second {
+		t.Errorf("Dcp.Listener.Batch.FlushInterval is not set to expected value")
+	}
+
+	if c.Dcp.Listener.PausedCollection.Strategy != PausedCollectionStrategyBuffer {
+		t.Errorf("Dcp.Listener.PausedCollection.Strategy is not set to expected value")
+	}
+
+	if c.Dcp.Listener.PausedCollection.BufferSize != 10000 {
+		t.Errorf("Dcp.Listener.PausedCollection.BufferSize is not set to expected value")
+	}
+
+	if c.Dcp.Listener.OnError != ListenerOnErrorBlock {
+		t.Errorf("Dcp.Listener.OnError is not set to expected value")
+	}
+
+	if c.Dcp.Listener.Retry.Attempts != 3 {
+		t.Errorf("Dcp.Listener.Retry.Attempts is not set to expected value")
+	}
+
+	if c.Dcp.Listener.Retry.MaxBackoff != 5*time.Second {
+		t.Errorf("Dcp.Listener.Retry.MaxBackoff is not set to expected value")
+	}
+
+	if len(c.Dcp.VBuckets.ValidCounts) != 3 {
+		t.Errorf("Dcp.VBuckets.ValidCounts is not set to expected value")
+	}
+
+	if c.Dcp.VBuckets.RetryAttempts != 5 {
+		t.Errorf("Dcp.VBuckets.RetryAttempts is not set to expected value")
+	}
+
+	if c.Dcp.Config.FilterEmptyStrategy != FilterEmptyStrategyClose {
+		t.Errorf("Dcp.Config.FilterEmptyStrategy is not set to expected value")
+	}
+
+	if c.Dcp.OpenStream.VbUUIDStrategy != VbUUIDStrategyStored {
+		t.Errorf("Dcp.OpenStream.VbUUIDStrategy is not set to expected value")
+	}
+
+	if c.Dcp.OpenStream.RetryAttempts != 3 {
+		t.Errorf("Dcp.OpenStream.RetryAttempts is not set to expected value")
+	}
+
+	if c.Dcp.OpenStream.RetryBackoff != time.Second {
+		t.Errorf("Dcp.OpenStream.RetryBackoff is not set to expected value")
+	}
+
+	if c.Dcp.CloseStream.RetryAttempts != 3 {
+		t.Errorf("Dcp.CloseStream.RetryAttempts is not set to expected value")
+	}
+
+	if c.Dcp.CloseStream.RetryInterval != time.Second {
+		t.Errorf("Dcp.CloseStream.RetryInterval is not set to expected value")
+	}
 }
 
 func TestApplyDefaultMetadata(t *testing.T) {
@@ -322,3 +795,48 @@ func TestApplyDefaultMetadata(t *testing.T) {
 		t.Errorf("Metadata.Type is not set to expected value")
 	}
 }
+
+func TestCheckpointShouldSaveOnClose(t *testing.T) {
+	if !(&Checkpoint{Type: CheckpointTypeAuto}).ShouldSaveOnClose() {
+		t.Errorf("auto checkpoint should save on close")
+	}
+
+	if (&Checkpoint{Type: CheckpointTypeManual}).ShouldSaveOnClose() {
+		t.Errorf("manual checkpoint should not save on close")
+	}
+
+	if !(&Checkpoint{Type: CheckpointTypeManual, SaveOnClose: true}).ShouldSaveOnClose() {
+		t.Errorf("manual checkpoint should save on close when opted in")
+	}
+}
+
+func TestDcpApplyDefaultMetadataPrefix(t *testing.T) {
+	c := &Dcp{}
+	c.applyDefaultMetadata()
+
+	if c.Metadata.Prefix != helpers.Prefix {
+		t.Errorf("Metadata.Prefix is not set to expected value")
+	}
+}
+
+func TestDcpGetMetadataOwner(t *testing.T) {
+	first := &Dcp{BucketName: "b", ScopeName: "s", CollectionNames: []string{"c2", "c1"}}
+	second := &Dcp{BucketName: "b", ScopeName: "s", CollectionNames: []string{"c1", "c2"}}
+
+	if first.GetMetadataOwner() != second.GetMetadataOwner() {
+		t.Errorf("GetMetadataOwner should not depend on collection order")
+	}
+
+	if first.GetMetadataOwner() != "b.s.c1,c2" {
+		t.Errorf("GetMetadataOwner is not set to expected value, got: %v", first.GetMetadataOwner())
+	}
+}
+
+func TestDcpApplyDefaultCollectionsWildcard(t *testing.T) {
+	c := &Dcp{CollectionNames: []string{CollectionNameWildcard}}
+	c.applyDefaultCollections()
+
+	if !c.IsCollectionWildcard() {
+		t.Errorf("IsCollectionWildcard is expected to be true")
+	}
+}
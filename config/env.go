@@ -0,0 +1,59 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"regexp"
+)
+
+var envPattern = regexp.MustCompile(`\${([^}]+)}`)
+
+// expandEnvString replaces the ${NAME} references of the set environment variables, unset ones are kept.
+func expandEnvString(value string) string {
+	return envPattern.ReplaceAllStringFunc(value, func(reference string) string {
+		if env, exists := os.LookupEnv(reference[2 : len(reference)-1]); exists {
+			return env
+		}
+		return reference
+	})
+}
+
+// ExpandEnv replaces the ${NAME} references in every string of the config, including the ones in
+// slices, maps and any fields.
+func (c *Dcp) ExpandEnv() {
+	expandEnvValue(reflect.ValueOf(c).Elem())
+}
+
+func expandEnvValue(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.String:
+		if v.CanSet() {
+			v.SetString(expandEnvString(v.String()))
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			expandEnvValue(v.Field(i))
+		}
+	case reflect.Pointer:
+		if !v.IsNil() {
+			expandEnvValue(v.Elem())
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			expandEnvValue(v.Index(i))
+		}
+	case reflect.Map:
+		if v.Type().Elem().Kind() != reflect.String {
+			return
+		}
+
+		for _, key := range v.MapKeys() {
+			v.SetMapIndex(key, reflect.ValueOf(expandEnvString(v.MapIndex(key).String())).Convert(v.Type().Elem()))
+		}
+	case reflect.Interface:
+		if s, ok := v.Interface().(string); ok && v.CanSet() {
+			v.Set(reflect.ValueOf(expandEnvString(s)))
+		}
+	default:
+	}
+}
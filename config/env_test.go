@@ -0,0 +1,36 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestDcpExpandEnv(t *testing.T) {
+	t.Setenv("CB_HOST", "couchbase:8091")
+	t.Setenv("CB_PASSWORD", "p#ss: word")
+	t.Setenv("REDIS_PASSWORD", "secret")
+
+	c := &Dcp{
+		Hosts:                []string{"${CB_HOST}", "localhost:8091"},
+		Password:             "${CB_PASSWORD}",
+		Username:             "${CB_UNSET_USERNAME}",
+		ConnectionBufferSize: "${CB_UNSET_BUFFER}",
+		Metadata:             Metadata{Config: map[string]string{"password": "${REDIS_PASSWORD}"}},
+	}
+	c.ExpandEnv()
+
+	if c.Hosts[0] != "couchbase:8091" || c.Hosts[1] != "localhost:8091" {
+		t.Errorf("hosts are not expanded, got: %v", c.Hosts)
+	}
+
+	if c.Password != "p#ss: word" {
+		t.Errorf("password is not expanded, got: %v", c.Password)
+	}
+
+	if c.Username != "${CB_UNSET_USERNAME}" || c.ConnectionBufferSize != "${CB_UNSET_BUFFER}" {
+		t.Errorf("unset variables are expected to be kept, got: %v, %v", c.Username, c.ConnectionBufferSize)
+	}
+
+	if c.Metadata.Config["password"] != "secret" {
+		t.Errorf("metadata config is not expanded, got: %v", c.Metadata.Config)
+	}
+}
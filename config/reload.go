@@ -0,0 +1,114 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrConfigNeedsRestart = errors.New("changed config fields need a restart")
+
+// reloadableFields are the fields that are read on use, the listener ones apply when the streams are reopened.
+var reloadableFields = map[string]func(c *Dcp, next *Dcp){
+	"logging.level":                 func(c *Dcp, next *Dcp) { c.Logging.Level = next.Logging.Level },
+	"checkpoint.interval":           func(c *Dcp, next *Dcp) { c.Checkpoint.Interval = next.Checkpoint.Interval },
+	"dcp.listener.concurrency":      func(c *Dcp, next *Dcp) { c.Dcp.Listener.Concurrency = next.Dcp.Listener.Concurrency },
+	"dcp.listener.queueSize":        func(c *Dcp, next *Dcp) { c.Dcp.Listener.QueueSize = next.Dcp.Listener.QueueSize },
+	"dcp.listener.retry.attempts":   func(c *Dcp, next *Dcp) { c.Dcp.Listener.Retry.Attempts = next.Dcp.Listener.Retry.Attempts },
+	"dcp.listener.retry.backoff":    func(c *Dcp, next *Dcp) { c.Dcp.Listener.Retry.Backoff = next.Dcp.Listener.Retry.Backoff },
+	"dcp.listener.retry.maxBackoff": func(c *Dcp, next *Dcp) { c.Dcp.Listener.Retry.MaxBackoff = next.Dcp.Listener.Retry.MaxBackoff },
+}
+
+// derivedFields are defaulted from checkpoint.interval, they keep their value while they still follow it so a
+// reloaded interval does not need a restart.
+var derivedFields = map[string]func(c *Dcp) bool{
+	"checkpoint.adaptive.maxInterval":   func(c *Dcp) bool { return c.Checkpoint.Adaptive.MaxInterval == 5*c.Checkpoint.Interval },
+	"checkpoint.writeBehind.maxLatency": func(c *Dcp) bool { return c.Checkpoint.WriteBehind.MaxLatency == c.Checkpoint.Interval },
+}
+
+// reloadLock guards the reloadable fields that are read while the stream runs, they are read through the
+// accessors below.
+var reloadLock sync.RWMutex
+
+// CheckpointInterval returns checkpoint.interval, a config reload can change it.
+func (c *Dcp) CheckpointInterval() time.Duration {
+	reloadLock.RLock()
+	defer reloadLock.RUnlock()
+
+	return c.Checkpoint.Interval
+}
+
+// ListenerRetry returns dcp.listener.retry, a config reload can change it.
+func (c *Dcp) ListenerRetry() DCPListenerRetry {
+	reloadLock.RLock()
+	defer reloadLock.RUnlock()
+
+	return c.Dcp.Listener.Retry
+}
+
+// ListenerWorkers returns dcp.listener.concurrency and dcp.listener.queueSize, a config reload can change them.
+func (c *Dcp) ListenerWorkers() (int, int) {
+	reloadLock.RLock()
+	defer reloadLock.RUnlock()
+
+	return c.Dcp.Listener.Concurrency, c.Dcp.Listener.QueueSize
+}
+
+// Reload copies the reloadable fields of next and returns the changed ones. Nothing is copied when a field
+// that needs a restart changed, the error lists those fields.
+func (c *Dcp) Reload(next *Dcp) ([]string, error) {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+
+	changed := slices.DeleteFunc(changedFields(reflect.ValueOf(c).Elem(), reflect.ValueOf(next).Elem(), ""), func(field string) bool {
+		derived, ok := derivedFields[field]
+		return ok && derived(c) && derived(next)
+	})
+
+	var restart []string
+	for _, field := range changed {
+		if _, ok := reloadableFields[field]; !ok {
+			restart = append(restart, field)
+		}
+	}
+
+	if len(restart) > 0 {
+		return nil, fmt.Errorf("%w: %v", ErrConfigNeedsRestart, strings.Join(restart, ", "))
+	}
+
+	for _, field := range changed {
+		reloadableFields[field](c, next)
+	}
+
+	return changed, nil
+}
+
+// changedFields returns the yaml paths of the differing fields, structs are compared field by field.
+func changedFields(current reflect.Value, next reflect.Value, prefix string) []string {
+	var changed []string
+
+	for i := 0; i < current.NumField(); i++ {
+		field := current.Type().Field(i)
+
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+
+		path := prefix + name
+
+		if field.Type.Kind() == reflect.Struct {
+			changed = append(changed, changedFields(current.Field(i), next.Field(i), path+".")...)
+		} else if !reflect.DeepEqual(current.Field(i).Interface(), next.Field(i).Interface()) {
+			changed = append(changed, path)
+		}
+	}
+
+	slices.Sort(changed)
+
+	return changed
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Trendyol/go-dcp/logger"
+)
+
+func TestDcpReload(t *testing.T) {
+	logger.InitDefaultLogger("error")
+
+	newConfig := func() *Dcp {
+		c := &Dcp{Hosts: []string{"localhost:8091"}, BucketName: "dcp-test"}
+		c.ApplyDefaults()
+		return c
+	}
+
+	c, next := newConfig(), newConfig()
+	next.Logging.Level = logger.DEBUG
+	next.Checkpoint.Interval = time.Minute
+
+	changed, err := c.Reload(next)
+	if err != nil {
+		t.Fatalf("reloadable fields are expected to be applied, err: %v", err)
+	}
+
+	if !reflect.DeepEqual(changed, []string{"checkpoint.interval", "logging.level"}) {
+		t.Errorf("unexpected changed fields: %v", changed)
+	}
+
+	if c.Logging.Level != logger.DEBUG || c.Checkpoint.Interval != time.Minute {
+		t.Errorf("reloadable fields are not applied, level: %v, interval: %v", c.Logging.Level, c.Checkpoint.Interval)
+	}
+
+	next = newConfig()
+	next.Checkpoint.Interval = 2 * time.Minute
+	next.BucketName = "other"
+	next.Dcp.Group.Membership.TotalMembers = 2
+
+	_, err = c.Reload(next)
+	if !errors.Is(err, ErrConfigNeedsRestart) {
+		t.Fatalf("ErrConfigNeedsRestart is expected, got: %v", err)
+	}
+
+	if err.Error() != "changed config fields need a restart: bucketName, dcp.group.membership.totalMembers" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if c.Checkpoint.Interval != time.Minute {
+		t.Errorf("nothing is expected to be applied when a field needs a restart, interval: %v", c.Checkpoint.Interval)
+	}
+}
+
+func TestDcpReloadWhileReading(t *testing.T) {
+	logger.InitDefaultLogger("error")
+
+	c := &Dcp{Hosts: []string{"localhost:8091"}, BucketName: "dcp-test"}
+	c.ApplyDefaults()
+
+	stopCh := make(chan struct{})
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for {
+			select {
+			case <-stopCh:
+				return
+			default:
+				_ = c.CheckpointInterval()
+				_ = c.ListenerRetry()
+				_, _ = c.ListenerWorkers()
+			}
+		}
+	}()
+
+	for i := 1; i <= 100; i++ {
+		next := &Dcp{Hosts: []string{"localhost:8091"}, BucketName: "dcp-test"}
+		next.ApplyDefaults()
+		next.Checkpoint.Interval = time.Duration(i) * time.Second
+		next.Dcp.Listener.Retry.Attempts = i
+
+		if _, err := c.Reload(next); err != nil {
+			t.Fatalf("reloadable fields are expected to be applied, err: %v", err)
+		}
+	}
+
+	close(stopCh)
+	wg.Wait()
+
+	if c.CheckpointInterval() != 100*time.Second || c.ListenerRetry().Attempts != 100 {
+		t.Errorf("unexpected reloaded fields, interval: %v, retry: %v", c.CheckpointInterval(), c.ListenerRetry())
+	}
+}
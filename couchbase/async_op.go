@@ -2,18 +2,89 @@ package couchbase
 
 import (
 	"context"
+	"sync"
 
 	"github.com/couchbase/gocbcore/v10"
 )
 
+// pendingOpTracker counts the operations that are waited on, so shutdown can drain them before
+// the agents are closed.
+type pendingOpTracker struct {
+	idleCh chan struct{}
+	lock   sync.Mutex
+	count  int
+}
+
+func (t *pendingOpTracker) add() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.count == 0 {
+		t.idleCh = make(chan struct{})
+	}
+
+	t.count++
+}
+
+func (t *pendingOpTracker) done() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.count--
+	if t.count == 0 {
+		close(t.idleCh)
+	}
+}
+
+func (t *pendingOpTracker) wait(ctx context.Context) error {
+	t.lock.Lock()
+	if t.count == 0 {
+		t.lock.Unlock()
+		return nil
+	}
+	idleCh := t.idleCh
+	t.lock.Unlock()
+
+	select {
+	case <-idleCh:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *pendingOpTracker) pending() int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.count
+}
+
+// agentTrackers maps the agents of a client to its pending operation tracker, so the document operations
+// that only get an agent are counted for the client that owns it.
+var agentTrackers sync.Map
+
+func trackAgent(agent *gocbcore.Agent, tracker *pendingOpTracker) {
+	if agent != nil {
+		agentTrackers.Store(agent, tracker)
+	}
+}
+
+func untrackAgent(agent *gocbcore.Agent) {
+	if agent != nil {
+		agentTrackers.Delete(agent)
+	}
+}
+
 type AsyncOp interface {
 	Resolve()
 	Wait(op gocbcore.PendingOp, err error) error
 }
 
 type asyncOp struct {
-	ctx    context.Context
-	signal chan struct{}
+	ctx     context.Context
+	signal  chan struct{}
+	tracker *pendingOpTracker
 }
 
 func (m *asyncOp) Resolve() {
@@ -25,6 +96,11 @@ func (m *asyncOp) Wait(op gocbcore.PendingOp, err error) error {
 		return err
 	}
 
+	if m.tracker != nil {
+		m.tracker.add()
+		defer m.tracker.done()
+	}
+
 	select {
 	case <-m.ctx.Done():
 		op.Cancel()
@@ -35,8 +111,35 @@ func (m *asyncOp) Wait(op gocbcore.PendingOp, err error) error {
 }
 
 func NewAsyncOp(ctx context.Context) AsyncOp {
+	return newTrackedAsyncOp(ctx, nil)
+}
+
+func newTrackedAsyncOp(ctx context.Context, tracker *pendingOpTracker) AsyncOp {
 	return &asyncOp{
-		signal: make(chan struct{}, 1),
-		ctx:    ctx,
+		signal:  make(chan struct{}, 1),
+		ctx:     ctx,
+		tracker: tracker,
+	}
+}
+
+// newAgentAsyncOp counts the operation for the client of the agent until it resolves.
+func newAgentAsyncOp(ctx context.Context, agent *gocbcore.Agent) AsyncOp {
+	var tracker *pendingOpTracker
+	if value, ok := agentTrackers.Load(agent); ok {
+		tracker = value.(*pendingOpTracker)
+	}
+
+	return newTrackedAsyncOp(ctx, tracker)
+}
+
+// receive reads the result of a resolved operation, it returns ctx.Err() instead of blocking once
+// the context is done.
+func receive[T any](ctx context.Context, ch <-chan T) (T, error) {
+	select {
+	case value := <-ch:
+		return value, nil
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
 	}
 }
@@ -0,0 +1,85 @@
+package couchbase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/couchbase/gocbcore/v10"
+)
+
+func TestPendingOpTracker_Wait(t *testing.T) {
+	t.Run("returns when operations resolve", func(t *testing.T) {
+		// Arrange
+		tracker := &pendingOpTracker{}
+		tracker.add()
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			tracker.done()
+		}()
+
+		// Act
+		err := tracker.wait(context.Background())
+
+		// Assert
+		if err != nil || tracker.pending() != 0 {
+			t.Errorf("Unexpected result. got %v pending, err %v", tracker.pending(), err)
+		}
+	})
+
+	t.Run("returns context error while operations are pending", func(t *testing.T) {
+		// Arrange
+		tracker := &pendingOpTracker{}
+		tracker.add()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		// Act
+		err := tracker.wait(ctx)
+
+		// Assert
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Unexpected result. got %v want %v", err, context.DeadlineExceeded)
+		}
+	})
+}
+
+func TestAsyncOp_AgentTracker(t *testing.T) {
+	// Arrange
+	first, second := &pendingOpTracker{}, &pendingOpTracker{}
+	firstAgent, secondAgent := &gocbcore.Agent{}, &gocbcore.Agent{}
+
+	trackAgent(firstAgent, first)
+	trackAgent(secondAgent, second)
+	defer untrackAgent(firstAgent)
+	defer untrackAgent(secondAgent)
+
+	op := newAgentAsyncOp(context.Background(), firstAgent)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- op.Wait(nil, nil)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for first.pending() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Act
+	firstPending, secondPending := first.pending(), second.pending()
+	op.Resolve()
+	err := <-done
+
+	// Assert
+	if firstPending != 1 || secondPending != 0 || err != nil {
+		t.Errorf("Unexpected result. got %v and %v pending, err %v want 1 and 0 pending", firstPending, secondPending, err)
+	}
+
+	if first.pending() != 0 {
+		t.Errorf("Unexpected result. got %v pending want 0", first.pending())
+	}
+}
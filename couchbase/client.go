@@ -2,11 +2,16 @@ package couchbase
 
 import (
 	"context"
+	"crypto/tls"
 	"crypto/x509"
 	"errors"
 	"fmt"
+	"math/rand"
 	"os"
 	"reflect"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Trendyol/go-dcp/wrapper"
@@ -28,29 +33,59 @@ import (
 )
 
 type Client interface {
+	SetEventHandler(handler models.EventHandler)
 	Ping() (*models.PingResult, error)
+	CheckHealth() *models.HealthCheckResult
 	GetAgent() *gocbcore.Agent
 	GetMetaAgent() *gocbcore.Agent
-	Connect() error
+	Connect(ctx context.Context) error
 	Close()
-	DcpConnect(useExpiryOpcode bool, useChangeStreams bool) error
+	DcpConnect(ctx context.Context, useExpiryOpcode bool, useChangeStreams bool) error
 	DcpClose()
+	DcpReconnect() error
+	PingDcp(ctx context.Context) error
 	GetVBucketSeqNos(awareCollection bool) (*wrapper.ConcurrentSwissMap[uint16, uint64], error)
-	GetNumVBuckets() int
+	GetVBucketSeqNosForState(state memd.VbucketState, vbIDs []uint16, awareCollection bool) (*wrapper.ConcurrentSwissMap[uint16, uint64], error) //nolint:lll
+	GetAllVBucketSeqNos() (*wrapper.ConcurrentSwissMap[uint16, *models.VBucketSeqNo], error)
+	GetNumVBuckets() (int, error)
+	GetBucketUUID() (string, error)
 	GetFailoverLogs(vbID uint16) ([]gocbcore.FailoverEntry, error)
 	OpenStream(vbID uint16, collectionIDs map[uint32]string, offset *models.Offset, observer Observer) error
+	OpenStreamRange(vbID uint16, collectionIDs map[uint32]string, offset *models.Offset, endSeqNo uint64, observer Observer) error
 	CloseStream(vbID uint16) error
 	GetCollectionIDs(scopeName string, collectionNames []string) map[uint32]string
+	ResolveCollectionIDs(scopeName string, collectionNames []string) (map[uint32]string, error)
 	GetAgentConfigSnapshot() (*gocbcore.ConfigSnapshot, error)
 	GetDcpAgentConfigSnapshot() (*gocbcore.ConfigSnapshot, error)
 	GetAgentQueues() []*models.AgentQueue
+	GetRollbackMetric() *RollbackMetric
+	GetVBucketNodeMap() (map[uint16]string, error)
+	GetMulti(ctx context.Context, scopeName string, collectionName string, ids [][]byte) (map[string][]byte, map[string]error, error)
+	GetReplica(ctx context.Context, scopeName string, collectionName string, id []byte, replicaIndex int) (*gocbcore.GetReplicaResult, error)
+	GetAnyReplica(ctx context.Context, scopeName string, collectionName string, id []byte) (*gocbcore.GetReplicaResult, error)
+	WaitForPendingOps(ctx context.Context) error
 }
 
+var (
+	ErrUnexpectedVBucketCount = errors.New("config snapshot reports unexpected vBucket count")
+	ErrNotConnected           = errors.New("client is not connected")
+	ErrNoReplicasConfigured   = errors.New("bucket has no replicas configured")
+	ErrInvalidReplicaIndex    = errors.New("replica index is out of range")
+	ErrNoServers              = errors.New("config snapshot has no servers")
+	ErrInvalidSeqNoRange      = errors.New("end seqNo must not be lower than the start seqNo")
+)
+
 type client struct {
-	agent     *gocbcore.Agent
-	metaAgent *gocbcore.Agent
-	dcpAgent  *gocbcore.DCPAgent
-	config    *config.Dcp
+	agent            *gocbcore.Agent
+	metaAgent        *gocbcore.Agent
+	dcpAgent         atomic.Pointer[gocbcore.DCPAgent]
+	config           *config.Dcp
+	useExpiryOpcode  bool
+	useChangeStreams bool
+	wildcardScopeID  atomic.Uint32
+	rollbackMetric   *RollbackMetric
+	pendingOps       *pendingOpTracker
+	eventHandler     models.EventHandler
 }
 
 func getServiceEndpoint(result *gocbcore.PingResult, serviceType gocbcore.ServiceType) string {
@@ -88,7 +123,7 @@ func (s *client) Ping() (*models.PingResult, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), s.config.HealthCheck.Timeout)
 	defer cancel()
 
-	opm := NewAsyncOp(ctx)
+	opm := newTrackedAsyncOp(ctx, s.pendingOps)
 	errorCh := make(chan error, 1)
 
 	var pingResult models.PingResult
@@ -123,6 +158,155 @@ func (s *client) Ping() (*models.PingResult, error) {
 	return &pingResult, <-errorCh
 }
 
+func pingStateName(state gocbcore.PingState) string {
+	switch state {
+	case gocbcore.PingStateOK:
+		return "ok"
+	case gocbcore.PingStateTimeout:
+		return "timeout"
+	default:
+		return "error"
+	}
+}
+
+func (s *client) pingServices(ctx context.Context, result *models.HealthCheckResult) {
+	opm := newTrackedAsyncOp(ctx, s.pendingOps)
+	resultCh := make(chan *gocbcore.PingResult, 1)
+	errorCh := make(chan error, 1)
+
+	op, err := s.agent.Ping(gocbcore.PingOptions{
+		ServiceTypes: []gocbcore.ServiceType{gocbcore.MemdService, gocbcore.MgmtService},
+	}, func(pingResult *gocbcore.PingResult, err error) {
+		resultCh <- pingResult
+		errorCh <- err
+		opm.Resolve()
+	})
+
+	err = opm.Wait(op, err)
+	if err == nil {
+		err = <-errorCh
+	}
+
+	if err != nil {
+		for _, name := range []string{"memd", "mgmt"} {
+			result.Services[name] = []models.ServiceHealth{{State: "error", Error: err.Error()}}
+		}
+		return
+	}
+
+	pingResult := <-resultCh
+
+	for serviceType, name := range map[gocbcore.ServiceType]string{gocbcore.MemdService: "memd", gocbcore.MgmtService: "mgmt"} {
+		for _, serviceResult := range pingResult.Services[serviceType] {
+			health := models.ServiceHealth{
+				Endpoint: serviceResult.Endpoint,
+				State:    pingStateName(serviceResult.State),
+				Latency:  serviceResult.Latency.Milliseconds(),
+			}
+			if serviceResult.Error != nil {
+				health.Error = serviceResult.Error.Error()
+			}
+			result.Services[name] = append(result.Services[name], health)
+		}
+	}
+}
+
+// pingDcp probes every node over the dcp connection, the dcp agent has no ping so an active vbucket seqNo request is used.
+func (s *client) pingDcp(ctx context.Context, result *models.HealthCheckResult) {
+	snapshot, err := s.GetDcpAgentConfigSnapshot()
+	if err != nil {
+		result.Services["dcp"] = []models.ServiceHealth{{State: "error", Error: err.Error()}}
+		return
+	}
+
+	numNodes, err := snapshot.NumServers()
+	if err != nil {
+		result.Services["dcp"] = []models.ServiceHealth{{State: "error", Error: err.Error()}}
+		return
+	}
+
+	for i := 1; i <= numNodes; i++ {
+		health := models.ServiceHealth{Endpoint: fmt.Sprintf("server-%d", i), State: "ok"}
+
+		start := time.Now()
+		opm := newTrackedAsyncOp(ctx, s.pendingOps)
+		errorCh := make(chan error, 1)
+
+		op, err := s.getDcpAgent().GetVbucketSeqnos(
+			i, memd.VbucketStateActive, gocbcore.GetVbucketSeqnoOptions{},
+			func(_ []gocbcore.VbSeqNoEntry, err error) {
+				errorCh <- err
+				opm.Resolve()
+			},
+		)
+
+		err = opm.Wait(op, err)
+		if err == nil {
+			err = <-errorCh
+		}
+
+		health.Latency = time.Since(start).Milliseconds()
+
+		if errors.Is(err, gocbcore.ErrTimeout) || errors.Is(err, context.DeadlineExceeded) {
+			health.State, health.Error = "timeout", err.Error()
+		} else if err != nil {
+			health.State, health.Error = "error", err.Error()
+		}
+
+		result.Services["dcp"] = append(result.Services["dcp"], health)
+	}
+}
+
+// PingDcp returns an error when any node does not answer over its dcp connection.
+func (s *client) PingDcp(ctx context.Context) error {
+	result := models.NewHealthCheckResult()
+
+	s.pingDcp(ctx, result)
+
+	for _, service := range result.Services["dcp"] {
+		if service.State != "ok" {
+			return fmt.Errorf("dcp endpoint %v is %v: %v", service.Endpoint, service.State, service.Error)
+		}
+	}
+
+	return nil
+}
+
+// CheckHealth runs an immediate ping against memd, mgmt and dcp services and reports every endpoint.
+func (s *client) CheckHealth() *models.HealthCheckResult {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.HealthCheck.Timeout)
+	defer cancel()
+
+	result := models.NewHealthCheckResult()
+
+	s.pingServices(ctx, result)
+	s.pingDcp(ctx, result)
+
+	evaluateServiceHealth(result)
+
+	return result
+}
+
+// evaluateServiceHealth degrades the result for every endpoint that is not ok and fails it for a service without
+// a healthy endpoint.
+func evaluateServiceHealth(result *models.HealthCheckResult) {
+	for _, name := range []string{"memd", "mgmt", "dcp"} {
+		healthy := 0
+
+		for _, service := range result.Services[name] {
+			if service.State == "ok" {
+				healthy++
+			} else {
+				result.Degrade(fmt.Sprintf("%v endpoint %v is %v", name, service.Endpoint, service.State))
+			}
+		}
+
+		if healthy == 0 {
+			result.Fail(fmt.Sprintf("%v has no healthy endpoint", name))
+		}
+	}
+}
+
 func (s *client) GetAgent() *gocbcore.Agent {
 	return s.agent
 }
@@ -131,22 +315,41 @@ func (s *client) GetMetaAgent() *gocbcore.Agent {
 	return s.metaAgent
 }
 
-func CreateTLSRootCaProvider(rootCAPath string) func() *x509.CertPool {
+var ErrNoCertificateInRootCA = errors.New("no certificate found in root ca file")
+
+// newTLSRootCaProvider returns a nil provider when rootCAPath is empty, gocbcore then verifies
+// against the system cert pool.
+func newTLSRootCaProvider(rootCAPath string) (func() *x509.CertPool, error) {
+	if rootCAPath == "" {
+		return nil, nil
+	}
+
 	cert, err := os.ReadFile(os.ExpandEnv(rootCAPath))
 	if err != nil {
-		logger.Log.Error("error while reading cert file, err: %v", err)
-		panic(err)
+		return nil, err
 	}
 
 	certPool := x509.NewCertPool()
-	certPool.AppendCertsFromPEM(cert)
+	if !certPool.AppendCertsFromPEM(cert) {
+		return nil, fmt.Errorf("%w: %v", ErrNoCertificateInRootCA, rootCAPath)
+	}
 
 	return func() *x509.CertPool {
 		return certPool
+	}, nil
+}
+
+func CreateTLSRootCaProvider(rootCAPath string) func() *x509.CertPool {
+	provider, err := newTLSRootCaProvider(rootCAPath)
+	if err != nil {
+		logger.Log.Error("error while reading cert file, err: %v", err)
+		panic(err)
 	}
+
+	return provider
 }
 
-func CreateSecurityConfig(username string, password string, secureConnection bool, rootCAPath string) gocbcore.SecurityConfig {
+func newSecurityConfig(username string, password string, secureConnection bool, rootCAPath string) (gocbcore.SecurityConfig, error) {
 	securityConfig := gocbcore.SecurityConfig{
 		Auth: gocbcore.PasswordAuthProvider{
 			Username: username,
@@ -155,63 +358,346 @@ func CreateSecurityConfig(username string, password string, secureConnection boo
 	}
 
 	if secureConnection {
+		provider, err := newTLSRootCaProvider(rootCAPath)
+		if err != nil {
+			return securityConfig, err
+		}
+
 		securityConfig.UseTLS = true
-		securityConfig.TLSRootCAProvider = CreateTLSRootCaProvider(rootCAPath)
+		securityConfig.TLSRootCAProvider = provider
+	}
+
+	return securityConfig, nil
+}
+
+func CreateSecurityConfig(username string, password string, secureConnection bool, rootCAPath string) gocbcore.SecurityConfig {
+	securityConfig, err := newSecurityConfig(username, password, secureConnection, rootCAPath)
+	if err != nil {
+		logger.Log.Error("error while reading cert file, err: %v", err)
+		panic(err)
 	}
 
 	return securityConfig
 }
 
+var (
+	ErrClientCertRequiresSecureConnection = errors.New("client certificate authentication requires secure connection")
+	ErrIncompleteClientCert               = errors.New("clientCertPath and clientKeyPath must be set together")
+	ErrConflictingAuth                    = errors.New("client certificate and password authentication can not be used together")
+	ErrMissingAuth                        = errors.New("either client certificate or password authentication must be configured")
+)
+
+// certificateAuthProvider authenticates with the client certificate presented on the tls handshake.
+type certificateAuthProvider struct {
+	certificate *tls.Certificate
+}
+
+func (auth certificateAuthProvider) SupportsNonTLS() bool {
+	return false
+}
+
+func (auth certificateAuthProvider) SupportsTLS() bool {
+	return true
+}
+
+func (auth certificateAuthProvider) Certificate(_ gocbcore.AuthCertRequest) (*tls.Certificate, error) {
+	return auth.certificate, nil
+}
+
+// Credentials returns a single empty pair since gocbcore expects one, the server takes the identity from the certificate.
+func (auth certificateAuthProvider) Credentials(_ gocbcore.AuthCredsRequest) ([]gocbcore.UserPassPair, error) {
+	return []gocbcore.UserPassPair{{}}, nil
+}
+
+func newCertificateAuthProvider(clientCertPath string, clientKeyPath string) (gocbcore.AuthProvider, error) {
+	certificate, err := tls.LoadX509KeyPair(os.ExpandEnv(clientCertPath), os.ExpandEnv(clientKeyPath))
+	if err != nil {
+		return nil, err
+	}
+
+	return certificateAuthProvider{certificate: &certificate}, nil
+}
+
+// newConfigSecurityConfig picks the client certificate or the password authentication of the config,
+// they are mutually exclusive.
+func newConfigSecurityConfig(config *config.Dcp) (gocbcore.SecurityConfig, error) {
+	certAuth := config.ClientCertPath != "" || config.ClientKeyPath != ""
+	passwordAuth := config.Username != "" || config.Password != ""
+
+	if !certAuth {
+		if config.SecureConnection && !passwordAuth {
+			return gocbcore.SecurityConfig{}, ErrMissingAuth
+		}
+
+		return newSecurityConfig(config.Username, config.Password, config.SecureConnection, config.RootCAPath)
+	}
+
+	switch {
+	case !config.SecureConnection:
+		return gocbcore.SecurityConfig{}, ErrClientCertRequiresSecureConnection
+	case passwordAuth:
+		return gocbcore.SecurityConfig{}, ErrConflictingAuth
+	case config.ClientCertPath == "" || config.ClientKeyPath == "":
+		return gocbcore.SecurityConfig{}, ErrIncompleteClientCert
+	}
+
+	securityConfig, err := newSecurityConfig("", "", true, config.RootCAPath)
+	if err != nil {
+		return securityConfig, err
+	}
+
+	provider, err := newCertificateAuthProvider(config.ClientCertPath, config.ClientKeyPath)
+	if err != nil {
+		return securityConfig, err
+	}
+
+	securityConfig.Auth = provider
+
+	return securityConfig, nil
+}
+
 func CreateAgent(httpAddresses []string, bucketName string,
 	username string, password string, secureConnection bool, rootCAPath string,
 	connectionBufferSize uint, connectionTimeout time.Duration,
 ) (*gocbcore.Agent, error) {
-	agent, err := gocbcore.CreateAgent(
-		&gocbcore.AgentConfig{
-			BucketName: bucketName,
-			SeedConfig: gocbcore.SeedConfig{
-				HTTPAddrs: resolveHostsAsHTTP(httpAddresses),
-			},
-			SecurityConfig: CreateSecurityConfig(username, password, secureConnection, rootCAPath),
-			CompressionConfig: gocbcore.CompressionConfig{
-				Enabled: true,
-			},
-			IoConfig: gocbcore.IoConfig{
-				UseCollections: true,
-			},
-			KVConfig: gocbcore.KVConfig{
-				ConnectionBufferSize: connectionBufferSize,
-			},
-		},
-	)
+	securityConfig, err := newSecurityConfig(username, password, secureConnection, rootCAPath)
 	if err != nil {
 		return nil, err
 	}
 
-	ch := make(chan error, 1)
-
-	_, err = agent.WaitUntilReady(
-		time.Now().Add(connectionTimeout),
-		gocbcore.WaitUntilReadyOptions{
-			RetryStrategy: gocbcore.NewBestEffortRetryStrategy(nil),
+	agentConfig := &gocbcore.AgentConfig{
+		UserAgent:  helpers.DefaultClientIdentifier(),
+		BucketName: bucketName,
+		SeedConfig: gocbcore.SeedConfig{
+			HTTPAddrs: resolveHostsAsHTTP(httpAddresses),
 		},
-		func(result *gocbcore.WaitUntilReadyResult, err error) {
-			ch <- err
+		SecurityConfig: securityConfig,
+		CompressionConfig: gocbcore.CompressionConfig{
+			Enabled: true,
 		},
-	)
+		IoConfig: gocbcore.IoConfig{
+			UseCollections: true,
+		},
+		KVConfig: gocbcore.KVConfig{
+			ConnectionBufferSize: connectionBufferSize,
+		},
+	}
+
+	return createAgent(context.Background(), agentConfig, connectionTimeout)
+}
+
+// waitUntilReady waits for the callback of the wait, the wait is cancelled when ctx is done first.
+func waitUntilReady(ctx context.Context, wait func(cb gocbcore.WaitUntilReadyCallback) (gocbcore.PendingOp, error)) error {
+	ch := make(chan error, 1)
+
+	op, err := wait(func(result *gocbcore.WaitUntilReadyResult, err error) {
+		ch <- err
+	})
+	if err != nil {
+		return err
+	}
+
+	select {
+	case err = <-ch:
+		return err
+	case <-ctx.Done():
+		op.Cancel()
+		return ctx.Err()
+	}
+}
+
+func createAgent(ctx context.Context, agentConfig *gocbcore.AgentConfig, connectionTimeout time.Duration) (*gocbcore.Agent, error) {
+	agent, err := gocbcore.CreateAgent(agentConfig)
 	if err != nil {
 		return nil, err
 	}
 
-	if err = <-ch; err != nil {
+	err = waitUntilReady(ctx, func(cb gocbcore.WaitUntilReadyCallback) (gocbcore.PendingOp, error) {
+		return agent.WaitUntilReady(
+			time.Now().Add(connectionTimeout),
+			gocbcore.WaitUntilReadyOptions{
+				RetryStrategy: gocbcore.NewBestEffortRetryStrategy(nil),
+			},
+			cb,
+		)
+	})
+	if err != nil {
+		_ = agent.Close()
 		return nil, err
 	}
 
 	return agent, nil
 }
 
-func (s *client) connect(bucketName string, connectionBufferSize uint, connectionTimeout time.Duration) (*gocbcore.Agent, error) {
-	return CreateAgent(s.config.Hosts, bucketName, s.config.Username, s.config.Password, s.config.SecureConnection, s.config.RootCAPath, connectionBufferSize, connectionTimeout) //nolint:lll
+func (s *client) connect(
+	ctx context.Context, bucketName string, connectionBufferSize uint, connectionTimeout time.Duration,
+) (*gocbcore.Agent, error) {
+	securityConfig, err := newConfigSecurityConfig(s.config)
+	if err != nil {
+		return nil, err
+	}
+
+	agentConfig := s.agentConfig(bucketName, securityConfig, connectionBufferSize)
+
+	var agent *gocbcore.Agent
+
+	err = retryConnect(ctx, s.config.ConnectionRetry, "bucket "+bucketName, func() error {
+		agentConfig.SeedConfig, err = s.seedConfig()
+		if err != nil {
+			return err
+		}
+
+		agent, err = createAgent(ctx, agentConfig, connectionTimeout)
+		return err
+	})
+
+	return agent, err
+}
+
+func (s *client) agentConfig(
+	bucketName string, securityConfig gocbcore.SecurityConfig, connectionBufferSize uint,
+) *gocbcore.AgentConfig {
+	return &gocbcore.AgentConfig{
+		UserAgent:         s.config.ClientIdentifier,
+		BucketName:        bucketName,
+		SecurityConfig:    securityConfig,
+		CompressionConfig: s.compressionConfig(),
+		IoConfig:          s.ioConfig(),
+		KVConfig: gocbcore.KVConfig{
+			ConnectionBufferSize: connectionBufferSize,
+		},
+	}
+}
+
+func (s *client) dcpAgentConfig(
+	securityConfig gocbcore.SecurityConfig, useExpiryOpcode bool, useChangeStreams bool,
+) *gocbcore.DCPAgentConfig {
+	compressionConfig := s.compressionConfig()
+	compressionConfig.DisableDecompression = s.config.Compression.DisableDecompression
+
+	return &gocbcore.DCPAgentConfig{
+		UserAgent:         s.config.ClientIdentifier,
+		BucketName:        s.config.BucketName,
+		SecurityConfig:    securityConfig,
+		CompressionConfig: compressionConfig,
+		DCPConfig: gocbcore.DCPConfig{
+			BufferSize:       helpers.ResolveUnionIntOrStringValue(s.config.Dcp.BufferSize),
+			UseExpiryOpcode:  useExpiryOpcode,
+			UseChangeStreams: useChangeStreams,
+		},
+		IoConfig: s.ioConfig(),
+		KVConfig: gocbcore.KVConfig{
+			ConnectionBufferSize: uint(helpers.ResolveUnionIntOrStringValue(s.config.Dcp.ConnectionBufferSize)),
+		},
+	}
+}
+
+// ioConfig sets the network of the cluster config to use, external picks the alternate addresses
+// for clients outside the network of the cluster.
+func (s *client) ioConfig() gocbcore.IoConfig {
+	return gocbcore.IoConfig{
+		UseCollections: true,
+		NetworkType:    s.config.NetworkType,
+	}
+}
+
+// connectionRetryDelay returns the delay with equal jitter, so restarted pods do not reconnect in lockstep.
+func connectionRetryDelay(delay time.Duration) time.Duration {
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1)) //nolint:gosec
+}
+
+// retryConnect retries connect with exponential backoff and returns the last error once the attempts are exhausted,
+// it stops waiting for the next attempt once ctx is done.
+func retryConnect(ctx context.Context, retry config.ConnectionRetry, target string, connect func() error) error {
+	delay := retry.InitialDelay
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = connect(); err == nil {
+			return nil
+		}
+
+		if attempt >= retry.Attempts {
+			return err
+		}
+
+		wait := connectionRetryDelay(delay)
+
+		logger.Log.Warn("error while connect to %v, attempt: %v/%v, retry in: %v, err: %v", target, attempt, retry.Attempts, wait, err)
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		delay *= 2
+		if delay > retry.MaxDelay {
+			delay = retry.MaxDelay
+		}
+	}
+}
+
+func (s *client) compressionConfig() gocbcore.CompressionConfig {
+	return gocbcore.CompressionConfig{
+		Enabled:  s.config.Compression.Enabled == nil || *s.config.Compression.Enabled,
+		MinSize:  s.config.Compression.MinSize,
+		MinRatio: s.config.Compression.MinRatio,
+	}
+}
+
+// seedConfig takes the seed nodes from connectionString when it is set, hosts are ignored then.
+// It runs on every connection attempt, so a failing srv lookup is retried.
+func (s *client) seedConfig() (gocbcore.SeedConfig, error) {
+	if s.config.ConnectionString == "" {
+		return gocbcore.SeedConfig{HTTPAddrs: resolveHostsAsHTTP(s.config.Hosts)}, nil
+	}
+
+	return resolveConnectionString(s.config.ConnectionString)
+}
+
+// seeds is the seed of the connections for the logs.
+func (s *client) seeds() any {
+	if s.config.ConnectionString != "" {
+		return s.config.ConnectionString
+	}
+
+	return s.config.Hosts
+}
+
+// resolveConnectionString resolves a couchbase:// or couchbases:// connection string, a single host without
+// a port is looked up as a dns srv record first and gocbcore keeps polling the record for node changes.
+func resolveConnectionString(connectionString string) (gocbcore.SeedConfig, error) {
+	spec, err := connstr.Parse(connectionString)
+	if err != nil {
+		return gocbcore.SeedConfig{}, fmt.Errorf("error while parsing connection string %v: %w", connectionString, err)
+	}
+
+	out, err := connstr.Resolve(spec)
+	if err != nil {
+		return gocbcore.SeedConfig{}, fmt.Errorf("error while resolving connection string %v: %w", connectionString, err)
+	}
+
+	var seedConfig gocbcore.SeedConfig
+
+	for _, host := range out.HttpHosts {
+		seedConfig.HTTPAddrs = append(seedConfig.HTTPAddrs, fmt.Sprintf("%s:%d", host.Host, host.Port))
+	}
+
+	for _, host := range out.MemdHosts {
+		seedConfig.MemdAddrs = append(seedConfig.MemdAddrs, fmt.Sprintf("%s:%d", host.Host, host.Port))
+	}
+
+	if out.SrvRecord != nil {
+		seedConfig.SRVRecord = &gocbcore.SRVRecord{
+			Proto:  out.SrvRecord.Proto,
+			Scheme: out.SrvRecord.Scheme,
+			Host:   out.SrvRecord.Host,
+		}
+	}
+
+	return seedConfig, nil
 }
 
 func resolveHostsAsHTTP(hosts []string) []string {
@@ -239,9 +725,28 @@ func resolveHostsAsHTTP(hosts []string) []string {
 	return httpHosts
 }
 
-func (s *client) Connect() error {
+// SetEventHandler receives the Connecting and Connected events of the agents.
+func (s *client) SetEventHandler(handler models.EventHandler) {
+	s.eventHandler = handler
+}
+
+func (s *client) notifyConnect(agent string, connect func() error) error {
+	handler, ok := s.eventHandler.(models.ConnectionEventHandler)
+	if !ok {
+		return connect()
+	}
+
+	handler.Connecting(models.ConnectionEvent{Agent: agent})
+	err := connect()
+	handler.Connected(models.ConnectionEvent{Agent: agent, Err: err})
+
+	return err
+}
+
+// Connect opens the agents of the bucket and the metadata bucket, the connection attempts stop once ctx is done.
+func (s *client) Connect(ctx context.Context) error {
 	connectionBufferSize := uint(helpers.ResolveUnionIntOrStringValue(s.config.ConnectionBufferSize))
-	connectionTimeout := s.config.ConnectionTimeout
+	connectionTimeout := s.config.DataConnectTimeout
 
 	if s.config.IsCouchbaseMetadata() {
 		couchbaseMetadataConfig := s.config.GetCouchbaseMetadata()
@@ -256,168 +761,396 @@ func (s *client) Connect() error {
 		}
 	}
 
-	agent, err := s.connect(s.config.BucketName, connectionBufferSize, connectionTimeout)
+	var agent *gocbcore.Agent
+	err := s.notifyConnect(models.ConnectionAgentData, func() (err error) {
+		agent, err = s.connect(ctx, s.config.BucketName, connectionBufferSize, connectionTimeout)
+		return err
+	})
 	if err != nil {
 		logger.Log.Error("error while connect to source bucket, err: %v", err)
 		return err
 	}
 
 	s.agent = agent
+	trackAgent(agent, s.pendingOps)
 
 	if s.config.IsCouchbaseMetadata() {
 		couchbaseMetadataConfig := s.config.GetCouchbaseMetadata()
 		if couchbaseMetadataConfig.Bucket == s.config.BucketName {
 			s.metaAgent = agent
 		} else {
-			metaAgent, err := s.connect(
-				couchbaseMetadataConfig.Bucket,
-				couchbaseMetadataConfig.ConnectionBufferSize,
-				couchbaseMetadataConfig.ConnectionTimeout,
-			)
+			var metaAgent *gocbcore.Agent
+			err := s.notifyConnect(models.ConnectionAgentMetadata, func() (err error) {
+				metaAgent, err = s.connect(
+					ctx,
+					couchbaseMetadataConfig.Bucket,
+					couchbaseMetadataConfig.ConnectionBufferSize,
+					couchbaseMetadataConfig.ConnectionTimeout,
+				)
+				return err
+			})
 			if err != nil {
 				logger.Log.Error("error while connect to metadata bucket, err: %v", err)
 				return err
 			}
 
 			s.metaAgent = metaAgent
+			trackAgent(metaAgent, s.pendingOps)
 		}
 
-		logger.Log.Info("connected to %s, bucket: %s, meta bucket: %s", s.config.Hosts, s.config.BucketName, couchbaseMetadataConfig.Bucket)
+		logger.Log.Info("connected to %s, bucket: %s, meta bucket: %s", s.seeds(), s.config.BucketName, couchbaseMetadataConfig.Bucket)
 		return nil
 	}
 
-	logger.Log.Info("connected to %s, bucket: %s", s.config.Hosts, s.config.BucketName)
+	logger.Log.Info("connected to %s, bucket: %s", s.seeds(), s.config.BucketName)
 
 	return nil
 }
 
+// WaitForPendingOps blocks until the document operations in flight resolve or ctx is done,
+// it is called before the agents are closed so metadata writes are not lost on shutdown.
+func (s *client) WaitForPendingOps(ctx context.Context) error {
+	if pending := s.pendingOps.pending(); pending > 0 {
+		logger.Log.Info("waiting for %v pending operations", pending)
+	}
+
+	return s.pendingOps.wait(ctx)
+}
+
 func (s *client) Close() {
 	if s.metaAgent != nil {
+		untrackAgent(s.metaAgent)
 		_ = s.metaAgent.Close()
 	}
 
 	if s.metaAgent != s.agent {
+		untrackAgent(s.agent)
 		_ = s.agent.Close()
 	}
 
-	logger.Log.Info("connections closed %s", s.config.Hosts)
+	logger.Log.Info("connections closed %s", s.seeds())
 }
 
-func (s *client) DcpConnect(useExpiryOpcode bool, useChangeStreams bool) error {
-	agentConfig := &gocbcore.DCPAgentConfig{
-		BucketName: s.config.BucketName,
-		SeedConfig: gocbcore.SeedConfig{
-			HTTPAddrs: resolveHostsAsHTTP(s.config.Hosts),
-		},
-		SecurityConfig: CreateSecurityConfig(s.config.Username, s.config.Password, s.config.SecureConnection, s.config.RootCAPath),
-		CompressionConfig: gocbcore.CompressionConfig{
-			Enabled: true,
-		},
-		DCPConfig: gocbcore.DCPConfig{
-			BufferSize:       helpers.ResolveUnionIntOrStringValue(s.config.Dcp.BufferSize),
-			UseExpiryOpcode:  useExpiryOpcode,
-			UseChangeStreams: useChangeStreams,
-		},
-		IoConfig: gocbcore.IoConfig{
-			UseCollections: true,
-		},
-		KVConfig: gocbcore.KVConfig{
-			ConnectionBufferSize: uint(helpers.ResolveUnionIntOrStringValue(s.config.Dcp.ConnectionBufferSize)),
-		},
+// DcpConnect opens the dcp agent, the connection attempts stop once ctx is done.
+func (s *client) DcpConnect(ctx context.Context, useExpiryOpcode bool, useChangeStreams bool) error {
+	return s.notifyConnect(models.ConnectionAgentDcp, func() error {
+		return s.dcpConnectAgent(ctx, useExpiryOpcode, useChangeStreams)
+	})
+}
+
+func (s *client) dcpConnectAgent(ctx context.Context, useExpiryOpcode bool, useChangeStreams bool) error {
+	securityConfig, err := newConfigSecurityConfig(s.config)
+	if err != nil {
+		logger.Log.Error("error while creating dcp security config, err: %v", err)
+		return err
+	}
+
+	agentConfig := s.dcpAgentConfig(securityConfig, useExpiryOpcode, useChangeStreams)
+
+	var client *gocbcore.DCPAgent
+
+	err = retryConnect(ctx, s.config.ConnectionRetry, "dcp", func() error {
+		agentConfig.SeedConfig, err = s.seedConfig()
+		if err != nil {
+			return err
+		}
+
+		client, err = s.dcpConnect(ctx, agentConfig)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	s.dcpAgent.Store(client)
+	s.useExpiryOpcode, s.useChangeStreams = useExpiryOpcode, useChangeStreams
+	logger.Log.Info("connected to %s as dcp, bucket: %s", s.seeds(), s.config.BucketName)
+
+	return nil
+}
+
+func (s *client) dcpConnect(ctx context.Context, agentConfig *gocbcore.DCPAgentConfig) (*gocbcore.DCPAgent, error) {
+	client, err := gocbcore.CreateDcpAgent(
+		agentConfig,
+		fmt.Sprintf("%s_%s", s.config.Dcp.Group.Name, uuid.New().String()),
+		memd.DcpOpenFlagProducer,
+	)
+	if err != nil {
+		logger.Log.Error("error while connect to dcp, err: %v", err)
+		return nil, err
+	}
+
+	err = waitUntilReady(ctx, func(cb gocbcore.WaitUntilReadyCallback) (gocbcore.PendingOp, error) {
+		return client.WaitUntilReady(
+			time.Now().Add(s.config.DcpConnectTimeout),
+			gocbcore.WaitUntilReadyOptions{
+				RetryStrategy: gocbcore.NewBestEffortRetryStrategy(nil),
+			},
+			cb,
+		)
+	})
+	if err != nil {
+		logger.Log.Error("error while wait until ready to dcp, err: %v", err)
+		_ = client.Close()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+func (s *client) GetRollbackMetric() *RollbackMetric {
+	return s.rollbackMetric
+}
+
+func (s *client) GetAgentQueues() []*models.AgentQueue {
+	var configSnapshots []*gocbcore.ConfigSnapshot
+	var dcp *gocbcore.ConfigSnapshot
+
+	agentConfigSnapshot, err := s.GetAgentConfigSnapshot()
+	if err == nil {
+		configSnapshots = append(configSnapshots, agentConfigSnapshot)
+	}
+	dcpAgentConfigSnapshot, err := s.GetDcpAgentConfigSnapshot()
+	if err == nil {
+		dcp = dcpAgentConfigSnapshot
+		configSnapshots = append(configSnapshots, dcp)
+	}
+
+	clientQueue := make([]*models.AgentQueue, 0)
+
+	for i := range configSnapshots {
+		configSnapshot := configSnapshots[i]
+		var isDcp bool
+		if configSnapshot == dcp {
+			isDcp = true
+		}
+
+		snapshot := reflect.ValueOf(configSnapshot).Elem()
+		state := snapshot.FieldByName("state").Elem()
+		pipelines := state.FieldByName("pipelines")
+		pipelineLen := pipelines.Len()
+
+		for i := 0; i < pipelineLen; i++ {
+			pipeline := pipelines.Index(i).Elem()
+
+			address := pipeline.FieldByName("address").String()
+			queue := pipeline.FieldByName("queue").Elem()
+			max := pipeline.FieldByName("maxItems").Int()
+			items := queue.FieldByName("items").Elem()
+			current := items.FieldByName("len").Int()
+
+			clientQueue = append(clientQueue, &models.AgentQueue{
+				Address: address,
+				IsDcp:   isDcp,
+				Current: int(current),
+				Max:     int(max),
+			})
+		}
+	}
+
+	return clientQueue
+}
+
+// getDcpAgent returns the current dcp agent, DcpReconnect replaces it while the other goroutines keep using the client.
+func (s *client) getDcpAgent() *gocbcore.DCPAgent {
+	return s.dcpAgent.Load()
+}
+
+func (s *client) DcpClose() {
+	_ = s.getDcpAgent().Close()
+	logger.Log.Info("dcp connection closed %s", s.seeds())
+}
+
+// DcpReconnect replaces the dcp connections with new ones using the options of the previous DcpConnect.
+func (s *client) DcpReconnect() error {
+	s.DcpClose()
+	return s.DcpConnect(context.Background(), s.useExpiryOpcode, s.useChangeStreams)
+}
+
+// GetVBucketNodeMap returns the address of the node owning the active copy of every vBucket,
+// the address is empty while a vBucket has no active node.
+func (s *client) GetVBucketNodeMap() (map[uint16]string, error) {
+	snapshot, err := s.GetDcpAgentConfigSnapshot()
+	if err != nil {
+		return nil, err
 	}
 
-	client, err := gocbcore.CreateDcpAgent(
-		agentConfig,
-		fmt.Sprintf("%s_%s", s.config.Dcp.Group.Name, uuid.New().String()),
-		memd.DcpOpenFlagProducer,
-	)
-	if err != nil {
-		logger.Log.Error("error while connect to dcp, err: %v", err)
-		return err
+	vBuckets, err := snapshot.NumVbuckets()
+	if err != nil {
+		return nil, err
+	}
+
+	pipelines := reflect.ValueOf(snapshot).Elem().FieldByName("state").Elem().FieldByName("pipelines")
+
+	nodeMap := make(map[uint16]string, vBuckets)
+
+	for i := 0; i < vBuckets; i++ {
+		vbID := uint16(i)
+
+		serverIdx, err := snapshot.VbucketToServer(vbID, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		if serverIdx < 0 || serverIdx >= pipelines.Len() {
+			nodeMap[vbID] = ""
+			continue
+		}
+
+		nodeMap[vbID] = pipelines.Index(serverIdx).Elem().FieldByName("address").String()
+	}
+
+	return nodeMap, nil
+}
+
+// GetMulti fetches the documents concurrently from the source bucket, bounded by bulkGet.parallelism.
+// Failures are reported per id, the returned error is only set when the batch can not be issued at all.
+func (s *client) GetMulti(
+	ctx context.Context, scopeName string, collectionName string, ids [][]byte,
+) (map[string][]byte, map[string]error, error) {
+	if s.agent == nil {
+		return nil, nil, ErrNotConnected
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	documents := make(map[string][]byte, len(ids))
+	errs := map[string]error{}
+	lock := sync.Mutex{}
+
+	eg := errgroup.Group{}
+	eg.SetLimit(s.config.BulkGet.Parallelism)
+
+	for _, id := range ids {
+		eg.Go(func(id []byte) func() error {
+			return func() error {
+				result, err := Get(ctx, s.agent, scopeName, collectionName, id)
+
+				lock.Lock()
+				defer lock.Unlock()
+
+				if err != nil {
+					errs[string(id)] = err
+				} else {
+					documents[string(id)] = result.Value
+				}
+
+				return nil
+			}
+		}(id))
 	}
 
-	ch := make(chan error, 1)
+	_ = eg.Wait()
 
-	_, err = client.WaitUntilReady(
-		time.Now().Add(s.config.Dcp.ConnectionTimeout),
-		gocbcore.WaitUntilReadyOptions{
-			RetryStrategy: gocbcore.NewBestEffortRetryStrategy(nil),
-		},
-		func(result *gocbcore.WaitUntilReadyResult, err error) {
-			ch <- err
-		},
-	)
+	return documents, errs, nil
+}
+
+func (s *client) numReplicas() (int, error) {
+	if s.agent == nil {
+		return 0, ErrNotConnected
+	}
+
+	snapshot, err := s.agent.ConfigSnapshot()
 	if err != nil {
-		logger.Log.Error("error while wait until ready to dcp, err: %v", err)
-		return err
+		return 0, err
 	}
 
-	if err = <-ch; err != nil {
-		logger.Log.Error("error while wait until ready to dcp on callback, err: %v", err)
-		return err
+	numReplicas, err := snapshot.NumReplicas()
+	if err != nil {
+		return 0, err
 	}
 
-	s.dcpAgent = client
-	logger.Log.Info("connected to %s as dcp, bucket: %s", s.config.Hosts, s.config.BucketName)
+	if numReplicas == 0 {
+		return 0, fmt.Errorf("%w: %v", ErrNoReplicasConfigured, s.config.BucketName)
+	}
 
-	return nil
+	return numReplicas, nil
 }
 
-func (s *client) GetAgentQueues() []*models.AgentQueue {
-	var configSnapshots []*gocbcore.ConfigSnapshot
-	var dcp *gocbcore.ConfigSnapshot
+// GetReplica reads the document from the replica at replicaIndex, starting from 1, the result may be stale.
+func (s *client) GetReplica(
+	ctx context.Context, scopeName string, collectionName string, id []byte, replicaIndex int,
+) (*gocbcore.GetReplicaResult, error) {
+	numReplicas, err := s.numReplicas()
+	if err != nil {
+		return nil, err
+	}
 
-	agentConfigSnapshot, err := s.GetAgentConfigSnapshot()
-	if err == nil {
-		configSnapshots = append(configSnapshots, agentConfigSnapshot)
+	if replicaIndex < 1 || replicaIndex > numReplicas {
+		return nil, fmt.Errorf("%w: %v, replicas: %v", ErrInvalidReplicaIndex, replicaIndex, numReplicas)
 	}
-	dcpAgentConfigSnapshot, err := s.GetDcpAgentConfigSnapshot()
-	if err == nil {
-		dcp = dcpAgentConfigSnapshot
-		configSnapshots = append(configSnapshots, dcp)
+
+	return GetReplica(ctx, s.agent, scopeName, collectionName, id, replicaIndex)
+}
+
+// GetAnyReplica races the active and every replica read and returns the first successful response,
+// the others are cancelled. The last error is returned when every read fails.
+func (s *client) GetAnyReplica(
+	ctx context.Context, scopeName string, collectionName string, id []byte,
+) (*gocbcore.GetReplicaResult, error) {
+	numReplicas, err := s.numReplicas()
+	if err != nil {
+		return nil, err
 	}
 
-	clientQueue := make([]*models.AgentQueue, 0)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	for i := range configSnapshots {
-		configSnapshot := configSnapshots[i]
-		var isDcp bool
-		if configSnapshot == dcp {
-			isDcp = true
-		}
+	type replicaRead struct {
+		result *gocbcore.GetReplicaResult
+		err    error
+	}
 
-		snapshot := reflect.ValueOf(configSnapshot).Elem()
-		state := snapshot.FieldByName("state").Elem()
-		pipelines := state.FieldByName("pipelines")
-		pipelineLen := pipelines.Len()
+	readCh := make(chan replicaRead, numReplicas+1)
 
-		for i := 0; i < pipelineLen; i++ {
-			pipeline := pipelines.Index(i).Elem()
+	go func() {
+		result, err := Get(ctx, s.agent, scopeName, collectionName, id)
+		if err != nil {
+			readCh <- replicaRead{err: err}
+			return
+		}
 
-			address := pipeline.FieldByName("address").String()
-			queue := pipeline.FieldByName("queue").Elem()
-			max := pipeline.FieldByName("maxItems").Int()
-			items := queue.FieldByName("items").Elem()
-			current := items.FieldByName("len").Int()
+		readCh <- replicaRead{result: &gocbcore.GetReplicaResult{
+			Value:    result.Value,
+			Flags:    result.Flags,
+			Datatype: result.Datatype,
+			Cas:      result.Cas,
+		}}
+	}()
+
+	for replicaIndex := 1; replicaIndex <= numReplicas; replicaIndex++ {
+		go func(replicaIndex int) {
+			result, err := GetReplica(ctx, s.agent, scopeName, collectionName, id, replicaIndex)
+			readCh <- replicaRead{result: result, err: err}
+		}(replicaIndex)
+	}
 
-			clientQueue = append(clientQueue, &models.AgentQueue{
-				Address: address,
-				IsDcp:   isDcp,
-				Current: int(current),
-				Max:     int(max),
-			})
+	for i := 0; i <= numReplicas; i++ {
+		read := <-readCh
+		if read.err == nil {
+			return read.result, nil
 		}
+
+		err = read.err
 	}
 
-	return clientQueue
+	return nil, err
 }
 
-func (s *client) DcpClose() {
-	_ = s.dcpAgent.Close()
-	logger.Log.Info("dcp connection closed %s", s.config.Hosts)
-}
+// vBucketSeqNosConcurrency bounds the GetVbucketSeqnos requests in flight, one is sent per node and collection.
+const vBucketSeqNosConcurrency = 8
 
 func (s *client) GetVBucketSeqNos(awareCollection bool) (*wrapper.ConcurrentSwissMap[uint16, uint64], error) {
+	return s.GetVBucketSeqNosForState(memd.VbucketStateActive, nil, awareCollection)
+}
+
+// GetVBucketSeqNosForState returns the high seqNo of the vBuckets in the given state, the highest one is kept
+// when several nodes report a vBucket, like replicas do. All vBuckets are returned when vbIDs is empty.
+func (s *client) GetVBucketSeqNosForState(
+	state memd.VbucketState, vbIDs []uint16, awareCollection bool,
+) (*wrapper.ConcurrentSwissMap[uint16, uint64], error) {
 	snapshot, err := s.GetDcpAgentConfigSnapshot()
 	if err != nil {
 		return nil, err
@@ -428,11 +1161,18 @@ func (s *client) GetVBucketSeqNos(awareCollection bool) (*wrapper.ConcurrentSwis
 		return nil, err
 	}
 
+	if numNodes == 0 {
+		return nil, ErrNoServers
+	}
+
 	eg := errgroup.Group{}
+	eg.SetLimit(vBucketSeqNosConcurrency)
 
 	seqNos := wrapper.CreateConcurrentSwissMap[uint16, uint64](1024)
+	var seqNosLock sync.Mutex
 
-	hasCollectionSupport := awareCollection && s.dcpAgent.HasCollectionsSupport()
+	dcpAgent := s.getDcpAgent()
+	hasCollectionSupport := awareCollection && dcpAgent.HasCollectionsSupport()
 
 	cIds := s.GetCollectionIDs(s.config.ScopeName, s.config.CollectionNames)
 	collectionIDs := make([]uint32, 0, len(cIds))
@@ -451,7 +1191,7 @@ func (s *client) GetVBucketSeqNos(awareCollection bool) (*wrapper.ConcurrentSwis
 					ctx, cancel := context.WithTimeout(context.Background(), time.Second*60)
 					defer cancel()
 
-					opm := NewAsyncOp(ctx)
+					opm := newTrackedAsyncOp(ctx, s.pendingOps)
 
 					opts := gocbcore.GetVbucketSeqnoOptions{}
 					if hasCollectionSupport {
@@ -460,14 +1200,20 @@ func (s *client) GetVBucketSeqNos(awareCollection bool) (*wrapper.ConcurrentSwis
 						}
 					}
 
-					op, err := s.dcpAgent.GetVbucketSeqnos(
-						i, memd.VbucketStateActive, opts,
+					op, err := dcpAgent.GetVbucketSeqnos(
+						i, state, opts,
 						func(entries []gocbcore.VbSeqNoEntry, err error) {
+							seqNosLock.Lock()
 							for _, entry := range entries {
+								if len(vbIDs) > 0 && !slices.Contains(vbIDs, entry.VbID) {
+									continue
+								}
+
 								if seqNo, exist := seqNos.Load(entry.VbID); !exist || (exist && uint64(entry.SeqNo) > seqNo) {
 									seqNos.Store(entry.VbID, uint64(entry.SeqNo))
 								}
 							}
+							seqNosLock.Unlock()
 
 							opm.Resolve()
 						},
@@ -489,20 +1235,140 @@ func (s *client) GetVBucketSeqNos(awareCollection bool) (*wrapper.ConcurrentSwis
 	return seqNos, nil
 }
 
-func (s *client) GetNumVBuckets() int {
+func (s *client) getPersistSeqNo(vbID uint16) (uint64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*60)
+	defer cancel()
+
+	opm := newTrackedAsyncOp(ctx, s.pendingOps)
+
+	ch := make(chan error, 1)
+	var persistSeqNo uint64
+
+	op, err := s.agent.ObserveVb(gocbcore.ObserveVbOptions{
+		VbID:       vbID,
+		ReplicaIdx: 0,
+	}, func(result *gocbcore.ObserveVbResult, err error) {
+		if err == nil {
+			persistSeqNo = uint64(result.PersistSeqNo)
+		}
+
+		opm.Resolve()
+
+		ch <- err
+	})
+
+	err = opm.Wait(op, err)
+	if err != nil {
+		return 0, err
+	}
+
+	return persistSeqNo, <-ch
+}
+
+// GetAllVBucketSeqNos returns the high seqNo with the last persisted seqNo of the active vBuckets,
+// the difference is the amount of data that is only in memory on the source.
+func (s *client) GetAllVBucketSeqNos() (*wrapper.ConcurrentSwissMap[uint16, *models.VBucketSeqNo], error) {
+	highSeqNos, err := s.GetVBucketSeqNos(false)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectPersistSeqNos(highSeqNos, persistSeqNosConcurrency, s.getPersistSeqNo)
+}
+
+// persistSeqNosConcurrency bounds the ObserveVb requests in flight, one is sent per vBucket.
+const persistSeqNosConcurrency = 16
+
+func collectPersistSeqNos(
+	highSeqNos *wrapper.ConcurrentSwissMap[uint16, uint64],
+	concurrency int,
+	getPersistSeqNo func(vbID uint16) (uint64, error),
+) (*wrapper.ConcurrentSwissMap[uint16, *models.VBucketSeqNo], error) {
+	eg := errgroup.Group{}
+	eg.SetLimit(concurrency)
+
+	seqNos := wrapper.CreateConcurrentSwissMap[uint16, *models.VBucketSeqNo](1024)
+
+	highSeqNos.Range(func(vbID uint16, highSeqNo uint64) bool {
+		eg.Go(func() error {
+			persistSeqNo, err := getPersistSeqNo(vbID)
+			if err != nil {
+				return err
+			}
+
+			seqNos.Store(vbID, &models.VBucketSeqNo{
+				HighSeqNo:    highSeqNo,
+				PersistSeqNo: persistSeqNo,
+			})
+
+			return nil
+		})
+
+		return true
+	})
+
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+
+	return seqNos, nil
+}
+
+func (s *client) getNumVBuckets() (int, error) {
+	if s.getDcpAgent() == nil {
+		return 0, ErrNotConnected
+	}
+
 	snapshot, err := s.GetDcpAgentConfigSnapshot()
 	if err != nil {
-		logger.Log.Error("error while get config snapshot, err: %v", err)
-		panic(err)
+		return 0, err
 	}
 
 	vBuckets, err := snapshot.NumVbuckets()
 	if err != nil {
-		logger.Log.Error("error while get number of vBucket, err: %v", err)
-		panic(err)
+		return 0, err
+	}
+
+	if !slices.Contains(s.config.Dcp.VBuckets.ValidCounts, vBuckets) {
+		return 0, fmt.Errorf("%w: %v, valid counts: %v", ErrUnexpectedVBucketCount, vBuckets, s.config.Dcp.VBuckets.ValidCounts)
+	}
+
+	return vBuckets, nil
+}
+
+// GetNumVBuckets retries the config snapshot while it reports a vBucket count that is not valid,
+// a transient partial snapshot would otherwise break the vBucket assignment.
+func (s *client) GetNumVBuckets() (int, error) {
+	var vBuckets int
+
+	err := helpers.Retry(func() error {
+		var err error
+
+		vBuckets, err = s.getNumVBuckets()
+		if err != nil {
+			logger.Log.Warn("cannot get number of vBucket, err: %v", err)
+		}
+
+		return err
+	}, s.config.Dcp.VBuckets.RetryAttempts, s.config.Dcp.VBuckets.RetryInterval)
+	if err != nil {
+		return 0, err
 	}
 
-	return vBuckets
+	return vBuckets, nil
+}
+
+func (s *client) GetBucketUUID() (string, error) {
+	if s.getDcpAgent() == nil {
+		return "", ErrNotConnected
+	}
+
+	snapshot, err := s.GetDcpAgentConfigSnapshot()
+	if err != nil {
+		return "", err
+	}
+
+	return snapshot.BucketUUID(), nil
 }
 
 func (s *client) GetAgentConfigSnapshot() (*gocbcore.ConfigSnapshot, error) { //nolint:unused
@@ -510,20 +1376,20 @@ func (s *client) GetAgentConfigSnapshot() (*gocbcore.ConfigSnapshot, error) { //
 }
 
 func (s *client) GetDcpAgentConfigSnapshot() (*gocbcore.ConfigSnapshot, error) { //nolint:unused
-	return s.dcpAgent.ConfigSnapshot()
+	return s.getDcpAgent().ConfigSnapshot()
 }
 
 func (s *client) GetFailoverLogs(vbID uint16) ([]gocbcore.FailoverEntry, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*60)
 	defer cancel()
 
-	opm := NewAsyncOp(ctx)
+	opm := newTrackedAsyncOp(ctx, s.pendingOps)
 
 	ch := make(chan error, 1)
 
 	var failoverLogs []gocbcore.FailoverEntry
 
-	op, err := s.dcpAgent.GetFailoverLog(
+	op, err := s.getDcpAgent().GetFailoverLog(
 		vbID,
 		func(entries []gocbcore.FailoverEntry, err error) {
 			failoverLogs = entries
@@ -541,17 +1407,40 @@ func (s *client) GetFailoverLogs(vbID uint16) ([]gocbcore.FailoverEntry, error)
 	return failoverLogs, <-ch
 }
 
+// snapshotRollbackPoint moves a rollback that lands inside the checkpointed snapshot to just before its
+// first item, so the whole snapshot is streamed again instead of its second half with a made up marker.
+func snapshotRollbackPoint(rollbackSeqNo gocbcore.SeqNo, snapshot *models.SnapshotMarker) gocbcore.SeqNo {
+	start, end := gocbcore.SeqNo(snapshot.StartSeqNo), gocbcore.SeqNo(snapshot.EndSeqNo)
+	if rollbackSeqNo < start || rollbackSeqNo >= end {
+		return rollbackSeqNo
+	}
+
+	if start == 0 {
+		return 0
+	}
+
+	return start - 1
+}
+
 func (s *client) openStreamWithRollback(vbID uint16,
-	failedSeqNo gocbcore.SeqNo,
-	rollbackSeqNo gocbcore.SeqNo,
+	offset *models.Offset,
+	serverRollbackSeqNo gocbcore.SeqNo,
+	endSeqNo gocbcore.SeqNo,
 	observer Observer,
 	openStreamOptions gocbcore.OpenStreamOptions,
 ) error {
+	observer.SetStreamState(vbID, StreamStateRollingBack)
+
+	failedSeqNo := gocbcore.SeqNo(offset.SeqNo)
+	rollbackSeqNo := snapshotRollbackPoint(serverRollbackSeqNo, offset.SnapshotMarker)
+
 	logger.Log.Info(
-		"open stream with rollback, vbID: %d, failedSeqNo: %d, rollbackSeqNo: %d",
-		vbID, failedSeqNo, rollbackSeqNo,
+		"open stream with rollback, vbID: %d, failedSeqNo: %d, serverRollbackSeqNo: %d, rollbackSeqNo: %d",
+		vbID, failedSeqNo, serverRollbackSeqNo, rollbackSeqNo,
 	)
 
+	s.rollbackMetric.observe(vbID, failedSeqNo, rollbackSeqNo)
+
 	failoverLogs, err := s.GetFailoverLogs(vbID)
 	if err != nil {
 		logger.Log.Error("error while get failover logs when rollback, err: %v", err)
@@ -570,16 +1459,16 @@ func (s *client) openStreamWithRollback(vbID uint16,
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*60)
 	defer cancel()
 
-	opm := NewAsyncOp(ctx)
+	opm := newTrackedAsyncOp(ctx, s.pendingOps)
 
 	ch := make(chan error, 1)
 
-	op, err := s.dcpAgent.OpenStream(
+	op, err := s.getDcpAgent().OpenStream(
 		vbID,
 		0,
 		targetUUID,
 		rollbackSeqNo,
-		0xffffffffffffffff,
+		endSeqNo,
 		rollbackSeqNo,
 		rollbackSeqNo,
 		observer,
@@ -604,20 +1493,91 @@ func (s *client) openStreamWithRollback(vbID uint16,
 	return <-ch
 }
 
+// selectVbUUID keeps the stored VbUUID whenever it is set, the server rolls the stream back when the failover log
+// does not contain it any more. Only an offset without a VbUUID, e.g. a start offset given by seqNo, takes the
+// newest entry that started at or before its seqNo.
+func selectVbUUID(failoverLogs []gocbcore.FailoverEntry, offset *models.Offset) gocbcore.VbUUID {
+	if offset.VbUUID != 0 {
+		return offset.VbUUID
+	}
+
+	for _, entry := range failoverLogs {
+		if uint64(entry.SeqNo) <= offset.SeqNo {
+			return entry.VbUUID
+		}
+	}
+
+	return offset.VbUUID
+}
+
+func (s *client) resolveVbUUID(vbID uint16, offset *models.Offset) gocbcore.VbUUID {
+	if s.config.Dcp.OpenStream.VbUUIDStrategy != config.VbUUIDStrategyFailoverLog || offset.SeqNo == 0 || offset.VbUUID != 0 {
+		return offset.VbUUID
+	}
+
+	failoverLogs, err := s.GetFailoverLogs(vbID)
+	if err != nil {
+		logger.Warnw("cannot get failover logs to select vbUUID, using stored one", "vbID", vbID, "err", err)
+		return offset.VbUUID
+	}
+
+	vbUUID := selectVbUUID(failoverLogs, offset)
+	if vbUUID != offset.VbUUID {
+		logger.Infow("selected vbUUID from failover log", "vbID", vbID, "stored", offset.VbUUID, "selected", vbUUID)
+	}
+
+	return vbUUID
+}
+
 func (s *client) OpenStream(
 	vbID uint16,
 	collectionIDs map[uint32]string,
 	offset *models.Offset,
 	observer Observer,
 ) error {
+	return s.openStream(vbID, collectionIDs, offset, 0xffffffffffffffff, observer)
+}
+
+// OpenStreamRange opens a stream that ends at endSeqNo, the server closes it once the snapshot containing
+// endSeqNo is delivered and the observer gets an End event without error.
+func (s *client) OpenStreamRange(
+	vbID uint16,
+	collectionIDs map[uint32]string,
+	offset *models.Offset,
+	endSeqNo uint64,
+	observer Observer,
+) error {
+	if endSeqNo < offset.SeqNo {
+		return ErrInvalidSeqNoRange
+	}
+
+	return s.openStream(vbID, collectionIDs, offset, endSeqNo, observer)
+}
+
+func (s *client) openStream(
+	vbID uint16,
+	collectionIDs map[uint32]string,
+	offset *models.Offset,
+	endSeqNo uint64,
+	observer Observer,
+) (err error) {
+	observer.SetStreamState(vbID, StreamStateOpening)
+	defer func() {
+		if err != nil {
+			observer.SetStreamState(vbID, StreamStateClosed)
+		} else {
+			observer.SetStreamState(vbID, StreamStateOpen)
+		}
+	}()
+
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*60)
 	defer cancel()
 
-	opm := NewAsyncOp(ctx)
+	opm := newTrackedAsyncOp(ctx, s.pendingOps)
 
 	openStreamOptions := gocbcore.OpenStreamOptions{}
 
-	if s.dcpAgent.HasCollectionsSupport() {
+	if s.getDcpAgent().HasCollectionsSupport() {
 		openStreamOptions.ManifestOptions = &gocbcore.OpenStreamManifestOptions{ManifestUID: 0}
 
 		options := &gocbcore.OpenStreamFilterOptions{
@@ -628,19 +1588,24 @@ func (s *client) OpenStream(
 			options.CollectionIDs = append(options.CollectionIDs, id)
 		}
 
-		if len(options.CollectionIDs) > 0 {
+		if s.config.IsCollectionWildcard() {
+			// the scope filter also streams the collections created after the stream is opened
+			openStreamOptions.FilterOptions = &gocbcore.OpenStreamFilterOptions{ScopeID: s.wildcardScopeID.Load()}
+		} else if len(options.CollectionIDs) > 0 {
 			openStreamOptions.FilterOptions = options
 		}
 	}
 
 	ch := make(chan error, 1)
 
-	op, err := s.dcpAgent.OpenStream(
+	vbUUID := s.resolveVbUUID(vbID, offset)
+
+	op, err := s.getDcpAgent().OpenStream(
 		vbID,
 		0x80,
-		offset.VbUUID,
+		vbUUID,
 		gocbcore.SeqNo(offset.SeqNo),
-		0xffffffffffffffff,
+		gocbcore.SeqNo(endSeqNo),
 		gocbcore.SeqNo(offset.StartSeqNo),
 		gocbcore.SeqNo(offset.EndSeqNo),
 		observer,
@@ -664,8 +1629,10 @@ func (s *client) OpenStream(
 	err = <-ch
 	if err != nil {
 		if rollbackErr, ok := err.(gocbcore.DCPRollbackError); ok {
-			logger.Log.Info("need to rollback for vbID: %d, vbUUID: %d", vbID, offset.VbUUID)
-			return s.openStreamWithRollback(vbID, gocbcore.SeqNo(offset.SeqNo), rollbackErr.SeqNo, observer, openStreamOptions)
+			logger.Infow("need to rollback", "vbID", vbID, "vbUUID", vbUUID, "seqNo", rollbackErr.SeqNo)
+			return s.openStreamWithRollback(
+				vbID, offset, rollbackErr.SeqNo, gocbcore.SeqNo(endSeqNo), observer, openStreamOptions,
+			)
 		}
 	}
 
@@ -676,11 +1643,11 @@ func (s *client) CloseStream(vbID uint16) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*60)
 	defer cancel()
 
-	opm := NewAsyncOp(ctx)
+	opm := newTrackedAsyncOp(ctx, s.pendingOps)
 
 	ch := make(chan error, 1)
 
-	op, err := s.dcpAgent.CloseStream(
+	op, err := s.getDcpAgent().CloseStream(
 		vbID,
 		gocbcore.CloseStreamOptions{},
 		func(err error) {
@@ -699,7 +1666,7 @@ func (s *client) CloseStream(vbID uint16) error {
 }
 
 func (s *client) getCollectionID(ctx context.Context, scopeName string, collectionName string) (uint32, error) {
-	opm := NewAsyncOp(ctx)
+	opm := newTrackedAsyncOp(ctx, s.pendingOps)
 
 	ch := make(chan error, 1)
 	var collectionID uint32
@@ -725,13 +1692,74 @@ func (s *client) getCollectionID(ctx context.Context, scopeName string, collecti
 	return collectionID, <-ch
 }
 
+func (s *client) getCollectionManifest(ctx context.Context) (*gocbcore.Manifest, error) {
+	opm := newTrackedAsyncOp(ctx, s.pendingOps)
+
+	ch := make(chan error, 1)
+	var manifest gocbcore.Manifest
+	op, err := s.agent.GetCollectionManifest(
+		gocbcore.GetCollectionManifestOptions{},
+		func(result *gocbcore.GetCollectionManifestResult, err error) {
+			if err == nil {
+				err = manifest.UnmarshalJSON(result.Manifest)
+			}
+
+			opm.Resolve()
+
+			ch <- err
+		},
+	)
+	err = opm.Wait(op, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return &manifest, <-ch
+}
+
+// resolveScopeCollectionIDs returns all current collections of the scope from the collection manifest,
+// the scope id is kept to open the streams with a scope filter.
+func (s *client) resolveScopeCollectionIDs(ctx context.Context, scopeName string) (map[uint32]string, error) {
+	manifest, err := s.getCollectionManifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, scope := range manifest.Scopes {
+		if scope.Name != scopeName {
+			continue
+		}
+
+		collectionIDs := make(map[uint32]string, len(scope.Collections))
+		for _, collection := range scope.Collections {
+			collectionIDs[collection.UID] = collection.Name
+		}
+
+		s.wildcardScopeID.Store(scope.UID)
+
+		return collectionIDs, nil
+	}
+
+	return nil, gocbcore.ErrScopeNotFound
+}
+
 func (s *client) GetCollectionIDs(scopeName string, collectionNames []string) map[uint32]string {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
 	defer cancel()
 
 	collectionIDs := map[uint32]string{}
 
-	if s.dcpAgent.HasCollectionsSupport() {
+	if s.getDcpAgent().HasCollectionsSupport() && config.IsCollectionWildcard(collectionNames) {
+		collectionIDs, err := s.resolveScopeCollectionIDs(ctx, scopeName)
+		if err != nil {
+			logger.Log.Error("error while get collection ids of scope: %s, err: %v", scopeName, err)
+			panic(err)
+		}
+
+		return collectionIDs
+	}
+
+	if s.getDcpAgent().HasCollectionsSupport() {
 		for _, collectionName := range collectionNames {
 			collectionID, err := s.getCollectionID(ctx, scopeName, collectionName)
 			if err != nil {
@@ -746,10 +1774,51 @@ func (s *client) GetCollectionIDs(scopeName string, collectionNames []string) ma
 	return collectionIDs
 }
 
+// ResolveCollectionIDs looks up the current ids of the collections, skipping the ones that no longer exist.
+// The collection wildcard resolves to all collections of the scope.
+func (s *client) ResolveCollectionIDs(scopeName string, collectionNames []string) (map[uint32]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	collectionIDs := map[uint32]string{}
+
+	if !s.getDcpAgent().HasCollectionsSupport() {
+		return collectionIDs, nil
+	}
+
+	if config.IsCollectionWildcard(collectionNames) {
+		collectionIDs, err := s.resolveScopeCollectionIDs(ctx, scopeName)
+		if errors.Is(err, gocbcore.ErrScopeNotFound) {
+			logger.Log.Debug("scope not found while resolving collection ids, scope: %s", scopeName)
+			return map[uint32]string{}, nil
+		}
+
+		return collectionIDs, err
+	}
+
+	for _, collectionName := range collectionNames {
+		collectionID, err := s.getCollectionID(ctx, scopeName, collectionName)
+		if err != nil {
+			if errors.Is(err, gocbcore.ErrCollectionNotFound) || errors.Is(err, gocbcore.ErrScopeNotFound) {
+				logger.Log.Debug("collection not found while resolving collection ids, collection: %s.%s", scopeName, collectionName)
+				continue
+			}
+
+			return nil, err
+		}
+
+		collectionIDs[collectionID] = collectionName
+	}
+
+	return collectionIDs, nil
+}
+
 func NewClient(config *config.Dcp) Client {
 	return &client{
-		agent:    nil,
-		dcpAgent: nil,
-		config:   config,
+		agent:          nil,
+		config:         config,
+		rollbackMetric: NewRollbackMetric(),
+		pendingOps:     &pendingOpTracker{},
+		eventHandler:   models.DefaultEventHandler,
 	}
 }
@@ -1,8 +1,27 @@
 package couchbase
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
 	"reflect"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/Trendyol/go-dcp/config"
+	"github.com/Trendyol/go-dcp/logger"
+	"github.com/Trendyol/go-dcp/models"
+	"github.com/Trendyol/go-dcp/wrapper"
+	"github.com/couchbase/gocbcore/v10"
 )
 
 func TestClient_ResolveHttpAddress(t *testing.T) {
@@ -62,3 +81,559 @@ func TestClient_ResolveHttpAddress(t *testing.T) {
 		}
 	})
 }
+
+func TestClient_SelectVbUUID(t *testing.T) {
+	failoverLogs := []gocbcore.FailoverEntry{
+		{VbUUID: 30, SeqNo: 200},
+		{VbUUID: 20, SeqNo: 100},
+		{VbUUID: 10, SeqNo: 0},
+	}
+
+	t.Run("stored vbUUID exists in failover log", func(t *testing.T) {
+		// Act
+		vbUUID := selectVbUUID(failoverLogs, &models.Offset{VbUUID: 20, SeqNo: 250})
+
+		// Assert
+		if vbUUID != 20 {
+			t.Errorf("Unexpected result. got %v want %v", vbUUID, 20)
+		}
+	})
+
+	t.Run("stored vbUUID missing from failover log", func(t *testing.T) {
+		// Act
+		vbUUID := selectVbUUID(failoverLogs, &models.Offset{VbUUID: 99, SeqNo: 150})
+
+		// Assert
+		if vbUUID != 99 {
+			t.Errorf("Unexpected result. got %v want %v, the server has to roll back the diverged branch", vbUUID, 99)
+		}
+	})
+
+	t.Run("offset without vbUUID", func(t *testing.T) {
+		// Act
+		vbUUID := selectVbUUID(failoverLogs, &models.Offset{SeqNo: 150})
+
+		// Assert
+		if vbUUID != 20 {
+			t.Errorf("Unexpected result. got %v want %v", vbUUID, 20)
+		}
+	})
+
+	t.Run("no entry consistent with saved seqNo", func(t *testing.T) {
+		// Act
+		vbUUID := selectVbUUID([]gocbcore.FailoverEntry{{VbUUID: 30, SeqNo: 200}}, &models.Offset{SeqNo: 150})
+
+		// Assert
+		if vbUUID != 0 {
+			t.Errorf("Unexpected result. got %v want %v", vbUUID, 0)
+		}
+	})
+}
+
+func TestClient_SnapshotRollbackPoint(t *testing.T) {
+	snapshot := &models.SnapshotMarker{StartSeqNo: 100, EndSeqNo: 200}
+
+	for name, tc := range map[string]struct {
+		rollbackSeqNo gocbcore.SeqNo
+		want          gocbcore.SeqNo
+	}{
+		"mid snapshot":      {rollbackSeqNo: 150, want: 99},
+		"snapshot end":      {rollbackSeqNo: 200, want: 200},
+		"before snapshot":   {rollbackSeqNo: 80, want: 80},
+		"first of snapshot": {rollbackSeqNo: 100, want: 99},
+	} {
+		t.Run(name, func(t *testing.T) {
+			// Act
+			seqNo := snapshotRollbackPoint(tc.rollbackSeqNo, snapshot)
+
+			// Assert
+			if seqNo != tc.want {
+				t.Errorf("Unexpected result. got %v want %v", seqNo, tc.want)
+			}
+		})
+	}
+
+	t.Run("mid first snapshot", func(t *testing.T) {
+		// Act
+		seqNo := snapshotRollbackPoint(50, &models.SnapshotMarker{StartSeqNo: 0, EndSeqNo: 200})
+
+		// Assert
+		if seqNo != 0 {
+			t.Errorf("Unexpected result. got %v want %v", seqNo, 0)
+		}
+	})
+}
+
+func TestClient_NewTLSRootCaProvider(t *testing.T) {
+	t.Run("empty path falls back to system roots", func(t *testing.T) {
+		// Act
+		provider, err := newTLSRootCaProvider("")
+
+		// Assert
+		if err != nil || provider != nil {
+			t.Errorf("Unexpected result. got err %v want nil provider", err)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		// Act
+		_, err := newTLSRootCaProvider(filepath.Join(t.TempDir(), "missing.pem"))
+
+		// Assert
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Unexpected result. got %v want %v", err, os.ErrNotExist)
+		}
+	})
+
+	t.Run("file without certificate", func(t *testing.T) {
+		// Arrange
+		path := filepath.Join(t.TempDir(), "ca.pem")
+		if err := os.WriteFile(path, []byte("not a certificate"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		// Act
+		_, err := newTLSRootCaProvider(path)
+
+		// Assert
+		if !errors.Is(err, ErrNoCertificateInRootCA) {
+			t.Errorf("Unexpected result. got %v want %v", err, ErrNoCertificateInRootCA)
+		}
+	})
+
+	t.Run("secure connection without root ca uses system roots", func(t *testing.T) {
+		// Act
+		securityConfig, err := newSecurityConfig("user", "pass", true, "")
+
+		// Assert
+		if err != nil || !securityConfig.UseTLS || securityConfig.TLSRootCAProvider != nil {
+			t.Errorf("Unexpected result. got tls %v, err %v", securityConfig.UseTLS, err)
+		}
+	})
+}
+
+func writeTestKeyPair(t *testing.T) (string, string, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "go-dcp"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return certPath, keyPath, der
+}
+
+func TestClient_NewConfigSecurityConfig(t *testing.T) {
+	certPath, keyPath, der := writeTestKeyPair(t)
+
+	t.Run("client certificate", func(t *testing.T) {
+		// Arrange
+		givenConfig := &config.Dcp{SecureConnection: true, ClientCertPath: certPath, ClientKeyPath: keyPath}
+
+		// Act
+		securityConfig, err := newConfigSecurityConfig(givenConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		certificate, _ := securityConfig.Auth.Certificate(gocbcore.AuthCertRequest{})
+
+		// Assert
+		if !securityConfig.UseTLS || securityConfig.Auth.SupportsNonTLS() {
+			t.Errorf("Unexpected result. got tls %v want %v", securityConfig.UseTLS, true)
+		}
+
+		if certificate == nil || len(certificate.Certificate) != 1 || !reflect.DeepEqual(certificate.Certificate[0], der) {
+			t.Errorf("Unexpected result. security config does not carry the client certificate")
+		}
+	})
+
+	t.Run("password", func(t *testing.T) {
+		// Arrange
+		givenConfig := &config.Dcp{SecureConnection: true, Username: "user", Password: "pass"}
+
+		// Act
+		securityConfig, err := newConfigSecurityConfig(givenConfig)
+
+		// Assert
+		if _, ok := securityConfig.Auth.(gocbcore.PasswordAuthProvider); err != nil || !ok {
+			t.Errorf("Unexpected result. got %T, err %v", securityConfig.Auth, err)
+		}
+	})
+
+	t.Run("invalid combinations", func(t *testing.T) {
+		cases := []struct {
+			config   *config.Dcp
+			expected error
+		}{
+			{&config.Dcp{SecureConnection: true, Username: "user", ClientCertPath: certPath, ClientKeyPath: keyPath}, ErrConflictingAuth},
+			{&config.Dcp{SecureConnection: true}, ErrMissingAuth},
+			{&config.Dcp{ClientCertPath: certPath, ClientKeyPath: keyPath}, ErrClientCertRequiresSecureConnection},
+			{&config.Dcp{SecureConnection: true, ClientCertPath: certPath}, ErrIncompleteClientCert},
+		}
+
+		for _, c := range cases {
+			// Act
+			_, err := newConfigSecurityConfig(c.config)
+
+			// Assert
+			if !errors.Is(err, c.expected) {
+				t.Errorf("Unexpected result. got %v want %v", err, c.expected)
+			}
+		}
+	})
+}
+
+func TestClient_RetryConnect(t *testing.T) {
+	logger.InitDefaultLogger("error")
+
+	retry := config.ConnectionRetry{Attempts: 3, InitialDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond}
+	errConnect := errors.New("connect")
+
+	t.Run("succeeds after transient failures", func(t *testing.T) {
+		// Arrange
+		calls := 0
+
+		// Act
+		err := retryConnect(context.Background(), retry, "bucket", func() error {
+			calls++
+			if calls < 3 {
+				return errConnect
+			}
+			return nil
+		})
+
+		// Assert
+		if err != nil || calls != 3 {
+			t.Errorf("Unexpected result. got %v calls, err %v want %v calls", calls, err, 3)
+		}
+	})
+
+	t.Run("returns the error once attempts are exhausted", func(t *testing.T) {
+		// Arrange
+		calls := 0
+
+		// Act
+		err := retryConnect(context.Background(), retry, "bucket", func() error {
+			calls++
+			return errConnect
+		})
+
+		// Assert
+		if !errors.Is(err, errConnect) || calls != 3 {
+			t.Errorf("Unexpected result. got %v calls, err %v want %v calls", calls, err, 3)
+		}
+	})
+
+	t.Run("stops waiting once the context is done", func(t *testing.T) {
+		// Arrange
+		calls := 0
+		ctx, cancel := context.WithCancel(context.Background())
+		slow := config.ConnectionRetry{Attempts: 3, InitialDelay: time.Hour, MaxDelay: time.Hour}
+
+		// Act
+		err := retryConnect(ctx, slow, "bucket", func() error {
+			calls++
+			cancel()
+			return errConnect
+		})
+
+		// Assert
+		if !errors.Is(err, context.Canceled) || calls != 1 {
+			t.Errorf("Unexpected result. got %v calls, err %v want %v calls", calls, err, 1)
+		}
+	})
+}
+
+type cancelledOp struct {
+	cancelled bool
+}
+
+func (o *cancelledOp) Cancel() {
+	o.cancelled = true
+}
+
+func TestClient_WaitUntilReadyCancelled(t *testing.T) {
+	// Arrange
+	op := &cancelledOp{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Act
+	err := waitUntilReady(ctx, func(_ gocbcore.WaitUntilReadyCallback) (gocbcore.PendingOp, error) {
+		return op, nil
+	})
+
+	// Assert
+	if !errors.Is(err, context.Canceled) || !op.cancelled {
+		t.Errorf("Unexpected result. got %v, cancelled: %v want %v", err, op.cancelled, context.Canceled)
+	}
+}
+
+func TestClient_ConnectionRetryDelay(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		if delay := connectionRetryDelay(time.Second); delay < 500*time.Millisecond || delay > time.Second {
+			t.Fatalf("Unexpected result. got %v want between %v and %v", delay, 500*time.Millisecond, time.Second)
+		}
+	}
+}
+
+func TestClient_GetReplicaNotConnected(t *testing.T) {
+	c := &client{config: &config.Dcp{}}
+
+	if _, err := c.GetReplica(context.Background(), "_default", "_default", []byte("id"), 1); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Unexpected result. got %v want %v", err, ErrNotConnected)
+	}
+
+	if _, err := c.GetAnyReplica(context.Background(), "_default", "_default", []byte("id")); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Unexpected result. got %v want %v", err, ErrNotConnected)
+	}
+}
+
+func TestClient_ResolveConnectionString(t *testing.T) {
+	t.Run("couchbase scheme", func(t *testing.T) {
+		// Act
+		seedConfig, err := resolveConnectionString("couchbase://10.0.0.1,10.0.0.2")
+
+		// Assert
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(seedConfig.MemdAddrs, []string{"10.0.0.1:11210", "10.0.0.2:11210"}) {
+			t.Errorf("Unexpected result. got %v", seedConfig.MemdAddrs)
+		}
+
+		if !reflect.DeepEqual(seedConfig.HTTPAddrs, []string{"10.0.0.1:8091", "10.0.0.2:8091"}) {
+			t.Errorf("Unexpected result. got %v", seedConfig.HTTPAddrs)
+		}
+
+		if seedConfig.SRVRecord != nil {
+			t.Errorf("Unexpected result. got srv record %v for ip addresses", seedConfig.SRVRecord)
+		}
+	})
+
+	t.Run("couchbases scheme", func(t *testing.T) {
+		// Act
+		seedConfig, err := resolveConnectionString("couchbases://10.0.0.1")
+
+		// Assert
+		if err != nil || !reflect.DeepEqual(seedConfig.MemdAddrs, []string{"10.0.0.1:11207"}) {
+			t.Errorf("Unexpected result. got %v, err %v", seedConfig.MemdAddrs, err)
+		}
+	})
+
+	t.Run("bad scheme", func(t *testing.T) {
+		// Act
+		_, err := resolveConnectionString("ftp://10.0.0.1")
+
+		// Assert
+		if err == nil {
+			t.Errorf("Unexpected result. got nil error")
+		}
+	})
+}
+
+func TestClient_NetworkType(t *testing.T) {
+	// Arrange
+	c := &client{config: &config.Dcp{NetworkType: config.NetworkTypeExternal}}
+
+	// Act
+	agentConfig := c.agentConfig("bucket", gocbcore.SecurityConfig{}, 0)
+	dcpAgentConfig := c.dcpAgentConfig(gocbcore.SecurityConfig{}, false, false)
+
+	// Assert
+	if agentConfig.IoConfig.NetworkType != config.NetworkTypeExternal {
+		t.Errorf("Unexpected result. got %v want %v", agentConfig.IoConfig.NetworkType, config.NetworkTypeExternal)
+	}
+
+	if dcpAgentConfig.IoConfig.NetworkType != config.NetworkTypeExternal {
+		t.Errorf("Unexpected result. got %v want %v", dcpAgentConfig.IoConfig.NetworkType, config.NetworkTypeExternal)
+	}
+}
+
+func TestClient_DisableDecompression(t *testing.T) {
+	// Arrange
+	c := &client{config: &config.Dcp{Compression: config.Compression{DisableDecompression: true}}}
+
+	// Act
+	agentConfig := c.agentConfig("bucket", gocbcore.SecurityConfig{}, 0)
+	dcpAgentConfig := c.dcpAgentConfig(gocbcore.SecurityConfig{}, false, false)
+
+	// Assert
+	if agentConfig.CompressionConfig.DisableDecompression {
+		t.Errorf("Unexpected result. data agent is not expected to disable decompression")
+	}
+
+	if !dcpAgentConfig.CompressionConfig.DisableDecompression {
+		t.Errorf("Unexpected result. dcp agent is expected to disable decompression")
+	}
+}
+
+func TestClient_ConfigSnapshotFailure(t *testing.T) {
+	logger.InitDefaultLogger("error")
+
+	// Arrange
+	c := &client{config: &config.Dcp{
+		Dcp: config.ExternalDcp{VBuckets: config.DCPVBuckets{RetryAttempts: 2, RetryInterval: time.Millisecond}},
+	}}
+
+	// Act
+	_, numVBucketsErr := c.GetNumVBuckets()
+	_, bucketUUIDErr := c.GetBucketUUID()
+
+	// Assert
+	if !errors.Is(numVBucketsErr, ErrNotConnected) {
+		t.Errorf("Unexpected result. got %v want %v", numVBucketsErr, ErrNotConnected)
+	}
+
+	if !errors.Is(bucketUUIDErr, ErrNotConnected) {
+		t.Errorf("Unexpected result. got %v want %v", bucketUUIDErr, ErrNotConnected)
+	}
+}
+
+func TestClient_OpenStreamRangeInvalidRange(t *testing.T) {
+	c := &client{config: &config.Dcp{}}
+
+	err := c.OpenStreamRange(0, nil, &models.Offset{SeqNo: 10}, 5, nil)
+
+	if !errors.Is(err, ErrInvalidSeqNoRange) {
+		t.Errorf("Unexpected result. got %v want %v", err, ErrInvalidSeqNoRange)
+	}
+}
+
+func TestClient_CollectPersistSeqNosBoundsConcurrency(t *testing.T) {
+	highSeqNos := wrapper.CreateConcurrentSwissMap[uint16, uint64](64)
+	for vbID := uint16(0); vbID < 64; vbID++ {
+		highSeqNos.Store(vbID, uint64(vbID)+10)
+	}
+
+	var inFlight, maxInFlight atomic.Int32
+
+	seqNos, err := collectPersistSeqNos(highSeqNos, 4, func(vbID uint16) (uint64, error) {
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+
+		for {
+			observed := maxInFlight.Load()
+			if current <= observed || maxInFlight.CompareAndSwap(observed, current) {
+				break
+			}
+		}
+
+		time.Sleep(time.Millisecond)
+
+		return uint64(vbID), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if maxInFlight.Load() > 4 {
+		t.Errorf("Unexpected concurrent ObserveVb requests. got %v want at most 4", maxInFlight.Load())
+	}
+
+	if seqNos.Count() != 64 {
+		t.Fatalf("Unexpected seqNo count. got %v want 64", seqNos.Count())
+	}
+
+	if seqNo, _ := seqNos.Load(7); seqNo.HighSeqNo != 17 || seqNo.PersistSeqNo != 7 {
+		t.Errorf("Unexpected seqNos of vbID 7. got %+v", seqNo)
+	}
+}
+
+func TestClient_CollectPersistSeqNosReturnsError(t *testing.T) {
+	highSeqNos := wrapper.CreateConcurrentSwissMap[uint16, uint64](2)
+	highSeqNos.Store(0, 1)
+	highSeqNos.Store(1, 1)
+
+	expected := errors.New("observe failed")
+
+	_, err := collectPersistSeqNos(highSeqNos, 4, func(vbID uint16) (uint64, error) {
+		if vbID == 1 {
+			return 0, expected
+		}
+		return 1, nil
+	})
+	if !errors.Is(err, expected) {
+		t.Errorf("Unexpected error. got %v want %v", err, expected)
+	}
+}
+
+func TestClient_EvaluateServiceHealth(t *testing.T) {
+	ok := models.ServiceHealth{Endpoint: "node-1", State: "ok"}
+	timeout := models.ServiceHealth{Endpoint: "node-2", State: "timeout"}
+
+	tests := []struct {
+		services map[string][]models.ServiceHealth
+		name     string
+		expected string
+		reasons  int
+	}{
+		{
+			name:     "all endpoints ok",
+			services: map[string][]models.ServiceHealth{"memd": {ok}, "mgmt": {ok}, "dcp": {ok}},
+			expected: models.HealthStateHealthy,
+		},
+		{
+			name:     "one endpoint down",
+			services: map[string][]models.ServiceHealth{"memd": {ok, timeout}, "mgmt": {ok}, "dcp": {ok}},
+			expected: models.HealthStateDegraded,
+			reasons:  1,
+		},
+		{
+			name:     "service without healthy endpoint",
+			services: map[string][]models.ServiceHealth{"memd": {ok}, "mgmt": {ok}, "dcp": {timeout}},
+			expected: models.HealthStateFailed,
+			reasons:  2,
+		},
+		{
+			name:     "service without endpoint",
+			services: map[string][]models.ServiceHealth{"memd": {ok}, "dcp": {ok}},
+			expected: models.HealthStateFailed,
+			reasons:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := models.NewHealthCheckResult()
+			result.Services = tt.services
+			evaluateServiceHealth(result)
+
+			if result.State != tt.expected || result.Healthy != (tt.expected == models.HealthStateHealthy) ||
+				len(result.Reasons) != tt.reasons {
+				t.Errorf("expected state: %v with %v reasons, got: %v, reasons: %v", tt.expected, tt.reasons, result.State, result.Reasons)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package couchbase
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Trendyol/go-dcp/config"
+	"github.com/Trendyol/go-dcp/logger"
+)
+
+var ErrDcpReconnectStopped = errors.New("dcp reconnect is stopped")
+
+// ReconnectDcpWithBackoff closes and connects the dcp agent until it succeeds or the attempts are exhausted,
+// the backoff doubles up to maxBackoff. It returns the attempts it took and the last error when it gives up.
+func ReconnectDcpWithBackoff(client Client, config *config.DCPReconnect, stopCh <-chan struct{}) (int, error) {
+	backoff := config.Backoff
+
+	for attempt := 1; ; attempt++ {
+		err := client.DcpReconnect()
+		if err == nil {
+			return attempt, nil
+		}
+
+		if attempt >= config.Attempts {
+			return attempt, fmt.Errorf("dcp reconnect failed after %v attempts: %w", attempt, err)
+		}
+
+		logger.Log.Warn("error while reconnecting dcp, attempt: %v, retry in: %v, err: %v", attempt, backoff, err)
+
+		select {
+		case <-stopCh:
+			return attempt, ErrDcpReconnectStopped
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > config.MaxBackoff {
+			backoff = config.MaxBackoff
+		}
+	}
+}
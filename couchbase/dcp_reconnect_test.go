@@ -0,0 +1,53 @@
+package couchbase
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Trendyol/go-dcp/config"
+	"github.com/Trendyol/go-dcp/logger"
+)
+
+type reconnectingClient struct {
+	Client
+	err      error
+	failures int
+	calls    int
+}
+
+func (c *reconnectingClient) DcpReconnect() error {
+	c.calls++
+	if c.calls <= c.failures {
+		return c.err
+	}
+	return nil
+}
+
+func TestReconnectDcpWithBackoff(t *testing.T) {
+	logger.InitDefaultLogger("error")
+
+	errDead := errors.New("connection refused")
+	reconnectConfig := &config.DCPReconnect{Attempts: 3, Backoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+
+	client := &reconnectingClient{err: errDead, failures: 2}
+	attempts, err := ReconnectDcpWithBackoff(client, reconnectConfig, make(chan struct{}))
+	if err != nil || attempts != 3 {
+		t.Fatalf("reconnect is expected to succeed on the third attempt, attempts: %v, err: %v", attempts, err)
+	}
+
+	client = &reconnectingClient{err: errDead, failures: 3}
+	attempts, err = ReconnectDcpWithBackoff(client, reconnectConfig, make(chan struct{}))
+	if !errors.Is(err, errDead) || attempts != 3 {
+		t.Fatalf("reconnect is expected to give up after 3 attempts, attempts: %v, err: %v", attempts, err)
+	}
+
+	stopCh := make(chan struct{})
+	close(stopCh)
+
+	client = &reconnectingClient{err: errDead, failures: 3}
+	_, err = ReconnectDcpWithBackoff(client, reconnectConfig, stopCh)
+	if !errors.Is(err, ErrDcpReconnectStopped) || client.calls != 1 {
+		t.Errorf("reconnect is expected to stop after the first attempt, calls: %v, err: %v", client.calls, err)
+	}
+}
@@ -2,12 +2,40 @@ package couchbase
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
 
 	"github.com/couchbase/gocbcore/v10/memd"
 
 	"github.com/couchbase/gocbcore/v10"
 )
 
+// ErrMetadataNotCouchbase is returned by document operations when there is no meta agent,
+// which is the case when metadata is not couchbase-backed.
+var ErrMetadataNotCouchbase = errors.New("metadata is not couchbase-backed")
+
+var ErrDurabilityNotSupported = errors.New("durable writes are not supported by the bucket")
+
+// Durability is the synchronous durability requirement of a write, the zero value writes without durability.
+type Durability struct {
+	Level   memd.DurabilityLevel
+	Timeout time.Duration
+}
+
+// checkDurability fails a durable write instead of letting it silently go through without a durability guarantee.
+func checkDurability(agent *gocbcore.Agent, durability Durability) error {
+	if durability.Level == 0 {
+		return nil
+	}
+
+	if agent.Internal().BucketCapabilityStatus(gocbcore.BucketCapabilityDurableWrites) == gocbcore.CapabilityStatusUnsupported {
+		return fmt.Errorf("%w: bucket %v, level %v", ErrDurabilityNotSupported, agent.BucketName(), durability.Level)
+	}
+
+	return nil
+}
+
 func CreateDocument(ctx context.Context,
 	agent *gocbcore.Agent,
 	scopeName string,
@@ -16,21 +44,32 @@ func CreateDocument(ctx context.Context,
 	value []byte,
 	flags uint32,
 	expiry uint32,
+	durability Durability,
 ) error {
-	opm := NewAsyncOp(ctx)
+	if agent == nil {
+		return ErrMetadataNotCouchbase
+	}
+
+	if err := checkDurability(agent, durability); err != nil {
+		return err
+	}
+
+	opm := newAgentAsyncOp(ctx, agent)
 
 	deadline, _ := ctx.Deadline()
 
 	ch := make(chan error, 1)
 
 	op, err := agent.Set(gocbcore.SetOptions{
-		Key:            id,
-		Value:          value,
-		Flags:          flags,
-		Deadline:       deadline,
-		Expiry:         expiry,
-		ScopeName:      scopeName,
-		CollectionName: collectionName,
+		Key:                    id,
+		Value:                  value,
+		Flags:                  flags,
+		Deadline:               deadline,
+		Expiry:                 expiry,
+		ScopeName:              scopeName,
+		CollectionName:         collectionName,
+		DurabilityLevel:        durability.Level,
+		DurabilityLevelTimeout: durability.Timeout,
 	}, func(result *gocbcore.StoreResult, err error) {
 		opm.Resolve()
 
@@ -53,8 +92,17 @@ func UpdateDocument(ctx context.Context,
 	value []byte,
 	expiry uint32,
 	cas *gocbcore.Cas,
+	durability Durability,
 ) error {
-	opm := NewAsyncOp(ctx)
+	if agent == nil {
+		return ErrMetadataNotCouchbase
+	}
+
+	if err := checkDurability(agent, durability); err != nil {
+		return err
+	}
+
+	opm := newAgentAsyncOp(ctx, agent)
 
 	deadline, _ := ctx.Deadline()
 
@@ -68,10 +116,12 @@ func UpdateDocument(ctx context.Context,
 				Value: value,
 			},
 		},
-		Expiry:         expiry,
-		Deadline:       deadline,
-		ScopeName:      scopeName,
-		CollectionName: collectionName,
+		Expiry:                 expiry,
+		Deadline:               deadline,
+		ScopeName:              scopeName,
+		CollectionName:         collectionName,
+		DurabilityLevel:        durability.Level,
+		DurabilityLevelTimeout: durability.Timeout,
 	}
 	if cas != nil {
 		mutateInOptions.Cas = *cas
@@ -93,7 +143,11 @@ func UpdateDocument(ctx context.Context,
 }
 
 func DeleteDocument(ctx context.Context, agent *gocbcore.Agent, scopeName string, collectionName string, id []byte) error {
-	opm := NewAsyncOp(ctx)
+	if agent == nil {
+		return ErrMetadataNotCouchbase
+	}
+
+	opm := newAgentAsyncOp(ctx, agent)
 
 	deadline, _ := ctx.Deadline()
 
@@ -126,27 +180,106 @@ func UpsertXattrs(ctx context.Context,
 	path string,
 	value []byte,
 	expiry uint32,
+	durability Durability,
 ) error {
-	opm := NewAsyncOp(ctx)
+	return mutateXattrs(ctx, agent, scopeName, collectionName, id, path, value, expiry, durability, memd.SubdocDocFlagNone)
+}
+
+// UpsertDocumentXattrs creates the document when it does not exist, so a single MutateIn is enough for the first write.
+func UpsertDocumentXattrs(ctx context.Context,
+	agent *gocbcore.Agent,
+	scopeName string,
+	collectionName string,
+	id []byte,
+	path string,
+	value []byte,
+	expiry uint32,
+	durability Durability,
+) error {
+	return mutateXattrs(ctx, agent, scopeName, collectionName, id, path, value, expiry, durability, memd.SubdocDocFlagMkDoc)
+}
+
+// UpsertDocumentBody replaces the body of the document, creating it when it does not exist. The xattr at path is set
+// to null in the same write, so the body is not shadowed by a value written there before.
+func UpsertDocumentBody(ctx context.Context,
+	agent *gocbcore.Agent,
+	scopeName string,
+	collectionName string,
+	id []byte,
+	path string,
+	value []byte,
+	expiry uint32,
+	durability Durability,
+) error {
+	return mutateIn(ctx, agent, scopeName, collectionName, id, []gocbcore.SubDocOp{
+		{
+			Op:    memd.SubDocOpDictSet,
+			Flags: memd.SubdocFlagXattrPath,
+			Path:  path,
+			Value: []byte("null"),
+		},
+		{
+			Op:    memd.SubDocOpSetDoc,
+			Value: value,
+		},
+	}, expiry, durability, memd.SubdocDocFlagMkDoc)
+}
+
+func mutateXattrs(ctx context.Context,
+	agent *gocbcore.Agent,
+	scopeName string,
+	collectionName string,
+	id []byte,
+	path string,
+	value []byte,
+	expiry uint32,
+	durability Durability,
+	flags memd.SubdocDocFlag,
+) error {
+	return mutateIn(ctx, agent, scopeName, collectionName, id, []gocbcore.SubDocOp{
+		{
+			Op:    memd.SubDocOpDictSet,
+			Flags: memd.SubdocFlagXattrPath,
+			Path:  path,
+			Value: value,
+		},
+	}, expiry, durability, flags)
+}
+
+func mutateIn(ctx context.Context,
+	agent *gocbcore.Agent,
+	scopeName string,
+	collectionName string,
+	id []byte,
+	ops []gocbcore.SubDocOp,
+	expiry uint32,
+	durability Durability,
+	flags memd.SubdocDocFlag,
+) error {
+	if agent == nil {
+		return ErrMetadataNotCouchbase
+	}
+
+	if err := checkDurability(agent, durability); err != nil {
+		return err
+	}
+
+	opm := newAgentAsyncOp(ctx, agent)
 
 	deadline, _ := ctx.Deadline()
 
 	ch := make(chan error, 1)
 
 	op, err := agent.MutateIn(gocbcore.MutateInOptions{
-		Key: id,
-		Ops: []gocbcore.SubDocOp{
-			{
-				Op:    memd.SubDocOpDictSet,
-				Flags: memd.SubdocFlagXattrPath,
-				Path:  path,
-				Value: value,
-			},
-		},
-		Expiry:         expiry,
-		Deadline:       deadline,
-		ScopeName:      scopeName,
-		CollectionName: collectionName,
+		Key:                    id,
+		Flags:                  flags,
+		Ops:                    ops,
+		Expiry:                 expiry,
+		Deadline:               deadline,
+		ScopeName:              scopeName,
+		CollectionName:         collectionName,
+		DurabilityLevel:        durability.Level,
+		DurabilityLevelTimeout: durability.Timeout,
 	}, func(result *gocbcore.MutateInResult, err error) {
 		opm.Resolve()
 
@@ -164,13 +297,20 @@ func UpsertXattrs(ctx context.Context,
 }
 
 func GetXattrs(ctx context.Context, agent *gocbcore.Agent, scopeName string, collectionName string, id []byte, path string) ([]byte, error) { //nolint:lll
-	opm := NewAsyncOp(ctx)
+	if agent == nil {
+		return nil, ErrMetadataNotCouchbase
+	}
+
+	opm := newAgentAsyncOp(ctx, agent)
+
+	deadline, _ := ctx.Deadline()
 
 	errorCh := make(chan error, 1)
 	documentCh := make(chan []byte, 1)
 
 	op, err := agent.LookupIn(gocbcore.LookupInOptions{
-		Key: id,
+		Key:      id,
+		Deadline: deadline,
 		Ops: []gocbcore.SubDocOp{
 			{
 				Op:    memd.SubDocOpGet,
@@ -197,14 +337,98 @@ func GetXattrs(ctx context.Context, agent *gocbcore.Agent, scopeName string, col
 		return nil, err
 	}
 
-	document := <-documentCh
-	err = <-errorCh
+	document, ctxErr := receive(ctx, documentCh)
+	if ctxErr != nil {
+		return nil, ctxErr
+	}
+
+	err, ctxErr = receive(ctx, errorCh)
+	if ctxErr != nil {
+		return nil, ctxErr
+	}
 
 	return document, err
 }
 
+// GetXattrsAndDocument returns the xattr at path and the body of the document, each is nil when it cannot be read.
+func GetXattrsAndDocument(
+	ctx context.Context, agent *gocbcore.Agent, scopeName string, collectionName string, id []byte, path string,
+) ([]byte, []byte, error) {
+	if agent == nil {
+		return nil, nil, ErrMetadataNotCouchbase
+	}
+
+	opm := newAgentAsyncOp(ctx, agent)
+
+	deadline, _ := ctx.Deadline()
+
+	errorCh := make(chan error, 1)
+	documentCh := make(chan []gocbcore.SubDocResult, 1)
+
+	op, err := agent.LookupIn(gocbcore.LookupInOptions{
+		Key:      id,
+		Deadline: deadline,
+		Ops: []gocbcore.SubDocOp{
+			{
+				Op:    memd.SubDocOpGet,
+				Flags: memd.SubdocFlagXattrPath,
+				Path:  path,
+			},
+			{
+				Op: memd.SubDocOpGetDoc,
+			},
+		},
+		ScopeName:      scopeName,
+		CollectionName: collectionName,
+	}, func(result *gocbcore.LookupInResult, err error) {
+		opm.Resolve()
+
+		if err == nil {
+			documentCh <- result.Ops
+		} else {
+			documentCh <- nil
+		}
+
+		errorCh <- err
+	})
+
+	err = opm.Wait(op, err)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	results, ctxErr := receive(ctx, documentCh)
+	if ctxErr != nil {
+		return nil, nil, ctxErr
+	}
+
+	err, ctxErr = receive(ctx, errorCh)
+	if ctxErr != nil {
+		return nil, nil, ctxErr
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var xattr, document []byte
+	if results[0].Err == nil {
+		xattr = results[0].Value
+	}
+
+	if results[1].Err == nil {
+		document = results[1].Value
+	}
+
+	return xattr, document, nil
+}
+
 func Get(ctx context.Context, agent *gocbcore.Agent, scopeName string, collectionName string, id []byte) (*gocbcore.GetResult, error) {
-	opm := NewAsyncOp(ctx)
+	if agent == nil {
+		return nil, ErrMetadataNotCouchbase
+	}
+
+	opm := newAgentAsyncOp(ctx, agent)
 
 	deadline, _ := ctx.Deadline()
 
@@ -233,8 +457,65 @@ func Get(ctx context.Context, agent *gocbcore.Agent, scopeName string, collectio
 		return nil, err
 	}
 
-	document := <-documentCh
-	err = <-errorCh
+	document, ctxErr := receive(ctx, documentCh)
+	if ctxErr != nil {
+		return nil, ctxErr
+	}
+
+	err, ctxErr = receive(ctx, errorCh)
+	if ctxErr != nil {
+		return nil, ctxErr
+	}
+
+	return document, err
+}
+
+func GetReplica(
+	ctx context.Context, agent *gocbcore.Agent, scopeName string, collectionName string, id []byte, replicaIndex int,
+) (*gocbcore.GetReplicaResult, error) {
+	if agent == nil {
+		return nil, ErrMetadataNotCouchbase
+	}
+
+	opm := newAgentAsyncOp(ctx, agent)
+
+	deadline, _ := ctx.Deadline()
+
+	errorCh := make(chan error, 1)
+	documentCh := make(chan *gocbcore.GetReplicaResult, 1)
+
+	op, err := agent.GetOneReplica(gocbcore.GetOneReplicaOptions{
+		Key:            id,
+		ReplicaIdx:     replicaIndex,
+		Deadline:       deadline,
+		ScopeName:      scopeName,
+		CollectionName: collectionName,
+	}, func(result *gocbcore.GetReplicaResult, err error) {
+		opm.Resolve()
+
+		if err == nil {
+			documentCh <- result
+		} else {
+			documentCh <- nil
+		}
+
+		errorCh <- err
+	})
+
+	err = opm.Wait(op, err)
+	if err != nil {
+		return nil, err
+	}
+
+	document, ctxErr := receive(ctx, documentCh)
+	if ctxErr != nil {
+		return nil, ctxErr
+	}
+
+	err, ctxErr = receive(ctx, errorCh)
+	if ctxErr != nil {
+		return nil, ctxErr
+	}
 
 	return document, err
 }
@@ -248,7 +529,11 @@ func CreatePath(ctx context.Context,
 	value []byte,
 	flags memd.SubdocDocFlag,
 ) error {
-	opm := NewAsyncOp(ctx)
+	if agent == nil {
+		return ErrMetadataNotCouchbase
+	}
+
+	opm := newAgentAsyncOp(ctx, agent)
 
 	deadline, _ := ctx.Deadline()
 
@@ -0,0 +1,41 @@
+package couchbase
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestDocOp_NilAgent(t *testing.T) {
+	ctx := context.Background()
+
+	if _, err := Get(ctx, nil, "_default", "_default", []byte("id")); !errors.Is(err, ErrMetadataNotCouchbase) {
+		t.Errorf("Unexpected result. got %v want %v", err, ErrMetadataNotCouchbase)
+	}
+
+	if _, err := GetReplica(ctx, nil, "_default", "_default", []byte("id"), 1); !errors.Is(err, ErrMetadataNotCouchbase) {
+		t.Errorf("Unexpected result. got %v want %v", err, ErrMetadataNotCouchbase)
+	}
+
+	if _, err := GetXattrs(ctx, nil, "_default", "_default", []byte("id"), "path"); !errors.Is(err, ErrMetadataNotCouchbase) {
+		t.Errorf("Unexpected result. got %v want %v", err, ErrMetadataNotCouchbase)
+	}
+
+	err := UpsertXattrs(ctx, nil, "_default", "_default", []byte("id"), "path", nil, 0, Durability{})
+	if !errors.Is(err, ErrMetadataNotCouchbase) {
+		t.Errorf("Unexpected result. got %v want %v", err, ErrMetadataNotCouchbase)
+	}
+
+	if err := DeleteDocument(ctx, nil, "_default", "_default", []byte("id")); !errors.Is(err, ErrMetadataNotCouchbase) {
+		t.Errorf("Unexpected result. got %v want %v", err, ErrMetadataNotCouchbase)
+	}
+}
+
+func TestDocOp_ReceiveCancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := receive(ctx, make(chan []byte)); !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected result. got %v want %v", err, context.Canceled)
+	}
+}
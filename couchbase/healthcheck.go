@@ -1,6 +1,7 @@
 package couchbase
 
 import (
+	"context"
 	"time"
 
 	"github.com/Trendyol/go-dcp/config"
@@ -41,3 +42,51 @@ func NewHealthCheck(config *config.HealthCheck, client Client) HealthCheck {
 		client: client,
 	}
 }
+
+// dcpKeepAlive probes the dcp connections every interval, a half open connection stays silent without
+// an error, so a probe that does not complete within the interval triggers onDead.
+type dcpKeepAlive struct {
+	ticker   *time.Ticker
+	client   Client
+	onDead   func(err error)
+	stopCh   chan struct{}
+	interval time.Duration
+}
+
+func (k *dcpKeepAlive) Start() {
+	k.ticker = time.NewTicker(k.interval)
+
+	go func() {
+		for {
+			select {
+			case <-k.ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), k.interval)
+				err := k.client.PingDcp(ctx)
+				cancel()
+
+				if err != nil {
+					logger.Log.Warn("dcp connection is not responding within %v, err: %v", k.interval, err)
+					k.onDead(err)
+				}
+			case <-k.stopCh:
+				return
+			}
+		}
+	}()
+
+	logger.Log.Debug("started dcp keepalive, interval: %v", k.interval)
+}
+
+func (k *dcpKeepAlive) Stop() {
+	k.ticker.Stop()
+	close(k.stopCh)
+}
+
+func NewDcpKeepAlive(interval time.Duration, client Client, onDead func(err error)) HealthCheck {
+	return &dcpKeepAlive{
+		interval: interval,
+		client:   client,
+		onDead:   onDead,
+		stopCh:   make(chan struct{}),
+	}
+}
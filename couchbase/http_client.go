@@ -1,15 +1,34 @@
 package couchbase
 
 import (
+	"crypto/tls"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/Trendyol/go-dcp/logger"
 
 	"github.com/Trendyol/go-dcp/config"
 
+	"github.com/couchbase/gocbcore/v10"
 	jsoniter "github.com/json-iterator/go"
 	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttpproxy"
+)
+
+const (
+	httpServerErrorAttempts = 3
+	httpServerErrorDelay    = 500 * time.Millisecond
+)
+
+var (
+	ErrHTTPTimeout                = errors.New("management http request timed out")
+	ErrSecureManagementPortNotSet = errors.New("http.securePort must be set for a custom management port with secureConnection")
 )
 
 type PoolsResult struct {
@@ -29,10 +48,39 @@ func (b *BucketInfo) IsMagma() bool {
 	return b.StorageBackend == "magma"
 }
 
+type ManifestCollection struct {
+	Name   string
+	UID    uint32
+	MaxTTL int32
+}
+
+type ManifestScope struct {
+	Name        string
+	Collections []ManifestCollection
+	UID         uint32
+}
+
+// ManifestResult is the scope and collection hierarchy of the bucket, UID is the manifest revision.
+type ManifestResult struct {
+	Scopes []ManifestScope
+	UID    uint64
+}
+
+func (m *ManifestResult) Scope(name string) (*ManifestScope, bool) {
+	for i := range m.Scopes {
+		if m.Scopes[i].Name == name {
+			return &m.Scopes[i], true
+		}
+	}
+
+	return nil, false
+}
+
 type HTTPClient interface {
 	Connect() error
 	GetVersion() (*Version, error)
 	GetBucketInfo() (*BucketInfo, error)
+	GetCollectionManifest() (*ManifestResult, error)
 }
 
 type httpClient struct {
@@ -49,31 +97,112 @@ func (h *httpClient) Connect() error {
 		return err
 	}
 
-	h.baseURL = pingResult.MgmtEndpoint
+	h.baseURL, err = mgmtBaseURL(pingResult.MgmtEndpoint, h.config.SecureConnection, h.config.HTTP.SecurePort)
+	if err != nil {
+		logger.Log.Error("error while connecting as http to couchbase: %v", err)
+		return err
+	}
 
 	return nil
 }
 
+// mgmtBaseURL moves a plain mgmt endpoint to https on secure connections, to securePort when it is set or from
+// the default port 8091 to 18091. The tls port of a custom mgmt port is not known, so it must be set.
+func mgmtBaseURL(endpoint string, secureConnection bool, securePort int) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || !secureConnection || u.Scheme != "http" {
+		return endpoint, nil
+	}
+
+	switch {
+	case securePort != 0:
+		u.Host = net.JoinHostPort(u.Hostname(), strconv.Itoa(securePort))
+	case u.Port() == "8091":
+		u.Host = net.JoinHostPort(u.Hostname(), "18091")
+	default:
+		return "", fmt.Errorf("%w, mgmt endpoint: %v", ErrSecureManagementPortNotSet, endpoint)
+	}
+
+	u.Scheme = "https"
+
+	return u.String(), nil
+}
+
+// newHTTPTLSConfig trusts the root ca of the kv connection and presents the client certificate when it is configured.
+func newHTTPTLSConfig(config *config.Dcp) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	provider, err := newTLSRootCaProvider(config.RootCAPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if provider != nil {
+		tlsConfig.RootCAs = provider()
+	}
+
+	if config.ClientCertPath != "" && config.ClientKeyPath != "" {
+		certificate, err := tls.LoadX509KeyPair(os.ExpandEnv(config.ClientCertPath), os.ExpandEnv(config.ClientKeyPath))
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return tlsConfig, nil
+}
+
+// ResponseError is a non 2xx response of the management api, Body is the response body as sent by the server.
+type ResponseError struct {
+	URI        string
+	Body       string
+	StatusCode int
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("management http request failed, uri: %s, status: %d, body: %s", e.URI, e.StatusCode, e.Body)
+}
+
+// doRequest sends 5xx responses again up to httpServerErrorAttempts times, they are common while the cluster reconfigures.
 func (h *httpClient) doRequest(req *fasthttp.Request, v interface{}) error {
-	req.Header.Set(
-		"Authorization",
-		"Basic "+base64.StdEncoding.EncodeToString([]byte(h.config.Username+":"+h.config.Password)),
-	)
+	if h.config.ClientCertPath == "" {
+		req.Header.Set(
+			"Authorization",
+			"Basic "+base64.StdEncoding.EncodeToString([]byte(h.config.Username+":"+h.config.Password)),
+		)
+	}
 
 	res := fasthttp.AcquireResponse()
 	defer fasthttp.ReleaseResponse(res)
 
-	err := h.httpClient.Do(req, res)
-	if err != nil {
-		return err
-	}
+	for attempt := 1; ; attempt++ {
+		err := h.httpClient.DoTimeout(req, res, h.config.HTTP.Timeout)
+		if errors.Is(err, fasthttp.ErrTimeout) {
+			return fmt.Errorf("%w after %v, uri: %s", ErrHTTPTimeout, h.config.HTTP.Timeout, req.URI())
+		}
 
-	err = jsoniter.Unmarshal(res.Body(), v)
-	if err != nil {
-		return err
+		if err != nil {
+			return err
+		}
+
+		statusCode := res.StatusCode()
+		if statusCode >= fasthttp.StatusOK && statusCode < fasthttp.StatusMultipleChoices {
+			break
+		}
+
+		responseErr := &ResponseError{URI: req.URI().String(), Body: string(res.Body()), StatusCode: statusCode}
+
+		if statusCode < fasthttp.StatusInternalServerError || attempt >= httpServerErrorAttempts {
+			return responseErr
+		}
+
+		logger.Log.Warn("%v, attempt: %v/%v, retry in: %v", responseErr, attempt, httpServerErrorAttempts, httpServerErrorDelay)
+
+		time.Sleep(httpServerErrorDelay)
 	}
 
-	return nil
+	return jsoniter.Unmarshal(res.Body(), v)
 }
 
 func (h *httpClient) GetVersion() (*Version, error) {
@@ -113,10 +242,89 @@ func (h *httpClient) GetBucketInfo() (*BucketInfo, error) {
 	return &result, nil
 }
 
-func NewHTTPClient(config *config.Dcp, client Client) HTTPClient {
+// GetCollectionManifest parses the manifest with gocbcore, the api sends the uids as hex strings.
+func (h *httpClient) GetCollectionManifest() (*ManifestResult, error) {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+
+	req.SetRequestURI(fmt.Sprintf("%v/pools/default/buckets/%v/scopes", h.baseURL, url.PathEscape(h.config.BucketName)))
+	req.Header.SetMethod("GET")
+
+	var manifest gocbcore.Manifest
+	err := h.doRequest(req, &manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ManifestResult{UID: manifest.UID, Scopes: make([]ManifestScope, 0, len(manifest.Scopes))}
+	for _, scope := range manifest.Scopes {
+		collections := make([]ManifestCollection, 0, len(scope.Collections))
+		for _, collection := range scope.Collections {
+			collections = append(collections, ManifestCollection{Name: collection.Name, UID: collection.UID, MaxTTL: collection.MaxTTL})
+		}
+
+		result.Scopes = append(result.Scopes, ManifestScope{Name: scope.Name, UID: scope.UID, Collections: collections})
+	}
+
+	return result, nil
+}
+
+// newProxyDialer supports http and socks5 proxies, gocbcore has no proxy support
+// so only the management requests of this client go through the proxy.
+func newProxyDialer(proxy config.Proxy) (fasthttp.DialFunc, error) {
+	u, err := proxy.Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme == "socks5" {
+		return fasthttpproxy.FasthttpSocksDialer(proxy.URL), nil
+	}
+
+	// the dialer sends the userinfo as is, so it gets the decoded username and password
+	addr := u.Host
+	if u.User != nil {
+		userInfo := u.User.Username()
+		if password, ok := u.User.Password(); ok {
+			userInfo += ":" + password
+		}
+
+		addr = userInfo + "@" + u.Host
+	}
+
+	return fasthttpproxy.FasthttpHTTPDialer(addr), nil
+}
+
+func NewHTTPClient(config *config.Dcp, client Client) (HTTPClient, error) {
+	fasthttpClient := &fasthttp.Client{
+		ReadTimeout:     config.HTTP.Timeout,
+		WriteTimeout:    config.HTTP.Timeout,
+		MaxConnsPerHost: config.HTTP.MaxConnsPerHost,
+	}
+
+	if config.SecureConnection {
+		tlsConfig, err := newHTTPTLSConfig(config)
+		if err != nil {
+			logger.Log.Error("error while creating management http tls config, err: %v", err)
+			return nil, err
+		}
+
+		fasthttpClient.TLSConfig = tlsConfig
+	}
+
+	if config.Proxy.URL != "" {
+		dial, err := newProxyDialer(config.Proxy)
+		if err != nil {
+			logger.Log.Error("error while creating proxy dialer, err: %v", err)
+			return nil, err
+		}
+
+		fasthttpClient.Dial = dial
+	}
+
 	return &httpClient{
 		config:     config,
-		httpClient: &fasthttp.Client{},
+		httpClient: fasthttpClient,
 		client:     client,
-	}
+	}, nil
 }
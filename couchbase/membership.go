@@ -81,7 +81,17 @@ func (h *cbMembership) register() {
 
 	payload, _ := jsoniter.Marshal(instance)
 
-	err = UpdateDocument(ctx, h.client.GetMetaAgent(), h.scopeName, h.collectionName, h.id, payload, h.membershipConfig.ExpirySeconds, nil)
+	err = UpdateDocument(
+		ctx,
+		h.client.GetMetaAgent(),
+		h.scopeName,
+		h.collectionName,
+		h.id,
+		payload,
+		h.membershipConfig.ExpirySeconds,
+		nil,
+		Durability{},
+	)
 
 	var kvErr *gocbcore.KeyValueError
 	if err != nil && errors.As(err, &kvErr) && kvErr.StatusCode == memd.StatusKeyNotFound {
@@ -94,10 +104,21 @@ func (h *cbMembership) register() {
 			payload,
 			helpers.JSONFlags,
 			h.membershipConfig.ExpirySeconds,
+			Durability{},
 		)
 
 		if err == nil {
-			err = UpdateDocument(ctx, h.client.GetMetaAgent(), h.scopeName, h.collectionName, h.id, payload, h.membershipConfig.ExpirySeconds, nil)
+			err = UpdateDocument(
+				ctx,
+				h.client.GetMetaAgent(),
+				h.scopeName,
+				h.collectionName,
+				h.id,
+				payload,
+				h.membershipConfig.ExpirySeconds,
+				nil,
+				Durability{},
+			)
 		}
 	}
 
@@ -139,7 +160,17 @@ func (h *cbMembership) heartbeat() {
 
 	payload, _ := jsoniter.Marshal(instance)
 
-	err := UpdateDocument(ctx, h.client.GetMetaAgent(), h.scopeName, h.collectionName, h.id, payload, h.membershipConfig.ExpirySeconds, nil)
+	err := UpdateDocument(
+		ctx,
+		h.client.GetMetaAgent(),
+		h.scopeName,
+		h.collectionName,
+		h.id,
+		payload,
+		h.membershipConfig.ExpirySeconds,
+		nil,
+		Durability{},
+	)
 	if err != nil {
 		logger.Log.Error("error while heartbeat: %v", err)
 		return
@@ -207,7 +238,7 @@ func (h *cbMembership) monitor() {
 			if h.isAlive(instance.HeartbeatTime) {
 				instances[i] = instance
 			} else {
-				logger.Log.Info("instance %v is not alive", instance.ID)
+				logger.Log.Debug("instance %v is not alive", instance.ID)
 			}
 		}(i, id)
 	}
@@ -244,7 +275,7 @@ func (h *cbMembership) updateIndex(ctx context.Context, instances []Instance, ca
 
 	payload, _ := jsoniter.Marshal(all)
 
-	err := UpdateDocument(ctx, h.client.GetMetaAgent(), h.scopeName, h.collectionName, h.instanceAll, payload, 0, &cas)
+	err := UpdateDocument(ctx, h.client.GetMetaAgent(), h.scopeName, h.collectionName, h.instanceAll, payload, 0, &cas, Durability{})
 	if err != nil {
 		return err
 	}
@@ -327,8 +358,8 @@ func NewCBMembership(config *config.Dcp, client Client, bus EventBus.Bus) member
 	cbm := &cbMembership{
 		infoChan:         make(chan *membership.Model),
 		client:           client,
-		id:               []byte(helpers.Prefix + config.Dcp.Group.Name + ":" + _type + ":" + uuid.New().String()),
-		instanceAll:      []byte(helpers.Prefix + config.Dcp.Group.Name + ":" + _type + ":all"),
+		id:               []byte(config.Metadata.Prefix + config.Dcp.Group.Name + ":" + _type + ":" + uuid.New().String()),
+		instanceAll:      []byte(config.Metadata.Prefix + config.Dcp.Group.Name + ":" + _type + ":all"),
 		bus:              bus,
 		scopeName:        couchbaseMetadataConfig.Scope,
 		collectionName:   couchbaseMetadataConfig.Collection,
@@ -1,10 +1,12 @@
 package couchbase
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"errors"
-	"strconv"
-	"strings"
+	"fmt"
+	"io"
 	"sync"
 
 	"github.com/couchbase/gocbcore/v10"
@@ -25,11 +27,73 @@ import (
 	"github.com/couchbase/gocbcore/v10/memd"
 )
 
+// checkpointCompressionMagic starts the gzipped checkpoints. Xattrs must be json, so they are written to the body
+// of the document instead, and the magic tells them apart from the json bodies.
+var checkpointCompressionMagic = []byte{0x00, 'g', 'z'}
+
+var errCheckpointNotFound = errors.New("checkpoint not found in the document")
+
+// encodeCheckpoint gzips the checkpoint when compression is enabled and the result is smaller than the json, it
+// reports whether the payload is compressed.
+func encodeCheckpoint(checkpointDocument *models.CheckpointDocument, compression bool) ([]byte, bool, error) {
+	payload, err := jsoniter.Marshal(checkpointDocument)
+	if err != nil || !compression {
+		return payload, false, err
+	}
+
+	buf := bytes.NewBuffer(append([]byte{}, checkpointCompressionMagic...))
+
+	writer, _ := gzip.NewWriterLevel(buf, gzip.BestCompression)
+	if _, err = writer.Write(payload); err != nil {
+		return nil, false, err
+	}
+
+	if err = writer.Close(); err != nil {
+		return nil, false, err
+	}
+
+	if buf.Len() >= len(payload) {
+		return payload, false, nil
+	}
+
+	return buf.Bytes(), true, nil
+}
+
+// decodeCheckpoint loads the checkpoint from the xattr, or from the body when the last write was compressed. Both
+// are read regardless of the compression config, so it can be toggled on running groups.
+func decodeCheckpoint(xattr []byte, body []byte) (*models.CheckpointDocument, error) {
+	var doc *models.CheckpointDocument
+
+	if len(xattr) > 0 && !bytes.Equal(xattr, []byte("null")) {
+		err := jsoniter.Unmarshal(xattr, &doc)
+		return doc, err
+	}
+
+	if !bytes.HasPrefix(body, checkpointCompressionMagic) {
+		return nil, errCheckpointNotFound
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(body[len(checkpointCompressionMagic):]))
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	err = jsoniter.Unmarshal(payload, &doc)
+	return doc, err
+}
+
 type cbMetadata struct {
-	client         Client
-	config         *config.Dcp
-	scopeName      string
-	collectionName string
+	client          Client
+	config          *config.Dcp
+	scopeName       string
+	collectionName  string
+	durability      Durability
+	saveConcurrency int
 }
 
 func (s *cbMetadata) Save(state map[uint16]*models.CheckpointDocument, dirtyOffsets map[uint16]bool, _ string) error {
@@ -37,6 +101,7 @@ func (s *cbMetadata) Save(state map[uint16]*models.CheckpointDocument, dirtyOffs
 	defer cancel()
 
 	eg, ctx := errgroup.WithContext(ctx)
+	eg.SetLimit(s.saveConcurrency)
 
 	for vbID := range state {
 		if dirtyOffsets[vbID] {
@@ -48,19 +113,17 @@ func (s *cbMetadata) Save(state map[uint16]*models.CheckpointDocument, dirtyOffs
 
 func (s *cbMetadata) saveVBucketCheckpoint(ctx context.Context, vbID uint16, checkpointDocument *models.CheckpointDocument) func() error {
 	return func() error {
-		id := getCheckpointID(vbID, s.config.Dcp.Group.Name)
-		payload, _ := jsoniter.Marshal(checkpointDocument)
-		err := UpsertXattrs(ctx, s.client.GetMetaAgent(), s.scopeName, s.collectionName, id, helpers.Name, payload, 0)
-
-		var kvErr *gocbcore.KeyValueError
-		if err != nil && errors.As(err, &kvErr) && kvErr.StatusCode == memd.StatusKeyNotFound {
-			err = CreateDocument(ctx, s.client.GetMetaAgent(), s.scopeName, s.collectionName, id, []byte{}, helpers.JSONFlags, 0)
+		id := metadata.GetCheckpointID(vbID, s.config.Dcp.Group.Name, s.config.Metadata.Prefix)
+		payload, compressed, err := encodeCheckpoint(checkpointDocument, s.config.Metadata.Compression)
+		if err != nil {
+			return err
+		}
 
-			if err == nil {
-				err = UpsertXattrs(ctx, s.client.GetMetaAgent(), s.scopeName, s.collectionName, id, helpers.Name, payload, 0)
-			}
+		if compressed {
+			return UpsertDocumentBody(ctx, s.client.GetMetaAgent(), s.scopeName, s.collectionName, id, helpers.Name, payload, 0, s.durability)
 		}
-		return err
+
+		return UpsertDocumentXattrs(ctx, s.client.GetMetaAgent(), s.scopeName, s.collectionName, id, helpers.Name, payload, 0, s.durability)
 	}
 }
 
@@ -75,20 +138,25 @@ func (s *cbMetadata) Load(
 
 	exist := false
 
+	var loadErr error
+	var loadErrOnce sync.Once
+
 	for _, vbID := range vbIds {
 		go func(vbID uint16) {
 			var err error
 
-			id := getCheckpointID(vbID, s.config.Dcp.Group.Name)
+			id := metadata.GetCheckpointID(vbID, s.config.Dcp.Group.Name, s.config.Metadata.Prefix)
 
-			data, err := GetXattrs(context.Background(), s.client.GetMetaAgent(), s.scopeName, s.collectionName, id, helpers.Name)
+			xattr, body, err := GetXattrsAndDocument(
+				context.Background(), s.client.GetMetaAgent(), s.scopeName, s.collectionName, id, helpers.Name,
+			)
 
 			var doc *models.CheckpointDocument
 
 			if err == nil {
-				err = jsoniter.Unmarshal(data, &doc)
+				doc, err = decodeCheckpoint(xattr, body)
 
-				if err != nil {
+				if err != nil || doc == nil {
 					doc = models.NewEmptyCheckpointDocument(bucketUUID)
 					logger.Log.Warn("corrupted checkpoint, vbID: %d, key: %v, err: %v", vbID, id, err)
 					err = nil
@@ -104,7 +172,9 @@ func (s *cbMetadata) Load(
 				state.Store(vbID, doc)
 			} else {
 				logger.Log.Error("error while load checkpoint, vbID: %d, err: %v", vbID, err)
-				panic(err)
+				loadErrOnce.Do(func() {
+					loadErr = err
+				})
 			}
 
 			wg.Done()
@@ -113,6 +183,10 @@ func (s *cbMetadata) Load(
 
 	wg.Wait()
 
+	if loadErr != nil {
+		return nil, false, loadErr
+	}
+
 	return state, exist, nil
 }
 
@@ -121,7 +195,7 @@ func (s *cbMetadata) Clear(vbIds []uint16) error {
 	defer cancel()
 
 	for _, vbID := range vbIds {
-		id := getCheckpointID(vbID, s.config.Dcp.Group.Name)
+		id := metadata.GetCheckpointID(vbID, s.config.Dcp.Group.Name, s.config.Metadata.Prefix)
 
 		err := DeleteDocument(ctx, s.client.GetMetaAgent(), s.scopeName, s.collectionName, id)
 		if err != nil {
@@ -141,20 +215,36 @@ func NewCBMetadata(client Client, config *config.Dcp) metadata.Metadata {
 
 	couchbaseMetadataConfig := config.GetCouchbaseMetadata()
 
+	durabilityLevel, err := resolveDurabilityLevel(couchbaseMetadataConfig.DurabilityLevel)
+	if err != nil {
+		logger.Log.Error("error while initialize couchbase metadata, err: %v", err)
+		panic(err)
+	}
+
 	return &cbMetadata{
-		client:         client,
-		config:         config,
-		scopeName:      couchbaseMetadataConfig.Scope,
-		collectionName: couchbaseMetadataConfig.Collection,
+		client:          client,
+		config:          config,
+		scopeName:       couchbaseMetadataConfig.Scope,
+		collectionName:  couchbaseMetadataConfig.Collection,
+		saveConcurrency: couchbaseMetadataConfig.SaveConcurrency,
+		durability: Durability{
+			Level:   durabilityLevel,
+			Timeout: couchbaseMetadataConfig.DurabilityTimeout,
+		},
 	}
 }
 
-func getCheckpointID(vbID uint16, groupName string) []byte {
-	// _connector:cbgo:groupName:stdout-listener:checkpoint:vbId
-	if strings.Contains(groupName, ".") {
-		err := errors.New("unsupported group name includes dot")
-		logger.Log.Error("error while get checkpoint id, err: %v", err)
-		panic(err)
+func resolveDurabilityLevel(level string) (memd.DurabilityLevel, error) {
+	switch level {
+	case config.DurabilityLevelNone:
+		return 0, nil
+	case config.DurabilityLevelMajority:
+		return memd.DurabilityLevelMajority, nil
+	case config.DurabilityLevelMajorityAndPersistOnMaster:
+		return memd.DurabilityLevelMajorityAndPersistOnMaster, nil
+	case config.DurabilityLevelPersistToMajority:
+		return memd.DurabilityLevelPersistToMajority, nil
+	default:
+		return 0, fmt.Errorf("unsupported metadata durability level: %v", level)
 	}
-	return []byte(helpers.Prefix + groupName + ":checkpoint:" + strconv.Itoa(int(vbID)))
 }
@@ -1,24 +1,102 @@
 package couchbase
 
 import (
-	"bytes"
+	"errors"
 	"testing"
+
+	"github.com/Trendyol/go-dcp/config"
+	"github.com/Trendyol/go-dcp/models"
+	"github.com/couchbase/gocbcore/v10/memd"
 )
 
-func TestGetCheckpointID(t *testing.T) {
-	expected := []byte("_connector:cbgo:group1:checkpoint:1")
-	actual := getCheckpointID(uint16(1), "group1")
-	if !bytes.Equal(actual, expected) {
-		t.Errorf("Unexpected result. Expected: %s, Got: %s", expected, actual)
+func TestResolveDurabilityLevel(t *testing.T) {
+	levels := map[string]memd.DurabilityLevel{
+		config.DurabilityLevelNone:                       0,
+		config.DurabilityLevelMajority:                   memd.DurabilityLevelMajority,
+		config.DurabilityLevelMajorityAndPersistOnMaster: memd.DurabilityLevelMajorityAndPersistOnMaster,
+		config.DurabilityLevelPersistToMajority:          memd.DurabilityLevelPersistToMajority,
+	}
+
+	for name, expected := range levels {
+		if actual, err := resolveDurabilityLevel(name); err != nil || actual != expected {
+			t.Errorf("Unexpected result for %v. Expected: %v, Got: %v, err: %v", name, expected, actual, err)
+		}
+	}
+
+	if _, err := resolveDurabilityLevel("all"); err == nil {
+		t.Errorf("Expected error for unsupported durability level")
 	}
 }
 
-func TestGetCheckpointIDWithInvalidGroupName(t *testing.T) {
-	defer func() {
-		if r := recover(); r == nil {
-			t.Errorf("Expected panic but did not occur")
+func TestCheckpointCompressionRoundTrip(t *testing.T) {
+	docs := []*models.CheckpointDocument{
+		{
+			Checkpoint: &models.CheckpointDocumentCheckpoint{
+				Snapshot: &models.CheckpointDocumentSnapshot{StartSeqNo: 18446744073709551000, EndSeqNo: 18446744073709551000},
+				VbUUID:   18446744073709551000,
+				SeqNo:    18446744073709551000,
+			},
+			BucketUUID: "0a3b7e5d1c9f4e2a8b6d0c4f2e1a9b7d",
+			Owner:      "connector-group-member-1",
+		},
+		{
+			Checkpoint: &models.CheckpointDocumentCheckpoint{
+				Snapshot: &models.CheckpointDocumentSnapshot{StartSeqNo: 30, EndSeqNo: 40},
+				VbUUID:   456,
+				SeqNo:    35,
+			},
+			BucketUUID: "0a3b7e5d1c9f4e2a8b6d0c4f2e1a9b7d",
+		},
+	}
+
+	// the document is written by the members one after the other, with and without compression
+	var xattr, body []byte
+
+	for i, compression := range []bool{false, true, false, true, true} {
+		expected := docs[i%len(docs)]
+
+		payload, compressed, err := encodeCheckpoint(expected, compression)
+		if err != nil {
+			t.Fatalf("Unexpected error while encoding, compression: %v, err: %v", compression, err)
+		}
+
+		if compressed != compression {
+			t.Errorf("Unexpected result. got %v want %v", compressed, compression)
+		}
+
+		if compressed {
+			xattr, body = []byte("null"), payload
+		} else {
+			xattr = payload
+		}
+
+		actual, err := decodeCheckpoint(xattr, body)
+		if err != nil {
+			t.Fatalf("Unexpected error while decoding, compression: %v, err: %v", compression, err)
 		}
-	}()
 
-	getCheckpointID(uint16(1), "group.with.dot")
+		if actual.BucketUUID != expected.BucketUUID || actual.Owner != expected.Owner ||
+			*actual.Checkpoint.Snapshot != *expected.Checkpoint.Snapshot ||
+			actual.Checkpoint.SeqNo != expected.Checkpoint.SeqNo || actual.Checkpoint.VbUUID != expected.Checkpoint.VbUUID {
+			t.Errorf("Unexpected result. got %+v want %+v", actual.Checkpoint, expected.Checkpoint)
+		}
+	}
+
+	// checkpoints written before the option existed have a json body
+	if _, err := decodeCheckpoint(nil, []byte("{}")); !errors.Is(err, errCheckpointNotFound) {
+		t.Errorf("Unexpected error. got %v want %v", err, errCheckpointNotFound)
+	}
+}
+
+func TestCheckpointCompressionKeepsSmallerPayload(t *testing.T) {
+	doc := &models.CheckpointDocument{BucketUUID: "uuid"}
+
+	payload, compressed, err := encodeCheckpoint(doc, true)
+	if err != nil || compressed {
+		t.Fatalf("Unexpected result. got %v, err: %v want uncompressed", compressed, err)
+	}
+
+	if actual, err := decodeCheckpoint(payload, nil); err != nil || actual.BucketUUID != doc.BucketUUID {
+		t.Errorf("Unexpected result. got %+v, err: %v", actual, err)
+	}
 }
@@ -1,6 +1,9 @@
 package couchbase
 
 import (
+	"errors"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/asaskevich/EventBus"
@@ -15,8 +18,11 @@ import (
 	"github.com/Trendyol/go-dcp/models"
 
 	"github.com/couchbase/gocbcore/v10"
+	"github.com/couchbase/gocbcore/v10/memd"
 )
 
+// Observer forwards the events of a vbucket to a single listener channel in the order gocbcore
+// delivers them, so system events and data events stay in seqNo order.
 type Observer interface {
 	SnapshotMarker(marker models.DcpSnapshotMarker)
 	Mutation(mutation gocbcore.DcpMutation)
@@ -31,6 +37,7 @@ type Observer interface {
 	ModifyCollection(modification gocbcore.DcpCollectionModification)
 	OSOSnapshot(snapshot models.DcpOSOSnapshot)
 	SeqNoAdvanced(advanced gocbcore.DcpSeqNoAdvanced)
+	Heartbeat(now time.Time)
 	GetMetrics() *wrapper.ConcurrentSwissMap[uint16, *ObserverMetric]
 	GetPersistSeqNo() *wrapper.ConcurrentSwissMap[uint16, gocbcore.SeqNo]
 	Listen() models.ListenerCh
@@ -39,9 +46,50 @@ type Observer interface {
 	ListenEnd() models.ListenerEndCh
 	AddCatchup(vbID uint16, seqNo gocbcore.SeqNo)
 	SetVbUUID(vbID uint16, vbUUID gocbcore.VbUUID)
+	SetStreamState(vbID uint16, state StreamState)
+	CountStreamStates() map[StreamState]int
+	Pause()
+	Resume()
+}
+
+var streamEndStatuses = []struct {
+	err    error
+	status models.StreamEndStatus
+}{
+	{gocbcore.ErrDCPStreamClosed, memd.StreamEndClosed},
+	{gocbcore.ErrDCPStreamStateChanged, memd.StreamEndStateChanged},
+	{gocbcore.ErrDCPStreamDisconnected, memd.StreamEndDisconnected},
+	{gocbcore.ErrDCPStreamTooSlow, memd.StreamEndTooSlow},
+	{gocbcore.ErrDCPBackfillFailed, memd.StreamEndBackfillFailed},
+	{gocbcore.ErrDCPStreamFilterEmpty, memd.StreamEndFilterEmpty},
+	{gocbcore.ErrSocketClosed, memd.StreamEndDisconnected},
+}
+
+// streamEndStatus maps the error gocbcore ends a stream with back to its stream end status,
+// a closed socket is reported as a disconnect since the server had no chance to send one.
+func streamEndStatus(err error) models.StreamEndStatus {
+	if err == nil {
+		return memd.StreamEndOK
+	}
+
+	for _, entry := range streamEndStatuses {
+		if errors.Is(err, entry.err) {
+			return entry.status
+		}
+	}
+
+	return models.StreamEndUnknown
 }
 
-const DefaultCollectionName = "_default"
+const (
+	DefaultScopeName      = "_default"
+	DefaultCollectionName = "_default"
+)
+
+type collectionInfo struct {
+	scopeName      string
+	collectionName string
+}
 
 type ObserverMetric struct {
 	TotalMutations   float64
@@ -65,14 +113,19 @@ type observer struct {
 	bus                    EventBus.Bus
 	metrics                *wrapper.ConcurrentSwissMap[uint16, *ObserverMetric]
 	listenerEndCh          models.ListenerEndCh
-	collectionIDs          map[uint32]string
+	collections            *wrapper.ConcurrentSwissMap[uint32, *collectionInfo]
+	scopes                 *wrapper.ConcurrentSwissMap[uint32, string]
 	catchup                *wrapper.ConcurrentSwissMap[uint16, uint64]
 	currentSnapshots       *wrapper.ConcurrentSwissMap[uint16, *models.SnapshotMarker]
 	listenerCh             models.ListenerCh
 	persistSeqNo           *wrapper.ConcurrentSwissMap[uint16, gocbcore.SeqNo]
 	uuIDMap                *wrapper.ConcurrentSwissMap[uint16, gocbcore.VbUUID]
 	config                 *dcp.Dcp
+	resumeCh               chan struct{}
+	streamStates           map[uint16]StreamState
 	catchupNeededVbIDCount int
+	streamStatesLock       sync.Mutex
+	flowControlLock        sync.Mutex
 	closed                 bool
 }
 
@@ -109,7 +162,7 @@ func (so *observer) needCatchup(vbID uint16, seqNo uint64) bool {
 			so.catchup.Delete(vbID)
 			so.catchupNeededVbIDCount--
 
-			logger.Log.Info("catchup completed for vbID: %d, remaining catchup: %d", vbID, so.catchupNeededVbIDCount)
+			logger.Infow("catchup completed", "vbID", vbID, "seqNo", seqNo, "remainingCatchup", so.catchupNeededVbIDCount)
 
 			return seqNo == catchupSeqNo
 		}
@@ -138,12 +191,46 @@ func (so *observer) canForward(vbID uint16, seqNo uint64) bool {
 	return !so.needCatchup(vbID, seqNo)
 }
 
-func (so *observer) convertToCollectionName(collectionID uint32) string {
-	if name, ok := so.collectionIDs[collectionID]; ok {
+func (so *observer) resolveCollection(collectionID uint32) *collectionInfo {
+	if info, ok := so.collections.Load(collectionID); ok {
+		return info
+	}
+
+	if collectionID == 0 {
+		return &collectionInfo{
+			scopeName:      DefaultScopeName,
+			collectionName: DefaultCollectionName,
+		}
+	}
+
+	// collection is not in the manifest resolved at startup, fallback to numeric id
+	return &collectionInfo{
+		collectionName: strconv.FormatUint(uint64(collectionID), 10),
+	}
+}
+
+func (so *observer) resolveScopeName(scopeID uint32) string {
+	if name, ok := so.scopes.Load(scopeID); ok {
 		return name
 	}
 
-	return DefaultCollectionName
+	if scopeID == 0 {
+		return DefaultScopeName
+	}
+
+	return strconv.FormatUint(uint64(scopeID), 10)
+}
+
+// waitFlowControl holds the gocbcore callback while the observer is paused, so buffered events
+// can drain and the server stops sending once the dcp buffer is not acknowledged.
+func (so *observer) waitFlowControl() {
+	so.flowControlLock.Lock()
+	resumeCh := so.resumeCh
+	so.flowControlLock.Unlock()
+
+	if resumeCh != nil {
+		<-resumeCh
+	}
 }
 
 // nolint:staticcheck
@@ -154,6 +241,8 @@ func (so *observer) sendOrSkip(args models.ListenerArgs) {
 		}
 	}()
 
+	so.waitFlowControl()
+
 	so.listenerCh <- args
 }
 
@@ -175,6 +264,7 @@ func (so *observer) Mutation(mutation gocbcore.DcpMutation) { //nolint:dupl
 
 	if currentSnapshot, ok := so.currentSnapshots.Load(mutation.VbID); ok && currentSnapshot != nil {
 		vbUUID, _ := so.uuIDMap.Load(mutation.VbID)
+		collection := so.resolveCollection(mutation.CollectionID)
 
 		so.sendOrSkip(models.ListenerArgs{
 			Event: models.InternalDcpMutation{
@@ -184,7 +274,8 @@ func (so *observer) Mutation(mutation gocbcore.DcpMutation) { //nolint:dupl
 					VbUUID:         vbUUID,
 					SeqNo:          mutation.SeqNo,
 				},
-				CollectionName: so.convertToCollectionName(mutation.CollectionID),
+				CollectionName: collection.collectionName,
+				ScopeName:      collection.scopeName,
 				EventTime:      time.Unix(int64(mutation.Cas/1000000000), 0),
 			},
 		})
@@ -206,6 +297,7 @@ func (so *observer) Deletion(deletion gocbcore.DcpDeletion) { //nolint:dupl
 
 	if currentSnapshot, ok := so.currentSnapshots.Load(deletion.VbID); ok && currentSnapshot != nil {
 		vbUUID, _ := so.uuIDMap.Load(deletion.VbID)
+		collection := so.resolveCollection(deletion.CollectionID)
 
 		so.sendOrSkip(models.ListenerArgs{
 			Event: models.InternalDcpDeletion{
@@ -215,7 +307,8 @@ func (so *observer) Deletion(deletion gocbcore.DcpDeletion) { //nolint:dupl
 					VbUUID:         vbUUID,
 					SeqNo:          deletion.SeqNo,
 				},
-				CollectionName: so.convertToCollectionName(deletion.CollectionID),
+				CollectionName: collection.collectionName,
+				ScopeName:      collection.scopeName,
 				EventTime:      time.Unix(int64(deletion.Cas/1000000000), 0),
 			},
 		})
@@ -237,6 +330,7 @@ func (so *observer) Expiration(expiration gocbcore.DcpExpiration) { //nolint:dup
 
 	if currentSnapshot, ok := so.currentSnapshots.Load(expiration.VbID); ok && currentSnapshot != nil {
 		vbUUID, _ := so.uuIDMap.Load(expiration.VbID)
+		collection := so.resolveCollection(expiration.CollectionID)
 
 		so.sendOrSkip(models.ListenerArgs{
 			Event: models.InternalDcpExpiration{
@@ -246,7 +340,8 @@ func (so *observer) Expiration(expiration gocbcore.DcpExpiration) { //nolint:dup
 					VbUUID:         vbUUID,
 					SeqNo:          expiration.SeqNo,
 				},
-				CollectionName: so.convertToCollectionName(expiration.CollectionID),
+				CollectionName: collection.collectionName,
+				ScopeName:      collection.scopeName,
 				EventTime:      time.Unix(int64(expiration.Cas/1000000000), 0),
 			},
 		})
@@ -269,19 +364,28 @@ func (so *observer) End(event models.DcpStreamEnd, err error) {
 		}
 	}()
 
+	so.SetStreamState(event.VbID, StreamStateClosed)
+
 	so.listenerEndCh <- models.DcpStreamEndContext{
-		Event: event,
-		Err:   err,
+		Event:  event,
+		Err:    err,
+		Status: streamEndStatus(err),
 	}
 }
 
 func (so *observer) CreateCollection(event gocbcore.DcpCollectionCreation) {
+	so.collections.Store(event.CollectionID, &collectionInfo{
+		scopeName:      so.resolveScopeName(event.ScopeID),
+		collectionName: string(event.Key),
+	})
+
 	if !so.canForward(event.VbID, event.SeqNo) {
 		return
 	}
 
 	if currentSnapshot, ok := so.currentSnapshots.Load(event.VbID); ok && currentSnapshot != nil {
 		vbUUID, _ := so.uuIDMap.Load(event.VbID)
+		collection := so.resolveCollection(event.CollectionID)
 
 		so.sendOrSkip(models.ListenerArgs{
 			Event: models.InternalDcpCollectionCreation{
@@ -291,7 +395,8 @@ func (so *observer) CreateCollection(event gocbcore.DcpCollectionCreation) {
 					VbUUID:         vbUUID,
 					SeqNo:          event.SeqNo,
 				},
-				CollectionName: so.convertToCollectionName(event.CollectionID),
+				CollectionName: collection.collectionName,
+				ScopeName:      collection.scopeName,
 			},
 		})
 	}
@@ -304,6 +409,7 @@ func (so *observer) DeleteCollection(event gocbcore.DcpCollectionDeletion) {
 
 	if currentSnapshot, ok := so.currentSnapshots.Load(event.VbID); ok && currentSnapshot != nil {
 		vbUUID, _ := so.uuIDMap.Load(event.VbID)
+		collection := so.resolveCollection(event.CollectionID)
 
 		so.sendOrSkip(models.ListenerArgs{
 			Event: models.InternalDcpCollectionDeletion{
@@ -313,7 +419,8 @@ func (so *observer) DeleteCollection(event gocbcore.DcpCollectionDeletion) {
 					VbUUID:         vbUUID,
 					SeqNo:          event.SeqNo,
 				},
-				CollectionName: so.convertToCollectionName(event.CollectionID),
+				CollectionName: collection.collectionName,
+				ScopeName:      collection.scopeName,
 			},
 		})
 	}
@@ -326,6 +433,7 @@ func (so *observer) FlushCollection(event gocbcore.DcpCollectionFlush) {
 
 	if currentSnapshot, ok := so.currentSnapshots.Load(event.VbID); ok && currentSnapshot != nil {
 		vbUUID, _ := so.uuIDMap.Load(event.VbID)
+		collection := so.resolveCollection(event.CollectionID)
 
 		so.sendOrSkip(models.ListenerArgs{
 			Event: models.InternalDcpCollectionFlush{
@@ -335,13 +443,16 @@ func (so *observer) FlushCollection(event gocbcore.DcpCollectionFlush) {
 					VbUUID:         vbUUID,
 					SeqNo:          event.SeqNo,
 				},
-				CollectionName: so.convertToCollectionName(event.CollectionID),
+				CollectionName: collection.collectionName,
+				ScopeName:      collection.scopeName,
 			},
 		})
 	}
 }
 
 func (so *observer) CreateScope(event gocbcore.DcpScopeCreation) {
+	so.scopes.Store(event.ScopeID, string(event.Key))
+
 	if !so.canForward(event.VbID, event.SeqNo) {
 		return
 	}
@@ -357,6 +468,7 @@ func (so *observer) CreateScope(event gocbcore.DcpScopeCreation) {
 					VbUUID:         vbUUID,
 					SeqNo:          event.SeqNo,
 				},
+				ScopeName: so.resolveScopeName(event.ScopeID),
 			},
 		})
 	}
@@ -378,6 +490,7 @@ func (so *observer) DeleteScope(event gocbcore.DcpScopeDeletion) {
 					VbUUID:         vbUUID,
 					SeqNo:          event.SeqNo,
 				},
+				ScopeName: so.resolveScopeName(event.ScopeID),
 			},
 		})
 	}
@@ -390,6 +503,7 @@ func (so *observer) ModifyCollection(event gocbcore.DcpCollectionModification) {
 
 	if currentSnapshot, ok := so.currentSnapshots.Load(event.VbID); ok && currentSnapshot != nil {
 		vbUUID, _ := so.uuIDMap.Load(event.VbID)
+		collection := so.resolveCollection(event.CollectionID)
 
 		so.sendOrSkip(models.ListenerArgs{
 			Event: models.InternalDcpCollectionModification{
@@ -399,7 +513,8 @@ func (so *observer) ModifyCollection(event gocbcore.DcpCollectionModification) {
 					VbUUID:         vbUUID,
 					SeqNo:          event.SeqNo,
 				},
-				CollectionName: so.convertToCollectionName(event.CollectionID),
+				CollectionName: collection.collectionName,
+				ScopeName:      collection.scopeName,
 			},
 		})
 	}
@@ -437,6 +552,14 @@ func (so *observer) SeqNoAdvanced(advanced gocbcore.DcpSeqNoAdvanced) {
 	})
 }
 
+func (so *observer) Heartbeat(now time.Time) {
+	so.sendOrSkip(models.ListenerArgs{
+		Event: models.Heartbeat{
+			EventTime: now,
+		},
+	})
+}
+
 func (so *observer) GetMetrics() *wrapper.ConcurrentSwissMap[uint16, *ObserverMetric] {
 	return so.metrics
 }
@@ -468,7 +591,11 @@ func (so *observer) Close() {
 		logger.Log.Error("error while unsubscribe: %v", err)
 	}
 
+	so.flowControlLock.Lock()
 	so.closed = true
+	so.releaseFlowControl()
+	so.flowControlLock.Unlock()
+
 	close(so.listenerCh)
 
 	// to drain buffered channel
@@ -479,6 +606,34 @@ func (so *observer) Close() {
 	logger.Log.Debug("observer closed")
 }
 
+func (so *observer) Pause() {
+	so.flowControlLock.Lock()
+	defer so.flowControlLock.Unlock()
+
+	if so.resumeCh == nil && !so.closed {
+		so.resumeCh = make(chan struct{})
+	}
+
+	logger.Log.Debug("observer paused")
+}
+
+func (so *observer) Resume() {
+	so.flowControlLock.Lock()
+	defer so.flowControlLock.Unlock()
+
+	so.releaseFlowControl()
+
+	logger.Log.Debug("observer resumed")
+}
+
+// releaseFlowControl wakes up the callbacks waiting in waitFlowControl, flowControlLock must be held.
+func (so *observer) releaseFlowControl() {
+	if so.resumeCh != nil {
+		close(so.resumeCh)
+		so.resumeCh = nil
+	}
+}
+
 func (so *observer) SetVbUUID(vbID uint16, vbUUID gocbcore.VbUUID) {
 	so.uuIDMap.Store(vbID, vbUUID)
 }
@@ -499,17 +654,27 @@ func NewObserver(
 	collectionIDs map[uint32]string,
 	bus EventBus.Bus,
 ) Observer {
+	collections := wrapper.CreateConcurrentSwissMap[uint32, *collectionInfo](uint64(len(collectionIDs)))
+	for collectionID, collectionName := range collectionIDs {
+		collections.Store(collectionID, &collectionInfo{
+			scopeName:      config.ScopeName,
+			collectionName: collectionName,
+		})
+	}
+
 	observer := &observer{
 		currentSnapshots: wrapper.CreateConcurrentSwissMap[uint16, *models.SnapshotMarker](1024),
 		uuIDMap:          wrapper.CreateConcurrentSwissMap[uint16, gocbcore.VbUUID](100),
 		metrics:          wrapper.CreateConcurrentSwissMap[uint16, *ObserverMetric](100),
 		catchup:          wrapper.CreateConcurrentSwissMap[uint16, uint64](100),
-		collectionIDs:    collectionIDs,
+		collections:      collections,
+		scopes:           wrapper.CreateConcurrentSwissMap[uint32, string](10),
 		listenerCh:       make(models.ListenerCh, config.Dcp.Listener.BufferSize),
 		listenerEndCh:    make(models.ListenerEndCh, 1),
 		bus:              bus,
 		persistSeqNo:     wrapper.CreateConcurrentSwissMap[uint16, gocbcore.SeqNo](100),
 		config:           config,
+		streamStates:     map[uint16]StreamState{},
 	}
 
 	err := observer.bus.Subscribe(helpers.PersistSeqNoChangedBusEventName, observer.persistSeqNoChangedListener)
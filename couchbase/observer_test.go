@@ -0,0 +1,175 @@
+package couchbase
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/asaskevich/EventBus"
+	"github.com/couchbase/gocbcore/v10"
+	"github.com/couchbase/gocbcore/v10/memd"
+
+	"github.com/Trendyol/go-dcp/config"
+	"github.com/Trendyol/go-dcp/logger"
+	"github.com/Trendyol/go-dcp/models"
+)
+
+func TestObserver_DeliversSystemAndDataEventsInSeqNoOrder(t *testing.T) {
+	logger.InitDefaultLogger("error")
+
+	dcpConfig := &config.Dcp{
+		ScopeName:          DefaultScopeName,
+		RollbackMitigation: config.RollbackMitigation{Disabled: true},
+		Dcp:                config.ExternalDcp{Listener: config.DCPListener{BufferSize: 10}},
+	}
+
+	observer := NewObserver(dcpConfig, map[uint32]string{}, EventBus.New())
+
+	observer.SnapshotMarker(models.DcpSnapshotMarker{VbID: 1, StartSeqNo: 1, EndSeqNo: 4})
+	observer.CreateCollection(gocbcore.DcpCollectionCreation{VbID: 1, SeqNo: 2, CollectionID: 8, Key: []byte("orders")})
+	observer.Mutation(gocbcore.DcpMutation{VbID: 1, SeqNo: 3, CollectionID: 8, Key: []byte("order-1")})
+	observer.Deletion(gocbcore.DcpDeletion{VbID: 1, SeqNo: 4, CollectionID: 8, Key: []byte("order-1")})
+
+	events := make([]interface{}, 0, 4)
+	for i := 0; i < 4; i++ {
+		events = append(events, (<-observer.Listen()).Event)
+	}
+
+	if _, ok := events[0].(models.DcpSnapshotMarker); !ok {
+		t.Fatalf("Unexpected first event. got %T", events[0])
+	}
+
+	creation, ok := events[1].(models.DcpCollectionCreation)
+	if !ok || creation.SeqNo != 2 {
+		t.Fatalf("Unexpected second event. got %T", events[1])
+	}
+
+	mutation, ok := events[2].(models.DcpMutation)
+	if !ok || mutation.SeqNo != 3 {
+		t.Fatalf("Unexpected third event. got %T", events[2])
+	}
+
+	if mutation.CollectionName != "orders" {
+		t.Errorf("Unexpected collection name. got %v want %v", mutation.CollectionName, "orders")
+	}
+
+	deletion, ok := events[3].(models.DcpDeletion)
+	if !ok || deletion.SeqNo != 4 {
+		t.Fatalf("Unexpected fourth event. got %T", events[3])
+	}
+}
+
+func TestObserver_StreamEndStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want models.StreamEndStatus
+	}{
+		{nil, memd.StreamEndOK},
+		{gocbcore.ErrDCPStreamTooSlow, memd.StreamEndTooSlow},
+		{gocbcore.ErrDCPStreamStateChanged, memd.StreamEndStateChanged},
+		{gocbcore.ErrSocketClosed, memd.StreamEndDisconnected},
+		{errors.New("unexpected"), models.StreamEndUnknown},
+	}
+
+	for _, test := range tests {
+		if got := streamEndStatus(test.err); got != test.want {
+			t.Errorf("Unexpected status for %v. got %v want %v", test.err, got, test.want)
+		}
+	}
+}
+
+func TestObserver_CountStreamStates(t *testing.T) {
+	logger.InitDefaultLogger("error")
+
+	dcpConfig := &config.Dcp{
+		ScopeName:          DefaultScopeName,
+		RollbackMitigation: config.RollbackMitigation{Disabled: true},
+		Dcp:                config.ExternalDcp{Listener: config.DCPListener{BufferSize: 10}},
+	}
+
+	observer := NewObserver(dcpConfig, map[uint32]string{}, EventBus.New())
+
+	observer.SetStreamState(0, StreamStateOpening)
+	observer.SetStreamState(1, StreamStateOpening)
+	observer.SetStreamState(1, StreamStateRollingBack)
+	observer.SetStreamState(2, StreamStateOpening)
+	observer.SetStreamState(2, StreamStateOpen)
+
+	// the stream ends before its open request returns
+	observer.SetStreamState(3, StreamStateOpening)
+	observer.End(models.DcpStreamEnd{VbID: 3}, nil)
+	observer.SetStreamState(3, StreamStateOpen)
+
+	want := map[StreamState]int{StreamStateOpening: 1, StreamStateRollingBack: 1, StreamStateOpen: 1, StreamStateClosed: 1}
+	if got := observer.CountStreamStates(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected stream states. got %v want %v", got, want)
+	}
+}
+
+func TestObserver_PauseHoldsEventsUntilResume(t *testing.T) {
+	logger.InitDefaultLogger("error")
+
+	dcpConfig := &config.Dcp{
+		RollbackMitigation: config.RollbackMitigation{Disabled: true},
+		Dcp:                config.ExternalDcp{Listener: config.DCPListener{BufferSize: 10}},
+	}
+
+	observer := NewObserver(dcpConfig, map[uint32]string{}, EventBus.New())
+	observer.Pause()
+
+	sent := make(chan struct{})
+	go func() {
+		observer.SnapshotMarker(models.DcpSnapshotMarker{VbID: 1, StartSeqNo: 1, EndSeqNo: 2})
+		close(sent)
+	}()
+
+	select {
+	case <-sent:
+		t.Fatal("Unexpected event while the observer is paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	observer.Resume()
+
+	select {
+	case <-sent:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the event to be sent once the observer is resumed")
+	}
+
+	if _, ok := (<-observer.Listen()).Event.(models.DcpSnapshotMarker); !ok {
+		t.Fatal("Expected the snapshot marker on the listener channel")
+	}
+}
+
+func TestObserver_CloseReleasesPausedCallbacks(t *testing.T) {
+	logger.InitDefaultLogger("error")
+
+	dcpConfig := &config.Dcp{
+		RollbackMitigation: config.RollbackMitigation{Disabled: true},
+		Dcp:                config.ExternalDcp{Listener: config.DCPListener{BufferSize: 10}},
+	}
+
+	so := NewObserver(dcpConfig, map[uint32]string{}, EventBus.New()).(*observer)
+	so.Pause()
+
+	released := make(chan struct{})
+	go func() {
+		so.waitFlowControl()
+		close(released)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	so.Close()
+
+	select {
+	case <-released:
+	case <-time.After(time.Second):
+		t.Fatal("Expected close to release the paused callback")
+	}
+
+	// pausing a closed observer does not hold the callbacks again
+	so.Pause()
+	so.waitFlowControl()
+}
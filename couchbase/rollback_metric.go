@@ -0,0 +1,65 @@
+package couchbase
+
+import (
+	"sync"
+
+	"github.com/couchbase/gocbcore/v10"
+)
+
+// RollbackSeqNoDeltaBuckets are the upper bounds of the histogram of seqNos streamed again after a rollback.
+var RollbackSeqNoDeltaBuckets = []float64{1, 10, 100, 1000, 10000, 100000, 1000000}
+
+// RollbackMetric counts the rollbacks of the client, it is not reset when the dcp agent reconnects.
+type RollbackMetric struct {
+	rollbacks map[uint16]uint64
+	counts    []uint64
+	sum       float64
+	count     uint64
+	lock      sync.Mutex
+}
+
+func (m *RollbackMetric) observe(vbID uint16, failedSeqNo gocbcore.SeqNo, rollbackSeqNo gocbcore.SeqNo) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var delta float64
+	if failedSeqNo > rollbackSeqNo {
+		delta = float64(failedSeqNo - rollbackSeqNo)
+	}
+
+	for i, bound := range RollbackSeqNoDeltaBuckets {
+		if delta <= bound {
+			m.counts[i]++
+		}
+	}
+
+	m.rollbacks[vbID]++
+	m.sum += delta
+	m.count++
+}
+
+// Snapshot returns the rollback count per vbucket, the rollback count, the seqNo delta sum and
+// the cumulative bucket counts keyed by their upper bounds.
+func (m *RollbackMetric) Snapshot() (map[uint16]uint64, uint64, float64, map[float64]uint64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	rollbacks := make(map[uint16]uint64, len(m.rollbacks))
+	for vbID, count := range m.rollbacks {
+		rollbacks[vbID] = count
+	}
+
+	buckets := make(map[float64]uint64, len(RollbackSeqNoDeltaBuckets))
+	for i, bound := range RollbackSeqNoDeltaBuckets {
+		buckets[bound] = m.counts[i]
+	}
+
+	return rollbacks, m.count, m.sum, buckets
+}
+
+func NewRollbackMetric() *RollbackMetric {
+	return &RollbackMetric{
+		rollbacks: map[uint16]uint64{},
+		counts:    make([]uint64, len(RollbackSeqNoDeltaBuckets)),
+	}
+}
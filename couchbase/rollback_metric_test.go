@@ -0,0 +1,37 @@
+package couchbase
+
+import (
+	"testing"
+)
+
+func TestRollbackMetric_Snapshot(t *testing.T) {
+	m := NewRollbackMetric()
+
+	m.observe(1, 150, 100)
+	m.observe(1, 5000, 4000)
+	m.observe(2, 100, 100)
+	// a rollback point past the failed seqNo does not count a negative delta
+	m.observe(3, 10, 20)
+
+	rollbacks, count, sum, buckets := m.Snapshot()
+
+	if rollbacks[1] != 2 || rollbacks[2] != 1 || rollbacks[3] != 1 || count != 4 {
+		t.Errorf("Unexpected rollback counts. got %v, count %v", rollbacks, count)
+	}
+
+	if sum != 1050 {
+		t.Errorf("Unexpected delta sum. got %v want %v", sum, 1050)
+	}
+
+	expected := map[float64]uint64{1: 2, 10: 2, 100: 3, 1000: 4, 10000: 4, 100000: 4, 1000000: 4}
+	for bound, expectedCount := range expected {
+		if buckets[bound] != expectedCount {
+			t.Errorf("Unexpected count of bucket %v. got %v want %v", bound, buckets[bound], expectedCount)
+		}
+	}
+
+	rollbacks[1] = 10
+	if again, _, _, _ := m.Snapshot(); again[1] != 2 {
+		t.Errorf("Unexpected change of the metric through its snapshot. got %v", again[1])
+	}
+}
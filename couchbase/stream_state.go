@@ -0,0 +1,42 @@
+package couchbase
+
+type StreamState string
+
+const (
+	StreamStateOpening     StreamState = "opening"
+	StreamStateOpen        StreamState = "open"
+	StreamStateRollingBack StreamState = "rolling_back"
+	StreamStateClosed      StreamState = "closed"
+)
+
+var streamStates = []StreamState{StreamStateOpening, StreamStateOpen, StreamStateRollingBack, StreamStateClosed}
+
+// SetStreamState records the state of the vbucket stream, a stream that ended while its open request was
+// still pending stays closed.
+func (so *observer) SetStreamState(vbID uint16, state StreamState) {
+	so.streamStatesLock.Lock()
+	defer so.streamStatesLock.Unlock()
+
+	if state == StreamStateOpen && so.streamStates[vbID] == StreamStateClosed {
+		return
+	}
+
+	so.streamStates[vbID] = state
+}
+
+// CountStreamStates returns the number of vbucket streams in each state, states without streams are zero.
+func (so *observer) CountStreamStates() map[StreamState]int {
+	so.streamStatesLock.Lock()
+	defer so.streamStatesLock.Unlock()
+
+	counts := make(map[StreamState]int, len(streamStates))
+	for _, state := range streamStates {
+		counts[state] = 0
+	}
+
+	for _, state := range so.streamStates {
+		counts[state]++
+	}
+
+	return counts
+}
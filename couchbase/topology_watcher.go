@@ -0,0 +1,149 @@
+package couchbase
+
+import (
+	"time"
+
+	"github.com/asaskevich/EventBus"
+	"github.com/couchbase/gocbcore/v10"
+
+	"github.com/Trendyol/go-dcp/helpers"
+	"github.com/Trendyol/go-dcp/logger"
+)
+
+// Topology is the server list and the active vbucket map of the dcp agent config snapshot.
+type Topology struct {
+	// VBucketServers is the index of the server of each active vbucket.
+	VBucketServers []int
+	// MovedVBuckets are the vbuckets whose active server differs from the previous topology.
+	MovedVBuckets []uint16
+	RevID         int64
+	NumServers    int
+}
+
+type TopologyWatcher interface {
+	Start()
+	Stop()
+}
+
+// topologyWatcher diffs the config snapshot of the dcp agent, which is kept up to date by gocbcore,
+// so a poll does not reach the cluster. Changes are published on the bus as a Topology.
+type topologyWatcher struct {
+	client   Client
+	bus      EventBus.Bus
+	topology *Topology
+	stopCh   chan struct{}
+	interval time.Duration
+}
+
+func topologyOf(snapshot *gocbcore.ConfigSnapshot) (Topology, error) {
+	numServers, err := snapshot.NumServers()
+	if err != nil {
+		return Topology{}, err
+	}
+
+	numVBuckets, err := snapshot.NumVbuckets()
+	if err != nil {
+		return Topology{}, err
+	}
+
+	vBucketServers := make([]int, numVBuckets)
+	for vbID := 0; vbID < numVBuckets; vbID++ {
+		vBucketServers[vbID], err = snapshot.VbucketToServer(uint16(vbID), 0)
+		if err != nil {
+			return Topology{}, err
+		}
+	}
+
+	return Topology{RevID: snapshot.RevID(), NumServers: numServers, VBucketServers: vBucketServers}, nil
+}
+
+// movedVBuckets returns the vbuckets whose active server differs between the vbucket maps.
+func movedVBuckets(previous []int, current []int) []uint16 {
+	var moved []uint16
+
+	for vbID := range current {
+		if vbID >= len(previous) || previous[vbID] != current[vbID] {
+			moved = append(moved, uint16(vbID))
+		}
+	}
+
+	return moved
+}
+
+func (w *topologyWatcher) poll() {
+	snapshot, err := w.client.GetDcpAgentConfigSnapshot()
+	if err != nil {
+		logger.Log.Debug("cannot get config snapshot for topology watch, err: %v", err)
+		return
+	}
+
+	topology, err := topologyOf(snapshot)
+	if err != nil {
+		logger.Log.Debug("cannot read topology of config snapshot, err: %v", err)
+		return
+	}
+
+	w.observe(topology)
+}
+
+// observe publishes the topology when its servers or vbucket map differ from the previous one, older revisions
+// are ignored.
+func (w *topologyWatcher) observe(topology Topology) {
+	previous := w.topology
+	if previous != nil && topology.RevID < previous.RevID {
+		return
+	}
+
+	w.topology = &topology
+
+	if previous == nil {
+		return
+	}
+
+	topology.MovedVBuckets = movedVBuckets(previous.VBucketServers, topology.VBucketServers)
+	if topology.NumServers == previous.NumServers && len(topology.MovedVBuckets) == 0 {
+		return
+	}
+
+	logger.Log.Info(
+		"topology changed, rev: %v -> %v, servers: %v -> %v, moved vbuckets: %v",
+		previous.RevID, topology.RevID, previous.NumServers, topology.NumServers, len(topology.MovedVBuckets),
+	)
+
+	w.bus.Publish(helpers.TopologyChangedBusEventName, topology)
+}
+
+func (w *topologyWatcher) Start() {
+	w.stopCh = make(chan struct{})
+
+	go func(stopCh chan struct{}) {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				w.poll()
+			case <-stopCh:
+				return
+			}
+		}
+	}(w.stopCh)
+
+	logger.Log.Debug("started topology watcher, interval: %v", w.interval)
+}
+
+func (w *topologyWatcher) Stop() {
+	if w.stopCh != nil {
+		close(w.stopCh)
+		w.stopCh = nil
+	}
+}
+
+func NewTopologyWatcher(client Client, bus EventBus.Bus, interval time.Duration) TopologyWatcher {
+	return &topologyWatcher{
+		client:   client,
+		bus:      bus,
+		interval: interval,
+	}
+}
@@ -0,0 +1,36 @@
+package couchbase
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/asaskevich/EventBus"
+
+	"github.com/Trendyol/go-dcp/helpers"
+	"github.com/Trendyol/go-dcp/logger"
+)
+
+func TestTopologyWatcher_Observe(t *testing.T) {
+	logger.InitDefaultLogger("error")
+
+	bus := EventBus.New()
+
+	var published []Topology
+	err := bus.Subscribe(helpers.TopologyChangedBusEventName, func(topology Topology) {
+		published = append(published, topology)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := &topologyWatcher{bus: bus}
+
+	w.observe(Topology{RevID: 10, NumServers: 2, VBucketServers: []int{0, 0, 1, 1}})
+	w.observe(Topology{RevID: 11, NumServers: 2, VBucketServers: []int{0, 0, 1, 1}})
+	w.observe(Topology{RevID: 12, NumServers: 3, VBucketServers: []int{0, 2, 1, 2}})
+	w.observe(Topology{RevID: 11, NumServers: 2, VBucketServers: []int{0, 0, 1, 1}})
+
+	if len(published) != 1 || published[0].NumServers != 3 || !slices.Equal(published[0].MovedVBuckets, []uint16{1, 3}) {
+		t.Errorf("Unexpected result. got %v", published)
+	}
+}
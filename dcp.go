@@ -2,14 +2,19 @@ package dcp
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"reflect"
-	"regexp"
+	"slices"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/asaskevich/EventBus"
 
@@ -21,8 +26,13 @@ import (
 
 	"gopkg.in/yaml.v3"
 
+	"github.com/BurntSushi/toml"
+
 	"github.com/prometheus/client_golang/prometheus"
 
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+
 	"github.com/Trendyol/go-dcp/api"
 	"github.com/Trendyol/go-dcp/config"
 	"github.com/Trendyol/go-dcp/couchbase"
@@ -37,15 +47,23 @@ import (
 
 type Dcp interface {
 	WaitUntilReady() chan struct{}
+	Done() <-chan struct{}
 	Start()
 	Close()
+	Pause() error
+	Resume() error
 	Commit()
+	CommitAndWait(ctx context.Context) error
 	GetClient() couchbase.Client
 	GetConfig() *config.Dcp
 	GetVersion() *couchbase.Version
 	SetMetadata(metadata metadata.Metadata)
 	SetMetricCollectors(collectors ...prometheus.Collector)
 	SetEventHandler(handler models.EventHandler)
+	SetDeadLetterHandler(handler models.DeadLetterHandler)
+	SetTracerProvider(provider trace.TracerProvider)
+	SetStartOffsets(offsets map[uint16]*models.Offset)
+	ReloadConfig(path string) error
 }
 
 type dcp struct {
@@ -57,18 +75,31 @@ type dcp struct {
 	serviceDiscovery servicediscovery.ServiceDiscovery
 	metadata         metadata.Metadata
 	eventHandler     models.EventHandler
+	tracerProvider   trace.TracerProvider
 	client           couchbase.Client
 	apiShutdown      chan struct{}
 	config           *config.Dcp
 	version          *couchbase.Version
 	bucketInfo       *couchbase.BucketInfo
 	healthCheck      couchbase.HealthCheck
+	dcpKeepAlive     couchbase.HealthCheck
+	topologyWatcher  couchbase.TopologyWatcher
+	statsdEmitter    metric.StatsdEmitter
+	checkpointLag    metric.CheckpointLagSampler
 	listener         models.Listener
+	errorListener    models.ErrorListener
+	batchListener    models.BatchListener
+	deadLetter       models.DeadLetterHandler
 	readyCh          chan struct{}
+	doneCh           chan struct{}
 	cancelCh         chan os.Signal
 	stopCh           chan struct{}
+	reconnectStopCh  chan struct{}
 	metricCollectors []prometheus.Collector
+	startOffsets     map[uint16]*models.Offset
+	doneLock         sync.Mutex
 	closeWithCancel  bool
+	reconnectFailed  bool
 }
 
 func (s *dcp) SetMetadata(metadata metadata.Metadata) {
@@ -79,44 +110,141 @@ func (s *dcp) SetMetricCollectors(metricCollectors ...prometheus.Collector) {
 	s.metricCollectors = append(s.metricCollectors, metricCollectors...)
 }
 
+// SetEventHandler must be called before Start, the connection events of NewDcp are only received by a handler
+// given to NewDcpWithEventHandler.
 func (s *dcp) SetEventHandler(eventHandler models.EventHandler) {
 	s.eventHandler = eventHandler
+	s.client.SetEventHandler(eventHandler)
+}
+
+// SetStartOffsets streams the vbuckets from the given offsets instead of the checkpoint, it must be called before
+// Start. Every owned vbucket needs an offset whose vbUUID and seqNo match its failover log, otherwise Start fails.
+func (s *dcp) SetStartOffsets(offsets map[uint16]*models.Offset) {
+	s.startOffsets = offsets
+}
+
+// SetDeadLetterHandler receives the events the listener failed on when dcp.listener.onError is dlq,
+// it must be called before Start.
+func (s *dcp) SetDeadLetterHandler(handler models.DeadLetterHandler) {
+	s.deadLetter = handler
+}
+
+// SetTracerProvider enables spans from receiving an event to the return of the listener, it must be called before Start.
+func (s *dcp) SetTracerProvider(provider trace.TracerProvider) {
+	s.tracerProvider = provider
 }
 
-func (s *dcp) membershipChangedListener(_ *membership.Model) {
+func (s *dcp) membershipChangedEvent(newInfo *membership.Model) models.MembershipChangedEvent {
+	discoveryMetric := s.vBucketDiscovery.GetMetric()
+
+	event := models.MembershipChangedEvent{New: newInfo}
+
+	if discoveryMetric.TotalMembers > 0 {
+		event.Old = &membership.Model{
+			MemberNumber: discoveryMetric.MemberNumber,
+			TotalMembers: discoveryMetric.TotalMembers,
+		}
+		event.OldVBuckets = stream.AssignedVBuckets(discoveryMetric.VBucketCount, event.Old)
+	}
+
+	if newInfo != nil && newInfo.MemberNumber >= 1 && newInfo.MemberNumber <= newInfo.TotalMembers {
+		event.NewVBuckets = stream.AssignedVBuckets(discoveryMetric.VBucketCount, newInfo)
+	}
+
+	return event
+}
+
+func (s *dcp) membershipChangedListener(newInfo *membership.Model) {
+	if handler, ok := s.eventHandler.(models.MembershipChangedHandler); ok {
+		handler.MembershipChanged(s.membershipChangedEvent(newInfo))
+	}
+
 	s.stream.Rebalance()
 }
 
+// topologyChangedListener logs the vbuckets of the member that moved to another server, the server ends their
+// streams and they are opened again on the new one. The ownership only depends on the vbucket count and the
+// membership, so the vbuckets are not reassigned.
+func (s *dcp) topologyChangedListener(topology couchbase.Topology) {
+	offsets, _, _ := s.stream.GetOffsets()
+
+	var moved []uint16
+	for _, vbID := range topology.MovedVBuckets {
+		if _, ok := offsets.Load(vbID); ok {
+			moved = append(moved, vbID)
+		}
+	}
+
+	if len(moved) > 0 {
+		logger.Log.Info("vbuckets moved to another server, vbIDs: %v", moved)
+	}
+}
+
+func (s *dcp) newMetadata(metadataConfig *config.Dcp) metadata.Metadata {
+	switch {
+	case metadataConfig.IsCouchbaseMetadata():
+		return couchbase.NewCBMetadata(s.client, metadataConfig)
+	case metadataConfig.IsFileMetadata():
+		return metadata.NewFSMetadata(metadataConfig)
+	case metadataConfig.IsRedisMetadata():
+		return metadata.NewRedisMetadata(metadataConfig)
+	case metadataConfig.IsDynamoDBMetadata():
+		return metadata.NewDynamoDBMetadata(metadataConfig)
+	default:
+		err := errors.New("invalid metadata type")
+		logger.Log.Error("error while dcp start, err: %v", err)
+		panic(err)
+	}
+}
+
 //nolint:funlen
 func (s *dcp) Start() {
 	if s.metadata == nil {
-		switch {
-		case s.config.IsCouchbaseMetadata():
-			s.metadata = couchbase.NewCBMetadata(s.client, s.config)
-		case s.config.IsFileMetadata():
-			s.metadata = metadata.NewFSMetadata(s.config)
-		default:
-			err := errors.New("invalid metadata type")
-			logger.Log.Error("error while dcp start, err: %v", err)
-			panic(err)
+		s.metadata = s.newMetadata(s.config)
+
+		if len(s.config.Metadata.Secondaries) > 0 {
+			secondaries := make([]metadata.Metadata, 0, len(s.config.Metadata.Secondaries))
+			for i := range s.config.Metadata.Secondaries {
+				secondaries = append(secondaries, s.newMetadata(s.config.GetSecondaryMetadataConfig(i)))
+			}
+
+			s.metadata = metadata.NewCompositeMetadata(s.metadata, secondaries...)
 		}
 	}
 
+	if s.config.Dcp.Listener.OnError == config.ListenerOnErrorDLQ && s.deadLetter == nil {
+		err := errors.New("dead letter handler is not set for dcp.listener.onError dlq")
+		logger.Log.Error("error while dcp start, err: %v", err)
+		panic(err)
+	}
+
 	if s.config.Metadata.ReadOnly {
 		s.metadata = metadata.NewReadMetadata(s.metadata)
 	}
 
 	logger.Log.Info("using %v metadata", reflect.TypeOf(s.metadata))
 
-	vBuckets := s.client.GetNumVBuckets()
+	signal.Notify(s.cancelCh, syscall.SIGTERM, syscall.SIGINT, syscall.SIGABRT, syscall.SIGQUIT)
+
+	vBuckets, bucketUUID, err := s.resolveBucket()
+	if err != nil {
+		logger.Log.Error("error while dcp start, err: %v", err)
+		return
+	}
 
 	s.vBucketDiscovery = stream.NewVBucketDiscovery(s.client, s.config, vBuckets, s.bus)
 
 	s.stream = stream.NewStream(
-		s.client, s.metadata, s.config, s.version, s.bucketInfo, s.vBucketDiscovery,
-		s.listener, s.client.GetCollectionIDs(s.config.ScopeName, s.config.CollectionNames), s.stopCh, s.bus, s.eventHandler,
+		s.client, s.metadata, s.config, s.version, s.bucketInfo, bucketUUID, s.vBucketDiscovery,
+		s.listener, s.errorListener, s.batchListener, s.deadLetter,
+		s.client.GetCollectionIDs(s.config.ScopeName, s.config.CollectionNames), s.stopCh, s.bus, s.eventHandler,
+		s.tracerProvider.Tracer(helpers.Name),
 	)
 
+	if s.startOffsets != nil {
+		s.stream.SetStartOffsets(s.startOffsets)
+	}
+
 	if s.config.LeaderElection.Enabled {
 		s.serviceDiscovery = servicediscovery.NewServiceDiscovery(s.config, s.bus)
 		s.serviceDiscovery.StartHeartbeat()
@@ -126,14 +254,53 @@ func (s *dcp) Start() {
 		s.leaderElection.Start()
 	}
 
-	s.stream.Open()
+	if s.config.IsSnapshotMode() {
+		if err := s.bus.SubscribeAsync(helpers.SnapshotCompletedBusEventName, s.snapshotCompletedListener, true); err != nil {
+			logger.Log.Error("error while subscribe to snapshot completed event, err: %v", err)
+			panic(err)
+		}
+	}
 
-	err := s.bus.SubscribeAsync(helpers.MembershipChangedBusEventName, s.membershipChangedListener, true)
+	if err := s.stream.Open(); err != nil {
+		logger.Log.Error("error while dcp start, err: %v", err)
+
+		if s.config.LeaderElection.Enabled {
+			s.leaderElection.Stop()
+
+			s.serviceDiscovery.StopMonitor()
+			s.serviceDiscovery.StopHeartbeat()
+		}
+
+		s.vBucketDiscovery.Close()
+		s.stream = nil
+		return
+	}
+
+	err = s.bus.SubscribeAsync(helpers.MembershipChangedBusEventName, s.membershipChangedListener, true)
 	if err != nil {
 		logger.Log.Error("error while subscribe to membership changed event, err: %v", err)
 		panic(err)
 	}
 
+	err = s.bus.SubscribeAsync(helpers.TopologyChangedBusEventName, s.topologyChangedListener, true)
+	if err != nil {
+		logger.Log.Error("error while subscribe to topology changed event, err: %v", err)
+		panic(err)
+	}
+
+	s.topologyWatcher = couchbase.NewTopologyWatcher(s.client, s.bus, s.config.Dcp.VBuckets.TopologyWatchInterval)
+	s.topologyWatcher.Start()
+
+	if !s.config.API.Disabled || s.config.Metric.Statsd.Enabled {
+		s.checkpointLag = metric.NewCheckpointLagSampler(s.client, s.stream, s.config.Metric.CheckpointLagInterval)
+		s.checkpointLag.Start()
+	}
+
+	s.metricCollectors = append(
+		s.metricCollectors,
+		metric.NewMetricCollector(s.client, s.stream, s.vBucketDiscovery, s.checkpointLag, s.config.Dcp.Group.Name),
+	)
+
 	if !s.config.API.Disabled {
 		go func() {
 			go func() {
@@ -141,19 +308,26 @@ func (s *dcp) Start() {
 				s.api.Shutdown()
 			}()
 
-			s.metricCollectors = append(s.metricCollectors, metric.NewMetricCollector(s.client, s.stream, s.vBucketDiscovery))
-			s.api = api.NewAPI(s.config, s.client, s.stream, s.serviceDiscovery, s.metricCollectors)
+			s.api = api.NewAPI(s.config, s.client, s.stream, s.vBucketDiscovery, s.serviceDiscovery, s.metricCollectors)
 			s.api.Listen()
 		}()
 	}
 
-	signal.Notify(s.cancelCh, syscall.SIGTERM, syscall.SIGINT, syscall.SIGABRT, syscall.SIGQUIT)
+	if s.config.Metric.Statsd.Enabled {
+		s.statsdEmitter = metric.NewStatsdEmitter(&s.config.Metric, s.metricCollectors)
+		s.statsdEmitter.Start()
+	}
 
 	if !s.config.HealthCheck.Disabled {
 		s.healthCheck = couchbase.NewHealthCheck(&s.config.HealthCheck, s.client)
 		s.healthCheck.Start()
 	}
 
+	if s.config.Dcp.NoopInterval > 0 {
+		s.dcpKeepAlive = couchbase.NewDcpKeepAlive(s.config.Dcp.NoopInterval, s.client, s.reconnectDcp)
+		s.dcpKeepAlive.Start()
+	}
+
 	logger.Log.Info("dcp stream started")
 
 	s.readyCh <- struct{}{}
@@ -167,6 +341,95 @@ func (s *dcp) Start() {
 	}
 }
 
+var errStartCancelled = errors.New("dcp start cancelled")
+
+// resolveBucket retries the vBucket count and the bucket uuid of the config snapshot until they are resolved,
+// so a transient reconfig at startup does not take down the process. It gives up once dcp is cancelled or closed.
+func (s *dcp) resolveBucket() (int, string, error) {
+	for {
+		vBuckets, err := s.client.GetNumVBuckets()
+		if err == nil {
+			var bucketUUID string
+			if bucketUUID, err = s.client.GetBucketUUID(); err == nil {
+				return vBuckets, bucketUUID, nil
+			}
+		}
+
+		logger.Log.Warn("cannot resolve bucket from config snapshot, retry in: %v, err: %v", s.config.Dcp.VBuckets.RetryInterval, err)
+
+		select {
+		case <-s.cancelCh:
+			s.closeWithCancel = true
+			return 0, "", errStartCancelled
+		case <-s.stopCh:
+			return 0, "", errStartCancelled
+		case <-time.After(s.config.Dcp.VBuckets.RetryInterval):
+		}
+	}
+}
+
+// reconnectDcp closes the streams, connects the dead dcp agent with backoff and reopens the owned vbuckets
+// from the checkpoint. Once dcp.reconnect.attempts are exhausted it gives up, the streams stay closed so the
+// readiness and the health check of the dcp connections fail.
+func (s *dcp) reconnectDcp(cause error) {
+	if s.reconnectFailed {
+		return
+	}
+
+	attempts := 0
+	err := s.stream.Reconnect(func() error {
+		var err error
+		attempts, err = couchbase.ReconnectDcpWithBackoff(s.client, &s.config.Dcp.Reconnect, s.reconnectStopCh)
+		return err
+	})
+	if errors.Is(err, couchbase.ErrDcpReconnectStopped) {
+		return
+	}
+
+	if err != nil {
+		s.reconnectFailed = true
+		logger.Log.Error("giving up reconnecting dcp, err: %v", err)
+		return
+	}
+
+	logger.Log.Info("dcp reconnected after %v attempts", attempts)
+	if handler, ok := s.eventHandler.(models.DcpReconnectedHandler); ok {
+		handler.DcpReconnected(models.DcpReconnectedEvent{Err: cause, Attempts: attempts})
+	}
+}
+
+// ReloadConfig reads the config file again and applies the fields that can change at runtime, like
+// logging.level and checkpoint.interval. It returns config.ErrConfigNeedsRestart without applying anything
+// when another field changed.
+func (s *dcp) ReloadConfig(path string) (err error) {
+	next, err := newDcpConfig(path)
+	if err != nil {
+		return err
+	}
+
+	if err := next.Validate(); err != nil {
+		return err
+	}
+
+	next.ApplyDefaults()
+
+	changed, err := s.config.Reload(&next)
+	if err != nil {
+		logger.Log.Error("error while reloading config, err: %v", err)
+		return err
+	}
+
+	if slices.Contains(changed, "logging.level") {
+		if err := logger.SetLevel(next.Logging.Level); err != nil {
+			logger.Log.Warn("logging level could not be changed, err: %v", err)
+		}
+	}
+
+	logger.Log.Info("config reloaded, changed fields: %v", changed)
+
+	return nil
+}
+
 func (s *dcp) GetClient() couchbase.Client {
 	return s.client
 }
@@ -175,21 +438,88 @@ func (s *dcp) WaitUntilReady() chan struct{} {
 	return s.readyCh
 }
 
+// Done is closed in snapshot mode once every owned vbucket reached the seqNo recorded at startup,
+// Close can be called then to save the checkpoint and shut down. A rebalance that assigns other vbuckets
+// replaces it with an open channel until those reach their seqNo too.
+func (s *dcp) Done() <-chan struct{} {
+	s.doneLock.Lock()
+	defer s.doneLock.Unlock()
+
+	return s.doneCh
+}
+
+func (s *dcp) snapshotCompletedListener(completed bool) {
+	s.doneLock.Lock()
+	defer s.doneLock.Unlock()
+
+	select {
+	case <-s.doneCh:
+		if !completed {
+			s.doneCh = make(chan struct{})
+		}
+	default:
+		if completed {
+			close(s.doneCh)
+		}
+	}
+}
+
 func (s *dcp) Close() {
+	if s.stream == nil {
+		select {
+		case s.stopCh <- struct{}{}:
+		default:
+		}
+
+		s.client.DcpClose()
+		s.client.Close()
+
+		logger.Log.Info("dcp closed before the stream started")
+		return
+	}
+
 	if !s.config.HealthCheck.Disabled {
 		s.healthCheck.Stop()
 	}
+	if s.dcpKeepAlive != nil {
+		close(s.reconnectStopCh)
+		s.dcpKeepAlive.Stop()
+	}
 	s.vBucketDiscovery.Close()
 
-	if s.config.Checkpoint.Type == stream.CheckpointTypeAuto {
+	if s.statsdEmitter != nil {
+		s.statsdEmitter.Stop()
+	}
+
+	if s.checkpointLag != nil {
+		s.checkpointLag.Stop()
+	}
+
+	if s.config.Checkpoint.ShouldSaveOnClose() {
 		s.stream.Save()
 	}
 
+	if s.topologyWatcher != nil {
+		s.topologyWatcher.Stop()
+	}
+
 	err := s.bus.Unsubscribe(helpers.MembershipChangedBusEventName, s.membershipChangedListener)
 	if err != nil {
 		logger.Log.Error("cannot while unsubscribe: %v", err)
 	}
 
+	err = s.bus.Unsubscribe(helpers.TopologyChangedBusEventName, s.topologyChangedListener)
+	if err != nil {
+		logger.Log.Error("cannot while unsubscribe: %v", err)
+	}
+
+	if s.config.IsSnapshotMode() {
+		err = s.bus.Unsubscribe(helpers.SnapshotCompletedBusEventName, s.snapshotCompletedListener)
+		if err != nil {
+			logger.Log.Error("cannot while unsubscribe: %v", err)
+		}
+	}
+
 	s.stream.Close(s.closeWithCancel)
 
 	if s.config.LeaderElection.Enabled {
@@ -203,6 +533,12 @@ func (s *dcp) Close() {
 		s.apiShutdown <- struct{}{}
 	}
 
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.PendingOpsTimeout)
+	if err := s.client.WaitForPendingOps(ctx); err != nil {
+		logger.Log.Warn("closing with pending operations, err: %v", err)
+	}
+	cancel()
+
 	s.client.DcpClose()
 	s.client.Close()
 
@@ -212,10 +548,35 @@ func (s *dcp) Close() {
 	logger.Log.Info("dcp stream closed")
 }
 
+// Pause stops consuming by closing the vbucket streams while the connections stay open, the readiness
+// endpoint reports the stream as paused until Resume opens them again from the last checkpoint.
+func (s *dcp) Pause() error {
+	if s.stream == nil {
+		return stream.ErrStreamNotOpen
+	}
+
+	s.stream.Pause()
+
+	return nil
+}
+
+func (s *dcp) Resume() error {
+	if s.stream == nil {
+		return stream.ErrStreamNotOpen
+	}
+
+	return s.stream.Resume()
+}
+
 func (s *dcp) Commit() {
 	s.stream.Save()
 }
 
+// CommitAndWait saves the checkpoint and reports whether the metadata write was confirmed.
+func (s *dcp) CommitAndWait(ctx context.Context) error {
+	return s.stream.SaveAndWait(ctx)
+}
+
 func (s *dcp) GetConfig() *config.Dcp {
 	return s.config
 }
@@ -224,39 +585,113 @@ func (s *dcp) GetVersion() *couchbase.Version {
 	return s.version
 }
 
-func newDcp(config *config.Dcp, listener models.Listener) (Dcp, error) {
+var ErrStartTimeout = errors.New("dcp is not connected within start timeout")
+
+// listeners are the callbacks a Dcp delivers the events to, errorListener or batchListener replaces the listener
+// of the events while listener still gets the heartbeats.
+type listeners struct {
+	listener      models.Listener
+	errorListener models.ErrorListener
+	batchListener models.BatchListener
+}
+
+func newDcp(config *config.Dcp, listeners listeners, eventHandler models.EventHandler) (Dcp, error) {
+	err := config.Validate()
+
+	// the defaults set up the logger too
 	config.ApplyDefaults()
+
+	if err != nil {
+		logger.Log.Error("invalid configuration, err: %v", err)
+		return nil, err
+	}
+
 	copyOfConfig := config
 	printConfiguration(*copyOfConfig)
 
+	type connectResult struct {
+		dcp *dcp
+		err error
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	resultCh := make(chan connectResult, 1)
+	connect := func() {
+		d, err := connectDcp(ctx, config, listeners, eventHandler)
+		resultCh <- connectResult{dcp: d, err: err}
+	}
+
+	var timeoutCh <-chan time.Time
+	if config.StartTimeout > 0 {
+		timeoutCh = time.After(config.StartTimeout)
+		go connect()
+	} else {
+		connect()
+	}
+
+	select {
+	case result := <-resultCh:
+		if result.err != nil {
+			return nil, result.err
+		}
+		return result.dcp, nil
+	case <-timeoutCh:
+		cancel()
+
+		go func() {
+			// the connect stops at its next attempt, connections it opened in the meantime are closed
+			if result := <-resultCh; result.err == nil {
+				result.dcp.client.DcpClose()
+				result.dcp.client.Close()
+			}
+		}()
+
+		return nil, fmt.Errorf("%w: %v", ErrStartTimeout, config.StartTimeout)
+	}
+}
+
+// connectDcp opens the connections and resolves the cluster version and the bucket, connections opened
+// before an error are closed. The connection attempts stop once ctx is done.
+func connectDcp(ctx context.Context, config *config.Dcp, listeners listeners, eventHandler models.EventHandler) (*dcp, error) {
 	client := couchbase.NewClient(config)
+	client.SetEventHandler(eventHandler)
 
-	err := client.Connect()
+	err := client.Connect(ctx)
 	if err != nil {
+		client.Close()
 		return nil, err
 	}
 
-	httpClient := couchbase.NewHTTPClient(config, client)
+	httpClient, err := couchbase.NewHTTPClient(config, client)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
 
 	err = httpClient.Connect()
 	if err != nil {
+		client.Close()
 		return nil, err
 	}
 
 	version, err := httpClient.GetVersion()
 	if err != nil {
+		client.Close()
 		return nil, err
 	}
 
 	bucketInfo, err := httpClient.GetBucketInfo()
 	if err != nil {
+		client.Close()
 		return nil, err
 	}
 
 	var useExpiryOpcode bool
 	var useChangeStreams bool
 
-	if version.Higher(couchbase.SrvVer650) || version.Equal(couchbase.SrvVer650) {
+	if *config.Dcp.UseExpiryOpcode && (version.Higher(couchbase.SrvVer650) || version.Equal(couchbase.SrvVer650)) {
 		useExpiryOpcode = true
 	}
 
@@ -264,23 +699,29 @@ func newDcp(config *config.Dcp, listener models.Listener) (Dcp, error) {
 		useChangeStreams = true
 	}
 
-	err = client.DcpConnect(useExpiryOpcode, useChangeStreams)
+	err = client.DcpConnect(ctx, useExpiryOpcode, useChangeStreams)
 	if err != nil {
+		client.Close()
 		return nil, err
 	}
 
 	return &dcp{
 		client:           client,
-		listener:         listener,
+		listener:         listeners.listener,
+		errorListener:    listeners.errorListener,
+		batchListener:    listeners.batchListener,
 		config:           config,
 		version:          version,
 		bucketInfo:       bucketInfo,
 		apiShutdown:      make(chan struct{}, 1),
 		cancelCh:         make(chan os.Signal, 1),
 		stopCh:           make(chan struct{}, 1),
+		reconnectStopCh:  make(chan struct{}),
 		readyCh:          make(chan struct{}, 1),
+		doneCh:           make(chan struct{}),
 		metricCollectors: []prometheus.Collector{},
-		eventHandler:     models.DefaultEventHandler,
+		eventHandler:     eventHandler,
+		tracerProvider:   noop.NewTracerProvider(),
 		bus:              EventBus.New(),
 	}, nil
 }
@@ -290,24 +731,155 @@ func newDcp(config *config.Dcp, listener models.Listener) (Dcp, error) {
 // config: path to a configuration file or a configuration struct
 // listener is a callback function that will be called when a mutation, deletion or expiration event occurs
 func NewDcp(cfg any, listener models.Listener) (Dcp, error) {
+	return NewDcpWithEventHandler(cfg, listener, models.DefaultEventHandler)
+}
+
+// NewDcpWithEventHandler creates a new Dcp client with the given event handler. When the handler implements
+// models.ConnectionEventHandler it also receives the Connecting and Connected events of the data, metadata and dcp
+// agents opened by the constructor.
+func NewDcpWithEventHandler(cfg any, listener models.Listener, eventHandler models.EventHandler) (Dcp, error) {
+	c, err := resolveConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return newDcp(c, listeners{listener: listener}, eventHandler)
+}
+
+// resolveConfig returns the configuration struct or reads it from the path.
+func resolveConfig(cfg any) (*config.Dcp, error) {
 	switch v := cfg.(type) {
 	case *config.Dcp:
-		return newDcp(v, listener)
+		return v, nil
 	case config.Dcp:
-		return newDcp(&v, listener)
+		return &v, nil
 	case string:
-		return newDcpWithPath(v, listener)
+		c, err := newDcpConfig(v)
+		if err != nil {
+			return nil, err
+		}
+		return &c, nil
 	default:
 		return nil, errors.New("invalid config")
 	}
 }
 
-func newDcpWithPath(path string, listener models.Listener) (Dcp, error) {
-	c, err := newDcpConfig(path)
+var ErrCollectionNotFound = errors.New("collection not found")
+
+// Validate connects with the configuration to check the credentials, TLS, bucket and collections without
+// opening any stream or touching the checkpoints, the connections are closed before it returns.
+func Validate(cfg any) (err error) {
+	c, err := resolveConfig(cfg)
 	if err != nil {
+		return err
+	}
+
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	defer func() {
+		// the metadata getters of the client panic on invalid values
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid configuration: %v", r)
+		}
+	}()
+
+	c.ApplyDefaults()
+
+	d, err := connectDcp(context.Background(), c, listeners{}, models.DefaultEventHandler)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		d.client.DcpClose()
+		d.client.Close()
+	}()
+
+	collectionIDs, err := d.client.ResolveCollectionIDs(c.ScopeName, c.CollectionNames)
+	if err != nil {
+		return err
+	}
+
+	return missingCollections(c, collectionIDs)
+}
+
+// missingCollections returns ErrCollectionNotFound for the configured collections that were not resolved.
+func missingCollections(c *config.Dcp, collectionIDs map[uint32]string) error {
+	found := make(map[string]struct{}, len(collectionIDs))
+	for _, collectionName := range collectionIDs {
+		found[collectionName] = struct{}{}
+	}
+
+	if c.IsCollectionWildcard() {
+		if len(found) == 0 {
+			return fmt.Errorf("%w, scope: %v", ErrCollectionNotFound, c.ScopeName)
+		}
+		return nil
+	}
+
+	var missing []string
+	for _, collectionName := range c.CollectionNames {
+		// the default collection exists on every bucket, servers without collections resolve no ids
+		if _, ok := found[collectionName]; !ok && collectionName != config.DefaultCollectionName {
+			missing = append(missing, c.ScopeName+"."+collectionName)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %v", ErrCollectionNotFound, strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// newDcpConfig reads a yaml, json or toml config by the file extension, other extensions are read as yaml.
+// convertToYaml decodes the config into a generic document and encodes it as yaml, so the yaml tags and
+// decoders like the one of time.Duration apply to every format.
+func convertToYaml(file []byte, unmarshal func([]byte, any) error) ([]byte, error) {
+	var document map[string]any
+	if err := unmarshal(file, &document); err != nil {
 		return nil, err
 	}
-	return newDcp(&c, listener)
+
+	return yaml.Marshal(document)
+}
+
+// unmarshalJSONDocument keeps the whole numbers as integers, so they fit the int and any fields like in yaml.
+func unmarshalJSONDocument(file []byte, document any) error {
+	decoder := json.NewDecoder(bytes.NewReader(file))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(document); err != nil {
+		return err
+	}
+
+	if m, ok := document.(*map[string]any); ok {
+		*m = resolveJSONNumbers(*m).(map[string]any)
+	}
+
+	return nil
+}
+
+func resolveJSONNumbers(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		for key, item := range v {
+			v[key] = resolveJSONNumbers(item)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = resolveJSONNumbers(item)
+		}
+	}
+
+	return value
 }
 
 func newDcpConfig(path string) (config.Dcp, error) {
@@ -315,28 +887,59 @@ func newDcpConfig(path string) (config.Dcp, error) {
 	if err != nil {
 		return config.Dcp{}, err
 	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		file, err = convertToYaml(file, unmarshalJSONDocument)
+	case ".toml":
+		file, err = convertToYaml(file, toml.Unmarshal)
+	}
+	if err != nil {
+		return config.Dcp{}, err
+	}
+
 	var c config.Dcp
 	err = yaml.Unmarshal(file, &c)
 	if err != nil {
 		return config.Dcp{}, err
 	}
 
-	envPattern := regexp.MustCompile(`\${([^}]+)}`)
-	matches := envPattern.FindAllStringSubmatch(string(file), -1)
-	for _, match := range matches {
-		envVar := match[1]
-		if value, exists := os.LookupEnv(envVar); exists {
-			updatedFile := strings.ReplaceAll(string(file), "${"+envVar+"}", value)
-			file = []byte(updatedFile)
-		}
+	c.ExpandEnv()
+
+	return c, nil
+}
+
+// NewDcpWithErrorListener creates a new Dcp client with a listener that reports failures,
+// an event is acknowledged when the listener returns nil and retried per dcp.listener.retry otherwise.
+func NewDcpWithErrorListener(cfg any, listener models.ErrorListener) (Dcp, error) {
+	c, err := resolveConfig(cfg)
+	if err != nil {
+		return nil, err
 	}
 
-	err = yaml.Unmarshal(file, &c)
+	return newDcp(c, listeners{
+		listener: func(ctx *models.ListenerContext) {
+			_ = listener(ctx)
+		},
+		errorListener: listener,
+	}, models.DefaultEventHandler)
+}
+
+// NewDcpWithBatchListener creates a new Dcp client with a listener that gets the events in batches of
+// dcp.listener.batch.size, a partial batch is delivered after dcp.listener.batch.flushInterval. The events of
+// a batch are acknowledged together when the listener returns nil and retried per dcp.listener.retry otherwise.
+func NewDcpWithBatchListener(cfg any, listener models.BatchListener) (Dcp, error) {
+	c, err := resolveConfig(cfg)
 	if err != nil {
-		return config.Dcp{}, err
+		return nil, err
 	}
 
-	return c, nil
+	return newDcp(c, listeners{
+		listener: func(ctx *models.ListenerContext) {
+			_ = listener([]*models.ListenerContext{ctx})
+		},
+		batchListener: listener,
+	}, models.DefaultEventHandler)
 }
 
 func NewDcpWithLogger(cfg any, listener models.Listener, logrus *logrus.Logger) (Dcp, error) {
@@ -346,6 +949,18 @@ func NewDcpWithLogger(cfg any, listener models.Listener, logrus *logrus.Logger)
 	return NewDcp(cfg, listener)
 }
 
+// NewDcpWithCustomLogger creates a new Dcp client that logs through a structured logger like zap, the messages
+// are logged with the group name of the config and the vbID and seqNo of the stream events as fields.
+func NewDcpWithCustomLogger(cfg any, listener models.Listener, structuredLogger logger.StructuredLogger) (Dcp, error) {
+	c, err := resolveConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Log = logger.NewStructuredLogger(structuredLogger, "group", c.Dcp.Group.Name)
+	return NewDcp(c, listener)
+}
+
 func printConfiguration(config config.Dcp) {
 	config.Password = "*****"
 	configJSON, _ := jsoniter.Marshal(config)
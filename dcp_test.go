@@ -2,11 +2,15 @@ package dcp
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -20,6 +24,8 @@ import (
 	"github.com/Trendyol/go-dcp/config"
 
 	"github.com/Trendyol/go-dcp/couchbase"
+	"github.com/Trendyol/go-dcp/membership"
+	"github.com/Trendyol/go-dcp/stream"
 	"github.com/couchbase/gocbcore/v10"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
@@ -137,7 +143,7 @@ func insertDataToContainer(c *config.Dcp, t *testing.T, iteration int, chunkSize
 
 	client := couchbase.NewClient(c)
 
-	err := client.Connect()
+	err := client.Connect(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -189,12 +195,49 @@ func insertDataToContainer(c *config.Dcp, t *testing.T, iteration int, chunkSize
 	logger.Log.Info("mock data stream finished with totalSize=%v", iteration)
 }
 
+const ttlDocumentKey = "ttl_document"
+
+func insertTTLDocumentToContainer(c *config.Dcp, t *testing.T, expiry time.Duration) {
+	client := couchbase.NewClient(c)
+
+	err := client.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ch := make(chan error, 1)
+
+	opm := couchbase.NewAsyncOp(context.Background())
+
+	op, err := client.GetAgent().Set(gocbcore.SetOptions{
+		Key:    []byte(ttlDocumentKey),
+		Value:  []byte(ttlDocumentKey),
+		Expiry: uint32(expiry.Seconds()),
+	}, func(result *gocbcore.StoreResult, err error) {
+		opm.Resolve()
+
+		ch <- err
+	})
+
+	err = opm.Wait(op, err)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = <-ch
+	if err != nil {
+		t.Error(err)
+	}
+}
+
 //nolint:funlen
 func test(t *testing.T, version string) {
 	chunkSize := 4
 	bulkSize := 1024
 	iteration := 512
-	mockDataSize := iteration * bulkSize * chunkSize
+	mockDataSize := iteration*bulkSize*chunkSize + 1
+	ttl := time.Hour
 	totalNotify := 10
 	notifySize := mockDataSize / totalNotify
 
@@ -211,10 +254,18 @@ func test(t *testing.T, version string) {
 	counter := 0
 	finish := make(chan struct{}, 1)
 
+	var ttlDocumentExpiry, unexpectedExpiry atomic.Uint32
+
 	dcp, err := NewDcp(c, func(ctx *models.ListenerContext) {
-		if _, ok := ctx.Event.(models.DcpMutation); ok {
+		if mutation, ok := ctx.Event.(models.DcpMutation); ok {
 			ctx.Ack()
 
+			if string(mutation.Key) == ttlDocumentKey {
+				ttlDocumentExpiry.Store(mutation.Expiry)
+			} else if mutation.Expiry != 0 {
+				unexpectedExpiry.Store(mutation.Expiry)
+			}
+
 			counter++
 
 			if counter%notifySize == 0 {
@@ -233,6 +284,7 @@ func test(t *testing.T, version string) {
 	go func() {
 		<-dcp.WaitUntilReady()
 		insertDataToContainer(c, t, iteration, chunkSize, bulkSize)
+		insertTTLDocumentToContainer(c, t, ttl)
 	}()
 
 	go func() {
@@ -248,6 +300,16 @@ func test(t *testing.T, version string) {
 	}
 
 	logger.Log.Info("mock data stream finished with totalSize=%v", counter)
+
+	if expiry := unexpectedExpiry.Load(); expiry != 0 {
+		t.Errorf("expected no expiry for documents without ttl, got %v", expiry)
+	}
+
+	// the server streams the expiry as an absolute unix time
+	expected := time.Now().Add(ttl).Unix()
+	if expiry := int64(ttlDocumentExpiry.Load()); expiry < expected-60 || expiry > expected {
+		t.Errorf("expected expiry around %v for the ttl document, got %v", expected, expiry)
+	}
 }
 
 func TestDcp(t *testing.T) {
@@ -301,3 +363,209 @@ bucketName: ${DCP_BUCKET_NAME}
 		t.Errorf("expected bucketName to be 'envBucket', got '%s'", dcpConfig.BucketName)
 	}
 }
+
+func TestNewDcpConfigFormats(t *testing.T) {
+	files := map[string]string{
+		"yml": `
+hosts: ["localhost:8091", "localhost:8092"]
+bucketName: dcp-test
+connectionBufferSize: 20971520
+dcp:
+  group:
+    name: groupName
+    membership:
+      totalMembers: 2
+      rebalanceDelay: 3s
+  listener:
+    bufferSize: 1000
+metadata:
+  type: file
+  config:
+    fileName: checkpoint.json
+checkpoint:
+  interval: 0.5s
+`,
+		"json": `{
+	"hosts": ["localhost:8091", "localhost:8092"],
+	"bucketName": "dcp-test",
+	"connectionBufferSize": 20971520,
+	"dcp": {
+		"group": {"name": "groupName", "membership": {"totalMembers": 2, "rebalanceDelay": "3s"}},
+		"listener": {"bufferSize": 1000}
+	},
+	"metadata": {"type": "file", "config": {"fileName": "checkpoint.json"}},
+	"checkpoint": {"interval": "0.5s"}
+}`,
+		"toml": `
+hosts = ["localhost:8091", "localhost:8092"]
+bucketName = "dcp-test"
+connectionBufferSize = 20971520
+
+[dcp.group]
+name = "groupName"
+
+[dcp.group.membership]
+totalMembers = 2
+rebalanceDelay = "3s"
+
+[dcp.listener]
+bufferSize = 1000
+
+[metadata]
+type = "file"
+
+[metadata.config]
+fileName = "checkpoint.json"
+
+[checkpoint]
+interval = "0.5s"
+`,
+	}
+
+	configs := map[string]config.Dcp{}
+
+	for extension, content := range files {
+		path := filepath.Join(t.TempDir(), "config."+extension)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		c, err := newDcpConfig(path)
+		if err != nil {
+			t.Fatalf("%v config could not be read, err: %v", extension, err)
+		}
+
+		configs[extension] = c
+	}
+
+	if configs["yml"].Dcp.Group.Membership.RebalanceDelay != 3*time.Second || configs["yml"].ConnectionBufferSize != 20971520 {
+		t.Fatalf("yml config is not read as expected, got: %+v", configs["yml"])
+	}
+
+	for _, extension := range []string{"json", "toml"} {
+		if !reflect.DeepEqual(configs[extension], configs["yml"]) {
+			t.Errorf("%v config is expected to equal the yml one, got: %+v, expected: %+v", extension, configs[extension], configs["yml"])
+		}
+	}
+}
+
+type fakeVBucketDiscovery struct {
+	metric *stream.VBucketDiscoveryMetric
+}
+
+func (d *fakeVBucketDiscovery) Get() []uint16 {
+	return nil
+}
+
+func (d *fakeVBucketDiscovery) Close() {
+}
+
+func (d *fakeVBucketDiscovery) GetMetric() *stream.VBucketDiscoveryMetric {
+	return d.metric
+}
+
+func TestReloadConfig(t *testing.T) {
+	logger.InitDefaultLogger("error")
+
+	writeConfig := func(interval string, bucketName string) string {
+		path := filepath.Join(t.TempDir(), "config.yml")
+		content := fmt.Sprintf("hosts: [\"localhost:8091\"]\nbucketName: %v\ndcp:\n  group:\n    name: groupName\n"+
+			"checkpoint:\n  interval: %v\n", bucketName, interval)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	current, err := newDcpConfig(writeConfig("10s", "dcp-test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	current.ApplyDefaults()
+
+	s := &dcp{config: &current}
+
+	if err := s.ReloadConfig(writeConfig("1m", "dcp-test")); err != nil {
+		t.Fatalf("ReloadConfig is expected to apply the interval, err: %v", err)
+	}
+
+	if s.config.CheckpointInterval() != time.Minute {
+		t.Errorf("unexpected checkpoint interval: %v", s.config.CheckpointInterval())
+	}
+
+	err = s.ReloadConfig(writeConfig("2m", "other"))
+	if !errors.Is(err, config.ErrConfigNeedsRestart) || s.config.CheckpointInterval() != time.Minute {
+		t.Errorf("ReloadConfig is expected to need a restart, err: %v, interval: %v", err, s.config.CheckpointInterval())
+	}
+
+	if err := s.ReloadConfig(writeConfig("-1s", "dcp-test")); err == nil {
+		t.Errorf("ReloadConfig is expected to reject a negative interval")
+	}
+}
+
+func TestMembershipChangedEvent(t *testing.T) {
+	s := &dcp{vBucketDiscovery: &fakeVBucketDiscovery{
+		metric: &stream.VBucketDiscoveryMetric{VBucketCount: 8, MemberNumber: 1, TotalMembers: 1},
+	}}
+
+	event := s.membershipChangedEvent(&membership.Model{MemberNumber: 2, TotalMembers: 2})
+
+	if event.Old == nil || event.Old.MemberNumber != 1 || event.Old.TotalMembers != 1 {
+		t.Fatalf("unexpected old membership: %v", event.Old)
+	}
+
+	if len(event.OldVBuckets) != 8 {
+		t.Errorf("expected 8 old vbuckets, got %v", event.OldVBuckets)
+	}
+
+	if len(event.NewVBuckets) != 4 || event.NewVBuckets[0] != 4 {
+		t.Errorf("expected vbuckets 4-7, got %v", event.NewVBuckets)
+	}
+}
+
+func TestSnapshotCompletedListenerReopensDoneOnReassignment(t *testing.T) {
+	s := &dcp{doneCh: make(chan struct{})}
+
+	s.snapshotCompletedListener(true)
+	s.snapshotCompletedListener(true)
+
+	select {
+	case <-s.Done():
+	default:
+		t.Fatal("expected done to be closed once the snapshot is completed")
+	}
+
+	s.snapshotCompletedListener(false)
+
+	select {
+	case <-s.Done():
+		t.Fatal("expected done to be open while reassigned vbuckets are pending")
+	default:
+	}
+}
+
+func TestMissingCollections(t *testing.T) {
+	tests := []struct {
+		name            string
+		collectionNames []string
+		collectionIDs   map[uint32]string
+		wantErr         bool
+	}{
+		{name: "all resolved", collectionNames: []string{"orders", "products"}, collectionIDs: map[uint32]string{8: "orders", 9: "products"}},
+		{name: "one missing", collectionNames: []string{"orders", "products"}, collectionIDs: map[uint32]string{8: "orders"}, wantErr: true},
+		{name: "default collection", collectionNames: []string{config.DefaultCollectionName}, collectionIDs: map[uint32]string{}},
+		{name: "empty wildcard scope", collectionNames: []string{config.CollectionNameWildcard}, collectionIDs: map[uint32]string{}, wantErr: true},
+		{name: "wildcard scope", collectionNames: []string{config.CollectionNameWildcard}, collectionIDs: map[uint32]string{8: "orders"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &config.Dcp{ScopeName: "inventory", CollectionNames: tt.collectionNames}
+
+			err := missingCollections(c, tt.collectionIDs)
+			if tt.wantErr != errors.Is(err, ErrCollectionNotFound) {
+				t.Errorf("missingCollections() err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
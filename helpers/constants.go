@@ -8,6 +8,8 @@ const (
 
 	MembershipChangedBusEventName   string = "membershipChanged"
 	PersistSeqNoChangedBusEventName string = "persistSeqNoChanged"
+	TopologyChangedBusEventName     string = "topologyChanged"
+	SnapshotCompletedBusEventName   string = "snapshotCompleted"
 
 	JSONFlags uint32 = 50333696
 )
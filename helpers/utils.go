@@ -7,27 +7,38 @@ import (
 )
 
 func IsMetadata(data interface{}) bool {
+	return IsMetadataWithPrefix(data, Prefix)
+}
+
+// IsMetadataWithPrefix reports whether the key of data starts with the given metadata prefix or the transaction prefix.
+func IsMetadataWithPrefix(data interface{}, prefix string) bool {
 	value := reflect.ValueOf(data).FieldByName("Key")
 	if !value.IsValid() {
 		return false
 	}
 
-	return bytes.HasPrefix(value.Bytes(), []byte(Prefix)) || bytes.HasPrefix(value.Bytes(), []byte(TxnPrefix))
+	return bytes.HasPrefix(value.Bytes(), []byte(prefix)) || bytes.HasPrefix(value.Bytes(), []byte(TxnPrefix))
 }
 
+// ChunkSlice splits the slice into the given number of chunks whose sizes differ by one at most, the first
+// chunks are the bigger ones. Chunks after the last element are empty and nil is returned when chunks <= 0.
 func ChunkSlice[T any](slice []T, chunks int) [][]T {
-	maxChunkSize := ((len(slice) - 1) / chunks) + 1
-	numFullChunks := chunks - (maxChunkSize*chunks - len(slice))
+	if chunks <= 0 {
+		return nil
+	}
+
+	chunkSize := len(slice) / chunks
+	numFullChunks := len(slice) % chunks
 
 	result := make([][]T, chunks)
 
 	startIndex := 0
 
 	for i := 0; i < chunks; i++ {
-		endIndex := startIndex + maxChunkSize
+		endIndex := startIndex + chunkSize
 
-		if i >= numFullChunks {
-			endIndex--
+		if i < numFullChunks {
+			endIndex++
 		}
 
 		result[i] = slice[startIndex:endIndex]
@@ -88,6 +88,46 @@ func TestChunkSlice(t *testing.T) {
 	}
 }
 
+func TestChunkSliceEdgeCases(t *testing.T) {
+	tests := []struct {
+		name   string
+		slice  []int
+		chunks int
+		want   []int
+	}{
+		{name: "zero chunks", slice: []int{0, 1, 2}, chunks: 0, want: nil},
+		{name: "negative chunks", slice: []int{0, 1, 2}, chunks: -1, want: nil},
+		{name: "more chunks than elements", slice: []int{0, 1, 2}, chunks: 5, want: []int{1, 1, 1, 0, 0}},
+		{name: "empty slice", slice: []int{}, chunks: 3, want: []int{0, 0, 0}},
+		{name: "single chunk", slice: []int{0, 1, 2}, chunks: 1, want: []int{3}},
+		{name: "uneven chunks", slice: []int{0, 1, 2, 3, 4, 5, 6}, chunks: 3, want: []int{3, 2, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := ChunkSlice[int](tt.slice, tt.chunks)
+
+			if len(chunks) != len(tt.want) {
+				t.Fatalf("ChunkSlice() returned %v chunks, want %v", len(chunks), len(tt.want))
+			}
+
+			next := 0
+			for i, chunk := range chunks {
+				if len(chunk) != tt.want[i] {
+					t.Errorf("ChunkSlice() chunk %v has %v elements, want %v", i, len(chunk), tt.want[i])
+				}
+
+				for _, item := range chunk {
+					if item != tt.slice[next] {
+						t.Errorf("ChunkSlice() chunk %v has %v, want %v", i, item, tt.slice[next])
+					}
+					next++
+				}
+			}
+		})
+	}
+}
+
 func TestChunkSliceWithSize(t *testing.T) {
 	size := 1001
 	slice := make([]int, size)
@@ -151,3 +191,21 @@ func TestChunkSliceWithSize(t *testing.T) {
 		t.Errorf("ChunkSliceWithSize failed")
 	}
 }
+
+func TestIsMetadataWithPrefix_ReturnsTrue_WhenKeyHasCustomPrefix(t *testing.T) {
+	type ts struct {
+		Key []byte
+	}
+
+	testData := ts{
+		Key: []byte("_custom:" + key),
+	}
+
+	if !IsMetadataWithPrefix(testData, "_custom:") {
+		t.Errorf("IsMetadataWithPrefix() = %v, want %v", IsMetadataWithPrefix(testData, "_custom:"), true)
+	}
+
+	if IsMetadata(testData) {
+		t.Errorf("IsMetadata() = %v, want %v", IsMetadata(testData), false)
+	}
+}
@@ -0,0 +1,29 @@
+package helpers
+
+import "runtime/debug"
+
+const ModulePath = "github.com/Trendyol/go-dcp"
+
+// Version returns the go-dcp module version from the build info of the binary.
+func Version() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "(devel)"
+	}
+
+	if info.Main.Path == ModulePath {
+		return info.Main.Version
+	}
+
+	for _, dep := range info.Deps {
+		if dep.Path == ModulePath {
+			return dep.Version
+		}
+	}
+
+	return "(devel)"
+}
+
+func DefaultClientIdentifier() string {
+	return "go-dcp/" + Version()
+}
@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/sirupsen/logrus"
@@ -54,6 +55,31 @@ func (loggers *Loggers) Log(level string, message string, args ...interface{}) {
 	loggers.Logrus.Log(logLevel, fmt.Sprintf(message, args...))
 }
 
+// Logw logs the message with the key-value pairs as logrus fields.
+func (loggers *Loggers) Logw(level string, message string, keysAndValues ...interface{}) {
+	logLevel, _ := logrus.ParseLevel(level)
+	loggers.Logrus.WithFields(fields(keysAndValues)).Log(logLevel, message)
+}
+
+var ErrLevelNotSupported = errors.New("logger does not support changing the level")
+
+// SetLevel changes the level of the default logger and the ones set with logrus.
+func SetLevel(logLevel string) error {
+	loggers, ok := Log.(*Loggers)
+	if !ok {
+		return ErrLevelNotSupported
+	}
+
+	level, err := logrus.ParseLevel(logLevel)
+	if err != nil {
+		return err
+	}
+
+	loggers.Logrus.SetLevel(level)
+
+	return nil
+}
+
 func InitDefaultLogger(logLevel string) {
 	logger := logrus.New()
 
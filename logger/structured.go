@@ -0,0 +1,161 @@
+package logger
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// StructuredLogger logs a message with key-value pairs, it matches the sugared loggers of zap and logr.
+type StructuredLogger interface {
+	Debug(message string, keysAndValues ...interface{})
+	Info(message string, keysAndValues ...interface{})
+	Warn(message string, keysAndValues ...interface{})
+	Error(message string, keysAndValues ...interface{})
+}
+
+// KeyValueLogger logs a message with key-value pairs of the call, like the vbucket and the seqNo of a stream.
+// The default logger and the ones of NewStructuredLogger implement it.
+type KeyValueLogger interface {
+	Logw(level string, message string, keysAndValues ...interface{})
+}
+
+// Debugw logs the message with the key-value pairs at debug level.
+func Debugw(message string, keysAndValues ...interface{}) {
+	logw(DEBUG, message, keysAndValues)
+}
+
+// Infow logs the message with the key-value pairs at info level.
+func Infow(message string, keysAndValues ...interface{}) {
+	logw(INFO, message, keysAndValues)
+}
+
+// Warnw logs the message with the key-value pairs at warn level.
+func Warnw(message string, keysAndValues ...interface{}) {
+	logw(WARN, message, keysAndValues)
+}
+
+// Errorw logs the message with the key-value pairs at error level.
+func Errorw(message string, keysAndValues ...interface{}) {
+	logw(ERROR, message, keysAndValues)
+}
+
+// logw appends the key-value pairs to the message when Log does not implement KeyValueLogger.
+func logw(level string, message string, keysAndValues []interface{}) {
+	if kvLogger, ok := Log.(KeyValueLogger); ok {
+		kvLogger.Logw(level, message, keysAndValues...)
+		return
+	}
+
+	for i := 0; i < len(keysAndValues); i += 2 {
+		var value interface{}
+		if i+1 < len(keysAndValues) {
+			value = keysAndValues[i+1]
+		}
+
+		message += fmt.Sprintf(", %v: %v", keysAndValues[i], value)
+	}
+
+	Log.Log(level, "%s", message)
+}
+
+type structuredLoggers struct {
+	logger        StructuredLogger
+	keysAndValues []interface{}
+}
+
+// NewStructuredLogger adapts a StructuredLogger to Logger, the formatted messages are logged with the given
+// key-value pairs. Trace messages are logged at debug level.
+func NewStructuredLogger(logger StructuredLogger, keysAndValues ...interface{}) Logger {
+	return &structuredLoggers{
+		logger:        logger,
+		keysAndValues: keysAndValues,
+	}
+}
+
+func (loggers *structuredLoggers) Trace(message string, args ...interface{}) {
+	loggers.Log(TRACE, message, args...)
+}
+
+func (loggers *structuredLoggers) Debug(message string, args ...interface{}) {
+	loggers.Log(DEBUG, message, args...)
+}
+
+func (loggers *structuredLoggers) Info(message string, args ...interface{}) {
+	loggers.Log(INFO, message, args...)
+}
+
+func (loggers *structuredLoggers) Warn(message string, args ...interface{}) {
+	loggers.Log(WARN, message, args...)
+}
+
+func (loggers *structuredLoggers) Error(message string, args ...interface{}) {
+	loggers.Log(ERROR, message, args...)
+}
+
+func (loggers *structuredLoggers) Log(level string, message string, args ...interface{}) {
+	loggers.Logw(level, fmt.Sprintf(message, args...))
+}
+
+// Logw logs the message with the bound key-value pairs followed by the given ones.
+func (loggers *structuredLoggers) Logw(level string, message string, keysAndValues ...interface{}) {
+	pairs := make([]interface{}, 0, len(loggers.keysAndValues)+len(keysAndValues))
+	pairs = append(pairs, loggers.keysAndValues...)
+	pairs = append(pairs, keysAndValues...)
+
+	switch level {
+	case ERROR:
+		loggers.logger.Error(message, pairs...)
+	case WARN:
+		loggers.logger.Warn(message, pairs...)
+	case INFO:
+		loggers.logger.Info(message, pairs...)
+	default:
+		loggers.logger.Debug(message, pairs...)
+	}
+}
+
+type logrusStructuredLogger struct {
+	logrus *logrus.Logger
+}
+
+// NewLogrusStructuredLogger adapts logrus to StructuredLogger, the key-value pairs become logrus fields.
+func NewLogrusStructuredLogger(logger *logrus.Logger) StructuredLogger {
+	return &logrusStructuredLogger{logrus: logger}
+}
+
+func (l *logrusStructuredLogger) Debug(message string, keysAndValues ...interface{}) {
+	l.log(logrus.DebugLevel, message, keysAndValues)
+}
+
+func (l *logrusStructuredLogger) Info(message string, keysAndValues ...interface{}) {
+	l.log(logrus.InfoLevel, message, keysAndValues)
+}
+
+func (l *logrusStructuredLogger) Warn(message string, keysAndValues ...interface{}) {
+	l.log(logrus.WarnLevel, message, keysAndValues)
+}
+
+func (l *logrusStructuredLogger) Error(message string, keysAndValues ...interface{}) {
+	l.log(logrus.ErrorLevel, message, keysAndValues)
+}
+
+func (l *logrusStructuredLogger) log(level logrus.Level, message string, keysAndValues []interface{}) {
+	l.logrus.WithFields(fields(keysAndValues)).Log(level, message)
+}
+
+// fields pairs the keys with their values, a key without a value gets nil and non string keys are formatted.
+func fields(keysAndValues []interface{}) logrus.Fields {
+	f := make(logrus.Fields, (len(keysAndValues)+1)/2)
+
+	for i := 0; i < len(keysAndValues); i += 2 {
+		var value interface{}
+		if i+1 < len(keysAndValues) {
+			value = keysAndValues[i+1]
+		}
+
+		f[fmt.Sprint(keysAndValues[i])] = value
+	}
+
+	return f
+}
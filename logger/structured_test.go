@@ -0,0 +1,99 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestStructuredLoggerLogsFormattedMessageWithFields(t *testing.T) {
+	output := &bytes.Buffer{}
+
+	logrusLogger := logrus.New()
+	logrusLogger.SetOutput(output)
+	logrusLogger.SetFormatter(&logrus.JSONFormatter{})
+	logrusLogger.SetLevel(logrus.DebugLevel)
+
+	logger := NewStructuredLogger(NewLogrusStructuredLogger(logrusLogger), "group", "orders", "dangling")
+	logger.Warn("cannot open stream, vbID: %d", 7)
+
+	var entry map[string]any
+	if err := json.Unmarshal(output.Bytes(), &entry); err != nil {
+		t.Fatalf("log entry is expected to be json, err: %v", err)
+	}
+
+	if entry["msg"] != "cannot open stream, vbID: 7" || entry["level"] != "warning" {
+		t.Errorf("warn message is expected to be formatted, got: %v", entry)
+	}
+
+	if entry["group"] != "orders" || entry["dangling"] != nil {
+		t.Errorf("key-value pairs are expected as fields, got: %v", entry)
+	}
+
+	output.Reset()
+	logger.Trace("trace")
+
+	if err := json.Unmarshal(output.Bytes(), &entry); err != nil || entry["level"] != "debug" {
+		t.Errorf("trace is expected to be logged at debug level, got: %v", entry)
+	}
+}
+
+type messageLogger struct {
+	messages []string
+}
+
+func (l *messageLogger) Trace(message string, args ...interface{}) { l.Log(TRACE, message, args...) }
+func (l *messageLogger) Debug(message string, args ...interface{}) { l.Log(DEBUG, message, args...) }
+func (l *messageLogger) Info(message string, args ...interface{})  { l.Log(INFO, message, args...) }
+func (l *messageLogger) Warn(message string, args ...interface{})  { l.Log(WARN, message, args...) }
+func (l *messageLogger) Error(message string, args ...interface{}) { l.Log(ERROR, message, args...) }
+
+func (l *messageLogger) Log(level string, message string, args ...interface{}) {
+	l.messages = append(l.messages, level+" "+fmt.Sprintf(message, args...))
+}
+
+func TestKeyValueLoggingAddsFieldsOfTheCall(t *testing.T) {
+	previous := Log
+	defer func() { Log = previous }()
+
+	output := &bytes.Buffer{}
+
+	logrusLogger := logrus.New()
+	logrusLogger.SetOutput(output)
+	logrusLogger.SetFormatter(&logrus.JSONFormatter{})
+
+	for name, log := range map[string]Logger{
+		"default":    &Loggers{Logrus: logrusLogger},
+		"structured": NewStructuredLogger(NewLogrusStructuredLogger(logrusLogger), "group", "orders"),
+	} {
+		output.Reset()
+		Log = log
+
+		Warnw("cannot open stream", "vbID", 7, "seqNo", uint64(42))
+
+		var entry map[string]any
+		if err := json.Unmarshal(output.Bytes(), &entry); err != nil {
+			t.Fatalf("%v log entry is expected to be json, err: %v", name, err)
+		}
+
+		if entry["msg"] != "cannot open stream" || entry["vbID"] != float64(7) || entry["seqNo"] != float64(42) {
+			t.Errorf("%v logger is expected to log the key-value pairs as fields, got: %v", name, entry)
+		}
+
+		if name == "structured" && entry["group"] != "orders" {
+			t.Errorf("structured logger is expected to keep the bound fields, got: %v", entry)
+		}
+	}
+
+	plain := &messageLogger{}
+	Log = plain
+
+	Infow("offset reset, 100%", "vbID", 3, "dangling")
+
+	if len(plain.messages) != 1 || plain.messages[0] != "INFO offset reset, 100%, vbID: 3, dangling: <nil>" {
+		t.Errorf("key-value pairs are expected in the message of a plain logger, got: %v", plain.messages)
+	}
+}
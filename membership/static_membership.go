@@ -1,7 +1,10 @@
 package membership
 
 import (
+	"fmt"
+
 	"github.com/Trendyol/go-dcp/config"
+	"github.com/Trendyol/go-dcp/logger"
 )
 
 type staticMembership struct {
@@ -16,10 +19,22 @@ func (s *staticMembership) Close() {
 }
 
 func NewStaticMembership(config *config.Dcp) Membership {
+	memberNumber := config.Dcp.Group.Membership.MemberNumber
+	totalMembers := config.Dcp.Group.Membership.TotalMembers
+
+	if memberNumber < 1 || memberNumber > totalMembers {
+		err := fmt.Errorf("memberNumber must be between 1 and totalMembers")
+		logger.Log.Error(
+			"error while static membership memberNumber: %v, totalMembers: %v, err: %v",
+			memberNumber, totalMembers, err,
+		)
+		panic(err)
+	}
+
 	return &staticMembership{
 		info: &Model{
-			MemberNumber: config.Dcp.Group.Membership.MemberNumber,
-			TotalMembers: config.Dcp.Group.Membership.TotalMembers,
+			MemberNumber: memberNumber,
+			TotalMembers: totalMembers,
 		},
 	}
 }
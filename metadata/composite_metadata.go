@@ -0,0 +1,77 @@
+package metadata
+
+import (
+	"reflect"
+
+	"github.com/Trendyol/go-dcp/logger"
+	"github.com/Trendyol/go-dcp/models"
+	"github.com/Trendyol/go-dcp/wrapper"
+)
+
+type compositeMetadata struct {
+	primary     Metadata
+	secondaries []Metadata
+}
+
+func (s *compositeMetadata) Save(state map[uint16]*models.CheckpointDocument, dirtyOffsets map[uint16]bool, bucketUUID string) error {
+	if err := s.primary.Save(state, dirtyOffsets, bucketUUID); err != nil {
+		return err
+	}
+
+	for _, secondary := range s.secondaries {
+		if err := secondary.Save(state, dirtyOffsets, bucketUUID); err != nil {
+			logger.Log.Warn("error while saving to secondary metadata %v, err: %v", reflect.TypeOf(secondary), err)
+		}
+	}
+
+	return nil
+}
+
+// Load falls back to the secondaries in order only when the primary fails, a primary without checkpoint is
+// trusted since it is empty after a clear or an offset reset that the secondaries may not have seen.
+func (s *compositeMetadata) Load(
+	vbIds []uint16,
+	bucketUUID string,
+) (*wrapper.ConcurrentSwissMap[uint16, *models.CheckpointDocument], bool, error) {
+	state, exist, err := s.primary.Load(vbIds, bucketUUID)
+	if err == nil {
+		return state, exist, nil
+	}
+
+	logger.Log.Warn("error while loading from primary metadata, err: %v, trying secondaries", err)
+
+	for _, secondary := range s.secondaries {
+		secondaryState, secondaryExist, secondaryErr := secondary.Load(vbIds, bucketUUID)
+		if secondaryErr != nil {
+			logger.Log.Warn("error while loading from secondary metadata %v, err: %v", reflect.TypeOf(secondary), secondaryErr)
+			continue
+		}
+
+		logger.Log.Info("loaded checkpoint from secondary metadata %v", reflect.TypeOf(secondary))
+		return secondaryState, secondaryExist, nil
+	}
+
+	return state, exist, err
+}
+
+func (s *compositeMetadata) Clear(vbIds []uint16) error {
+	if err := s.primary.Clear(vbIds); err != nil {
+		return err
+	}
+
+	for _, secondary := range s.secondaries {
+		if err := secondary.Clear(vbIds); err != nil {
+			logger.Log.Warn("error while clearing secondary metadata %v, err: %v", reflect.TypeOf(secondary), err)
+		}
+	}
+
+	return nil
+}
+
+// NewCompositeMetadata writes to the primary and, best-effort, to every secondary.
+func NewCompositeMetadata(primary Metadata, secondaries ...Metadata) Metadata {
+	return &compositeMetadata{
+		primary:     primary,
+		secondaries: secondaries,
+	}
+}
@@ -0,0 +1,105 @@
+package metadata
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Trendyol/go-dcp/logger"
+	"github.com/Trendyol/go-dcp/models"
+	"github.com/Trendyol/go-dcp/wrapper"
+)
+
+type fakeMetadata struct {
+	err   error
+	saved int
+	exist bool
+}
+
+func (f *fakeMetadata) Save(_ map[uint16]*models.CheckpointDocument, _ map[uint16]bool, _ string) error {
+	if f.err != nil {
+		return f.err
+	}
+
+	f.saved++
+	return nil
+}
+
+func (f *fakeMetadata) Load(vbIds []uint16, bucketUUID string) (*wrapper.ConcurrentSwissMap[uint16, *models.CheckpointDocument], bool, error) { //nolint:lll
+	if f.err != nil {
+		return nil, false, f.err
+	}
+
+	state := wrapper.CreateConcurrentSwissMap[uint16, *models.CheckpointDocument](1024)
+	for _, vbID := range vbIds {
+		state.Store(vbID, models.NewEmptyCheckpointDocument(bucketUUID))
+	}
+
+	return state, f.exist, nil
+}
+
+func (f *fakeMetadata) Clear(_ []uint16) error {
+	return f.err
+}
+
+func init() {
+	logger.InitDefaultLogger("error")
+}
+
+func TestCompositeMetadata_Save(t *testing.T) {
+	primary := &fakeMetadata{}
+	secondary := &fakeMetadata{err: errors.New("secondary is down")}
+
+	err := NewCompositeMetadata(primary, secondary).Save(nil, nil, "")
+	if err != nil {
+		t.Errorf("Unexpected result. got %v", err)
+	}
+
+	if primary.saved != 1 {
+		t.Errorf("Primary is not saved")
+	}
+}
+
+func TestCompositeMetadata_SavePrimaryFailure(t *testing.T) {
+	primary := &fakeMetadata{err: errors.New("primary is down")}
+	secondary := &fakeMetadata{}
+
+	err := NewCompositeMetadata(primary, secondary).Save(nil, nil, "")
+	if err == nil {
+		t.Errorf("Unexpected result. expected error")
+	}
+
+	if secondary.saved != 0 {
+		t.Errorf("Secondary is saved after primary failure")
+	}
+}
+
+func TestCompositeMetadata_LoadFallback(t *testing.T) {
+	primary := &fakeMetadata{err: errors.New("primary is down")}
+	secondary := &fakeMetadata{exist: true}
+
+	state, exist, err := NewCompositeMetadata(primary, secondary).Load([]uint16{0, 1}, "uuid")
+	if err != nil || !exist || state.Count() != 2 {
+		t.Errorf("Unexpected result. got exist: %v, err: %v", exist, err)
+	}
+}
+
+func TestCompositeMetadata_LoadTrustsEmptyPrimary(t *testing.T) {
+	primary := &fakeMetadata{}
+	secondary := &fakeMetadata{exist: true}
+
+	_, exist, err := NewCompositeMetadata(primary, secondary).Load([]uint16{0, 1}, "uuid")
+	if err != nil || exist {
+		t.Errorf("Unexpected result. got exist: %v, err: %v", exist, err)
+	}
+}
+
+func TestCompositeMetadata_LoadAllFailures(t *testing.T) {
+	primaryErr := errors.New("primary is down")
+	primary := &fakeMetadata{err: primaryErr}
+	secondary := &fakeMetadata{err: errors.New("secondary is down")}
+
+	_, _, err := NewCompositeMetadata(primary, secondary).Load([]uint16{0}, "uuid")
+	if !errors.Is(err, primaryErr) {
+		t.Errorf("Unexpected result. got %v want %v", err, primaryErr)
+	}
+}
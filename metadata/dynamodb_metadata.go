@@ -0,0 +1,232 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Trendyol/go-dcp/config"
+	"github.com/Trendyol/go-dcp/logger"
+	"github.com/Trendyol/go-dcp/models"
+	"github.com/Trendyol/go-dcp/wrapper"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/json-iterator/go"
+)
+
+const (
+	dynamoDBBatchWriteLimit = 25
+	dynamoDBBatchGetLimit   = 100
+	dynamoDBRetryDelay      = 50 * time.Millisecond
+	dynamoDBKeyAttribute    = "id"
+	dynamoDBValueAttribute  = "checkpoint"
+)
+
+// dynamoDBMetadata stores every vbucket checkpoint as an item keyed by its checkpoint id, so the group
+// name and the vbID are part of the key. The client uses the credentials of the default aws chain.
+type dynamoDBMetadata struct {
+	client    *dynamodb.Client
+	config    *config.DynamoDBMetadata
+	groupName string
+	prefix    string
+	timeout   time.Duration
+}
+
+// waitUnprocessed waits before the unprocessed items of a batch are sent again.
+func waitUnprocessed(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(dynamoDBRetryDelay):
+		return nil
+	}
+}
+
+// batchWrite sends the requests in chunks of the batch limit and sends unprocessed items again until
+// all of them are written or ctx is done.
+func (s *dynamoDBMetadata) batchWrite(requests []types.WriteRequest) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	for len(requests) > 0 {
+		chunk := requests[:min(len(requests), dynamoDBBatchWriteLimit)]
+		requests = requests[len(chunk):]
+
+		for len(chunk) > 0 {
+			output, err := s.client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+				RequestItems: map[string][]types.WriteRequest{s.config.Table: chunk},
+			})
+			if err != nil {
+				return err
+			}
+
+			chunk = output.UnprocessedItems[s.config.Table]
+			if len(chunk) > 0 {
+				if err := waitUnprocessed(ctx); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *dynamoDBMetadata) key(vbID uint16) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		dynamoDBKeyAttribute: &types.AttributeValueMemberS{Value: string(GetCheckpointID(vbID, s.groupName, s.prefix))},
+	}
+}
+
+func attributeString(item map[string]types.AttributeValue, name string) string {
+	if value, ok := item[name].(*types.AttributeValueMemberS); ok {
+		return value.Value
+	}
+
+	return ""
+}
+
+func (s *dynamoDBMetadata) Save(state map[uint16]*models.CheckpointDocument, dirtyOffsets map[uint16]bool, _ string) error {
+	var requests []types.WriteRequest
+
+	for vbID, doc := range state {
+		if !dirtyOffsets[vbID] {
+			continue
+		}
+
+		payload, _ := jsoniter.Marshal(doc)
+
+		item := s.key(vbID)
+		item[dynamoDBValueAttribute] = &types.AttributeValueMemberS{Value: string(payload)}
+
+		requests = append(requests, types.WriteRequest{PutRequest: &types.PutRequest{Item: item}})
+	}
+
+	return s.batchWrite(requests)
+}
+
+func (s *dynamoDBMetadata) Load(vbIds []uint16, bucketUUID string) (*wrapper.ConcurrentSwissMap[uint16, *models.CheckpointDocument], bool, error) { //nolint:lll
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	state := wrapper.CreateConcurrentSwissMap[uint16, *models.CheckpointDocument](1024)
+	vbIDsByKey := make(map[string]uint16, len(vbIds))
+
+	for _, vbID := range vbIds {
+		vbIDsByKey[string(GetCheckpointID(vbID, s.groupName, s.prefix))] = vbID
+		state.Store(vbID, models.NewEmptyCheckpointDocument(bucketUUID))
+	}
+
+	exist := false
+
+	for start := 0; start < len(vbIds); start += dynamoDBBatchGetLimit {
+		keys := make([]map[string]types.AttributeValue, 0, dynamoDBBatchGetLimit)
+		for _, vbID := range vbIds[start:min(len(vbIds), start+dynamoDBBatchGetLimit)] {
+			keys = append(keys, s.key(vbID))
+		}
+
+		for len(keys) > 0 {
+			output, err := s.client.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+				RequestItems: map[string]types.KeysAndAttributes{s.config.Table: {Keys: keys, ConsistentRead: aws.Bool(true)}},
+			})
+			if err != nil {
+				return nil, false, err
+			}
+
+			for _, item := range output.Responses[s.config.Table] {
+				vbID, ok := vbIDsByKey[attributeString(item, dynamoDBKeyAttribute)]
+				if !ok {
+					continue
+				}
+
+				var doc *models.CheckpointDocument
+				if err := jsoniter.Unmarshal([]byte(attributeString(item, dynamoDBValueAttribute)), &doc); err != nil || doc == nil {
+					logger.Log.Warn("corrupted checkpoint, vbID: %d, err: %v", vbID, err)
+					continue
+				}
+
+				state.Store(vbID, doc)
+				exist = true
+			}
+
+			keys = output.UnprocessedKeys[s.config.Table].Keys
+			if len(keys) > 0 {
+				if err := waitUnprocessed(ctx); err != nil {
+					return nil, false, err
+				}
+			}
+		}
+	}
+
+	return state, exist, nil
+}
+
+func (s *dynamoDBMetadata) Clear(vbIds []uint16) error {
+	requests := make([]types.WriteRequest, 0, len(vbIds))
+
+	for _, vbID := range vbIds {
+		requests = append(requests, types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: s.key(vbID)}})
+	}
+
+	return s.batchWrite(requests)
+}
+
+func NewDynamoDBMetadata(config *config.Dcp) Metadata {
+	if !config.IsDynamoDBMetadata() {
+		err := errors.New("unsupported metadata type")
+		logger.Log.Error("error while initialize dynamodb metadata, err: %v", err)
+		panic(err)
+	}
+
+	dynamoDBConfig := config.GetDynamoDBMetadata()
+
+	if _, err := url.Parse(dynamoDBConfig.Endpoint); err != nil {
+		logger.Log.Error("error while parse dynamodb metadata endpoint, err: %v", err)
+		panic(err)
+	}
+
+	proxy, err := config.Proxy.ProxyFunc()
+	if err != nil {
+		logger.Log.Error("error while create dynamodb metadata proxy, err: %v", err)
+		panic(err)
+	}
+
+	httpClient := awshttp.NewBuildableClient().WithTransportOptions(func(transport *http.Transport) {
+		transport.Proxy = proxy
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.Checkpoint.Timeout)
+	defer cancel()
+
+	// the default chain resolves the credentials from the environment, the shared config and credentials files,
+	// web identity, the container and the instance metadata, and refreshes them before they expire
+	awsConfig, err := awsconfig.LoadDefaultConfig(ctx,
+		awsconfig.WithRegion(dynamoDBConfig.Region),
+		awsconfig.WithHTTPClient(httpClient),
+	)
+	if err != nil {
+		logger.Log.Error("error while load dynamodb metadata aws config, err: %v", err)
+		panic(err)
+	}
+
+	client := dynamodb.NewFromConfig(awsConfig, func(options *dynamodb.Options) {
+		if dynamoDBConfig.Endpoint != "" {
+			options.BaseEndpoint = aws.String(dynamoDBConfig.Endpoint)
+		}
+	})
+
+	return &dynamoDBMetadata{
+		client:    client,
+		config:    dynamoDBConfig,
+		groupName: config.Dcp.Group.Name,
+		prefix:    config.Metadata.Prefix,
+		timeout:   config.Checkpoint.Timeout,
+	}
+}
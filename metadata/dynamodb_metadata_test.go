@@ -0,0 +1,218 @@
+package metadata
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Trendyol/go-dcp/config"
+	"github.com/Trendyol/go-dcp/helpers"
+	"github.com/Trendyol/go-dcp/models"
+
+	"github.com/json-iterator/go"
+)
+
+// the wire format of the dynamodb json protocol, holding the string attributes only
+type dynamoDBAttribute struct {
+	S string `json:"S"`
+}
+
+type dynamoDBItem map[string]dynamoDBAttribute
+
+type dynamoDBPutRequest struct {
+	Item dynamoDBItem `json:"Item"`
+}
+
+type dynamoDBDeleteRequest struct {
+	Key dynamoDBItem `json:"Key"`
+}
+
+type dynamoDBWriteRequest struct {
+	PutRequest    *dynamoDBPutRequest    `json:"PutRequest,omitempty"`
+	DeleteRequest *dynamoDBDeleteRequest `json:"DeleteRequest,omitempty"`
+}
+
+type dynamoDBKeysAndAttributes struct {
+	Keys           []dynamoDBItem `json:"Keys"`
+	ConsistentRead bool           `json:"ConsistentRead"`
+}
+
+type dynamoDBBatchGetResponse struct {
+	Responses map[string][]dynamoDBItem `json:"Responses"`
+}
+
+const dynamoDBTargetPrefix = "DynamoDB_20120810."
+
+// fakeDynamoDB keeps the items of a single table and leaves the first write unprocessed once.
+type fakeDynamoDB struct {
+	items       map[string]dynamoDBItem
+	lock        sync.Mutex
+	unprocessed bool
+}
+
+func (f *fakeDynamoDB) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+
+	switch r.Header.Get("X-Amz-Target") {
+	case dynamoDBTargetPrefix + "BatchWriteItem":
+		var input struct {
+			RequestItems map[string][]dynamoDBWriteRequest
+		}
+		_ = jsoniter.Unmarshal(body, &input)
+
+		requests := input.RequestItems["checkpoints"]
+		if !f.unprocessed && len(requests) > 1 {
+			f.unprocessed = true
+			_, _ = w.Write([]byte(`{"UnprocessedItems":{"checkpoints":[` + string(mustMarshal(requests[1])) + `]}}`))
+			requests = requests[:1]
+		} else {
+			_, _ = w.Write([]byte(`{}`))
+		}
+
+		for _, request := range requests {
+			if request.PutRequest != nil {
+				f.items[request.PutRequest.Item[dynamoDBKeyAttribute].S] = request.PutRequest.Item
+			}
+			if request.DeleteRequest != nil {
+				delete(f.items, request.DeleteRequest.Key[dynamoDBKeyAttribute].S)
+			}
+		}
+	case dynamoDBTargetPrefix + "BatchGetItem":
+		var input struct {
+			RequestItems map[string]dynamoDBKeysAndAttributes
+		}
+		_ = jsoniter.Unmarshal(body, &input)
+
+		var items []dynamoDBItem
+		for _, key := range input.RequestItems["checkpoints"].Keys {
+			if item, ok := f.items[key[dynamoDBKeyAttribute].S]; ok {
+				items = append(items, item)
+			}
+		}
+
+		_, _ = w.Write(mustMarshal(dynamoDBBatchGetResponse{Responses: map[string][]dynamoDBItem{"checkpoints": items}}))
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func mustMarshal(v interface{}) []byte {
+	data, _ := jsoniter.Marshal(v)
+	return data
+}
+
+func TestDynamoDBMetadata_SaveLoadClear(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	server := &fakeDynamoDB{items: map[string]dynamoDBItem{}}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	dynamoDB := NewDynamoDBMetadata(&config.Dcp{
+		Metadata: config.Metadata{
+			Type:   config.MetadataTypeDynamoDB,
+			Prefix: helpers.Prefix,
+			Config: map[string]string{
+				config.DynamoDBMetadataTableConfig:    "checkpoints",
+				config.DynamoDBMetadataRegionConfig:   "eu-west-1",
+				config.DynamoDBMetadataEndpointConfig: httpServer.URL,
+			},
+		},
+		Dcp:        config.ExternalDcp{Group: config.DCPGroup{Name: "group"}},
+		Checkpoint: config.Checkpoint{Timeout: time.Second},
+	})
+
+	doc := models.NewEmptyCheckpointDocument("uuid")
+	doc.Checkpoint.SeqNo = 42
+
+	err := dynamoDB.Save(map[uint16]*models.CheckpointDocument{1: doc, 2: doc, 3: doc}, map[uint16]bool{1: true, 2: true}, "uuid")
+	if err != nil {
+		t.Fatalf("Unexpected save error: %v", err)
+	}
+
+	server.lock.Lock()
+	if len(server.items) != 2 {
+		t.Errorf("Unexpected item count. got %v want %v", len(server.items), 2)
+	}
+	server.lock.Unlock()
+
+	state, exist, err := dynamoDB.Load([]uint16{1, 2, 3}, "uuid")
+	if err != nil || !exist {
+		t.Fatalf("Unexpected load result. exist: %v, err: %v", exist, err)
+	}
+
+	if loaded, _ := state.Load(2); loaded.Checkpoint.SeqNo != 42 {
+		t.Errorf("Unexpected seqNo. got %v want %v", loaded.Checkpoint.SeqNo, 42)
+	}
+
+	if empty, _ := state.Load(3); empty.Checkpoint.SeqNo != 0 {
+		t.Errorf("Unexpected seqNo. got %v want %v", empty.Checkpoint.SeqNo, 0)
+	}
+
+	if err = dynamoDB.Clear([]uint16{1, 2, 3}); err != nil {
+		t.Fatalf("Unexpected clear error: %v", err)
+	}
+
+	if _, exist, _ = dynamoDB.Load([]uint16{1, 2, 3}, "uuid"); exist {
+		t.Errorf("Checkpoint is not cleared")
+	}
+}
+
+func TestDynamoDBMetadata_UsesProxy(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	server := &fakeDynamoDB{items: map[string]dynamoDBItem{}}
+
+	var proxiedHost string
+	var proxiedHostLock sync.Mutex
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxiedHostLock.Lock()
+		proxiedHost = r.Host
+		proxiedHostLock.Unlock()
+
+		server.ServeHTTP(w, r)
+	}))
+	defer proxy.Close()
+
+	dynamoDB := NewDynamoDBMetadata(&config.Dcp{
+		Metadata: config.Metadata{
+			Type:   config.MetadataTypeDynamoDB,
+			Prefix: helpers.Prefix,
+			Config: map[string]string{
+				config.DynamoDBMetadataTableConfig:    "checkpoints",
+				config.DynamoDBMetadataRegionConfig:   "eu-west-1",
+				config.DynamoDBMetadataEndpointConfig: "http://dynamodb.proxied.test",
+			},
+		},
+		Dcp:        config.ExternalDcp{Group: config.DCPGroup{Name: "group"}},
+		Checkpoint: config.Checkpoint{Timeout: time.Second},
+		Proxy:      config.Proxy{URL: proxy.URL},
+	})
+
+	doc := models.NewEmptyCheckpointDocument("uuid")
+
+	if err := dynamoDB.Save(map[uint16]*models.CheckpointDocument{1: doc}, map[uint16]bool{1: true}, "uuid"); err != nil {
+		t.Fatalf("Unexpected save error: %v", err)
+	}
+
+	proxiedHostLock.Lock()
+	defer proxiedHostLock.Unlock()
+
+	if proxiedHost != "dynamodb.proxied.test" {
+		t.Errorf("Unexpected proxied host. got %v want %v", proxiedHost, "dynamodb.proxied.test")
+	}
+}
@@ -1,6 +1,11 @@
 package metadata
 
 import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/Trendyol/go-dcp/logger"
 	"github.com/Trendyol/go-dcp/models"
 	"github.com/Trendyol/go-dcp/wrapper"
 )
@@ -10,3 +15,13 @@ type Metadata interface {
 	Load(vbIds []uint16, bucketUUID string) (*wrapper.ConcurrentSwissMap[uint16, *models.CheckpointDocument], bool, error)
 	Clear(vbIds []uint16) error
 }
+
+func GetCheckpointID(vbID uint16, groupName string, prefix string) []byte {
+	// _connector:cbgo:groupName:checkpoint:vbId with the default prefix
+	if strings.Contains(groupName, ".") {
+		err := errors.New("unsupported group name includes dot")
+		logger.Log.Error("error while get checkpoint id, err: %v", err)
+		panic(err)
+	}
+	return []byte(prefix + groupName + ":checkpoint:" + strconv.Itoa(int(vbID)))
+}
@@ -0,0 +1,41 @@
+package metadata
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Trendyol/go-dcp/helpers"
+)
+
+func TestGetCheckpointID(t *testing.T) {
+	expected := []byte("_connector:cbgo:group1:checkpoint:1")
+	actual := GetCheckpointID(uint16(1), "group1", helpers.Prefix)
+	if !bytes.Equal(actual, expected) {
+		t.Errorf("Unexpected result. Expected: %s, Got: %s", expected, actual)
+	}
+}
+
+func TestGetCheckpointIDWithInvalidGroupName(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("Expected panic but did not occur")
+		}
+	}()
+
+	GetCheckpointID(uint16(1), "group.with.dot", helpers.Prefix)
+}
+
+func TestGetCheckpointIDIsUniquePerGroup(t *testing.T) {
+	groups := []string{"group1", "group2", "group10", "group", "1"}
+	ids := map[string]string{}
+
+	for _, group := range groups {
+		for vbID := uint16(0); vbID < 1024; vbID++ {
+			id := string(GetCheckpointID(vbID, group, helpers.Prefix))
+			if previous, exists := ids[id]; exists {
+				t.Fatalf("checkpoint id %s of group %s, vbID %d collides with %s", id, group, vbID, previous)
+			}
+			ids[id] = group
+		}
+	}
+}
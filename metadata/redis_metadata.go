@@ -0,0 +1,195 @@
+package metadata
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Trendyol/go-dcp/config"
+	"github.com/Trendyol/go-dcp/logger"
+	"github.com/Trendyol/go-dcp/models"
+	"github.com/Trendyol/go-dcp/wrapper"
+
+	"github.com/json-iterator/go"
+	"github.com/redis/go-redis/v9"
+)
+
+var errRedisNoCertificateInRootCA = errors.New("no certificate found in the redis metadata root ca")
+
+// redisMetadata keeps every vbucket checkpoint under its checkpoint id. The commands of a call are pipelined one
+// key each, so the keys do not need to share a slot on clusters.
+type redisMetadata struct {
+	client    redis.UniversalClient
+	groupName string
+	prefix    string
+	timeout   time.Duration
+}
+
+func (s *redisMetadata) Save(state map[uint16]*models.CheckpointDocument, dirtyOffsets map[uint16]bool, _ string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	pipe := s.client.Pipeline()
+
+	for vbID, doc := range state {
+		if dirtyOffsets[vbID] {
+			payload, _ := jsoniter.Marshal(doc)
+			pipe.Set(ctx, string(GetCheckpointID(vbID, s.groupName, s.prefix)), payload, 0)
+		}
+	}
+
+	if pipe.Len() == 0 {
+		return nil
+	}
+
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (s *redisMetadata) Load(vbIds []uint16, bucketUUID string) (*wrapper.ConcurrentSwissMap[uint16, *models.CheckpointDocument], bool, error) { //nolint:lll
+	state := wrapper.CreateConcurrentSwissMap[uint16, *models.CheckpointDocument](1024)
+
+	if len(vbIds) == 0 {
+		return state, false, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	pipe := s.client.Pipeline()
+
+	cmds := make([]*redis.StringCmd, 0, len(vbIds))
+	for _, vbID := range vbIds {
+		cmds = append(cmds, pipe.Get(ctx, string(GetCheckpointID(vbID, s.groupName, s.prefix))))
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, false, err
+	}
+
+	exist := false
+
+	for i, vbID := range vbIds {
+		doc := models.NewEmptyCheckpointDocument(bucketUUID)
+
+		value, err := cmds[i].Bytes()
+		switch {
+		case errors.Is(err, redis.Nil):
+		case err != nil:
+			return nil, false, err
+		default:
+			var loaded *models.CheckpointDocument
+			if err := jsoniter.Unmarshal(value, &loaded); err != nil || loaded == nil {
+				logger.Log.Warn("corrupted checkpoint, vbID: %d, err: %v", vbID, err)
+			} else {
+				doc = loaded
+				exist = true
+			}
+		}
+
+		state.Store(vbID, doc)
+	}
+
+	return state, exist, nil
+}
+
+func (s *redisMetadata) Clear(vbIds []uint16) error {
+	if len(vbIds) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	pipe := s.client.Pipeline()
+
+	for _, vbID := range vbIds {
+		pipe.Del(ctx, string(GetCheckpointID(vbID, s.groupName, s.prefix)))
+	}
+
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// newRedisTLSConfig trusts the root ca and presents the client certificate when they are configured.
+func newRedisTLSConfig(redisConfig *config.RedisMetadata) (*tls.Config, error) {
+	if !redisConfig.TLS {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         redisConfig.ServerName,
+		InsecureSkipVerify: redisConfig.InsecureSkipVerify, //nolint:gosec
+	}
+
+	if redisConfig.RootCAPath != "" {
+		cert, err := os.ReadFile(os.ExpandEnv(redisConfig.RootCAPath))
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(cert) {
+			return nil, fmt.Errorf("%w: %v", errRedisNoCertificateInRootCA, redisConfig.RootCAPath)
+		}
+	}
+
+	if redisConfig.ClientCertPath != "" {
+		certificate, err := tls.LoadX509KeyPair(os.ExpandEnv(redisConfig.ClientCertPath), os.ExpandEnv(redisConfig.ClientKeyPath))
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return tlsConfig, nil
+}
+
+func NewRedisMetadata(config *config.Dcp) Metadata {
+	if !config.IsRedisMetadata() {
+		err := errors.New("unsupported metadata type")
+		logger.Log.Error("error while initialize redis metadata, err: %v", err)
+		panic(err)
+	}
+
+	redisConfig := config.GetRedisMetadata()
+
+	tlsConfig, err := newRedisTLSConfig(redisConfig)
+	if err != nil {
+		logger.Log.Error("error while create redis metadata tls config, err: %v", err)
+		panic(err)
+	}
+
+	options := &redis.UniversalOptions{
+		Addrs:        strings.Split(redisConfig.Address, ","),
+		Username:     redisConfig.Username,
+		Password:     redisConfig.Password,
+		DB:           redisConfig.DB,
+		TLSConfig:    tlsConfig,
+		DialTimeout:  config.Checkpoint.Timeout,
+		ReadTimeout:  config.Checkpoint.Timeout,
+		WriteTimeout: config.Checkpoint.Timeout,
+	}
+
+	// a single address is the config endpoint of the cluster when cluster is set
+	var client redis.UniversalClient
+	if redisConfig.Cluster {
+		client = redis.NewClusterClient(options.Cluster())
+	} else {
+		client = redis.NewUniversalClient(options)
+	}
+
+	return &redisMetadata{
+		client:    client,
+		groupName: config.Dcp.Group.Name,
+		prefix:    config.Metadata.Prefix,
+		timeout:   config.Checkpoint.Timeout,
+	}
+}
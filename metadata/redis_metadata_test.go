@@ -0,0 +1,222 @@
+package metadata
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Trendyol/go-dcp/config"
+	"github.com/Trendyol/go-dcp/helpers"
+	"github.com/Trendyol/go-dcp/models"
+)
+
+// fakeRedis serves SET, GET and DEL from memory, the handshake commands of the client are refused so it falls back
+// to the defaults.
+type fakeRedis struct {
+	listener net.Listener
+	values   map[string]string
+	lock     sync.Mutex
+}
+
+// readRedisCommand reads a command sent as an array of bulk strings.
+func readRedisCommand(reader *bufio.Reader) ([]string, error) {
+	readLine := func() (string, error) {
+		line, err := reader.ReadString('\n')
+		return strings.TrimSuffix(line, "\r\n"), err
+	}
+
+	line, err := readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	size, _ := strconv.Atoi(strings.TrimPrefix(line, "*"))
+	args := make([]string, 0, size)
+
+	for i := 0; i < size; i++ {
+		if line, err = readLine(); err != nil {
+			return nil, err
+		}
+
+		length, _ := strconv.Atoi(strings.TrimPrefix(line, "$"))
+		data := make([]byte, length+2)
+		if _, err = io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+
+		args = append(args, string(data[:length]))
+	}
+
+	return args, nil
+}
+
+func (f *fakeRedis) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+
+	for {
+		args, err := readRedisCommand(reader)
+		if err != nil {
+			return
+		}
+
+		f.lock.Lock()
+		var response string
+		switch strings.ToUpper(args[0]) {
+		case "SET":
+			f.values[args[1]] = args[2]
+			response = "+OK\r\n"
+		case "GET":
+			if value, ok := f.values[args[1]]; ok {
+				response = "$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n"
+			} else {
+				response = "$-1\r\n"
+			}
+		case "DEL":
+			delete(f.values, args[1])
+			response = ":1\r\n"
+		default:
+			response = "-ERR unknown command\r\n"
+		}
+		f.lock.Unlock()
+
+		if _, err := conn.Write([]byte(response)); err != nil {
+			return
+		}
+	}
+}
+
+func newFakeRedis(t *testing.T, listener net.Listener) *fakeRedis {
+	server := &fakeRedis{listener: listener, values: map[string]string{}}
+	go server.serve()
+	t.Cleanup(func() { _ = listener.Close() })
+
+	return server
+}
+
+func newRedisTestConfig(redisConfig map[string]string) *config.Dcp {
+	return &config.Dcp{
+		Metadata: config.Metadata{
+			Type:   config.MetadataTypeRedis,
+			Prefix: helpers.Prefix,
+			Config: redisConfig,
+		},
+		Dcp:        config.ExternalDcp{Group: config.DCPGroup{Name: "group"}},
+		Checkpoint: config.Checkpoint{Timeout: time.Second},
+	}
+}
+
+func TestRedisMetadata_SaveLoadClear(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := newFakeRedis(t, listener)
+
+	redis := NewRedisMetadata(newRedisTestConfig(map[string]string{config.RedisMetadataAddressConfig: listener.Addr().String()}))
+
+	doc := models.NewEmptyCheckpointDocument("uuid")
+	doc.Checkpoint.SeqNo = 42
+
+	err = redis.Save(map[uint16]*models.CheckpointDocument{1: doc, 2: doc}, map[uint16]bool{1: true}, "uuid")
+	if err != nil {
+		t.Fatalf("Unexpected save error: %v", err)
+	}
+
+	server.lock.Lock()
+	if _, ok := server.values["_connector:cbgo:group:checkpoint:1"]; !ok || len(server.values) != 1 {
+		t.Errorf("Unexpected saved keys: %v", server.values)
+	}
+	server.lock.Unlock()
+
+	state, exist, err := redis.Load([]uint16{1, 2}, "uuid")
+	if err != nil || !exist {
+		t.Fatalf("Unexpected load result. exist: %v, err: %v", exist, err)
+	}
+
+	if loaded, _ := state.Load(1); loaded.Checkpoint.SeqNo != 42 {
+		t.Errorf("Unexpected seqNo. got %v want %v", loaded.Checkpoint.SeqNo, 42)
+	}
+
+	if empty, _ := state.Load(2); empty.Checkpoint.SeqNo != 0 {
+		t.Errorf("Unexpected seqNo. got %v want %v", empty.Checkpoint.SeqNo, 0)
+	}
+
+	if err = redis.Clear([]uint16{1, 2}); err != nil {
+		t.Fatalf("Unexpected clear error: %v", err)
+	}
+
+	if _, exist, _ = redis.Load([]uint16{1, 2}, "uuid"); exist {
+		t.Errorf("Checkpoint is not cleared")
+	}
+}
+
+func TestRedisMetadata_TLSWithRootCA(t *testing.T) {
+	// the certificate of the test server is issued for example.com by a ca the system does not trust
+	certificate := httptest.NewTLSServer(nil)
+	serverCertificate := certificate.TLS.Certificates[0]
+	certificate.Close()
+
+	rootCAPath := filepath.Join(t.TempDir(), "ca.pem")
+	leaf, err := x509.ParseCertificate(serverCertificate.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = os.WriteFile(rootCAPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw}), 0o600)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{serverCertificate},
+		MinVersion:   tls.VersionTLS12,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newFakeRedis(t, listener)
+
+	redis := NewRedisMetadata(newRedisTestConfig(map[string]string{
+		config.RedisMetadataAddressConfig:    listener.Addr().String(),
+		config.RedisMetadataTLSConfig:        "true",
+		config.RedisMetadataRootCAPathConfig: rootCAPath,
+		config.RedisMetadataServerNameConfig: "example.com",
+	}))
+
+	doc := models.NewEmptyCheckpointDocument("uuid")
+	if err = redis.Save(map[uint16]*models.CheckpointDocument{1: doc}, map[uint16]bool{1: true}, "uuid"); err != nil {
+		t.Fatalf("Unexpected save error: %v", err)
+	}
+
+	untrusted := NewRedisMetadata(newRedisTestConfig(map[string]string{
+		config.RedisMetadataAddressConfig:    listener.Addr().String(),
+		config.RedisMetadataTLSConfig:        "true",
+		config.RedisMetadataServerNameConfig: "example.com",
+	}))
+
+	if err = untrusted.Save(map[uint16]*models.CheckpointDocument{1: doc}, map[uint16]bool{1: true}, "uuid"); err == nil {
+		t.Errorf("Expected error for the certificate of an untrusted ca")
+	}
+}
@@ -0,0 +1,100 @@
+package metric
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Trendyol/go-dcp/couchbase"
+	"github.com/Trendyol/go-dcp/logger"
+	"github.com/Trendyol/go-dcp/stream"
+)
+
+type CheckpointLagSampler interface {
+	Start()
+	Stop()
+	Lags() map[uint16]uint64
+}
+
+// checkpointLagSampler fetches the high seqNos on its own interval instead of on every scrape, so the
+// lag between them and the saved checkpoints does not add server round trips to the collect path.
+type checkpointLagSampler struct {
+	client   couchbase.Client
+	stream   stream.Stream
+	lags     map[uint16]uint64
+	stopCh   chan struct{}
+	doneCh   chan struct{}
+	lock     sync.RWMutex
+	interval time.Duration
+}
+
+func (s *checkpointLagSampler) sample() {
+	seqNoMap, err := s.client.GetVBucketSeqNos(true)
+	if err != nil {
+		logger.Log.Debug("error while sampling checkpoint lag, err: %v", err)
+		return
+	}
+
+	lags := map[uint16]uint64{}
+
+	s.stream.GetCheckpointMetric().SavedSeqNos.Range(func(vbID uint16, savedSeqNo uint64) bool {
+		var lag uint64
+
+		seqNo, _ := seqNoMap.Load(vbID)
+		if seqNo > savedSeqNo {
+			lag = seqNo - savedSeqNo
+		}
+
+		lags[vbID] = lag
+
+		return true
+	})
+
+	s.lock.Lock()
+	s.lags = lags
+	s.lock.Unlock()
+}
+
+func (s *checkpointLagSampler) Lags() map[uint16]uint64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.lags
+}
+
+func (s *checkpointLagSampler) Start() {
+	go func() {
+		defer close(s.doneCh)
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.sample()
+			case <-s.stopCh:
+				return
+			}
+		}
+	}()
+
+	logger.Log.Debug("checkpoint lag sampler started, interval: %v", s.interval)
+}
+
+func (s *checkpointLagSampler) Stop() {
+	close(s.stopCh)
+	<-s.doneCh
+
+	logger.Log.Debug("checkpoint lag sampler stopped")
+}
+
+func NewCheckpointLagSampler(client couchbase.Client, stream stream.Stream, interval time.Duration) CheckpointLagSampler {
+	return &checkpointLagSampler{
+		client:   client,
+		stream:   stream,
+		lags:     map[uint16]uint64{},
+		stopCh:   make(chan struct{}),
+		doneCh:   make(chan struct{}),
+		interval: interval,
+	}
+}
@@ -15,9 +15,10 @@ import (
 )
 
 type metricCollector struct {
-	stream           stream.Stream
-	client           couchbase.Client
-	vBucketDiscovery stream.VBucketDiscovery
+	stream               stream.Stream
+	client               couchbase.Client
+	vBucketDiscovery     stream.VBucketDiscovery
+	checkpointLagSampler CheckpointLagSampler
 
 	mutation   *prometheus.Desc
 	deletion   *prometheus.Desc
@@ -31,14 +32,22 @@ type metricCollector struct {
 	endSeqNo     *prometheus.Desc
 	persistSeqNo *prometheus.Desc
 
-	processLatency *prometheus.Desc
-	dcpLatency     *prometheus.Desc
-	rebalance      *prometheus.Desc
+	processLatency      *prometheus.Desc
+	dcpLatency          *prometheus.Desc
+	rebalance           *prometheus.Desc
+	maxUnsavedOffsetAge *prometheus.Desc
+	closeStreamFailure  *prometheus.Desc
+	dedupSuppressed     *prometheus.Desc
+	listenerFailure     *prometheus.Desc
+	blockedVBucket      *prometheus.Desc
+	memoryPressure      *prometheus.Desc
 
 	lag      *prometheus.Desc
 	totalLag *prometheus.Desc
 
+	openStreamFailure *prometheus.Desc
 	activeStream      *prometheus.Desc
+	streamState       *prometheus.Desc
 	totalMembers      *prometheus.Desc
 	memberNumber      *prometheus.Desc
 	membershipType    *prometheus.Desc
@@ -48,6 +57,15 @@ type metricCollector struct {
 
 	offsetWrite        *prometheus.Desc
 	offsetWriteLatency *prometheus.Desc
+
+	checkpointSaveLatency *prometheus.Desc
+	checkpointSaveFailure *prometheus.Desc
+	checkpointLag         *prometheus.Desc
+
+	rollback           *prometheus.Desc
+	rollbackSeqNoDelta *prometheus.Desc
+
+	groupName string
 }
 
 func (s *metricCollector) Describe(ch chan<- *prometheus.Desc) {
@@ -99,6 +117,15 @@ func (s *metricCollector) Collect(ch chan<- prometheus.Metric) {
 		return true
 	})
 
+	for state, count := range observer.CountStreamStates() {
+		ch <- prometheus.MustNewConstMetric(
+			s.streamState,
+			prometheus.GaugeValue,
+			float64(count),
+			string(state),
+		)
+	}
+
 	queues := s.client.GetAgentQueues()
 	for i := range queues {
 		queue := queues[i]
@@ -189,10 +216,69 @@ func (s *metricCollector) Collect(ch chan<- prometheus.Metric) {
 		[]string{}...,
 	)
 
+	ch <- prometheus.MustNewConstMetric(
+		s.maxUnsavedOffsetAge,
+		prometheus.GaugeValue,
+		float64(s.stream.GetMaxUnsavedOffsetAge().Milliseconds()),
+		[]string{}...,
+	)
+
+	ch <- prometheus.MustNewConstMetric(
+		s.closeStreamFailure,
+		prometheus.CounterValue,
+		float64(streamMetric.CloseStreamFailure),
+		[]string{}...,
+	)
+
+	ch <- prometheus.MustNewConstMetric(
+		s.dedupSuppressed,
+		prometheus.CounterValue,
+		float64(streamMetric.DedupSuppressed.Load()),
+		[]string{}...,
+	)
+
+	ch <- prometheus.MustNewConstMetric(
+		s.listenerFailure,
+		prometheus.CounterValue,
+		float64(streamMetric.ListenerFailure.Load()),
+		[]string{}...,
+	)
+
+	ch <- prometheus.MustNewConstMetric(
+		s.blockedVBucket,
+		prometheus.GaugeValue,
+		float64(s.stream.GetBlockedVBucketCount()),
+		[]string{}...,
+	)
+
+	var memoryPressure float64
+	if streamMetric.MemoryPressure.Load() {
+		memoryPressure = 1
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		s.memoryPressure,
+		prometheus.GaugeValue,
+		memoryPressure,
+		[]string{}...,
+	)
+
+	streamMetric.OpenStreamFailures.Range(func(failure stream.OpenStreamFailure, count int64) bool {
+		ch <- prometheus.MustNewConstMetric(
+			s.openStreamFailure,
+			prometheus.CounterValue,
+			float64(count),
+			strconv.Itoa(int(failure.VbID)),
+			failure.Category,
+		)
+
+		return true
+	})
+
 	ch <- prometheus.MustNewConstMetric(
 		s.processLatency,
 		prometheus.GaugeValue,
-		float64(streamMetric.ProcessLatency),
+		float64(streamMetric.ProcessLatency.Load()),
 		[]string{}...,
 	)
 
@@ -269,14 +355,67 @@ func (s *metricCollector) Collect(ch chan<- prometheus.Metric) {
 		float64(checkpointMetric.OffsetWriteLatency),
 		[]string{}...,
 	)
+
+	saveCount, saveLatencySum, saveLatencyBuckets, saveFailures := checkpointMetric.Save.Snapshot()
+
+	ch <- prometheus.MustNewConstHistogram(
+		s.checkpointSaveLatency,
+		saveCount,
+		saveLatencySum,
+		saveLatencyBuckets,
+		s.groupName,
+	)
+
+	ch <- prometheus.MustNewConstMetric(
+		s.checkpointSaveFailure,
+		prometheus.CounterValue,
+		float64(saveFailures),
+		s.groupName,
+	)
+
+	rollbacks, rollbackCount, rollbackDeltaSum, rollbackDeltaBuckets := s.client.GetRollbackMetric().Snapshot()
+
+	for vbID, count := range rollbacks {
+		ch <- prometheus.MustNewConstMetric(
+			s.rollback,
+			prometheus.CounterValue,
+			float64(count),
+			strconv.Itoa(int(vbID)),
+		)
+	}
+
+	ch <- prometheus.MustNewConstHistogram(
+		s.rollbackSeqNoDelta,
+		rollbackCount,
+		rollbackDeltaSum,
+		rollbackDeltaBuckets,
+		[]string{}...,
+	)
+
+	for vbID, lag := range s.checkpointLagSampler.Lags() {
+		ch <- prometheus.MustNewConstMetric(
+			s.checkpointLag,
+			prometheus.GaugeValue,
+			float64(lag),
+			strconv.Itoa(int(vbID)),
+		)
+	}
 }
 
 //nolint:funlen
-func NewMetricCollector(client couchbase.Client, stream stream.Stream, vBucketDiscovery stream.VBucketDiscovery) *metricCollector {
+func NewMetricCollector(
+	client couchbase.Client,
+	stream stream.Stream,
+	vBucketDiscovery stream.VBucketDiscovery,
+	checkpointLagSampler CheckpointLagSampler,
+	groupName string,
+) *metricCollector {
 	return &metricCollector{
-		stream:           stream,
-		client:           client,
-		vBucketDiscovery: vBucketDiscovery,
+		stream:               stream,
+		client:               client,
+		vBucketDiscovery:     vBucketDiscovery,
+		checkpointLagSampler: checkpointLagSampler,
+		groupName:            groupName,
 
 		mutation: prometheus.NewDesc(
 			prometheus.BuildFQName(helpers.Name, "mutation", "total"),
@@ -362,12 +501,60 @@ func NewMetricCollector(client couchbase.Client, stream stream.Stream, vBucketDi
 			[]string{},
 			nil,
 		),
+		maxUnsavedOffsetAge: prometheus.NewDesc(
+			prometheus.BuildFQName(helpers.Name, "max_unsaved_offset_age_ms", "current"),
+			"Maximum time a vbucket offset has been advancing without being saved ms",
+			[]string{},
+			nil,
+		),
+		closeStreamFailure: prometheus.NewDesc(
+			prometheus.BuildFQName(helpers.Name, "close_stream_failure", "total"),
+			"Close stream failure count",
+			[]string{},
+			nil,
+		),
+		dedupSuppressed: prometheus.NewDesc(
+			prometheus.BuildFQName(helpers.Name, "dedup_suppressed", "total"),
+			"Re-delivered event count suppressed by dedup",
+			[]string{},
+			nil,
+		),
+		listenerFailure: prometheus.NewDesc(
+			prometheus.BuildFQName(helpers.Name, "listener_failure", "total"),
+			"Event count the listener failed after all retries",
+			[]string{},
+			nil,
+		),
+		blockedVBucket: prometheus.NewDesc(
+			prometheus.BuildFQName(helpers.Name, "blocked_vbucket", "current"),
+			"VBucket count blocked until a failed event is acknowledged",
+			[]string{},
+			nil,
+		),
+		memoryPressure: prometheus.NewDesc(
+			prometheus.BuildFQName(helpers.Name, "memory_pressure", "current"),
+			"Memory pressure flow control engaged",
+			[]string{},
+			nil,
+		),
 		activeStream: prometheus.NewDesc(
 			prometheus.BuildFQName(helpers.Name, "active_stream", "current"),
 			"Active stream",
 			[]string{},
 			nil,
 		),
+		streamState: prometheus.NewDesc(
+			prometheus.BuildFQName(helpers.Name, "stream_state", "current"),
+			"Vbucket streams by state",
+			[]string{"state"},
+			nil,
+		),
+		openStreamFailure: prometheus.NewDesc(
+			prometheus.BuildFQName(helpers.Name, "open_stream_failure", "total"),
+			"Open stream failure count",
+			[]string{"vbId", "category"},
+			nil,
+		),
 		totalMembers: prometheus.NewDesc(
 			prometheus.BuildFQName(helpers.Name, "total_members", "current"),
 			"Total members",
@@ -416,5 +603,35 @@ func NewMetricCollector(client couchbase.Client, stream stream.Stream, vBucketDi
 			[]string{},
 			nil,
 		),
+		checkpointSaveLatency: prometheus.NewDesc(
+			prometheus.BuildFQName(helpers.Name, "checkpoint_save_latency", "seconds"),
+			"Checkpoint save latency seconds",
+			[]string{"group"},
+			nil,
+		),
+		checkpointSaveFailure: prometheus.NewDesc(
+			prometheus.BuildFQName(helpers.Name, "checkpoint_save_failure", "total"),
+			"Failed checkpoint save count",
+			[]string{"group"},
+			nil,
+		),
+		checkpointLag: prometheus.NewDesc(
+			prometheus.BuildFQName(helpers.Name, "checkpoint_lag", "current"),
+			"Difference between the high seq no and the saved checkpoint seq no",
+			[]string{"vbId"},
+			nil,
+		),
+		rollback: prometheus.NewDesc(
+			prometheus.BuildFQName(helpers.Name, "rollback", "total"),
+			"Rollback count",
+			[]string{"vbId"},
+			nil,
+		),
+		rollbackSeqNoDelta: prometheus.NewDesc(
+			prometheus.BuildFQName(helpers.Name, "rollback_seq_no", "delta"),
+			"Seq nos streamed again after a rollback",
+			[]string{},
+			nil,
+		),
 	}
 }
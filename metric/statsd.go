@@ -0,0 +1,229 @@
+package metric
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Trendyol/go-dcp/config"
+	"github.com/Trendyol/go-dcp/logger"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// statsdMaxPacketSize keeps packets below the common network mtu to avoid fragmentation.
+const statsdMaxPacketSize = 1432
+
+type StatsdEmitter interface {
+	Start()
+	Stop()
+}
+
+type statsdEmitter struct {
+	registry *prometheus.Registry
+	conn     net.Conn
+	config   *config.Metric
+	ticker   *time.Ticker
+	counters map[string]float64
+	stopCh   chan struct{}
+	doneCh   chan struct{}
+}
+
+func sanitizeStatsdName(name string) string {
+	return strings.NewReplacer(":", "_", "|", "_", "@", "_", "#", "_", ",", "_", " ", "_").Replace(name)
+}
+
+// line renders a sample, dogstatsd gets the labels as tags while plain statsd gets the label values in the name.
+func (s *statsdEmitter) line(name string, labels map[string]string, value float64, metricType string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	if s.config.Statsd.Prefix != "" {
+		name = s.config.Statsd.Prefix + "." + name
+	}
+
+	if !s.config.Statsd.DogStatsd {
+		for _, key := range keys {
+			name += "." + labels[key]
+		}
+
+		return fmt.Sprintf("%s:%v|%s", sanitizeStatsdName(name), value, metricType)
+	}
+
+	tags := make([]string, 0, len(keys))
+	for _, key := range keys {
+		tags = append(tags, sanitizeStatsdName(key)+":"+sanitizeStatsdName(labels[key]))
+	}
+
+	line := fmt.Sprintf("%s:%v|%s", sanitizeStatsdName(name), value, metricType)
+	if len(tags) > 0 {
+		line += "|#" + strings.Join(tags, ",")
+	}
+
+	return line
+}
+
+// counter appends the increase of the counter since the previous interval, the first sample only sets the base.
+func (s *statsdEmitter) counter(lines []string, name string, labels map[string]string, value float64) []string {
+	key := s.line(name, labels, 0, "c")
+
+	previous, exist := s.counters[key]
+	s.counters[key] = value
+
+	if exist && value >= previous {
+		lines = append(lines, s.line(name, labels, value-previous, "c"))
+	}
+
+	return lines
+}
+
+// histogram sends the count, the sum and the cumulative count of every bucket as counters, the buckets get their
+// upper bound as the le label like the Prometheus exposition.
+func (s *statsdEmitter) histogram(lines []string, name string, labels map[string]string, h *dto.Histogram) []string {
+	lines = s.counter(lines, name+"_count", labels, float64(h.GetSampleCount()))
+	lines = s.counter(lines, name+"_sum", labels, h.GetSampleSum())
+
+	for _, bucket := range h.GetBucket() {
+		bucketLabels := make(map[string]string, len(labels)+1)
+		for key, value := range labels {
+			bucketLabels[key] = value
+		}
+		bucketLabels["le"] = strconv.FormatFloat(bucket.GetUpperBound(), 'g', -1, 64)
+
+		lines = s.counter(lines, name+"_bucket", bucketLabels, float64(bucket.GetCumulativeCount()))
+	}
+
+	return lines
+}
+
+// lines converts gathered families, counters and histograms are sent as the delta since the previous interval.
+func (s *statsdEmitter) lines(families []*dto.MetricFamily) []string {
+	var lines []string
+
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			labels := make(map[string]string, len(m.GetLabel())+len(s.config.Labels))
+			for key, value := range s.config.Labels {
+				labels[key] = value
+			}
+			for _, label := range m.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				lines = s.counter(lines, family.GetName(), labels, m.GetCounter().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				lines = s.histogram(lines, family.GetName(), labels, m.GetHistogram())
+			case dto.MetricType_GAUGE:
+				lines = append(lines, s.line(family.GetName(), labels, m.GetGauge().GetValue(), "g"))
+			case dto.MetricType_UNTYPED:
+				lines = append(lines, s.line(family.GetName(), labels, m.GetUntyped().GetValue(), "g"))
+			default:
+			}
+		}
+	}
+
+	return lines
+}
+
+func (s *statsdEmitter) send(lines []string) {
+	var packet strings.Builder
+
+	flush := func() {
+		if packet.Len() == 0 {
+			return
+		}
+
+		if _, err := s.conn.Write([]byte(packet.String())); err != nil {
+			logger.Log.Debug("error while sending statsd packet, err: %v", err)
+		}
+
+		packet.Reset()
+	}
+
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+len(line)+1 > statsdMaxPacketSize {
+			flush()
+		}
+
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+
+		packet.WriteString(line)
+	}
+
+	flush()
+}
+
+func (s *statsdEmitter) emit() {
+	families, err := s.registry.Gather()
+	if err != nil {
+		logger.Log.Warn("error while gathering metrics for statsd, err: %v", err)
+	}
+
+	s.send(s.lines(families))
+}
+
+func (s *statsdEmitter) Start() {
+	s.ticker = time.NewTicker(s.config.Statsd.Interval)
+
+	go func() {
+		defer close(s.doneCh)
+
+		for {
+			select {
+			case <-s.ticker.C:
+				s.emit()
+			case <-s.stopCh:
+				return
+			}
+		}
+	}()
+
+	logger.Log.Info("statsd emitter started, address: %v, interval: %v", s.config.Statsd.Address, s.config.Statsd.Interval)
+}
+
+func (s *statsdEmitter) Stop() {
+	s.ticker.Stop()
+	close(s.stopCh)
+	<-s.doneCh
+
+	if err := s.conn.Close(); err != nil {
+		logger.Log.Debug("error while closing statsd connection, err: %v", err)
+	}
+
+	logger.Log.Info("statsd emitter stopped")
+}
+
+func NewStatsdEmitter(config *config.Metric, collectors []prometheus.Collector) StatsdEmitter {
+	conn, err := net.Dial("udp", config.Statsd.Address)
+	if err != nil {
+		logger.Log.Error("error while connecting statsd, address: %v, err: %v", config.Statsd.Address, err)
+		panic(err)
+	}
+
+	registry := prometheus.NewRegistry()
+	for _, collector := range collectors {
+		if err := registry.Register(collector); err != nil {
+			logger.Log.Error("error while registering statsd metric collector, err: %v", err)
+		}
+	}
+
+	return &statsdEmitter{
+		registry: registry,
+		conn:     conn,
+		config:   config,
+		counters: map[string]float64{},
+		stopCh:   make(chan struct{}),
+		doneCh:   make(chan struct{}),
+	}
+}
@@ -0,0 +1,110 @@
+package metric
+
+import (
+	"testing"
+
+	"github.com/Trendyol/go-dcp/config"
+
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+func counterFamily(value float64) []*dto.MetricFamily {
+	return []*dto.MetricFamily{
+		{
+			Name: proto.String("cbgo_mutation_total"),
+			Type: dto.MetricType_COUNTER.Enum(),
+			Metric: []*dto.Metric{
+				{
+					Label:   []*dto.LabelPair{{Name: proto.String("vbId"), Value: proto.String("1")}},
+					Counter: &dto.Counter{Value: proto.Float64(value)},
+				},
+			},
+		},
+	}
+}
+
+func TestStatsdEmitter_CounterDelta(t *testing.T) {
+	s := &statsdEmitter{config: &config.Metric{Statsd: config.MetricStatsd{Prefix: "app"}}, counters: map[string]float64{}}
+
+	if lines := s.lines(counterFamily(10)); len(lines) != 0 {
+		t.Errorf("first counter sample is not skipped")
+	}
+
+	lines := s.lines(counterFamily(15))
+	if len(lines) != 1 || lines[0] != "app.cbgo_mutation_total.1:5|c" {
+		t.Errorf("counter delta is not set to expected value, got %v", lines)
+	}
+}
+
+func TestStatsdEmitter_DogStatsdTags(t *testing.T) {
+	s := &statsdEmitter{
+		config: &config.Metric{
+			Labels: map[string]string{"region": "eu"},
+			Statsd: config.MetricStatsd{DogStatsd: true},
+		},
+		counters: map[string]float64{},
+	}
+
+	families := []*dto.MetricFamily{
+		{
+			Name: proto.String("cbgo_lag_current"),
+			Type: dto.MetricType_GAUGE.Enum(),
+			Metric: []*dto.Metric{
+				{
+					Label: []*dto.LabelPair{{Name: proto.String("vbId"), Value: proto.String("3")}},
+					Gauge: &dto.Gauge{Value: proto.Float64(42)},
+				},
+			},
+		},
+	}
+
+	lines := s.lines(families)
+	if len(lines) != 1 || lines[0] != "cbgo_lag_current:42|g|#region:eu,vbId:3" {
+		t.Errorf("gauge line is not set to expected value, got %v", lines)
+	}
+}
+
+func histogramFamily(count uint64, sum float64, buckets ...uint64) []*dto.MetricFamily {
+	histogram := &dto.Histogram{SampleCount: proto.Uint64(count), SampleSum: proto.Float64(sum)}
+	for i, bucket := range buckets {
+		histogram.Bucket = append(histogram.Bucket, &dto.Bucket{
+			UpperBound:      proto.Float64([]float64{0.05, 1}[i]),
+			CumulativeCount: proto.Uint64(bucket),
+		})
+	}
+
+	return []*dto.MetricFamily{
+		{
+			Name:   proto.String("cbgo_checkpoint_save_latency_seconds"),
+			Type:   dto.MetricType_HISTOGRAM.Enum(),
+			Metric: []*dto.Metric{{Histogram: histogram}},
+		},
+	}
+}
+
+func TestStatsdEmitter_HistogramDelta(t *testing.T) {
+	s := &statsdEmitter{config: &config.Metric{Statsd: config.MetricStatsd{DogStatsd: true}}, counters: map[string]float64{}}
+
+	if lines := s.lines(histogramFamily(2, 0.5, 1, 2)); len(lines) != 0 {
+		t.Errorf("first histogram sample is not skipped, got %v", lines)
+	}
+
+	expected := []string{
+		"cbgo_checkpoint_save_latency_seconds_count:3|c",
+		"cbgo_checkpoint_save_latency_seconds_sum:1.5|c",
+		"cbgo_checkpoint_save_latency_seconds_bucket:1|c|#le:0.05",
+		"cbgo_checkpoint_save_latency_seconds_bucket:3|c|#le:1",
+	}
+
+	lines := s.lines(histogramFamily(5, 2, 2, 5))
+	if len(lines) != len(expected) {
+		t.Fatalf("histogram lines are not set to expected value, got %v", lines)
+	}
+
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Errorf("histogram line is not set to expected value, got %v want %v", lines[i], expected[i])
+		}
+	}
+}
@@ -1,5 +1,74 @@
 package models
 
+import (
+	"github.com/Trendyol/go-dcp/membership"
+
+	"github.com/couchbase/gocbcore/v10/memd"
+)
+
+type StreamEndStatus = memd.StreamEndStatus
+
+// StreamEndUnknown is reported when a stream ends with an error that does not carry a stream end status.
+const StreamEndUnknown = StreamEndStatus(0xffffffff)
+
+// StreamEndEvent tells why the stream of a vbucket ended, Status is memd.StreamEndTooSlow when the
+// server dropped the stream because the client could not keep up.
+type StreamEndEvent struct {
+	Err    error
+	VbID   uint16
+	Status StreamEndStatus
+}
+
+// MembershipChangedEvent is sent before the rebalance a membership change triggers. Old is nil when
+// no vbuckets were assigned yet, the vbuckets are the ones the member streams with each model.
+type MembershipChangedEvent struct {
+	Old         *membership.Model
+	New         *membership.Model
+	OldVBuckets []uint16
+	NewVBuckets []uint16
+}
+
+// CollectionDroppedEvent is sent once when a collection in the stream filter is dropped on the server,
+// the vbucket streams continue with the remaining collections.
+type CollectionDroppedEvent struct {
+	ScopeName      string
+	CollectionName string
+	CollectionID   uint32
+}
+
+// DcpReconnectedEvent is sent after a dead dcp agent is connected again and the streams are reopened from
+// the checkpoint, Err is the error the agent was detected dead with.
+type DcpReconnectedEvent struct {
+	Err      error
+	Attempts int
+}
+
+const (
+	ConnectionAgentData     = "data"
+	ConnectionAgentMetadata = "metadata"
+	ConnectionAgentDcp      = "dcp"
+)
+
+// ConnectionEvent is sent before and after an agent connects, Agent is data, metadata or dcp. Err is set on
+// Connected when the agent could not connect after the connection retries.
+type ConnectionEvent struct {
+	Err   error
+	Agent string
+}
+
+// StreamOpenEvent is sent once the stream of a vbucket is opened from Offset.
+type StreamOpenEvent struct {
+	Offset *Offset
+	VbID   uint16
+}
+
+// StreamCloseEvent is sent once the client closed the stream of a vbucket, Err is set when the close
+// request failed and the local stream state is abandoned.
+type StreamCloseEvent struct {
+	Err  error
+	VbID uint16
+}
+
 type EventHandler interface {
 	BeforeRebalanceStart()
 	AfterRebalanceStart()
@@ -11,6 +80,42 @@ type EventHandler interface {
 	AfterStreamStop()
 }
 
+// The handlers below are optional, an EventHandler receives their events when it implements them.
+// EmptyEventHandler implements all of them, so a handler embedding it only overrides the ones it needs.
+
+// StreamEndHandler is called when the stream of a vbucket ends.
+type StreamEndHandler interface {
+	StreamEnd(event StreamEndEvent)
+}
+
+// MembershipChangedHandler is called before the rebalance of a membership change.
+type MembershipChangedHandler interface {
+	MembershipChanged(event MembershipChangedEvent)
+}
+
+// CollectionDroppedHandler is called when a collection in the stream filter is dropped.
+type CollectionDroppedHandler interface {
+	CollectionDropped(event CollectionDroppedEvent)
+}
+
+// DcpReconnectedHandler is called after the streams reopen following a dcp agent reconnect.
+type DcpReconnectedHandler interface {
+	DcpReconnected(event DcpReconnectedEvent)
+}
+
+// ConnectionEventHandler is called before and after an agent connects.
+type ConnectionEventHandler interface {
+	Connecting(event ConnectionEvent)
+	Connected(event ConnectionEvent)
+}
+
+// StreamEventHandler is called when the stream of a vbucket is opened or closed. The streams are closed
+// concurrently, so StreamClose can be called from several goroutines at once.
+type StreamEventHandler interface {
+	StreamOpen(event StreamOpenEvent)
+	StreamClose(event StreamCloseEvent)
+}
+
 type EmptyEventHandler struct{}
 
 func (h *EmptyEventHandler) BeforeRebalanceStart() {
@@ -37,4 +142,28 @@ func (h *EmptyEventHandler) BeforeStreamStop() {
 func (h *EmptyEventHandler) AfterStreamStop() {
 }
 
+func (h *EmptyEventHandler) StreamEnd(_ StreamEndEvent) {
+}
+
+func (h *EmptyEventHandler) MembershipChanged(_ MembershipChangedEvent) {
+}
+
+func (h *EmptyEventHandler) CollectionDropped(_ CollectionDroppedEvent) {
+}
+
+func (h *EmptyEventHandler) DcpReconnected(_ DcpReconnectedEvent) {
+}
+
+func (h *EmptyEventHandler) Connecting(_ ConnectionEvent) {
+}
+
+func (h *EmptyEventHandler) Connected(_ ConnectionEvent) {
+}
+
+func (h *EmptyEventHandler) StreamOpen(_ StreamOpenEvent) {
+}
+
+func (h *EmptyEventHandler) StreamClose(_ StreamCloseEvent) {
+}
+
 var DefaultEventHandler EventHandler = &EmptyEventHandler{}
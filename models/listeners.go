@@ -1,9 +1,52 @@
 package models
 
+import "context"
+
 type ListenerContext struct {
-	Commit func()
-	Event  interface{}
-	Ack    func()
+	// Context carries the span of the event, listeners can start child spans from it.
+	Context context.Context
+	Commit  func()
+	Event   interface{}
+	Ack     func()
+}
+
+// Offset returns a copy of the offset of the event, so it can be stored outside with the manual checkpoint
+// type. It reports false for events without an offset like heartbeats.
+func (ctx *ListenerContext) Offset() (Offset, bool) {
+	var offset *Offset
+
+	switch v := ctx.Event.(type) {
+	case DcpMutation:
+		offset = v.Offset
+	case DcpDeletion:
+		offset = v.Offset
+	case DcpExpiration:
+		offset = v.Offset
+	case DcpCollectionCreation:
+		offset = v.Offset
+	case DcpCollectionDeletion:
+		offset = v.Offset
+	case DcpCollectionFlush:
+		offset = v.Offset
+	case DcpScopeCreation:
+		offset = v.Offset
+	case DcpScopeDeletion:
+		offset = v.Offset
+	case DcpCollectionModification:
+		offset = v.Offset
+	}
+
+	if offset == nil {
+		return Offset{}, false
+	}
+
+	copied := *offset
+	if offset.SnapshotMarker != nil {
+		snapshotMarker := *offset.SnapshotMarker
+		copied.SnapshotMarker = &snapshotMarker
+	}
+
+	return copied, true
 }
 
 type ListenerArgs struct {
@@ -11,8 +54,9 @@ type ListenerArgs struct {
 }
 
 type DcpStreamEndContext struct {
-	Err   error
-	Event DcpStreamEnd
+	Err    error
+	Event  DcpStreamEnd
+	Status StreamEndStatus
 }
 
 type (
@@ -20,3 +64,21 @@ type (
 	ListenerCh    chan ListenerArgs
 	ListenerEndCh chan DcpStreamEndContext
 )
+
+// ErrorListener acknowledges the event when it returns nil, errors are retried per dcp.listener.retry.
+type ErrorListener func(*ListenerContext) error
+
+// DeadLetter is an event the listener still failed on after the attempts of dcp.listener.retry.
+type DeadLetter struct {
+	Event interface{}
+	Err   error
+	VbID  uint16
+}
+
+// DeadLetterHandler gets the dead letters when dcp.listener.onError is dlq, the checkpoint moves past
+// the event once it returns. The vbucket of the event is blocked when it panics.
+type DeadLetterHandler func(DeadLetter)
+
+// BatchListener gets the events in seqNo order per vbucket, they are acknowledged together when it returns nil
+// and retried as a whole per dcp.listener.retry otherwise.
+type BatchListener func([]*ListenerContext) error
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestListenerContextOffsetIsCopied(t *testing.T) {
+	offset := &Offset{SnapshotMarker: &SnapshotMarker{StartSeqNo: 10, EndSeqNo: 20}, VbUUID: 100, SeqNo: 15}
+	ctx := &ListenerContext{Event: DcpMutation{Offset: offset}}
+
+	copied, ok := ctx.Offset()
+	if !ok || copied.VbUUID != 100 || copied.SeqNo != 15 || copied.SnapshotMarker.EndSeqNo != 20 {
+		t.Fatalf("expected the offset of the event, got: %v, ok: %v", copied, ok)
+	}
+
+	copied.SeqNo = 16
+	copied.SnapshotMarker.EndSeqNo = 30
+
+	if offset.SeqNo != 15 || offset.SnapshotMarker.EndSeqNo != 20 {
+		t.Errorf("offset of the event is not expected to change, got: %v, snapshot marker: %v", offset, offset.SnapshotMarker)
+	}
+}
+
+func TestListenerContextOffsetWithoutOffset(t *testing.T) {
+	for _, event := range []interface{}{Heartbeat{}, DcpDeletion{}} {
+		if _, ok := (&ListenerContext{Event: event}).Offset(); ok {
+			t.Errorf("expected no offset for %T", event)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/couchbase/gocbcore/v10"
+	"github.com/couchbase/gocbcore/v10/memd"
 )
 
 type Offset struct {
@@ -22,22 +23,42 @@ type SnapshotMarker struct {
 	EndSeqNo   uint64
 }
 
+// InternalDcpMutation is a mutation of a document, Expiry of the embedded mutation is the unix time the
+// document expires at and 0 when it has no expiry.
 type InternalDcpMutation struct {
 	EventTime time.Time
 	*gocbcore.DcpMutation
 	Offset         *Offset
 	CollectionName string
+	ScopeName      string
 }
 
 func (i *InternalDcpMutation) IsCreated() bool {
 	return i.RevNo == 1
 }
 
+// IsJSON reports whether the server sees the value as json, Flags carries the document flags set by the sdk.
+func (i *InternalDcpMutation) IsJSON() bool {
+	return i.Datatype&uint8(memd.DatatypeFlagJSON) != 0
+}
+
+// IsCompressed reports whether the value is still snappy compressed, which is only the case when
+// compression.disableDecompression is set.
+func (i *InternalDcpMutation) IsCompressed() bool {
+	return i.Datatype&uint8(memd.DatatypeFlagCompressed) != 0
+}
+
+// HasXattrs reports whether the value starts with the xattrs of the document.
+func (i *InternalDcpMutation) HasXattrs() bool {
+	return i.Datatype&uint8(memd.DatatypeFlagXattrs) != 0
+}
+
 type InternalDcpDeletion struct {
 	EventTime time.Time
 	*gocbcore.DcpDeletion
 	Offset         *Offset
 	CollectionName string
+	ScopeName      string
 }
 
 type InternalDcpExpiration struct {
@@ -45,6 +66,7 @@ type InternalDcpExpiration struct {
 	*gocbcore.DcpExpiration
 	Offset         *Offset
 	CollectionName string
+	ScopeName      string
 }
 
 type InternalDcpSeqNoAdvance struct {
@@ -56,34 +78,40 @@ type InternalDcpCollectionCreation struct {
 	*gocbcore.DcpCollectionCreation
 	Offset         *Offset
 	CollectionName string
+	ScopeName      string
 }
 
 type InternalDcpCollectionDeletion struct {
 	*gocbcore.DcpCollectionDeletion
 	Offset         *Offset
 	CollectionName string
+	ScopeName      string
 }
 
 type InternalDcpCollectionFlush struct {
 	*gocbcore.DcpCollectionFlush
 	Offset         *Offset
 	CollectionName string
+	ScopeName      string
 }
 
 type InternalDcpScopeCreation struct {
 	*gocbcore.DcpScopeCreation
-	Offset *Offset
+	Offset    *Offset
+	ScopeName string
 }
 
 type InternalDcpScopeDeletion struct {
 	*gocbcore.DcpScopeDeletion
-	Offset *Offset
+	Offset    *Offset
+	ScopeName string
 }
 
 type InternalDcpCollectionModification struct {
 	*gocbcore.DcpCollectionModification
 	Offset         *Offset
 	CollectionName string
+	ScopeName      string
 }
 
 type InternalDcpOSOSnapshot struct {
@@ -91,11 +119,62 @@ type InternalDcpOSOSnapshot struct {
 	Offset *Offset
 }
 
+// Heartbeat is delivered to the listener on every dcp.listener.heartbeatInterval regardless of stream activity.
+type Heartbeat struct {
+	EventTime time.Time
+}
+
 type PingResult struct {
 	MemdEndpoint string
 	MgmtEndpoint string
 }
 
+type ServiceHealth struct {
+	Endpoint string `json:"endpoint"`
+	State    string `json:"state"`
+	Error    string `json:"error,omitempty"`
+	Latency  int64  `json:"latencyMs"`
+}
+
+const (
+	HealthStateHealthy  = "healthy"
+	HealthStateDegraded = "degraded"
+	HealthStateFailed   = "failed"
+)
+
+// HealthCheckResult is degraded while the client can still stream with some nodes or streams down,
+// and failed when a service has no healthy endpoint or no stream is active. Healthy is only set while
+// the state is healthy.
+type HealthCheckResult struct {
+	Services map[string][]ServiceHealth `json:"services"`
+	State    string                     `json:"state"`
+	Reasons  []string                   `json:"reasons,omitempty"`
+	Healthy  bool                       `json:"healthy"`
+}
+
+func NewHealthCheckResult() *HealthCheckResult {
+	return &HealthCheckResult{
+		Services: map[string][]ServiceHealth{},
+		State:    HealthStateHealthy,
+		Healthy:  true,
+	}
+}
+
+func (r *HealthCheckResult) Degrade(reason string) {
+	if r.State == HealthStateHealthy {
+		r.State = HealthStateDegraded
+	}
+
+	r.Healthy = false
+	r.Reasons = append(r.Reasons, reason)
+}
+
+func (r *HealthCheckResult) Fail(reason string) {
+	r.State = HealthStateFailed
+	r.Healthy = false
+	r.Reasons = append(r.Reasons, reason)
+}
+
 type AgentQueue struct {
 	Address string
 	IsDcp   bool
@@ -103,6 +182,11 @@ type AgentQueue struct {
 	Max     int
 }
 
+type VBucketSeqNo struct {
+	HighSeqNo    uint64
+	PersistSeqNo uint64
+}
+
 type (
 	DcpSnapshotMarker         = gocbcore.DcpSnapshotMarker
 	DcpMutation               = InternalDcpMutation
@@ -133,6 +217,7 @@ type CheckpointDocumentCheckpoint struct {
 type CheckpointDocument struct {
 	Checkpoint *CheckpointDocumentCheckpoint `json:"checkpoint"`
 	BucketUUID string                        `json:"bucketUuid"`
+	Owner      string                        `json:"owner,omitempty"`
 }
 
 func NewEmptyCheckpointDocument(bucketUUID string) *CheckpointDocument {
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/couchbase/gocbcore/v10"
+	"github.com/couchbase/gocbcore/v10/memd"
+)
+
+func TestInternalDcpMutationDatatype(t *testing.T) {
+	tests := []struct {
+		name       string
+		datatype   memd.DatatypeFlag
+		json       bool
+		compressed bool
+		xattrs     bool
+	}{
+		{name: "raw"},
+		{name: "json", datatype: memd.DatatypeFlagJSON, json: true},
+		{name: "compressed json", datatype: memd.DatatypeFlagJSON | memd.DatatypeFlagCompressed, json: true, compressed: true},
+		{name: "xattrs", datatype: memd.DatatypeFlagXattrs, xattrs: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mutation := &InternalDcpMutation{DcpMutation: &gocbcore.DcpMutation{Datatype: uint8(tt.datatype)}}
+
+			if mutation.IsJSON() != tt.json || mutation.IsCompressed() != tt.compressed || mutation.HasXattrs() != tt.xattrs {
+				t.Errorf("expected json: %v, compressed: %v, xattrs: %v, got json: %v, compressed: %v, xattrs: %v",
+					tt.json, tt.compressed, tt.xattrs, mutation.IsJSON(), mutation.IsCompressed(), mutation.HasXattrs())
+			}
+		})
+	}
+}
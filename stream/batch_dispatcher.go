@@ -0,0 +1,319 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Trendyol/go-dcp/config"
+	"github.com/Trendyol/go-dcp/logger"
+	"github.com/Trendyol/go-dcp/models"
+	"github.com/Trendyol/go-dcp/wrapper"
+)
+
+type batchEvent struct {
+	spanCtx context.Context
+	ctx     *models.ListenerContext
+	ack     *eventAck
+	acked   func()
+	vbID    uint16
+}
+
+type heldOffset struct {
+	offset *models.Offset
+	dirty  bool
+}
+
+// batch is the events of a flush and the offsets of its vbuckets, including the events that are not delivered in
+// the meantime.
+type batch struct {
+	held       map[uint16]*heldOffset
+	events     []*batchEvent
+	generation uint64
+}
+
+func newBatch(generation uint64) *batch {
+	return &batch{held: map[uint16]*heldOffset{}, generation: generation}
+}
+
+type batchTarget int
+
+func (t batchTarget) String() string {
+	return fmt.Sprintf("batch size: %v", int(t))
+}
+
+// batchDispatcher collects the events for the batch listener and cuts a batch when it is full or the flush interval
+// passes. The batches are delivered one by one on the flusher goroutine, so the stream only waits while a cut batch
+// is queued behind the one being delivered. The offsets of a batch are committed once the listener returns nil and
+// the batches before it are committed.
+type batchDispatcher struct {
+	stream    *stream
+	ticker    *time.Ticker
+	current   *batch
+	resets    *wrapper.ConcurrentSwissMap[uint16, uint64]
+	flushCh   chan *batch
+	doneCh    chan struct{}
+	stopCh    chan struct{}
+	runWg     sync.WaitGroup
+	flushWg   sync.WaitGroup
+	lock      sync.Mutex
+	inFlight  atomic.Int32
+	size      int
+	closed    bool
+	abandoned bool
+}
+
+func (d *batchDispatcher) run() {
+	defer d.runWg.Done()
+
+	for {
+		select {
+		case <-d.ticker.C:
+			d.lock.Lock()
+			d.cut()
+			d.lock.Unlock()
+		case <-d.doneCh:
+			return
+		}
+	}
+}
+
+func (d *batchDispatcher) flusher() {
+	defer d.flushWg.Done()
+
+	for b := range d.flushCh {
+		d.flush(b)
+		d.inFlight.Add(-1)
+	}
+}
+
+// cut hands the current batch to the flusher, it must be called with the lock held so the batches keep their order.
+// The flusher never takes the lock, so cut can wait behind the batch being delivered while holding it.
+func (d *batchDispatcher) cut() {
+	if len(d.current.events) == 0 && len(d.current.held) == 0 {
+		return
+	}
+
+	d.inFlight.Add(1)
+	d.flushCh <- d.current
+	d.current = newBatch(d.current.generation + 1)
+}
+
+func (d *batchDispatcher) add(spanCtx context.Context, payload interface{}, offset *models.Offset, vbID uint16, acked func()) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.closed {
+		endSkippedEventSpan(spanCtx, "closed")
+		return
+	}
+
+	ack := newEventAck(func() {})
+
+	d.current.events = append(d.current.events, &batchEvent{
+		spanCtx: spanCtx,
+		ctx: &models.ListenerContext{
+			Context: spanCtx,
+			Commit:  d.stream.checkpoint.Save,
+			Event:   payload,
+			Ack:     ack.Ack,
+		},
+		ack:   ack,
+		acked: acked,
+		vbID:  vbID,
+	})
+
+	if held, ok := d.current.held[vbID]; ok {
+		held.offset, held.dirty = offset, true
+	} else {
+		d.current.held[vbID] = &heldOffset{offset: offset, dirty: true}
+	}
+
+	if len(d.current.events) >= d.size {
+		d.cut()
+	}
+}
+
+// advance moves the offset of events that are not delivered, it waits behind the batches that are not committed yet.
+func (d *batchDispatcher) advance(vbID uint16, offset *models.Offset, dirty bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.closed {
+		return
+	}
+
+	if held, ok := d.current.held[vbID]; ok {
+		held.offset = offset
+		held.dirty = held.dirty || dirty
+		return
+	}
+
+	if d.inFlight.Load() > 0 {
+		d.current.held[vbID] = &heldOffset{offset: offset, dirty: dirty}
+		return
+	}
+
+	d.stream.setOffset(vbID, offset, dirty)
+}
+
+// flush delivers the events of the batch and commits its offsets.
+func (d *batchDispatcher) flush(b *batch) {
+	if d.abandoned {
+		for _, event := range b.events {
+			endSkippedEventSpan(event.spanCtx, "abandoned")
+		}
+		return
+	}
+
+	if len(b.events) > 0 && !d.deliver(b) {
+		d.abandoned = true
+		return
+	}
+
+	for vbID, offset := range b.held {
+		if !d.resetAfter(vbID, b) {
+			d.stream.setOffset(vbID, offset.offset, offset.dirty)
+		}
+	}
+
+	for _, event := range b.events {
+		if event.acked != nil {
+			event.acked()
+		}
+	}
+
+	if len(b.events) > 0 {
+		d.stream.anyDirtyOffset.Store(true)
+	}
+}
+
+// deliver calls the listener with the events of the batch, it returns false when the batch is blocked and the
+// stream is closed before all of its events are acknowledged.
+func (d *batchDispatcher) deliver(b *batch) bool {
+	ctxs := make([]*models.ListenerContext, 0, len(b.events))
+	for _, event := range b.events {
+		ctxs = append(ctxs, event.ctx)
+	}
+
+	start := time.Now()
+
+	err := d.stream.callWithRetry(func() error {
+		return d.stream.batchListener(ctxs)
+	}, batchTarget(len(ctxs)))
+
+	d.stream.metric.ProcessLatency.Store(time.Since(start).Milliseconds())
+
+	for _, event := range b.events {
+		endEventSpan(event.spanCtx, err)
+	}
+
+	if err == nil {
+		return true
+	}
+
+	d.stream.metric.ListenerFailure.Add(1)
+
+	switch d.stream.config.Dcp.Listener.OnError {
+	case config.ListenerOnErrorSkip:
+		logger.Log.Error("batch listener failed, skipping %v events, err: %v", len(ctxs), err)
+		return true
+	case config.ListenerOnErrorDLQ:
+		logger.Log.Error("batch listener failed, sending %v events to dead letter, err: %v", len(ctxs), err)
+		if d.sendDeadLetters(b, err) {
+			return true
+		}
+	}
+
+	vbIDs := make([]int, 0, len(b.held))
+	for vbID := range b.held {
+		vbIDs = append(vbIDs, int(vbID))
+	}
+	sort.Ints(vbIDs)
+
+	logger.Log.Error("batch listener failed, blocking until the events of vbIDs: %v are acknowledged, err: %v", vbIDs, err)
+
+	for _, event := range b.events {
+		select {
+		case <-event.ack.wait():
+		case <-d.stopCh:
+			return false
+		}
+	}
+
+	return true
+}
+
+// sendDeadLetters hands the events of the batch to the dead letter handler, it returns false when the handler panics.
+func (d *batchDispatcher) sendDeadLetters(b *batch, err error) bool {
+	for _, event := range b.events {
+		if !d.stream.sendDeadLetter(models.DeadLetter{Event: event.ctx.Event, Err: err, VbID: event.vbID}) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// reset drops the offset of the vbucket from the batches that are not committed yet, its stream is opened again
+// from another offset. Their events are still delivered.
+func (d *batchDispatcher) reset(vbID uint16) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	// the offsets added to the current batch from now on are the ones of the reopened stream
+	delete(d.current.held, vbID)
+	d.resets.Store(vbID, d.current.generation)
+	d.current.generation++
+}
+
+// resetAfter reports a vbucket that is reset after the batch is started.
+func (d *batchDispatcher) resetAfter(vbID uint16, b *batch) bool {
+	generation, ok := d.resets.Load(vbID)
+	return ok && b.generation <= generation
+}
+
+// Close delivers the partial batch, events that arrive after it are streamed again from the checkpoint.
+func (d *batchDispatcher) Close() {
+	d.ticker.Stop()
+	close(d.doneCh)
+	d.runWg.Wait()
+
+	d.lock.Lock()
+	d.cut()
+	d.closed = true
+	d.lock.Unlock()
+
+	close(d.flushCh)
+	d.flushWg.Wait()
+
+	logger.Log.Debug("stopped batch dispatcher")
+}
+
+func newBatchDispatcher(s *stream) *batchDispatcher {
+	batchConfig := s.config.Dcp.Listener.Batch
+
+	d := &batchDispatcher{
+		stream:  s,
+		ticker:  time.NewTicker(batchConfig.FlushInterval),
+		current: newBatch(0),
+		resets:  wrapper.CreateConcurrentSwissMap[uint16, uint64](0),
+		flushCh: make(chan *batch, 1),
+		doneCh:  make(chan struct{}),
+		stopCh:  s.listenerStopCh,
+		size:    batchConfig.Size,
+	}
+
+	d.runWg.Add(1)
+	go d.run()
+
+	d.flushWg.Add(1)
+	go d.flusher()
+
+	logger.Log.Debug("started batch dispatcher, size: %v, flush interval: %v", batchConfig.Size, batchConfig.FlushInterval)
+
+	return d
+}
@@ -0,0 +1,167 @@
+package stream
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Trendyol/go-dcp/config"
+	"github.com/Trendyol/go-dcp/models"
+)
+
+func newBatchTestStream(batch config.DCPListenerBatch, onError string) (*stream, chan []*models.ListenerContext) {
+	s := newDispatchTestStream(config.DCPListener{
+		Batch:   batch,
+		OnError: onError,
+		Retry:   config.DCPListenerRetry{Attempts: 1},
+	})
+	s.listenerStopCh = make(chan struct{})
+
+	batches := make(chan []*models.ListenerContext, 16)
+	s.batchListener = func(ctxs []*models.ListenerContext) error {
+		batches <- ctxs
+		return nil
+	}
+
+	return s, batches
+}
+
+func waitBatch(t *testing.T, batches chan []*models.ListenerContext) []*models.ListenerContext {
+	t.Helper()
+
+	select {
+	case ctxs := <-batches:
+		return ctxs
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a batch")
+		return nil
+	}
+}
+
+func TestBatchDispatcherFlushesBySize(t *testing.T) {
+	s, batches := newBatchTestStream(config.DCPListenerBatch{Size: 2, FlushInterval: time.Hour}, config.ListenerOnErrorSkip)
+	d := newBatchDispatcher(s)
+
+	d.add(nil, "first", testOffset(1), 0, nil)
+	d.add(nil, "second", testOffset(1), 1, nil)
+
+	if ctxs := waitBatch(t, batches); len(ctxs) != 2 || ctxs[0].Event != "first" || ctxs[1].Event != "second" {
+		t.Fatalf("expected a batch of the two events in order, got: %v", ctxs)
+	}
+
+	d.Close()
+
+	if offsetSeqNo(s, 0) != 1 || offsetSeqNo(s, 1) != 1 {
+		t.Errorf("offsets are expected to be committed after the batch, got: %v, %v", offsetSeqNo(s, 0), offsetSeqNo(s, 1))
+	}
+}
+
+func TestBatchDispatcherFlushesByTime(t *testing.T) {
+	batch := config.DCPListenerBatch{Size: 100, FlushInterval: 10 * time.Millisecond}
+	s, batches := newBatchTestStream(batch, config.ListenerOnErrorSkip)
+	d := newBatchDispatcher(s)
+	defer d.Close()
+
+	d.add(nil, "partial", testOffset(1), 0, nil)
+
+	if ctxs := waitBatch(t, batches); len(ctxs) != 1 || ctxs[0].Event != "partial" {
+		t.Fatalf("expected the partial batch after the flush interval, got: %v", ctxs)
+	}
+}
+
+func TestBatchDispatcherFlushesPartialBatchOnClose(t *testing.T) {
+	s, batches := newBatchTestStream(config.DCPListenerBatch{Size: 100, FlushInterval: time.Hour}, config.ListenerOnErrorSkip)
+	d := newBatchDispatcher(s)
+
+	d.add(nil, "partial", testOffset(1), 0, nil)
+	d.Close()
+
+	if ctxs := waitBatch(t, batches); len(ctxs) != 1 {
+		t.Fatalf("expected the partial batch on close, got: %v", ctxs)
+	}
+}
+
+func TestBatchDispatcherHoldsAdvancesBehindUncommittedBatch(t *testing.T) {
+	s, _ := newBatchTestStream(config.DCPListenerBatch{Size: 1, FlushInterval: time.Hour}, config.ListenerOnErrorSkip)
+
+	release := make(chan struct{})
+	s.batchListener = func(_ []*models.ListenerContext) error {
+		<-release
+		return nil
+	}
+
+	d := newBatchDispatcher(s)
+
+	d.add(nil, "slow", testOffset(1), 0, nil)
+	d.advance(0, testOffset(2), true)
+
+	if seqNo := offsetSeqNo(s, 0); seqNo != 0 {
+		t.Fatalf("offset is expected to wait for the batch, got: %v", seqNo)
+	}
+
+	close(release)
+	d.Close()
+
+	if seqNo := offsetSeqNo(s, 0); seqNo != 2 {
+		t.Errorf("offset is expected to move to 2 after the batch, got: %v", seqNo)
+	}
+}
+
+func TestBatchDispatcherBlockWaitsForAcknowledgement(t *testing.T) {
+	s, _ := newBatchTestStream(config.DCPListenerBatch{Size: 1, FlushInterval: time.Hour}, config.ListenerOnErrorBlock)
+
+	failed := make(chan *models.ListenerContext, 1)
+	s.batchListener = func(ctxs []*models.ListenerContext) error {
+		failed <- ctxs[0]
+		return errors.New("sink is down")
+	}
+
+	d := newBatchDispatcher(s)
+	d.add(nil, "failing", testOffset(1), 0, nil)
+
+	ctx := <-failed
+	time.Sleep(20 * time.Millisecond)
+
+	if seqNo := offsetSeqNo(s, 0); seqNo != 0 {
+		t.Fatalf("offset is expected to stay until the event is acknowledged, got: %v", seqNo)
+	}
+
+	ctx.Ack()
+	d.Close()
+
+	if seqNo := offsetSeqNo(s, 0); seqNo != 1 {
+		t.Errorf("offset is expected to move once the event is acknowledged, got: %v", seqNo)
+	}
+}
+
+func TestBatchDispatcherDoesNotBlockBehindSlowListener(t *testing.T) {
+	s, _ := newBatchTestStream(config.DCPListenerBatch{Size: 1, FlushInterval: time.Hour}, config.ListenerOnErrorSkip)
+
+	var delivered []interface{}
+	s.batchListener = func(ctxs []*models.ListenerContext) error {
+		time.Sleep(10 * time.Millisecond)
+		delivered = append(delivered, ctxs[0].Event)
+		return nil
+	}
+
+	d := newBatchDispatcher(s)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= 5; i++ {
+			d.add(nil, i, testOffset(uint64(i)), 0, nil)
+		}
+		d.Close()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the batches to be delivered behind the slow listener")
+	}
+
+	if len(delivered) != 5 || delivered[0] != 1 || delivered[4] != 5 || offsetSeqNo(s, 0) != 5 {
+		t.Errorf("expected the batches in order, delivered: %v, seqNo: %v", delivered, offsetSeqNo(s, 0))
+	}
+}
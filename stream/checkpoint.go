@@ -1,8 +1,12 @@
 package stream
 
 import (
+	"context"
 	"errors"
+	"math"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Trendyol/go-dcp/wrapper"
@@ -18,46 +22,165 @@ import (
 	"github.com/Trendyol/go-dcp/logger"
 
 	"github.com/couchbase/gocbcore/v10"
+
+	"github.com/json-iterator/go"
 )
 
 const (
-	CheckpointTypeAuto            = "auto"
-	CheckpointAutoResetTypeLatest = "latest"
+	CheckpointTypeAuto              = "auto"
+	CheckpointTypeManual            = "manual"
+	CheckpointAutoResetTypeEarliest = "earliest"
+	CheckpointAutoResetTypeLatest   = "latest"
 )
 
 type Checkpoint interface {
 	Save()
-	Load() (*wrapper.ConcurrentSwissMap[uint16, *models.Offset], *wrapper.ConcurrentSwissMap[uint16, bool], bool)
+	SaveAndWait(ctx context.Context) error
+	OffsetAdvanced(vbID uint16)
+	Load() (*wrapper.ConcurrentSwissMap[uint16, *models.Offset], *wrapper.ConcurrentSwissMap[uint16, bool], bool, error)
 	Clear()
 	StartSchedule()
 	StopSchedule()
 	GetMetric() *CheckpointMetric
 }
 
+var ErrCheckpointAheadOfVBucket = errors.New("checkpoint seqNo bigger then vBucket latest seqNo")
+
 type CheckpointMetric struct {
+	Save               *CheckpointSaveMetric
+	SavedSeqNos        *wrapper.ConcurrentSwissMap[uint16, uint64]
 	OffsetWrite        int
 	OffsetWriteLatency int64
 }
 
+// CheckpointSaveLatencyBuckets are the upper bounds in seconds of the checkpoint save latency histogram.
+var CheckpointSaveLatencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// CheckpointSaveMetric is shared by the checkpoints of a stream, so it is not reset when the stream is reopened.
+type CheckpointSaveMetric struct {
+	counts   []uint64
+	sum      float64
+	count    uint64
+	failures uint64
+	lock     sync.Mutex
+}
+
+func (m *CheckpointSaveMetric) observe(latency time.Duration, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	seconds := latency.Seconds()
+
+	for i, bound := range CheckpointSaveLatencyBuckets {
+		if seconds <= bound {
+			m.counts[i]++
+		}
+	}
+
+	m.sum += seconds
+	m.count++
+
+	if err != nil {
+		m.failures++
+	}
+}
+
+// Snapshot returns the save count, the latency sum in seconds, the cumulative bucket counts keyed by
+// their upper bounds and the failed save count.
+func (m *CheckpointSaveMetric) Snapshot() (uint64, float64, map[float64]uint64, uint64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	buckets := make(map[float64]uint64, len(CheckpointSaveLatencyBuckets))
+	for i, bound := range CheckpointSaveLatencyBuckets {
+		buckets[bound] = m.counts[i]
+	}
+
+	return m.count, m.sum, buckets, m.failures
+}
+
+func NewCheckpointSaveMetric() *CheckpointSaveMetric {
+	return &CheckpointSaveMetric{counts: make([]uint64, len(CheckpointSaveLatencyBuckets))}
+}
+
 type checkpoint struct {
-	stream     Stream
-	client     couchbase.Client
-	metadata   metadata.Metadata
-	schedule   *time.Ticker
-	config     *config.Dcp
-	saveLock   *sync.Mutex
-	loadLock   *sync.Mutex
-	metric     *CheckpointMetric
-	bucketUUID string
-	vbIds      []uint16
+	stream      Stream
+	client      couchbase.Client
+	metadata    metadata.Metadata
+	schedule    *time.Ticker
+	config      *config.Dcp
+	saveLock    *sync.Mutex
+	loadLock    *sync.Mutex
+	metric      *CheckpointMetric
+	writeBehind atomic.Pointer[writeBehind]
+	bucketUUID  string
+	owner       string
+	vbIds       []uint16
+	// latencyWindow holds the latest offset write latencies, it is guarded by saveLock
+	latencyWindow   []time.Duration
+	smoothedLatency atomic.Int64
+}
+
+type writeBehind struct {
+	pending      *atomic.Int64
+	pendingBytes *atomic.Int64
+	dirty        []atomic.Bool
+	armCh        chan struct{}
+	flushCh      chan struct{}
+	stopCh       chan struct{}
+	doneCh       chan struct{}
+	documentSize int64
+}
+
+// reset forgets the buffered advances, it is called before the flush so advances that race with
+// the save are buffered for the next one.
+func (wb *writeBehind) reset() {
+	wb.pending.Store(0)
+	wb.pendingBytes.Store(0)
+
+	for i := range wb.dirty {
+		wb.dirty[i].Store(false)
+	}
+}
+
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
 }
 
 func (s *checkpoint) Save() {
+	_ = s.save()
+}
+
+// SaveAndWait saves the checkpoint and returns once the metadata write is confirmed or ctx is done, the
+// result channel is buffered so a write that outlives ctx does not block its goroutine.
+func (s *checkpoint) SaveAndWait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	errCh := make(chan error, 1)
+
+	go func() {
+		errCh <- s.save()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *checkpoint) save() error {
 	offsets, dirtyOffsets, anyDirtyOffset := s.stream.GetOffsets()
 
 	if !anyDirtyOffset {
 		logger.Log.Trace("no need to save checkpoint")
-		return
+		return nil
 	}
 
 	s.saveLock.Lock()
@@ -76,6 +199,7 @@ func (s *checkpoint) Save() {
 				},
 			},
 			BucketUUID: s.bucketUUID,
+			Owner:      s.owner,
 		}
 
 		return true
@@ -100,33 +224,44 @@ func (s *checkpoint) Save() {
 
 	err := s.metadata.Save(checkpointDump, dirtyOffsetsDump, s.bucketUUID)
 
-	s.metric.OffsetWriteLatency = time.Since(start).Milliseconds()
+	latency := time.Since(start)
+	s.metric.OffsetWriteLatency = latency.Milliseconds()
+	s.metric.Save.observe(latency, err)
+	s.observeLatency(latency)
 
 	if err == nil {
 		logger.Log.Trace("saved checkpoint")
 		s.stream.UnmarkDirtyOffsets()
+
+		for vbID, dirty := range dirtyOffsetsDump {
+			if doc, ok := checkpointDump[vbID]; ok && dirty {
+				s.metric.SavedSeqNos.Store(vbID, doc.Checkpoint.SeqNo)
+			}
+		}
 	} else {
 		logger.Log.Error("error while saving checkpoint document: %v", err)
 	}
+
+	return err
 }
 
 //nolint:funlen
-func (s *checkpoint) Load() (*wrapper.ConcurrentSwissMap[uint16, *models.Offset], *wrapper.ConcurrentSwissMap[uint16, bool], bool) {
+func (s *checkpoint) Load() (*wrapper.ConcurrentSwissMap[uint16, *models.Offset], *wrapper.ConcurrentSwissMap[uint16, bool], bool, error) { //nolint:lll
 	s.loadLock.Lock()
 	defer s.loadLock.Unlock()
 
 	dump, exist, err := s.metadata.Load(s.vbIds, s.bucketUUID)
-	if err == nil {
-		logger.Log.Debug("loaded checkpoint")
-	} else {
+	if err != nil {
 		logger.Log.Error("error while loading checkpoint document, err: %v", err)
-		panic(err)
+		return nil, nil, false, err
 	}
 
+	logger.Log.Debug("loaded checkpoint")
+
 	seqNoMap, err := s.client.GetVBucketSeqNos(false)
 	if err != nil {
 		logger.Log.Error("error while getting vBucket seqNos, err: %v", err)
-		panic(err)
+		return nil, nil, false, err
 	}
 
 	offsets := wrapper.CreateConcurrentSwissMap[uint16, *models.Offset](1024)
@@ -136,6 +271,8 @@ func (s *checkpoint) Load() (*wrapper.ConcurrentSwissMap[uint16, *models.Offset]
 	if !exist && s.config.Checkpoint.AutoReset == CheckpointAutoResetTypeLatest {
 		logger.Log.Debug("no checkpoint found, auto reset checkpoint to latest")
 
+		var rangeErr error
+
 		dump.Range(func(vbID uint16, doc *models.CheckpointDocument) bool {
 			currentSeqNo, _ := seqNoMap.Load(vbID)
 
@@ -147,7 +284,8 @@ func (s *checkpoint) Load() (*wrapper.ConcurrentSwissMap[uint16, *models.Offset]
 			failOverLogs, err := s.client.GetFailoverLogs(vbID)
 			if err != nil {
 				logger.Log.Error("error while get failover logs when initialize latest, err: %v", err)
-				panic(err)
+				rangeErr = err
+				return false
 			}
 
 			offsets.Store(vbID, &models.Offset{
@@ -162,33 +300,101 @@ func (s *checkpoint) Load() (*wrapper.ConcurrentSwissMap[uint16, *models.Offset]
 			return true
 		})
 
-		return offsets, dirtyOffsets, anyDirtyOffset
+		if rangeErr != nil {
+			return nil, nil, false, rangeErr
+		}
+
+		return offsets, dirtyOffsets, anyDirtyOffset, nil
 	}
 
+	if !exist && s.config.Checkpoint.AutoReset == CheckpointAutoResetTypeEarliest {
+		logger.Log.Debug("no checkpoint found, auto reset checkpoint to earliest")
+
+		for _, vbID := range s.vbIds {
+			offsets.Store(vbID, &models.Offset{SnapshotMarker: &models.SnapshotMarker{}})
+		}
+
+		return offsets, dirtyOffsets, anyDirtyOffset, nil
+	}
+
+	var rangeErr error
+	warnedOwner := false
+
 	dump.Range(func(vbID uint16, doc *models.CheckpointDocument) bool {
+		if !warnedOwner && doc.Owner != "" && doc.Owner != s.owner {
+			logger.Log.Warn(
+				"checkpoint of vbID: %v is owned by %v, another instance may use the same metadata prefix and group name, owner: %v",
+				vbID, doc.Owner, s.owner,
+			)
+			warnedOwner = true
+		}
+
 		latestSeqNo, _ := seqNoMap.Load(vbID)
 		if doc.Checkpoint.SeqNo > latestSeqNo {
-			err := errors.New("checkpoint seqNo bigger then vBucket latest seqNo")
 			logger.Log.Error(
 				"error while loading checkpoint, vbID: %v, checkpoint seqNo: %v, latest seqNo: %v, err: %v",
-				vbID, doc.Checkpoint.SeqNo, latestSeqNo, err,
+				vbID, doc.Checkpoint.SeqNo, latestSeqNo, ErrCheckpointAheadOfVBucket,
 			)
-			panic(err)
+			rangeErr = ErrCheckpointAheadOfVBucket
+			return false
 		}
 
-		offsets.Store(vbID, &models.Offset{
+		offset := &models.Offset{
 			SnapshotMarker: &models.SnapshotMarker{
 				StartSeqNo: doc.Checkpoint.Snapshot.StartSeqNo,
 				EndSeqNo:   doc.Checkpoint.Snapshot.EndSeqNo,
 			},
 			VbUUID: gocbcore.VbUUID(doc.Checkpoint.VbUUID),
 			SeqNo:  doc.Checkpoint.SeqNo,
-		})
+		}
+
+		if s.skipSnapshotGap(vbID, offset) {
+			dirtyOffsets.Store(vbID, true)
+			anyDirtyOffset = true
+		}
+
+		offsets.Store(vbID, offset)
+		s.metric.SavedSeqNos.Store(vbID, doc.Checkpoint.SeqNo)
 
 		return true
 	})
 
-	return offsets, dirtyOffsets, anyDirtyOffset
+	if rangeErr != nil {
+		return nil, nil, false, rangeErr
+	}
+
+	return offsets, dirtyOffsets, anyDirtyOffset, nil
+}
+
+// skipSnapshotGap moves the offset to the end of its snapshot when the checkpoint was saved far
+// before the snapshot end and the configured strategy accepts losing the events in between.
+func (s *checkpoint) skipSnapshotGap(vbID uint16, offset *models.Offset) bool {
+	if offset.EndSeqNo <= offset.SeqNo {
+		return false
+	}
+
+	gap := offset.EndSeqNo - offset.SeqNo
+	if gap < s.config.Checkpoint.SnapshotGap.Threshold {
+		return false
+	}
+
+	if s.config.Checkpoint.SnapshotGap.Strategy != config.SnapshotGapStrategySkip {
+		logger.Log.Info(
+			"large snapshot gap on restart, vbID: %v, seqNo: %v, snapshot end: %v, gap: %v, proceeding from seqNo",
+			vbID, offset.SeqNo, offset.EndSeqNo, gap,
+		)
+		return false
+	}
+
+	logger.Log.Warn(
+		"large snapshot gap on restart, vbID: %v, seqNo: %v, snapshot end: %v, gap: %v, skipping to snapshot end",
+		vbID, offset.SeqNo, offset.EndSeqNo, gap,
+	)
+
+	offset.SeqNo = offset.EndSeqNo
+	offset.StartSeqNo = offset.EndSeqNo
+
+	return true
 }
 
 func (s *checkpoint) Clear() {
@@ -196,21 +402,188 @@ func (s *checkpoint) Clear() {
 	logger.Log.Debug("cleared checkpoint")
 }
 
+func (s *checkpoint) OffsetAdvanced(vbID uint16) {
+	wb := s.writeBehind.Load()
+	if wb == nil {
+		return
+	}
+
+	pending := wb.pending.Add(1)
+	if pending == 1 {
+		notify(wb.armCh)
+	}
+
+	writeBehindConfig := s.config.Checkpoint.WriteBehind
+
+	if pending >= int64(writeBehindConfig.MaxPending) {
+		notify(wb.flushCh)
+		return
+	}
+
+	// every vbucket that became dirty since the latest flush adds its document to the next write
+	if writeBehindConfig.MaxPendingBytes > 0 && int(vbID) < len(wb.dirty) && !wb.dirty[vbID].Swap(true) {
+		if wb.pendingBytes.Add(wb.documentSize) >= int64(writeBehindConfig.MaxPendingBytes) {
+			notify(wb.flushCh)
+		}
+	}
+}
+
+// checkpointDocumentSize is the encoded size of the largest checkpoint document of this checkpoint.
+func (s *checkpoint) checkpointDocumentSize() int64 {
+	payload, err := jsoniter.Marshal(&models.CheckpointDocument{
+		Checkpoint: &models.CheckpointDocumentCheckpoint{
+			VbUUID: math.MaxUint64,
+			SeqNo:  math.MaxUint64,
+			Snapshot: &models.CheckpointDocumentSnapshot{
+				StartSeqNo: math.MaxUint64,
+				EndSeqNo:   math.MaxUint64,
+			},
+		},
+		BucketUUID: s.bucketUUID,
+		Owner:      s.owner,
+	})
+	if err != nil {
+		return 0
+	}
+
+	return int64(len(payload))
+}
+
+func (s *checkpoint) startWriteBehind() {
+	wb := &writeBehind{
+		pending:      &atomic.Int64{},
+		pendingBytes: &atomic.Int64{},
+		dirty:        make([]atomic.Bool, slices.Max(append([]uint16{0}, s.vbIds...))+1),
+		armCh:        make(chan struct{}, 1),
+		flushCh:      make(chan struct{}, 1),
+		stopCh:       make(chan struct{}),
+		doneCh:       make(chan struct{}),
+		documentSize: s.checkpointDocumentSize(),
+	}
+	s.writeBehind.Store(wb)
+
+	go func() {
+		defer close(wb.doneCh)
+
+		var timer *time.Timer
+		var timerCh <-chan time.Time
+
+		flush := func() {
+			if timer != nil {
+				timer.Stop()
+				timer, timerCh = nil, nil
+			}
+
+			wb.reset()
+			s.Save()
+		}
+
+		for {
+			select {
+			case <-wb.armCh:
+				// bound the unsaved window from the first advance after the latest flush
+				if timer == nil {
+					timer = time.NewTimer(s.config.Checkpoint.WriteBehind.MaxLatency)
+					timerCh = timer.C
+				}
+			case <-wb.flushCh:
+				flush()
+			case <-timerCh:
+				flush()
+			case <-wb.stopCh:
+				if timer != nil {
+					timer.Stop()
+				}
+				return
+			}
+		}
+	}()
+
+	logger.Log.Debug(
+		"started checkpoint write-behind, maxPending: %v, maxPendingBytes: %v, maxLatency: %v",
+		s.config.Checkpoint.WriteBehind.MaxPending, s.config.Checkpoint.WriteBehind.MaxPendingBytes,
+		s.config.Checkpoint.WriteBehind.MaxLatency,
+	)
+}
+
 func (s *checkpoint) StartSchedule() {
 	if s.config.Checkpoint.Type != CheckpointTypeAuto {
 		return
 	}
 
+	if s.config.Checkpoint.WriteBehind.Enabled {
+		s.startWriteBehind()
+		return
+	}
+
 	go func() {
-		s.schedule = time.NewTicker(s.config.Checkpoint.Interval)
+		interval := s.config.CheckpointInterval()
+		s.schedule = time.NewTicker(interval)
 		for range s.schedule.C {
 			s.Save()
+
+			if s.config.Checkpoint.Adaptive.Enabled {
+				interval = s.adaptInterval(interval)
+			} else if configured := s.config.CheckpointInterval(); interval != configured {
+				// the interval is changed by a config reload
+				interval = configured
+				s.schedule.Reset(interval)
+			}
 		}
 	}()
 
 	logger.Log.Debug("started checkpoint schedule")
 }
 
+// observeLatency keeps the mean of the latest adaptive.window offset write latencies, so a single
+// slow write does not back off the save interval.
+func (s *checkpoint) observeLatency(latency time.Duration) {
+	window := s.config.Checkpoint.Adaptive.Window
+	if window < 1 {
+		window = 1
+	}
+
+	s.latencyWindow = append(s.latencyWindow, latency)
+	if len(s.latencyWindow) > window {
+		s.latencyWindow = s.latencyWindow[len(s.latencyWindow)-window:]
+	}
+
+	var sum time.Duration
+	for _, l := range s.latencyWindow {
+		sum += l
+	}
+
+	s.smoothedLatency.Store(int64(sum) / int64(len(s.latencyWindow)))
+}
+
+// adaptInterval doubles the save interval while the smoothed metadata write latency is above
+// the threshold and halves it back towards the configured interval once it recovers.
+func (s *checkpoint) adaptInterval(current time.Duration) time.Duration {
+	adaptive := s.config.Checkpoint.Adaptive
+	configured := s.config.CheckpointInterval()
+	latency := time.Duration(s.smoothedLatency.Load())
+
+	next := current
+	if latency > adaptive.LatencyThreshold {
+		next = current * 2
+		if next > adaptive.MaxInterval {
+			next = adaptive.MaxInterval
+		}
+	} else if current > configured {
+		next = current / 2
+		if next < configured {
+			next = configured
+		}
+	}
+
+	if next != current {
+		s.schedule.Reset(next)
+		logger.Log.Info("checkpoint interval changed from %v to %v, smoothed offset write latency: %v", current, next, latency)
+	}
+
+	return next
+}
+
 func (s *checkpoint) StopSchedule() {
 	if s.config.Checkpoint.Type != CheckpointTypeAuto {
 		return
@@ -220,6 +593,12 @@ func (s *checkpoint) StopSchedule() {
 		s.schedule.Stop()
 	}
 
+	if wb := s.writeBehind.Swap(nil); wb != nil {
+		close(wb.stopCh)
+		// a flush in progress finishes before the schedule is reported as stopped
+		<-wb.doneCh
+	}
+
 	logger.Log.Debug("stopped checkpoint schedule")
 }
 
@@ -227,32 +606,28 @@ func (s *checkpoint) GetMetric() *CheckpointMetric {
 	return s.metric
 }
 
-func getBucketUUID(client couchbase.Client) string {
-	snapshot, err := client.GetDcpAgentConfigSnapshot()
-	if err != nil {
-		logger.Log.Error("error while get config snapshot, err: %v", err)
-		panic(err)
-	}
-
-	return snapshot.BucketUUID()
-}
-
 func NewCheckpoint(
 	stream Stream,
 	vbIds []uint16,
 	client couchbase.Client,
 	metadata metadata.Metadata,
 	config *config.Dcp,
+	bucketUUID string,
+	saveMetric *CheckpointSaveMetric,
 ) Checkpoint {
 	return &checkpoint{
 		client:     client,
 		stream:     stream,
 		vbIds:      vbIds,
-		bucketUUID: getBucketUUID(client),
+		bucketUUID: bucketUUID,
+		owner:      config.GetMetadataOwner(),
 		metadata:   metadata,
 		config:     config,
 		saveLock:   &sync.Mutex{},
 		loadLock:   &sync.Mutex{},
-		metric:     &CheckpointMetric{},
+		metric: &CheckpointMetric{
+			Save:        saveMetric,
+			SavedSeqNos: wrapper.CreateConcurrentSwissMap[uint16, uint64](1024),
+		},
 	}
 }
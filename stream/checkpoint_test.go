@@ -0,0 +1,204 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Trendyol/go-dcp/config"
+	"github.com/Trendyol/go-dcp/metadata"
+	"github.com/Trendyol/go-dcp/models"
+	"github.com/Trendyol/go-dcp/wrapper"
+)
+
+type dirtyStream struct {
+	Stream
+}
+
+func (s *dirtyStream) GetOffsets() (*wrapper.ConcurrentSwissMap[uint16, *models.Offset], *wrapper.ConcurrentSwissMap[uint16, bool], bool) { //nolint:lll
+	offsets := wrapper.CreateConcurrentSwissMap[uint16, *models.Offset](1)
+	offsets.Store(0, &models.Offset{SnapshotMarker: &models.SnapshotMarker{}, SeqNo: 1})
+
+	dirtyOffsets := wrapper.CreateConcurrentSwissMap[uint16, bool](1)
+	dirtyOffsets.Store(0, true)
+
+	return offsets, dirtyOffsets, true
+}
+
+func (s *dirtyStream) UnmarkDirtyOffsets() {}
+
+type savingMetadata struct {
+	metadata.Metadata
+	saved chan struct{}
+}
+
+func (m *savingMetadata) Save(_ map[uint16]*models.CheckpointDocument, _ map[uint16]bool, _ string) error {
+	m.saved <- struct{}{}
+	return nil
+}
+
+func newWriteBehindTestCheckpoint(writeBehind config.CheckpointWriteBehind) (*checkpoint, *savingMetadata) {
+	writeBehind.Enabled = true
+
+	c := &config.Dcp{}
+	c.Checkpoint.Type = CheckpointTypeAuto
+	c.Checkpoint.WriteBehind = writeBehind
+
+	m := &savingMetadata{saved: make(chan struct{}, 16)}
+
+	return NewCheckpoint(&dirtyStream{}, []uint16{0, 1, 2, 3}, nil, m, c, "uuid", NewCheckpointSaveMetric()).(*checkpoint), m
+}
+
+func waitSave(t *testing.T, m *savingMetadata, expected bool) {
+	t.Helper()
+
+	select {
+	case <-m.saved:
+		if !expected {
+			t.Fatal("expected no checkpoint save")
+		}
+	case <-time.After(100 * time.Millisecond):
+		if expected {
+			t.Fatal("expected a checkpoint save")
+		}
+	}
+}
+
+func TestWriteBehindFlushesOnMaxPending(t *testing.T) {
+	cp, m := newWriteBehindTestCheckpoint(config.CheckpointWriteBehind{MaxPending: 3, MaxLatency: time.Hour})
+	cp.StartSchedule()
+	defer cp.StopSchedule()
+
+	cp.OffsetAdvanced(0)
+	cp.OffsetAdvanced(0)
+	waitSave(t, m, false)
+
+	cp.OffsetAdvanced(0)
+	waitSave(t, m, true)
+}
+
+func TestWriteBehindFlushesOnMaxPendingBytes(t *testing.T) {
+	cp, m := newWriteBehindTestCheckpoint(config.CheckpointWriteBehind{MaxPending: 1000, MaxLatency: time.Hour})
+	cp.config.Checkpoint.WriteBehind.MaxPendingBytes = int(2 * cp.checkpointDocumentSize())
+	cp.StartSchedule()
+	defer cp.StopSchedule()
+
+	// advances of an already dirty vbucket do not grow the pending write
+	cp.OffsetAdvanced(1)
+	cp.OffsetAdvanced(1)
+	waitSave(t, m, false)
+
+	cp.OffsetAdvanced(2)
+	waitSave(t, m, true)
+}
+
+func TestWriteBehindFlushesOnMaxLatency(t *testing.T) {
+	cp, m := newWriteBehindTestCheckpoint(config.CheckpointWriteBehind{MaxPending: 1000, MaxLatency: 20 * time.Millisecond})
+	cp.StartSchedule()
+	defer cp.StopSchedule()
+
+	cp.OffsetAdvanced(3)
+	waitSave(t, m, true)
+}
+
+func TestWriteBehindIgnoresAdvancesAfterStop(t *testing.T) {
+	cp, m := newWriteBehindTestCheckpoint(config.CheckpointWriteBehind{MaxPending: 1, MaxLatency: time.Hour})
+	cp.StartSchedule()
+	cp.StopSchedule()
+
+	cp.OffsetAdvanced(0)
+	waitSave(t, m, false)
+}
+
+func TestAdaptiveIntervalFollowsSmoothedLatency(t *testing.T) {
+	c := &config.Dcp{}
+	c.Checkpoint.Interval = time.Second
+	c.Checkpoint.Adaptive = config.CheckpointAdaptive{
+		Enabled:          true,
+		LatencyThreshold: 100 * time.Millisecond,
+		MaxInterval:      4 * time.Second,
+		Window:           4,
+	}
+
+	cp := NewCheckpoint(&dirtyStream{}, []uint16{0}, nil, nil, c, "uuid", NewCheckpointSaveMetric()).(*checkpoint)
+	cp.schedule = time.NewTicker(time.Hour)
+	defer cp.schedule.Stop()
+
+	for _, latency := range []time.Duration{10, 10, 10, 300} {
+		cp.observeLatency(latency * time.Millisecond)
+	}
+
+	// a single slow write among fast ones keeps the interval
+	interval := cp.adaptInterval(time.Second)
+	if interval != time.Second {
+		t.Fatalf("expected interval to stay at 1s, got: %v", interval)
+	}
+
+	for _, latency := range []time.Duration{300, 300, 300} {
+		cp.observeLatency(latency * time.Millisecond)
+	}
+
+	interval = cp.adaptInterval(interval)
+	interval = cp.adaptInterval(interval)
+	interval = cp.adaptInterval(interval)
+	if interval != 4*time.Second {
+		t.Fatalf("expected interval to back off up to 4s, got: %v", interval)
+	}
+
+	for _, latency := range []time.Duration{10, 10, 10, 10} {
+		cp.observeLatency(latency * time.Millisecond)
+	}
+
+	interval = cp.adaptInterval(interval)
+	if interval != 2*time.Second {
+		t.Fatalf("expected interval to be halved to 2s, got: %v", interval)
+	}
+}
+
+type blockingMetadata struct {
+	metadata.Metadata
+	release chan struct{}
+	saves   atomic.Int32
+}
+
+func (m *blockingMetadata) Save(_ map[uint16]*models.CheckpointDocument, _ map[uint16]bool, _ string) error {
+	m.saves.Add(1)
+	<-m.release
+	return nil
+}
+
+func TestSaveAndWaitReturnsOnContextWithoutLeaking(t *testing.T) {
+	m := &blockingMetadata{release: make(chan struct{})}
+	cp := NewCheckpoint(&dirtyStream{}, []uint16{0}, nil, m, &config.Dcp{}, "uuid", NewCheckpointSaveMetric()).(*checkpoint)
+
+	goroutines := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := cp.SaveAndWait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got: %v", err)
+	}
+
+	close(m.release)
+
+	// the write holds the save lock until it returns
+	cp.saveLock.Lock()
+	cp.saveLock.Unlock() //nolint:staticcheck
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > goroutines {
+		if time.Now().After(deadline) {
+			t.Fatalf("save goroutine is expected to exit, goroutines: %v, before: %v", runtime.NumGoroutine(), goroutines)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// a done context does not start another write
+	if err := cp.SaveAndWait(ctx); !errors.Is(err, context.DeadlineExceeded) || m.saves.Load() != 1 {
+		t.Fatalf("expected no save with a done context, err: %v, saves: %v", err, m.saves.Load())
+	}
+}
@@ -0,0 +1,315 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Trendyol/go-dcp/config"
+	"github.com/Trendyol/go-dcp/logger"
+	"github.com/Trendyol/go-dcp/models"
+)
+
+var ErrCollectionNotConfigured = errors.New("collection is not configured")
+
+type bufferedEvent struct {
+	eventTime time.Time
+	spanCtx   context.Context
+	payload   interface{}
+	offset    *models.Offset
+	vbID      uint16
+}
+
+// heldVBucket keeps the seqNos of the events of a vbucket that are buffered, or replayed and not acknowledged
+// yet, in order. The offset of the vbucket is held before the first of them and the offsets after it are deferred.
+type heldVBucket struct {
+	deferred *models.Offset
+	seqNos   []uint64
+	dirty    bool
+}
+
+func (h *heldVBucket) add(seqNo uint64) {
+	i := sort.Search(len(h.seqNos), func(i int) bool { return h.seqNos[i] >= seqNo })
+	h.seqNos = slices.Insert(h.seqNos, i, seqNo)
+}
+
+func (h *heldVBucket) remove(seqNo uint64) {
+	i := sort.Search(len(h.seqNos), func(i int) bool { return h.seqNos[i] >= seqNo })
+	if i < len(h.seqNos) && h.seqNos[i] == seqNo {
+		h.seqNos = slices.Delete(h.seqNos, i, i+1)
+	}
+}
+
+// collectionPause filters the events of paused collections at dispatch while the vbucket streams stay open.
+// The offset of a vbucket with buffered events stays before the first of them, so a checkpoint never skips them.
+type collectionPause struct {
+	stream     *stream
+	cond       *sync.Cond
+	paused     map[string][]*bufferedEvent
+	held       map[uint16]*heldVBucket
+	resumeCh   chan struct{}
+	replay     []*bufferedEvent
+	lock       sync.Mutex
+	holding    atomic.Int32
+	generation int
+}
+
+func eventCollectionName(payload interface{}) (string, bool) {
+	switch v := payload.(type) {
+	case models.DcpMutation:
+		return v.CollectionName, true
+	case models.DcpDeletion:
+		return v.CollectionName, true
+	case models.DcpExpiration:
+		return v.CollectionName, true
+	default:
+		return "", false
+	}
+}
+
+func (p *collectionPause) Pause(collectionName string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if _, ok := p.paused[collectionName]; !ok {
+		p.paused[collectionName] = nil
+		logger.Log.Info("collection paused: %v, strategy: %v", collectionName, p.stream.config.Dcp.Listener.PausedCollection.Strategy)
+	}
+}
+
+func (p *collectionPause) Resume(collectionName string) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	events, ok := p.paused[collectionName]
+	if !ok {
+		return false
+	}
+
+	delete(p.paused, collectionName)
+	p.replay = append(p.replay, events...)
+	p.cond.Broadcast()
+
+	select {
+	case p.resumeCh <- struct{}{}:
+	default:
+	}
+
+	logger.Log.Info("collection resumed: %v, buffered events: %v", collectionName, len(events))
+
+	return true
+}
+
+func (p *collectionPause) Paused() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	names := make([]string, 0, len(p.paused))
+	for name := range p.paused {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// hold reports whether the offset is at or after the first held event of the vbucket, the latest of these offsets
+// is applied once the held events are acknowledged. It does not lock while no vbucket is held.
+func (p *collectionPause) hold(vbID uint16, offset *models.Offset, dirty bool) bool {
+	if p.holding.Load() == 0 {
+		return false
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	held, ok := p.held[vbID]
+	if !ok || offset.SeqNo < held.seqNos[0] {
+		return false
+	}
+
+	if held.deferred == nil || offset.SeqNo >= held.deferred.SeqNo {
+		held.deferred = offset
+	}
+	held.dirty = held.dirty || dirty
+
+	return true
+}
+
+// track holds the offset of the vbucket before the buffered event, it must be called with the lock held.
+func (p *collectionPause) track(vbID uint16, seqNo uint64) {
+	held, ok := p.held[vbID]
+	if !ok {
+		held = &heldVBucket{}
+		p.held[vbID] = held
+		p.holding.Add(1)
+	}
+
+	held.add(seqNo)
+}
+
+// release is called once a replayed event is acknowledged, the deferred offset is applied when it was the last
+// held event of the vbucket. Acknowledgements of events held before a reset are ignored.
+func (p *collectionPause) release(vbID uint16, seqNo uint64, held *heldVBucket) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if held == nil || p.held[vbID] != held {
+		return
+	}
+
+	held.remove(seqNo)
+	if len(held.seqNos) > 0 {
+		return
+	}
+
+	delete(p.held, vbID)
+	p.holding.Add(-1)
+
+	if held.deferred != nil {
+		p.stream.storeOffset(vbID, held.deferred, held.dirty)
+	}
+}
+
+// filter reports whether the event belongs to a paused collection and was buffered or dropped.
+// When the buffer is full it waits until the collection is resumed or the stream is closed.
+func (p *collectionPause) filter(
+	spanCtx context.Context, payload interface{}, offset *models.Offset, vbID uint16, eventTime time.Time,
+) bool {
+	collectionName, ok := eventCollectionName(payload)
+	if !ok {
+		return false
+	}
+
+	p.lock.Lock()
+
+	if _, paused := p.paused[collectionName]; !paused {
+		p.lock.Unlock()
+		return false
+	}
+
+	if p.stream.config.Dcp.Listener.PausedCollection.Strategy == config.PausedCollectionStrategyDrop {
+		p.lock.Unlock()
+		p.stream.advanceOffset(vbID, offset, true)
+		endSkippedEventSpan(spanCtx, "paused")
+		return true
+	}
+
+	generation := p.generation
+	for p.generation == generation && len(p.paused[collectionName]) >= p.stream.config.Dcp.Listener.PausedCollection.BufferSize {
+		if _, paused := p.paused[collectionName]; !paused {
+			break
+		}
+		p.cond.Wait()
+	}
+
+	if p.generation != generation {
+		p.lock.Unlock()
+		endSkippedEventSpan(spanCtx, "reset")
+		return true
+	}
+
+	if _, paused := p.paused[collectionName]; !paused {
+		p.lock.Unlock()
+		p.drain()
+		return false
+	}
+
+	p.paused[collectionName] = append(p.paused[collectionName], &bufferedEvent{
+		spanCtx:   spanCtx,
+		payload:   payload,
+		offset:    offset,
+		vbID:      vbID,
+		eventTime: eventTime,
+	})
+	p.track(vbID, offset.SeqNo)
+
+	p.lock.Unlock()
+
+	return true
+}
+
+// drain delivers the buffered events of resumed collections, it runs on the listen goroutine.
+// They skip the dedup check since later events of their vbuckets were already delivered.
+func (p *collectionPause) drain() {
+	p.lock.Lock()
+	events := p.replay
+	p.replay = nil
+	p.lock.Unlock()
+
+	for _, event := range events {
+		event := event
+
+		p.lock.Lock()
+		held := p.held[event.vbID]
+		p.lock.Unlock()
+
+		p.stream.deliver(event.spanCtx, event.payload, event.offset, event.vbID, event.eventTime, func() {
+			p.release(event.vbID, event.offset.SeqNo, held)
+		})
+	}
+}
+
+// reset discards buffered events when the stream restarts, they are streamed again from the last checkpoint.
+func (p *collectionPause) reset() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for name, events := range p.paused {
+		for _, event := range events {
+			endSkippedEventSpan(event.spanCtx, "reset")
+		}
+
+		p.paused[name] = nil
+	}
+
+	p.held = map[uint16]*heldVBucket{}
+	p.holding.Store(0)
+	p.replay = nil
+	p.generation++
+	p.cond.Broadcast()
+}
+
+// forget discards the buffered events of the vbucket and its held offset, its offset is reset.
+func (p *collectionPause) forget(vbID uint16) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	discard := func(event *bufferedEvent) bool {
+		if event.vbID != vbID {
+			return false
+		}
+
+		endSkippedEventSpan(event.spanCtx, "reset")
+
+		return true
+	}
+
+	for name, events := range p.paused {
+		p.paused[name] = slices.DeleteFunc(events, discard)
+	}
+	p.replay = slices.DeleteFunc(p.replay, discard)
+
+	if _, ok := p.held[vbID]; ok {
+		delete(p.held, vbID)
+		p.holding.Add(-1)
+	}
+
+	p.cond.Broadcast()
+}
+
+func newCollectionPause(s *stream) *collectionPause {
+	p := &collectionPause{
+		stream:   s,
+		paused:   map[string][]*bufferedEvent{},
+		held:     map[uint16]*heldVBucket{},
+		resumeCh: make(chan struct{}, 1),
+	}
+	p.cond = sync.NewCond(&p.lock)
+
+	return p
+}
@@ -0,0 +1,128 @@
+package stream
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Trendyol/go-dcp/config"
+	"github.com/Trendyol/go-dcp/helpers"
+	"github.com/Trendyol/go-dcp/models"
+
+	"github.com/couchbase/gocbcore/v10"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func newPauseTestStream(strategy string) (*stream, *[]uint64) {
+	s := newDispatchTestStream(config.DCPListener{
+		PausedCollection: config.DCPPausedCollection{Strategy: strategy, BufferSize: 10},
+	})
+	s.config.CollectionNames = []string{"orders", "products"}
+	s.config.Metadata.Prefix = helpers.Prefix
+	s.tracer = noop.NewTracerProvider().Tracer("test")
+
+	delivered := &[]uint64{}
+	s.listener = func(ctx *models.ListenerContext) {
+		*delivered = append(*delivered, ctx.Event.(models.DcpMutation).SeqNo)
+		ctx.Ack()
+	}
+
+	return s, delivered
+}
+
+func pauseTestMutation(collectionName string, vbID uint16, seqNo uint64) models.DcpMutation {
+	return models.DcpMutation{
+		DcpMutation:    &gocbcore.DcpMutation{VbID: vbID, SeqNo: seqNo, Key: []byte("key")},
+		Offset:         testOffset(seqNo),
+		CollectionName: collectionName,
+	}
+}
+
+func TestCollectionPauseHoldsOffsetAtFirstBufferedEvent(t *testing.T) {
+	s, delivered := newPauseTestStream(config.PausedCollectionStrategyBuffer)
+
+	if err := s.PauseCollection("orders"); err != nil {
+		t.Fatalf("expected orders to be paused, err: %v", err)
+	}
+
+	s.handleEvent(pauseTestMutation("products", 0, 1))
+	s.handleEvent(pauseTestMutation("orders", 0, 2))
+	s.handleEvent(pauseTestMutation("products", 0, 3))
+	s.handleEvent(pauseTestMutation("products", 1, 4))
+
+	if len(*delivered) != 3 || offsetSeqNo(s, 0) != 1 || offsetSeqNo(s, 1) != 4 {
+		t.Fatalf("offset of vbID 0 is expected to stay before the buffered event, delivered: %v, offsets: %v, %v",
+			*delivered, offsetSeqNo(s, 0), offsetSeqNo(s, 1))
+	}
+
+	var replayed *models.ListenerContext
+	s.listener = func(ctx *models.ListenerContext) {
+		replayed = ctx
+	}
+
+	if !s.ResumeCollection("orders") {
+		t.Fatal("expected orders to be resumed")
+	}
+	s.collectionPause.drain()
+
+	if replayed == nil || offsetSeqNo(s, 0) != 1 {
+		t.Fatalf("offset is expected to be held until the replayed event is acknowledged, offset: %v", offsetSeqNo(s, 0))
+	}
+
+	replayed.Ack()
+
+	if offsetSeqNo(s, 0) != 3 || s.collectionPause.holding.Load() != 0 {
+		t.Errorf("offset is expected to move to the latest event once the replayed one is acknowledged, offset: %v",
+			offsetSeqNo(s, 0))
+	}
+}
+
+func TestCollectionPauseDropsEvents(t *testing.T) {
+	s, delivered := newPauseTestStream(config.PausedCollectionStrategyDrop)
+	_ = s.PauseCollection("orders")
+
+	s.handleEvent(pauseTestMutation("orders", 0, 1))
+	s.handleEvent(pauseTestMutation("products", 0, 2))
+
+	if len(*delivered) != 1 || (*delivered)[0] != 2 || offsetSeqNo(s, 0) != 2 {
+		t.Fatalf("dropped event is expected to be skipped, delivered: %v, offset: %v", *delivered, offsetSeqNo(s, 0))
+	}
+
+	s.ResumeCollection("orders")
+	s.collectionPause.drain()
+	s.handleEvent(pauseTestMutation("orders", 0, 3))
+
+	if len(*delivered) != 2 || offsetSeqNo(s, 0) != 3 {
+		t.Errorf("resumed collection is expected to be delivered, delivered: %v, offset: %v", *delivered, offsetSeqNo(s, 0))
+	}
+}
+
+func TestCollectionPauseForgetsResetVBucket(t *testing.T) {
+	s, delivered := newPauseTestStream(config.PausedCollectionStrategyBuffer)
+	_ = s.PauseCollection("orders")
+
+	s.handleEvent(pauseTestMutation("orders", 0, 1))
+	s.handleEvent(pauseTestMutation("orders", 1, 2))
+
+	s.collectionPause.forget(0)
+	s.setOffset(0, testOffset(10), true)
+
+	s.ResumeCollection("orders")
+	s.collectionPause.drain()
+
+	if len(*delivered) != 1 || (*delivered)[0] != 2 || offsetSeqNo(s, 0) != 10 || offsetSeqNo(s, 1) != 2 {
+		t.Errorf("buffered events of the reset vbucket are expected to be dropped, delivered: %v, offsets: %v, %v",
+			*delivered, offsetSeqNo(s, 0), offsetSeqNo(s, 1))
+	}
+}
+
+func TestCollectionPauseNotConfigured(t *testing.T) {
+	s, _ := newPauseTestStream(config.PausedCollectionStrategyBuffer)
+
+	if err := s.PauseCollection("users"); !errors.Is(err, ErrCollectionNotConfigured) {
+		t.Errorf("expected: %v, got: %v", ErrCollectionNotConfigured, err)
+	}
+
+	if s.ResumeCollection("orders") {
+		t.Error("collection that is not paused is not expected to be resumed")
+	}
+}
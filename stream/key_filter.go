@@ -0,0 +1,72 @@
+package stream
+
+import (
+	"bytes"
+	"regexp"
+
+	"github.com/Trendyol/go-dcp/config"
+	"github.com/Trendyol/go-dcp/models"
+)
+
+// keyFilter drops the data events whose keys do not match dcp.filter before they reach the listener. A key
+// has to start with one of the prefixes and match the regex, each condition only applies when it is set.
+type keyFilter struct {
+	regex    *regexp.Regexp
+	prefixes [][]byte
+}
+
+func eventKey(payload interface{}) ([]byte, bool) {
+	switch v := payload.(type) {
+	case models.DcpMutation:
+		return v.Key, true
+	case models.DcpDeletion:
+		return v.Key, true
+	case models.DcpExpiration:
+		return v.Key, true
+	default:
+		return nil, false
+	}
+}
+
+// skips reports whether the event is filtered out, events without a key are never filtered.
+func (f *keyFilter) skips(payload interface{}) bool {
+	key, ok := eventKey(payload)
+	if !ok {
+		return false
+	}
+
+	if len(f.prefixes) > 0 {
+		matched := false
+		for _, prefix := range f.prefixes {
+			if bytes.HasPrefix(key, prefix) {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			return true
+		}
+	}
+
+	return f.regex != nil && !f.regex.Match(key)
+}
+
+// newKeyFilter returns nil when no filter is configured.
+func newKeyFilter(filter config.DCPFilter) *keyFilter {
+	if filter.KeyRegex == "" && len(filter.KeyPrefixes) == 0 {
+		return nil
+	}
+
+	f := &keyFilter{}
+
+	if filter.KeyRegex != "" {
+		f.regex = regexp.MustCompile(filter.KeyRegex)
+	}
+
+	for _, prefix := range filter.KeyPrefixes {
+		f.prefixes = append(f.prefixes, []byte(prefix))
+	}
+
+	return f
+}
@@ -0,0 +1,72 @@
+package stream
+
+import (
+	"testing"
+
+	"github.com/Trendyol/go-dcp/config"
+	"github.com/Trendyol/go-dcp/models"
+
+	"github.com/couchbase/gocbcore/v10"
+)
+
+func TestNewKeyFilterWithoutFilter(t *testing.T) {
+	if f := newKeyFilter(config.DCPFilter{}); f != nil {
+		t.Errorf("expected no key filter, got: %v", f)
+	}
+}
+
+func TestKeyFilterSkips(t *testing.T) {
+	tests := []struct {
+		payload  interface{}
+		name     string
+		filter   config.DCPFilter
+		expected bool
+	}{
+		{
+			name:    "matching prefix",
+			filter:  config.DCPFilter{KeyPrefixes: []string{"order:", "user:"}},
+			payload: models.DcpMutation{DcpMutation: &gocbcore.DcpMutation{Key: []byte("user:1")}},
+		},
+		{
+			name:     "other prefix",
+			filter:   config.DCPFilter{KeyPrefixes: []string{"order:", "user:"}},
+			payload:  models.DcpMutation{DcpMutation: &gocbcore.DcpMutation{Key: []byte("product:1")}},
+			expected: true,
+		},
+		{
+			name:    "matching regex",
+			filter:  config.DCPFilter{KeyRegex: "^user:[0-9]+$"},
+			payload: models.DcpDeletion{DcpDeletion: &gocbcore.DcpDeletion{Key: []byte("user:12")}},
+		},
+		{
+			name:     "not matching regex",
+			filter:   config.DCPFilter{KeyRegex: "^user:[0-9]+$"},
+			payload:  models.DcpExpiration{DcpExpiration: &gocbcore.DcpExpiration{Key: []byte("user:abc")}},
+			expected: true,
+		},
+		{
+			name:     "matching prefix but not regex",
+			filter:   config.DCPFilter{KeyPrefixes: []string{"user:"}, KeyRegex: "[0-9]$"},
+			payload:  models.DcpMutation{DcpMutation: &gocbcore.DcpMutation{Key: []byte("user:abc")}},
+			expected: true,
+		},
+		{
+			name:    "matching prefix and regex",
+			filter:  config.DCPFilter{KeyPrefixes: []string{"user:"}, KeyRegex: "[0-9]$"},
+			payload: models.DcpMutation{DcpMutation: &gocbcore.DcpMutation{Key: []byte("user:1")}},
+		},
+		{
+			name:    "event without key",
+			filter:  config.DCPFilter{KeyPrefixes: []string{"user:"}},
+			payload: models.DcpSeqNoAdvanced{DcpSeqNoAdvanced: &gocbcore.DcpSeqNoAdvanced{SeqNo: 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if skips := newKeyFilter(tt.filter).skips(tt.payload); skips != tt.expected {
+				t.Errorf("expected: %v, got: %v", tt.expected, skips)
+			}
+		})
+	}
+}
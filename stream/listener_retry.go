@@ -0,0 +1,187 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/Trendyol/go-dcp/config"
+	"github.com/Trendyol/go-dcp/logger"
+	"github.com/Trendyol/go-dcp/models"
+)
+
+var ErrListenerPanicked = errors.New("listener panicked")
+
+// eventAck acknowledges an event once, a failed event that blocks the stream waits for it.
+type eventAck struct {
+	ack    func()
+	waitCh chan struct{}
+	lock   sync.Mutex
+	acked  bool
+}
+
+func newEventAck(ack func()) *eventAck {
+	return &eventAck{ack: ack}
+}
+
+func (a *eventAck) Ack() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.acked {
+		return
+	}
+
+	a.acked = true
+	a.ack()
+
+	if a.waitCh != nil {
+		close(a.waitCh)
+	}
+}
+
+// wait returns a channel that is closed once the event is acknowledged.
+func (a *eventAck) wait() <-chan struct{} {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.waitCh == nil {
+		a.waitCh = make(chan struct{})
+		if a.acked {
+			close(a.waitCh)
+		}
+	}
+
+	return a.waitCh
+}
+
+// recoverListener turns a panic of the listener into an error, so a single event can not crash the stream.
+func recoverListener(call func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Log.Error("listener panicked, err: %v, stack: %s", r, debug.Stack())
+			err = fmt.Errorf("%w: %v", ErrListenerPanicked, r)
+		}
+	}()
+
+	return call()
+}
+
+// callListener runs the listener in a slot of the parallel dispatcher, the slots bound the listener calls of all vbuckets.
+func (s *stream) callListener(call func() error) error {
+	if s.dispatcher != nil {
+		return s.dispatcher.call(call)
+	}
+
+	return call()
+}
+
+// callWithRetry calls the listener with exponential backoff until it returns nil or the attempts are exhausted,
+// it returns the last listener error in that case.
+func (s *stream) callWithRetry(call func() error, target fmt.Stringer) error {
+	retry := s.config.ListenerRetry()
+	backoff := retry.Backoff
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = s.callListener(func() error { return recoverListener(call) }); err == nil {
+			return nil
+		}
+
+		if attempt >= retry.Attempts {
+			break
+		}
+
+		logger.Log.Warn("listener failed, %v, attempt: %v, retry in: %v, err: %v", target, attempt, backoff, err)
+
+		time.Sleep(backoff)
+
+		backoff *= 2
+		if backoff > retry.MaxBackoff {
+			backoff = retry.MaxBackoff
+		}
+	}
+
+	return err
+}
+
+type vbIDTarget uint16
+
+func (t vbIDTarget) String() string {
+	return fmt.Sprintf("vbID: %v", uint16(t))
+}
+
+// onListenerFailure handles an event whose listener failed or panicked. It is either skipped and acknowledged, handed
+// to the dead letter handler and acknowledged, or its vbucket is blocked until the event is acknowledged.
+func (s *stream) onListenerFailure(ctx *models.ListenerContext, ack *eventAck, vbID uint16, err error) {
+	s.metric.ListenerFailure.Add(1)
+
+	switch s.config.Dcp.Listener.OnError {
+	case config.ListenerOnErrorSkip:
+		logger.Errorw("listener failed, skipping event", "vbID", vbID, "err", err)
+		ctx.Ack()
+		return
+	case config.ListenerOnErrorDLQ:
+		logger.Errorw("listener failed, sending event to dead letter", "vbID", vbID, "err", err)
+		if s.sendDeadLetter(models.DeadLetter{Event: ctx.Event, Err: err, VbID: vbID}) {
+			ctx.Ack()
+			return
+		}
+	}
+
+	logger.Errorw("listener failed, blocking the vbucket until the event is acknowledged", "vbID", vbID, "err", err)
+	s.waitAcknowledgement(vbID, ack)
+}
+
+// sendDeadLetter hands the event to the dead letter handler, it returns false when the handler panics so the event
+// is not acknowledged without reaching the dead letter.
+func (s *stream) sendDeadLetter(deadLetter models.DeadLetter) (sent bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorw("dead letter handler panicked", "vbID", deadLetter.VbID, "err", r, "stack", string(debug.Stack()))
+			sent = false
+		}
+	}()
+
+	s.deadLetterHandler(deadLetter)
+
+	return true
+}
+
+// waitAcknowledgement blocks the vbucket until the failed event is acknowledged. The wait ends without it when the
+// stream is closed or the offset of the vbucket is reset, the vbucket stays blocked in the dispatcher on close.
+func (s *stream) waitAcknowledgement(vbID uint16, ack *eventAck) {
+	releaseCh := make(chan struct{})
+	s.blockedVbIds.Store(vbID, releaseCh)
+
+	if s.dispatcher != nil {
+		s.dispatcher.block(vbID, true)
+	}
+
+	select {
+	case <-ack.wait():
+		if s.dispatcher != nil {
+			s.dispatcher.block(vbID, false)
+		}
+	case <-releaseCh:
+	case <-s.listenerStopCh:
+	}
+
+	if current, ok := s.blockedVbIds.Load(vbID); ok && current == releaseCh {
+		s.blockedVbIds.Delete(vbID)
+	}
+}
+
+// releaseBlocked ends the wait of a blocked vbucket, the events queued behind it are dropped.
+func (s *stream) releaseBlocked(vbID uint16) {
+	if releaseCh, ok := s.blockedVbIds.Load(vbID); ok {
+		s.blockedVbIds.Delete(vbID)
+		close(releaseCh)
+	}
+
+	if s.dispatcher != nil {
+		s.dispatcher.reset(vbID)
+	}
+}
@@ -0,0 +1,231 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Trendyol/go-dcp/config"
+	"github.com/Trendyol/go-dcp/models"
+)
+
+func newRetryTestStream(onError string, errorListener models.ErrorListener) *stream {
+	s := newDispatchTestStream(config.DCPListener{
+		Parallelism: 1,
+		Concurrency: 1,
+		MaxInFlight: 10,
+		OnError:     onError,
+		Retry: config.DCPListenerRetry{
+			Attempts:   3,
+			Backoff:    time.Millisecond,
+			MaxBackoff: time.Millisecond,
+		},
+	})
+	s.listenerStopCh = make(chan struct{})
+	s.errorListener = errorListener
+	s.dispatcher = newParallelDispatcher(s)
+
+	return s
+}
+
+func deliverTestEvent(s *stream, vbID uint16, seqNo uint64) {
+	s.deliver(context.Background(), seqNo, testOffset(seqNo), vbID, time.Now(), nil)
+}
+
+func waitOffset(t *testing.T, s *stream, vbID uint16, seqNo uint64) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for offsetSeqNo(s, vbID) != seqNo {
+		if time.Now().After(deadline) {
+			t.Fatalf("offset of vbID: %v is expected to move to %v, got: %v", vbID, seqNo, offsetSeqNo(s, vbID))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func waitBlocked(s *stream, count int) {
+	for s.blockedVbIds.Count() != count {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestListenerRetrySucceedsAfterFailures(t *testing.T) {
+	var attempts atomic.Int32
+	s := newRetryTestStream(config.ListenerOnErrorBlock, func(_ *models.ListenerContext) error {
+		if attempts.Add(1) < 3 {
+			return errors.New("sink is down")
+		}
+		return nil
+	})
+
+	deliverTestEvent(s, 0, 1)
+	s.dispatcher.Close()
+
+	if offsetSeqNo(s, 0) != 1 || attempts.Load() != 3 || s.metric.ListenerFailure.Load() != 0 {
+		t.Errorf("event is expected to succeed on the third attempt, offset: %v, attempts: %v, failures: %v",
+			offsetSeqNo(s, 0), attempts.Load(), s.metric.ListenerFailure.Load())
+	}
+}
+
+func TestListenerRetrySkipAcknowledgesAndCounts(t *testing.T) {
+	s := newRetryTestStream(config.ListenerOnErrorSkip, func(_ *models.ListenerContext) error {
+		return errors.New("bad document")
+	})
+
+	deliverTestEvent(s, 0, 1)
+	s.dispatcher.Close()
+
+	if offsetSeqNo(s, 0) != 1 || s.metric.ListenerFailure.Load() != 1 {
+		t.Errorf("skipped event is expected to be acknowledged and counted, offset: %v, failures: %v",
+			offsetSeqNo(s, 0), s.metric.ListenerFailure.Load())
+	}
+}
+
+func TestListenerRetryBlockWaitsForAcknowledgement(t *testing.T) {
+	failed := make(chan *models.ListenerContext, 1)
+	var delivered atomic.Int32
+
+	s := newRetryTestStream(config.ListenerOnErrorBlock, func(ctx *models.ListenerContext) error {
+		if ctx.Event == uint64(1) {
+			select {
+			case failed <- ctx:
+			default:
+			}
+			return errors.New("sink is down")
+		}
+		delivered.Add(1)
+		return nil
+	})
+
+	deliverTestEvent(s, 0, 1)
+	deliverTestEvent(s, 0, 2)
+	ctx := <-failed
+
+	// the other vbuckets are not held up by the retries or the block
+	deliverTestEvent(s, 1, 10)
+	waitOffset(t, s, 1, 10)
+	waitBlocked(s, 1)
+
+	if s.GetBlockedVBucketCount() != 1 || offsetSeqNo(s, 0) != 0 || delivered.Load() != 1 {
+		t.Fatalf("vbucket 0 is expected to be blocked before seqNo 2, blocked: %v, offset: %v, delivered: %v",
+			s.GetBlockedVBucketCount(), offsetSeqNo(s, 0), delivered.Load())
+	}
+
+	ctx.Ack()
+	waitOffset(t, s, 0, 2)
+	s.dispatcher.Close()
+
+	if s.GetBlockedVBucketCount() != 0 || delivered.Load() != 2 {
+		t.Errorf("vbucket 0 is expected to continue once the event is acknowledged, blocked: %v, delivered: %v",
+			s.GetBlockedVBucketCount(), delivered.Load())
+	}
+}
+
+func TestListenerRetryBlockIsReleasedByOffsetReset(t *testing.T) {
+	failing := make(chan struct{}, 1)
+	s := newRetryTestStream(config.ListenerOnErrorBlock, func(_ *models.ListenerContext) error {
+		failing <- struct{}{}
+		return errors.New("sink is down")
+	})
+	s.config.Dcp.Listener.Retry.Attempts = 1
+
+	deliverTestEvent(s, 0, 1)
+	deliverTestEvent(s, 0, 2)
+	<-failing
+
+	waitBlocked(s, 1)
+
+	s.releaseBlocked(0)
+	s.dispatcher.Close()
+
+	if offsetSeqNo(s, 0) != 0 || len(failing) != 0 {
+		t.Errorf("released vbucket is expected to drop its queued events, offset: %v", offsetSeqNo(s, 0))
+	}
+}
+
+func newPlainListenerTestStream(onError string, listener models.Listener) *stream {
+	s := newRetryTestStream(onError, nil)
+	s.listener = listener
+
+	return s
+}
+
+func TestPlainListenerPanicIsSkipped(t *testing.T) {
+	s := newPlainListenerTestStream(config.ListenerOnErrorSkip, func(_ *models.ListenerContext) {
+		panic("bad document")
+	})
+
+	deliverTestEvent(s, 0, 1)
+	s.dispatcher.Close()
+
+	if offsetSeqNo(s, 0) != 1 || s.metric.ListenerFailure.Load() != 1 {
+		t.Errorf("panicked event is expected to be acknowledged and counted, offset: %v, failures: %v",
+			offsetSeqNo(s, 0), s.metric.ListenerFailure.Load())
+	}
+}
+
+func TestPlainListenerPanicIsSentToDeadLetter(t *testing.T) {
+	s := newPlainListenerTestStream(config.ListenerOnErrorDLQ, func(_ *models.ListenerContext) {
+		panic("bad document")
+	})
+
+	var deadLetters []models.DeadLetter
+	s.deadLetterHandler = func(deadLetter models.DeadLetter) {
+		deadLetters = append(deadLetters, deadLetter)
+	}
+
+	deliverTestEvent(s, 0, 1)
+	s.dispatcher.Close()
+
+	if len(deadLetters) != 1 || !errors.Is(deadLetters[0].Err, ErrListenerPanicked) || offsetSeqNo(s, 0) != 1 {
+		t.Errorf("panicked event is expected to be sent to dead letter and acknowledged, dead letters: %v, offset: %v",
+			deadLetters, offsetSeqNo(s, 0))
+	}
+}
+
+func TestPlainListenerPanicBlocksUntilAcknowledged(t *testing.T) {
+	failed := make(chan *models.ListenerContext, 1)
+	s := newPlainListenerTestStream(config.ListenerOnErrorBlock, func(ctx *models.ListenerContext) {
+		failed <- ctx
+		panic("sink is down")
+	})
+
+	deliverTestEvent(s, 0, 1)
+	ctx := <-failed
+	waitBlocked(s, 1)
+
+	if offsetSeqNo(s, 0) != 0 {
+		t.Fatalf("offset of the blocked vbucket is not expected to move, got: %v", offsetSeqNo(s, 0))
+	}
+
+	ctx.Ack()
+	waitOffset(t, s, 0, 1)
+	s.dispatcher.Close()
+}
+
+func TestDeadLetterHandlerPanicBlocks(t *testing.T) {
+	failed := make(chan *models.ListenerContext, 1)
+	s := newRetryTestStream(config.ListenerOnErrorDLQ, func(ctx *models.ListenerContext) error {
+		failed <- ctx
+		return errors.New("bad document")
+	})
+	s.config.Dcp.Listener.Retry.Attempts = 1
+	s.deadLetterHandler = func(_ models.DeadLetter) {
+		panic("dead letter topic is down")
+	}
+
+	deliverTestEvent(s, 0, 1)
+	ctx := <-failed
+	waitBlocked(s, 1)
+
+	if offsetSeqNo(s, 0) != 0 {
+		t.Fatalf("event is not expected to be acknowledged when the dead letter handler panics, offset: %v", offsetSeqNo(s, 0))
+	}
+
+	ctx.Ack()
+	waitOffset(t, s, 0, 1)
+	s.dispatcher.Close()
+}
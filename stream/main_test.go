@@ -0,0 +1,14 @@
+package stream
+
+import (
+	"os"
+	"testing"
+
+	"github.com/Trendyol/go-dcp/logger"
+)
+
+// TestMain initializes the logger once, goroutines of a test may still log while the next one starts.
+func TestMain(m *testing.M) {
+	logger.InitDefaultLogger("error")
+	os.Exit(m.Run())
+}
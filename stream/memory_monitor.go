@@ -0,0 +1,124 @@
+package stream
+
+import (
+	"errors"
+	"runtime/metrics"
+	"sync/atomic"
+	"time"
+
+	"github.com/Trendyol/go-dcp/helpers"
+	"github.com/Trendyol/go-dcp/logger"
+)
+
+const (
+	memoryTotalMetricName    = "/memory/classes/total:bytes"
+	memoryReleasedMetricName = "/memory/classes/heap/released:bytes"
+	// memoryResumeRatio keeps flow control engaged until usage falls clearly below the soft limit
+	memoryResumeRatio = 0.9
+)
+
+type memoryMonitor struct {
+	stream  *stream
+	ticker  *time.Ticker
+	stopCh  chan struct{}
+	doneCh  chan struct{}
+	samples []metrics.Sample
+	limit   uint64
+	engaged atomic.Bool
+}
+
+// usage follows the accounting of the runtime memory limit, mapped memory minus memory released to the os.
+func (m *memoryMonitor) usage() uint64 {
+	metrics.Read(m.samples)
+
+	return m.samples[0].Value.Uint64() - m.samples[1].Value.Uint64()
+}
+
+func (m *memoryMonitor) engage(usage uint64) {
+	logger.Log.Warn("memory soft limit crossed, usage: %v, limit: %v, engaging flow control", usage, m.limit)
+
+	m.engaged.Store(true)
+	m.stream.metric.MemoryPressure.Store(true)
+
+	if m.stream.config.Checkpoint.Type == CheckpointTypeAuto {
+		m.stream.Save()
+	}
+
+	if observer := m.stream.GetObserver(); observer != nil {
+		observer.Pause()
+	}
+}
+
+func (m *memoryMonitor) release(usage uint64) {
+	logger.Log.Info("memory usage recovered, usage: %v, limit: %v, releasing flow control", usage, m.limit)
+
+	m.engaged.Store(false)
+	m.stream.metric.MemoryPressure.Store(false)
+
+	if observer := m.stream.GetObserver(); observer != nil {
+		observer.Resume()
+	}
+}
+
+func (m *memoryMonitor) check() {
+	usage := m.usage()
+
+	engaged := m.engaged.Load()
+
+	if !engaged && usage >= m.limit {
+		m.engage(usage)
+	} else if engaged && float64(usage) < float64(m.limit)*memoryResumeRatio {
+		m.release(usage)
+	}
+}
+
+func (m *memoryMonitor) Start() {
+	m.ticker = time.NewTicker(m.stream.config.MemoryPressure.CheckInterval)
+	m.stopCh = make(chan struct{})
+	m.doneCh = make(chan struct{})
+
+	go func() {
+		defer close(m.doneCh)
+
+		for {
+			select {
+			case <-m.ticker.C:
+				m.check()
+			case <-m.stopCh:
+				return
+			}
+		}
+	}()
+
+	logger.Log.Debug("started memory monitor, soft limit: %v", m.limit)
+}
+
+func (m *memoryMonitor) Stop() {
+	m.ticker.Stop()
+	close(m.stopCh)
+	<-m.doneCh
+
+	if m.engaged.Load() {
+		m.release(m.usage())
+	}
+
+	logger.Log.Debug("stopped memory monitor")
+}
+
+func newMemoryMonitor(s *stream) *memoryMonitor {
+	limit := helpers.ResolveUnionIntOrStringValue(s.config.MemoryPressure.SoftLimit)
+	if limit <= 0 {
+		err := errors.New("memory pressure soft limit must be set when memory pressure is enabled")
+		logger.Log.Error("error while creating memory monitor, err: %v", err)
+		panic(err)
+	}
+
+	return &memoryMonitor{
+		stream: s,
+		limit:  uint64(limit),
+		samples: []metrics.Sample{
+			{Name: memoryTotalMetricName},
+			{Name: memoryReleasedMetricName},
+		},
+	}
+}
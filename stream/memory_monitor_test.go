@@ -0,0 +1,29 @@
+package stream
+
+import (
+	"testing"
+
+	"github.com/Trendyol/go-dcp/config"
+)
+
+func TestMemoryMonitorEngagesAndReleasesFlowControl(t *testing.T) {
+	c := &config.Dcp{}
+	c.Checkpoint.Type = CheckpointTypeManual
+	c.MemoryPressure.SoftLimit = 1
+
+	s := NewStream(nil, nil, c, nil, nil, "", nil, nil, nil, nil, nil, nil, nil, nil, nil, nil).(*stream)
+	monitor := newMemoryMonitor(s)
+
+	monitor.check()
+
+	if !monitor.engaged.Load() || !s.metric.MemoryPressure.Load() {
+		t.Fatal("flow control is expected to be engaged above the soft limit")
+	}
+
+	monitor.limit = monitor.usage() * 4
+	monitor.check()
+
+	if monitor.engaged.Load() || s.metric.MemoryPressure.Load() {
+		t.Fatal("flow control is expected to be released below the resume ratio")
+	}
+}
@@ -0,0 +1,213 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/Trendyol/go-dcp/couchbase"
+	"github.com/Trendyol/go-dcp/logger"
+	"github.com/Trendyol/go-dcp/models"
+
+	"github.com/couchbase/gocbcore/v10"
+)
+
+const OffsetResetTargetSeqNo = "seqNo"
+
+var (
+	ErrVBucketNotOwned            = errors.New("vbucket is not owned by this member")
+	ErrOffsetResetWhileBalancing  = errors.New("offsets cannot be reset while rebalancing")
+	ErrOffsetResetNotSupported    = errors.New("offset reset needs couchbase server 5.5.0 or later")
+	ErrUnknownOffsetResetTarget   = errors.New("unknown offset reset target")
+	ErrOffsetResetAheadOfVBucket  = errors.New("offset reset seqNo bigger then vBucket latest seqNo")
+	ErrOffsetResetAlreadyInFlight = errors.New("offset reset of the vbucket is in progress")
+)
+
+// resolveResetOffset returns the offset the vbucket stream is reopened from for the target.
+func (s *stream) resolveResetOffset(vbID uint16, target string, seqNo uint64, latestSeqNo uint64) (*models.Offset, error) {
+	if target == CheckpointAutoResetTypeEarliest {
+		return &models.Offset{SnapshotMarker: &models.SnapshotMarker{}}, nil
+	}
+
+	if target == CheckpointAutoResetTypeLatest {
+		seqNo = latestSeqNo
+	} else if seqNo > latestSeqNo {
+		return nil, fmt.Errorf("%w, vbID: %v, seqNo: %v, latest seqNo: %v", ErrOffsetResetAheadOfVBucket, vbID, seqNo, latestSeqNo)
+	}
+
+	failoverLogs, err := s.client.GetFailoverLogs(vbID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.Offset{
+		SnapshotMarker: &models.SnapshotMarker{StartSeqNo: seqNo, EndSeqNo: seqNo},
+		VbUUID:         failoverVbUUID(failoverLogs, seqNo),
+		SeqNo:          seqNo,
+	}, nil
+}
+
+// failoverVbUUID returns the vbUUID of the branch the seqNo belongs to. The failover log is newest first and
+// every entry starts its branch at its seqNo, a seqNo before the newest entry was written on an older branch.
+func failoverVbUUID(failoverLogs []gocbcore.FailoverEntry, seqNo uint64) gocbcore.VbUUID {
+	if len(failoverLogs) == 0 {
+		return 0
+	}
+
+	for _, entry := range failoverLogs {
+		if uint64(entry.SeqNo) <= seqNo {
+			return entry.VbUUID
+		}
+	}
+
+	return failoverLogs[len(failoverLogs)-1].VbUUID
+}
+
+// ResetOffsets clears the checkpoints of the vbuckets and restarts their streams from the target, which is
+// latest, earliest or seqNo. Only vbuckets owned by this member can be reset, so no other member writes
+// the same checkpoints. The offsets are applied when the server ends the closed streams and the events
+// streamed before are drained, the vbuckets are not checkpointed in the meantime.
+func (s *stream) ResetOffsets(vbIDs []uint16, target string, seqNo uint64) error {
+	if target != CheckpointAutoResetTypeLatest && target != CheckpointAutoResetTypeEarliest && target != OffsetResetTargetSeqNo {
+		return fmt.Errorf("%w: %v", ErrUnknownOffsetResetTarget, target)
+	}
+
+	if s.version.Lower(couchbase.SrvVer550) {
+		return ErrOffsetResetNotSupported
+	}
+
+	// a rebalance holds the lock until its delay passes
+	if s.balancing.Load() {
+		return ErrOffsetResetWhileBalancing
+	}
+
+	s.rebalanceLock.Lock()
+	defer s.rebalanceLock.Unlock()
+
+	if s.balancing.Load() {
+		return ErrOffsetResetWhileBalancing
+	}
+
+	vbIDs = slices.Clone(vbIDs)
+	slices.Sort(vbIDs)
+	vbIDs = slices.Compact(vbIDs)
+
+	for _, vbID := range vbIDs {
+		if _, ok := s.vbIds.Load(vbID); !ok {
+			return fmt.Errorf("%w, vbID: %v", ErrVBucketNotOwned, vbID)
+		}
+
+		if _, ok := s.resetOffsets.Load(vbID); ok {
+			return fmt.Errorf("%w, vbID: %v", ErrOffsetResetAlreadyInFlight, vbID)
+		}
+	}
+
+	seqNoMap, err := s.client.GetVBucketSeqNos(false)
+	if err != nil {
+		return err
+	}
+
+	offsets := make(map[uint16]*models.Offset, len(vbIDs))
+
+	for _, vbID := range vbIDs {
+		latestSeqNo, _ := seqNoMap.Load(vbID)
+
+		offset, err := s.resolveResetOffset(vbID, target, seqNo, latestSeqNo)
+		if err != nil {
+			return err
+		}
+
+		offsets[vbID] = offset
+	}
+
+	for _, vbID := range vbIDs {
+		s.resetOffsets.Store(vbID, offsets[vbID])
+	}
+
+	if err = s.metadata.Clear(vbIDs); err != nil {
+		s.cancelResetOffsets(vbIDs)
+		return err
+	}
+
+	for i, vbID := range vbIDs {
+		if err = s.client.CloseStream(vbID); err != nil {
+			s.cancelResetOffsets(vbIDs[i:])
+			return fmt.Errorf("error while closing stream for offset reset, vbID: %v, err: %w", vbID, err)
+		}
+	}
+
+	logger.Log.Info("offset reset requested, vbIDs: %v, target: %v, seqNo: %v", vbIDs, target, seqNo)
+
+	return nil
+}
+
+// cancelResetOffsets drops the resets of the vbuckets whose streams are not closed, their offsets are saved
+// again with the next checkpoint.
+func (s *stream) cancelResetOffsets(vbIDs []uint16) {
+	for _, vbID := range vbIDs {
+		s.resetOffsets.Delete(vbID)
+		s.dirtyOffsets.Store(vbID, true)
+	}
+
+	s.anyDirtyOffset.Store(true)
+}
+
+// isResetting reports a vbucket whose stream is closed for an offset reset, its events and offsets are dropped
+// until the reset offset is applied.
+func (s *stream) isResetting(vbID uint16) bool {
+	_, ok := s.resetOffsets.Load(vbID)
+	return ok
+}
+
+// offsetResetApply is queued behind the events of an ended stream, so they are handled before its reset offset is written.
+type offsetResetApply struct {
+	vbID uint16
+}
+
+// queueResetOffset hands the reset of an ended stream to the listen goroutine, a blocked event of the vbucket
+// is released first since the listen goroutine may be waiting on it.
+//
+//nolint:staticcheck
+func (s *stream) queueResetOffset(observer couchbase.Observer, vbID uint16) bool {
+	if !s.isResetting(vbID) {
+		return false
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			// listener channel is closed, the stream is opened from the checkpoint again
+		}
+	}()
+
+	s.releaseBlocked(vbID)
+
+	observer.Listen() <- models.ListenerArgs{Event: offsetResetApply{vbID: vbID}}
+
+	return true
+}
+
+// applyResetOffset moves the vbucket to its reset offset once its stream is ended and its events are drained,
+// then opens it again.
+func (s *stream) applyResetOffset(vbID uint16) {
+	offset, ok := s.resetOffsets.Load(vbID)
+	if !ok {
+		return
+	}
+
+	s.releaseBlocked(vbID)
+
+	if s.batcher != nil {
+		s.batcher.reset(vbID)
+	}
+
+	s.collectionPause.forget(vbID)
+	s.deliveredSeqNos.Delete(vbID)
+
+	s.resetOffsets.Delete(vbID)
+	s.setOffset(vbID, offset, true)
+	s.anyDirtyOffset.Store(true)
+
+	logger.Infow("offset reset", "vbID", vbID, "seqNo", offset.SeqNo)
+
+	s.reopenStream(vbID)
+}
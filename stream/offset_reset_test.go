@@ -0,0 +1,135 @@
+package stream
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Trendyol/go-dcp/config"
+	"github.com/Trendyol/go-dcp/couchbase"
+	"github.com/Trendyol/go-dcp/helpers"
+	"github.com/Trendyol/go-dcp/models"
+
+	"github.com/couchbase/gocbcore/v10"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+type listeningObserver struct {
+	fakeObserver
+	listenCh models.ListenerCh
+}
+
+func (o *listeningObserver) Listen() models.ListenerCh {
+	return o.listenCh
+}
+
+func TestFailoverVbUUIDPicksTheBranchOfTheSeqNo(t *testing.T) {
+	failoverLogs := []gocbcore.FailoverEntry{{VbUUID: 3, SeqNo: 100}, {VbUUID: 2, SeqNo: 50}, {VbUUID: 1, SeqNo: 0}}
+
+	for seqNo, expected := range map[uint64]gocbcore.VbUUID{120: 3, 100: 3, 99: 2, 50: 2, 10: 1, 0: 1} {
+		if vbUUID := failoverVbUUID(failoverLogs, seqNo); vbUUID != expected {
+			t.Errorf("unexpected vbUUID for seqNo: %v, got: %v, want: %v", seqNo, vbUUID, expected)
+		}
+	}
+}
+
+func TestResetOffsetsDoesNotWaitBehindRebalance(t *testing.T) {
+	s := newDispatchTestStream(config.DCPListener{})
+	s.version = couchbase.SrvVer720
+	s.balancing.Store(true)
+
+	// the rebalance holds the lock until its delay passes
+	s.rebalanceLock.Lock()
+	defer s.rebalanceLock.Unlock()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.ResetOffsets([]uint16{0}, CheckpointAutoResetTypeEarliest, 0)
+	}()
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, ErrOffsetResetWhileBalancing) {
+			t.Fatalf("expected offset reset while balancing error, got: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the offset reset to return while rebalancing")
+	}
+}
+
+func TestOffsetResetIsAppliedAfterQueuedEvents(t *testing.T) {
+	s := newDispatchTestStream(config.DCPListener{})
+	s.config.Metadata.Prefix = helpers.Prefix
+	s.tracer = noop.NewTracerProvider().Tracer("test")
+	client := s.client.(*fakeClient)
+
+	var delivered []uint64
+	s.listener = func(ctx *models.ListenerContext) {
+		delivered = append(delivered, ctx.Event.(models.DcpMutation).SeqNo)
+		ctx.Ack()
+	}
+
+	s.offsets.Store(1, testOffset(3))
+	s.resetOffsets.Store(0, testOffset(100))
+
+	observer := &listeningObserver{listenCh: make(models.ListenerCh, 2)}
+	observer.listenCh <- models.ListenerArgs{Event: pauseTestMutation("orders", 0, 5)}
+
+	if !s.queueResetOffset(observer, 0) {
+		t.Fatal("expected the reset of vbID 0 to be queued")
+	}
+
+	// the reset vbucket is not checkpointed until its reset offset is applied
+	offsets, _, _ := s.GetOffsets()
+	if _, ok := offsets.Load(0); ok || offsets.Count() != 1 {
+		t.Fatalf("expected the offsets to leave out the reset vbucket, got: %v", offsets.Count())
+	}
+
+	s.handleEvent((<-observer.listenCh).Event)
+
+	if len(delivered) != 0 || offsetSeqNo(s, 0) != 0 {
+		t.Fatalf("expected the queued event to be dropped, delivered: %v, seqNo: %v", delivered, offsetSeqNo(s, 0))
+	}
+
+	s.handleEvent((<-observer.listenCh).Event)
+
+	if dirty, _ := s.dirtyOffsets.Load(0); offsetSeqNo(s, 0) != 100 || !dirty || s.isResetting(0) {
+		t.Fatalf("expected the reset offset to be applied, seqNo: %v, dirty: %v", offsetSeqNo(s, 0), dirty)
+	}
+
+	select {
+	case <-client.openedIDs:
+	case <-time.After(time.Second):
+		t.Fatal("expected the stream to be opened again")
+	}
+
+	s.handleEvent(pauseTestMutation("orders", 0, 101))
+
+	if len(delivered) != 1 || delivered[0] != 101 || offsetSeqNo(s, 0) != 101 {
+		t.Fatalf("expected the events of the reopened stream, delivered: %v, seqNo: %v", delivered, offsetSeqNo(s, 0))
+	}
+}
+
+func TestBatchDispatcherResetDropsOffsetsOfEarlierBatches(t *testing.T) {
+	s, _ := newBatchTestStream(config.DCPListenerBatch{Size: 1, FlushInterval: time.Hour}, config.ListenerOnErrorSkip)
+
+	gate := make(chan struct{})
+	s.batchListener = func(_ []*models.ListenerContext) error {
+		<-gate
+		return nil
+	}
+
+	d := newBatchDispatcher(s)
+
+	d.add(nil, "before", testOffset(5), 0, nil)
+	d.reset(0)
+	s.setOffset(0, testOffset(100), true)
+	close(gate)
+
+	d.add(nil, "after", testOffset(101), 1, nil)
+	d.Close()
+
+	if offsetSeqNo(s, 0) != 100 || offsetSeqNo(s, 1) != 101 {
+		t.Fatalf("expected the batch before the reset to keep the reset offset, got: %v, %v", offsetSeqNo(s, 0), offsetSeqNo(s, 1))
+	}
+}
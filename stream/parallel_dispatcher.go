@@ -0,0 +1,251 @@
+package stream
+
+import (
+	"sync"
+
+	"github.com/Trendyol/go-dcp/logger"
+	"github.com/Trendyol/go-dcp/models"
+)
+
+type pendingOffset struct {
+	offset *models.Offset
+	done   bool
+	dirty  bool
+	acked  bool
+}
+
+type dispatchJob struct {
+	entry   *pendingOffset
+	process func(ack func())
+}
+
+// vbucketQueue keeps the jobs of a vbucket that are not started yet and its offsets that are not committed
+// yet, both in seqNo order.
+type vbucketQueue struct {
+	jobs    []*dispatchJob
+	pending []*pendingOffset
+	running int
+	blocked bool
+}
+
+// parallelDispatcher runs the listener on up to parallelism goroutines per vbucket and only advances the
+// offset of a vbucket up to its highest contiguous processed seqNo, so a checkpoint never moves past an event
+// that is still in flight or was never acknowledged. The listener calls of all vbuckets share the slots.
+type parallelDispatcher struct {
+	stream      *stream
+	cond        *sync.Cond
+	queues      map[uint16]*vbucketQueue
+	slots       chan struct{}
+	wg          sync.WaitGroup
+	lock        sync.Mutex
+	parallelism int
+	queueSize   int
+	closed      bool
+	stopped     bool
+}
+
+func (d *parallelDispatcher) queue(vbID uint16) *vbucketQueue {
+	queue, ok := d.queues[vbID]
+	if !ok {
+		queue = &vbucketQueue{}
+		d.queues[vbID] = queue
+	}
+
+	return queue
+}
+
+// drain runs the jobs of the vbucket until its queue is empty.
+func (d *parallelDispatcher) drain(vbID uint16, queue *vbucketQueue) {
+	defer d.wg.Done()
+
+	for {
+		d.lock.Lock()
+		if len(queue.jobs) == 0 || queue.blocked {
+			queue.running--
+			d.lock.Unlock()
+			return
+		}
+
+		job := queue.jobs[0]
+		queue.jobs[0] = nil
+		queue.jobs = queue.jobs[1:]
+		d.cond.Broadcast()
+		d.lock.Unlock()
+
+		job.process(func() {
+			d.complete(vbID, job.entry, true, true)
+		})
+	}
+}
+
+// call runs the listener in a slot, it waits while all slots are taken.
+func (d *parallelDispatcher) call(listener func() error) error {
+	d.slots <- struct{}{}
+	defer func() {
+		<-d.slots
+	}()
+
+	return listener()
+}
+
+// register appends an entry to the pending offsets of the vbucket in seqNo order, it must be called with the lock held.
+func (d *parallelDispatcher) register(queue *vbucketQueue, offset *models.Offset) *pendingOffset {
+	entry := &pendingOffset{offset: offset}
+	queue.pending = append(queue.pending, entry)
+
+	return entry
+}
+
+// complete marks the entry as processed and advances the offset of the vbucket over the
+// contiguous processed prefix of its pending offsets.
+func (d *parallelDispatcher) complete(vbID uint16, entry *pendingOffset, dirty bool, acked bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.completeLocked(vbID, entry, dirty, acked)
+}
+
+func (d *parallelDispatcher) completeLocked(vbID uint16, entry *pendingOffset, dirty bool, acked bool) {
+	if d.stopped || entry.done {
+		return
+	}
+
+	entry.done = true
+	entry.dirty = dirty
+	entry.acked = acked
+
+	queue := d.queues[vbID]
+	pending := queue.pending
+
+	var last *pendingOffset
+	anyDirty, anyAcked := false, false
+
+	for len(pending) > 0 && pending[0].done {
+		last = pending[0]
+		anyDirty = anyDirty || last.dirty
+		anyAcked = anyAcked || last.acked
+		pending[0] = nil
+		pending = pending[1:]
+	}
+
+	if last == nil {
+		return
+	}
+
+	queue.pending = pending
+
+	d.stream.setOffset(vbID, last.offset, anyDirty)
+	if anyAcked {
+		d.stream.anyDirtyOffset.Store(true)
+	}
+}
+
+// advance keeps the offset of events that are not delivered to the listener in order with the
+// events that are still being processed.
+func (d *parallelDispatcher) advance(vbID uint16, offset *models.Offset, dirty bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.closed {
+		return
+	}
+
+	d.completeLocked(vbID, d.register(d.queue(vbID), offset), dirty, false)
+}
+
+// dispatch queues the event on its vbucket, it only waits while the vbucket has queueSize events that are not
+// started yet. Events that are processed but not acknowledged do not hold up the stream, they only hold the offset.
+func (d *parallelDispatcher) dispatch(vbID uint16, offset *models.Offset, process func(ack func())) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	queue := d.queue(vbID)
+
+	for !d.closed && len(queue.jobs) >= d.queueSize {
+		d.cond.Wait()
+	}
+
+	if d.closed {
+		return
+	}
+
+	queue.jobs = append(queue.jobs, &dispatchJob{entry: d.register(queue, offset), process: process})
+
+	d.startDrains(vbID, queue)
+}
+
+// startDrains runs the queued jobs of the vbucket on up to parallelism goroutines, it must be called with the lock held.
+func (d *parallelDispatcher) startDrains(vbID uint16, queue *vbucketQueue) {
+	for i := 0; !queue.blocked && queue.running < d.parallelism && i < len(queue.jobs); i++ {
+		queue.running++
+		d.wg.Add(1)
+		go d.drain(vbID, queue)
+	}
+}
+
+// block stops taking the jobs of the vbucket while its failed event waits to be acknowledged.
+func (d *parallelDispatcher) block(vbID uint16, blocked bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	queue := d.queue(vbID)
+	queue.blocked = blocked
+
+	if !d.stopped {
+		d.startDrains(vbID, queue)
+	}
+}
+
+// reset drops the queued jobs and the pending offsets of the vbucket, its stream is opened again from another offset.
+func (d *parallelDispatcher) reset(vbID uint16) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	queue := d.queue(vbID)
+	queue.jobs, queue.pending, queue.blocked = nil, nil, false
+	d.cond.Broadcast()
+}
+
+// Close stops taking events and waits until the queued ones are processed, acknowledgements after it are ignored
+// since the offsets of the stream are replaced.
+func (d *parallelDispatcher) Close() {
+	d.lock.Lock()
+	d.closed = true
+	d.cond.Broadcast()
+	d.lock.Unlock()
+
+	d.wg.Wait()
+
+	d.lock.Lock()
+	d.stopped = true
+	d.lock.Unlock()
+
+	logger.Log.Debug("stopped parallel dispatcher")
+}
+
+// newParallelDispatcher runs the events of a vbucket in parallel with dcp.listener.parallelism, or one by one
+// in seqNo order with dcp.listener.concurrency where the vbuckets share that many slots.
+func newParallelDispatcher(s *stream) *parallelDispatcher {
+	listener := &s.config.Dcp.Listener
+	concurrency, workerQueueSize := s.config.ListenerWorkers()
+
+	slots, parallelism, queueSize := listener.Parallelism, listener.Parallelism, listener.MaxInFlight
+	if concurrency > 1 {
+		slots, parallelism, queueSize = concurrency, 1, workerQueueSize
+	}
+
+	d := &parallelDispatcher{
+		stream:      s,
+		queues:      map[uint16]*vbucketQueue{},
+		slots:       make(chan struct{}, slots),
+		parallelism: parallelism,
+		queueSize:   queueSize,
+	}
+	d.cond = sync.NewCond(&d.lock)
+
+	logger.Log.Debug(
+		"started parallel dispatcher, slots: %v, parallelism per vbucket: %v, queue size: %v", slots, parallelism, queueSize,
+	)
+
+	return d
+}
@@ -0,0 +1,186 @@
+package stream
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Trendyol/go-dcp/config"
+	"github.com/Trendyol/go-dcp/models"
+	"github.com/Trendyol/go-dcp/wrapper"
+)
+
+func newDispatchTestStream(listener config.DCPListener) *stream {
+	s, _, _, _ := newCollectionDropTestStream(config.FilterEmptyStrategyClose)
+	s.config.Dcp.Listener = listener
+	s.checkpoint = NewCheckpoint(s, []uint16{0, 1}, nil, nil, s.config, "", NewCheckpointSaveMetric())
+	s.vbIds.Store(0, struct{}{})
+	s.vbIds.Store(1, struct{}{})
+	s.dirtyOffsets = wrapper.CreateConcurrentSwissMap[uint16, bool](2)
+
+	return s
+}
+
+func testOffset(seqNo uint64) *models.Offset {
+	return &models.Offset{SnapshotMarker: &models.SnapshotMarker{}, SeqNo: seqNo}
+}
+
+func offsetSeqNo(s *stream, vbID uint16) uint64 {
+	offset, ok := s.offsets.Load(vbID)
+	if !ok {
+		return 0
+	}
+
+	return offset.SeqNo
+}
+
+func TestParallelDispatcherCommitsContiguousPrefix(t *testing.T) {
+	s := newDispatchTestStream(config.DCPListener{Parallelism: 4, MaxInFlight: 10})
+	d := newParallelDispatcher(s)
+
+	var lock sync.Mutex
+	acks := map[uint64]func(){}
+
+	var processed sync.WaitGroup
+	processed.Add(3)
+	for seqNo := uint64(1); seqNo <= 3; seqNo++ {
+		seqNo := seqNo
+		d.dispatch(0, testOffset(seqNo), func(ack func()) {
+			lock.Lock()
+			acks[seqNo] = ack
+			lock.Unlock()
+			processed.Done()
+		})
+	}
+	processed.Wait()
+
+	acks[3]()
+	acks[2]()
+	if seqNo := offsetSeqNo(s, 0); seqNo != 0 {
+		t.Fatalf("offset is expected to wait for seqNo 1, got: %v", seqNo)
+	}
+
+	acks[1]()
+	if seqNo := offsetSeqNo(s, 0); seqNo != 3 {
+		t.Fatalf("offset is expected to move to 3, got: %v", seqNo)
+	}
+
+	d.Close()
+
+	if !s.anyDirtyOffset.Load() {
+		t.Error("acknowledged events are expected to mark the offsets dirty")
+	}
+}
+
+func TestParallelDispatcherUnackedEventDoesNotStallOtherVBuckets(t *testing.T) {
+	s := newDispatchTestStream(config.DCPListener{Parallelism: 2, MaxInFlight: 1})
+	d := newParallelDispatcher(s)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		// vbucket 0 is never acknowledged
+		for seqNo := uint64(1); seqNo <= 20; seqNo++ {
+			d.dispatch(0, testOffset(seqNo), func(_ func()) {})
+			d.dispatch(1, testOffset(seqNo), func(ack func()) { ack() })
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			s.GetOffsets()
+			s.GetMetric()
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("dispatch is expected not to wait behind unacknowledged events")
+	}
+
+	wg.Wait()
+	d.Close()
+
+	if seqNo := offsetSeqNo(s, 1); seqNo != 20 {
+		t.Errorf("offset of vbucket 1 is expected to move to 20, got: %v", seqNo)
+	}
+
+	if seqNo := offsetSeqNo(s, 0); seqNo != 0 {
+		t.Errorf("offset of vbucket 0 is expected to stay, got: %v", seqNo)
+	}
+}
+
+func TestParallelDispatcherCloseDrainsQueuedEvents(t *testing.T) {
+	s := newDispatchTestStream(config.DCPListener{Parallelism: 1, MaxInFlight: 10})
+	d := newParallelDispatcher(s)
+
+	release := make(chan struct{})
+	d.dispatch(0, testOffset(1), func(ack func()) {
+		<-release
+		ack()
+	})
+	for seqNo := uint64(2); seqNo <= 5; seqNo++ {
+		d.dispatch(0, testOffset(seqNo), func(ack func()) { ack() })
+	}
+
+	close(release)
+	d.Close()
+
+	if seqNo := offsetSeqNo(s, 0); seqNo != 5 {
+		t.Errorf("queued events are expected to be processed on close, got offset: %v", seqNo)
+	}
+}
+
+func TestParallelDispatcherConcurrencyKeepsVBucketOrder(t *testing.T) {
+	s := newDispatchTestStream(config.DCPListener{Parallelism: 1, Concurrency: 2, QueueSize: 5})
+	d := newParallelDispatcher(s)
+
+	release := make(chan struct{})
+	d.dispatch(0, testOffset(1), func(ack func()) {
+		<-release
+		ack()
+	})
+
+	var lock sync.Mutex
+	var order []uint64
+
+	for seqNo := uint64(2); seqNo <= 5; seqNo++ {
+		seqNo := seqNo
+		d.dispatch(0, testOffset(seqNo), func(ack func()) {
+			lock.Lock()
+			order = append(order, seqNo)
+			lock.Unlock()
+			ack()
+		})
+	}
+
+	// a slow vbucket does not hold up the others
+	processed := make(chan struct{})
+	d.dispatch(1, testOffset(1), func(ack func()) {
+		ack()
+		close(processed)
+	})
+
+	select {
+	case <-processed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("vbucket 1 is expected to be processed while vbucket 0 is slow")
+	}
+
+	close(release)
+	d.Close()
+
+	if fmt.Sprint(order) != "[2 3 4 5]" {
+		t.Errorf("events of a vbucket are expected in seqNo order, got: %v", order)
+	}
+
+	if seqNo := offsetSeqNo(s, 0); seqNo != 5 {
+		t.Errorf("offset of vbucket 0 is expected to move to 5, got: %v", seqNo)
+	}
+}
@@ -0,0 +1,104 @@
+package stream
+
+import (
+	"github.com/Trendyol/go-dcp/helpers"
+	"github.com/Trendyol/go-dcp/logger"
+	"github.com/Trendyol/go-dcp/models"
+)
+
+// recordSnapshotSeqNos captures the seqNos the streams end at in snapshot mode, they are kept across
+// rebalances so a reopened vbucket stops at the seqNo of the first Open.
+func (s *stream) recordSnapshotSeqNos() error {
+	if s.snapshotSeqNos != nil {
+		return nil
+	}
+
+	seqNoMap, err := s.client.GetVBucketSeqNos(false)
+	if err != nil {
+		logger.Log.Error("error while getting vBucket seqNos of snapshot, err: %v", err)
+		return err
+	}
+
+	s.snapshotSeqNos = seqNoMap
+
+	logger.Log.Info("snapshot mode, streams end at the seqNos of %v vbuckets", seqNoMap.Count())
+
+	return nil
+}
+
+// pendingSnapshotVbIds returns the vbuckets that did not reach their snapshot seqNo yet, the others are marked
+// ended without opening a stream.
+func (s *stream) pendingSnapshotVbIds(vbIds []uint16) []uint16 {
+	pending := make([]uint16, 0, len(vbIds))
+
+	for _, vbID := range vbIds {
+		offset, _ := s.offsets.Load(vbID)
+		endSeqNo, _ := s.snapshotSeqNos.Load(vbID)
+
+		if offset != nil && offset.SeqNo < endSeqNo {
+			pending = append(pending, vbID)
+			continue
+		}
+
+		s.snapshotEndedVbIds.Store(vbID, struct{}{})
+		s.activeStreams.Add(-1)
+	}
+
+	return pending
+}
+
+// markSnapshotEnd records that the stream of the vbucket reached its snapshot seqNo, the completion is
+// published once every owned vbucket reached it.
+func (s *stream) markSnapshotEnd(vbID uint16) {
+	s.snapshotEndedVbIds.Store(vbID, struct{}{})
+	s.completeSnapshot()
+}
+
+func (s *stream) completeSnapshot() {
+	if s.snapshotCompleted || s.snapshotEndedVbIds.Count() < s.vbIds.Count() {
+		return
+	}
+
+	s.snapshotCompleted = true
+
+	logger.Log.Info("snapshot completed, all %v vbuckets reached their seqNo", s.vbIds.Count())
+	s.bus.Publish(helpers.SnapshotCompletedBusEventName, true)
+}
+
+// resetSnapshotCompletion withdraws the completion when the vbuckets of the member change, the newly assigned
+// ones may not have reached their seqNo yet.
+func (s *stream) resetSnapshotCompletion(vbIds []uint16) {
+	if !s.snapshotCompleted || s.isAssigned(vbIds) {
+		return
+	}
+
+	s.snapshotCompleted = false
+
+	logger.Log.Info("vbuckets are reassigned, snapshot is not completed until they reach their seqNo")
+	s.bus.Publish(helpers.SnapshotCompletedBusEventName, false)
+}
+
+// isAssigned reports whether the vbuckets are the ones the stream owns.
+func (s *stream) isAssigned(vbIds []uint16) bool {
+	if s.vbIds == nil || s.vbIds.Count() != len(vbIds) {
+		return false
+	}
+
+	for _, vbID := range vbIds {
+		if _, ok := s.vbIds.Load(vbID); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *stream) isSnapshotEnded(vbID uint16) bool {
+	_, ok := s.snapshotEndedVbIds.Load(vbID)
+	return ok
+}
+
+func (s *stream) openSnapshotStream(vbID uint16, collectionIDs map[uint32]string, offset *models.Offset) error {
+	endSeqNo, _ := s.snapshotSeqNos.Load(vbID)
+	return s.client.OpenStreamRange(vbID, collectionIDs, offset, endSeqNo, s.observer)
+}
@@ -0,0 +1,107 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Trendyol/go-dcp/logger"
+	"github.com/Trendyol/go-dcp/models"
+	"github.com/Trendyol/go-dcp/wrapper"
+
+	"github.com/couchbase/gocbcore/v10"
+)
+
+var (
+	ErrStartOffsetMissing        = errors.New("start offset of the vbucket is missing")
+	ErrStartOffsetUnknownVbUUID  = errors.New("start offset vbUUID is not in the vbucket failover log")
+	ErrStartOffsetOutOfBranch    = errors.New("start offset seqNo is outside of the vbUUID history branch")
+	ErrStartOffsetAheadOfVBucket = errors.New("start offset seqNo bigger then vBucket latest seqNo")
+)
+
+// SetStartOffsets seeds the offsets of the next Open instead of loading the checkpoint, they are used once.
+func (s *stream) SetStartOffsets(offsets map[uint16]*models.Offset) {
+	s.startOffsets = offsets
+}
+
+// loadOffsets uses the seeded start offsets on the first Open, the streams reopen from the checkpoint afterwards.
+func (s *stream) loadOffsets(vbIds []uint16) (
+	*wrapper.ConcurrentSwissMap[uint16, *models.Offset], *wrapper.ConcurrentSwissMap[uint16, bool], bool, error,
+) {
+	if s.startOffsets == nil {
+		return s.loadCheckpoint()
+	}
+
+	offsets, dirtyOffsets, anyDirtyOffset, err := s.loadStartOffsets(vbIds)
+	if err == nil {
+		s.startOffsets = nil
+	}
+
+	return offsets, dirtyOffsets, anyDirtyOffset, err
+}
+
+// validateStartOffset checks the offset is a resume point the server accepts without a rollback. Failover logs
+// are newest first, a vbUUID owns the seqNos from its entry until the entry of the next vbUUID.
+func validateStartOffset(vbID uint16, offset *models.Offset, failoverLogs []gocbcore.FailoverEntry, latestSeqNo uint64) error {
+	if offset.SeqNo > latestSeqNo {
+		return fmt.Errorf("%w, vbID: %v, seqNo: %v, latest seqNo: %v", ErrStartOffsetAheadOfVBucket, vbID, offset.SeqNo, latestSeqNo)
+	}
+
+	for i, entry := range failoverLogs {
+		if entry.VbUUID != offset.VbUUID {
+			continue
+		}
+
+		if offset.SeqNo < uint64(entry.SeqNo) || (i > 0 && offset.SeqNo > uint64(failoverLogs[i-1].SeqNo)) {
+			return fmt.Errorf("%w, vbID: %v, vbUUID: %v, seqNo: %v", ErrStartOffsetOutOfBranch, vbID, offset.VbUUID, offset.SeqNo)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("%w, vbID: %v, vbUUID: %v", ErrStartOffsetUnknownVbUUID, vbID, offset.VbUUID)
+}
+
+// loadStartOffsets validates the seeded offsets of the owned vbuckets, they are marked dirty so the first
+// checkpoint save persists them.
+func (s *stream) loadStartOffsets(vbIds []uint16) (
+	*wrapper.ConcurrentSwissMap[uint16, *models.Offset], *wrapper.ConcurrentSwissMap[uint16, bool], bool, error,
+) {
+	seqNoMap, err := s.client.GetVBucketSeqNos(false)
+	if err != nil {
+		logger.Log.Error("error while getting vBucket seqNos, err: %v", err)
+		return nil, nil, false, err
+	}
+
+	offsets := wrapper.CreateConcurrentSwissMap[uint16, *models.Offset](1024)
+	dirtyOffsets := wrapper.CreateConcurrentSwissMap[uint16, bool](1024)
+
+	for _, vbID := range vbIds {
+		offset, ok := s.startOffsets[vbID]
+		if !ok || offset == nil {
+			return nil, nil, false, fmt.Errorf("%w, vbID: %v", ErrStartOffsetMissing, vbID)
+		}
+
+		failoverLogs, err := s.client.GetFailoverLogs(vbID)
+		if err != nil {
+			logger.Errorw("error while get failover logs of start offset", "vbID", vbID, "err", err)
+			return nil, nil, false, err
+		}
+
+		latestSeqNo, _ := seqNoMap.Load(vbID)
+		if err := validateStartOffset(vbID, offset, failoverLogs, latestSeqNo); err != nil {
+			return nil, nil, false, err
+		}
+
+		snapshotMarker := &models.SnapshotMarker{StartSeqNo: offset.SeqNo, EndSeqNo: offset.SeqNo}
+		if offset.SnapshotMarker != nil {
+			snapshotMarker = &models.SnapshotMarker{StartSeqNo: offset.StartSeqNo, EndSeqNo: offset.EndSeqNo}
+		}
+
+		offsets.Store(vbID, &models.Offset{SnapshotMarker: snapshotMarker, VbUUID: offset.VbUUID, SeqNo: offset.SeqNo})
+		dirtyOffsets.Store(vbID, true)
+	}
+
+	logger.Log.Info("loaded start offsets of %v vbuckets", len(vbIds))
+
+	return offsets, dirtyOffsets, len(vbIds) > 0, nil
+}
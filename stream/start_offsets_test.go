@@ -0,0 +1,40 @@
+package stream
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Trendyol/go-dcp/models"
+
+	"github.com/couchbase/gocbcore/v10"
+)
+
+func TestValidateStartOffset(t *testing.T) {
+	failoverLogs := []gocbcore.FailoverEntry{
+		{VbUUID: 300, SeqNo: 80},
+		{VbUUID: 200, SeqNo: 40},
+		{VbUUID: 100, SeqNo: 0},
+	}
+
+	tests := []struct {
+		expected error
+		offset   *models.Offset
+		name     string
+	}{
+		{name: "latest branch", offset: &models.Offset{VbUUID: 300, SeqNo: 90}},
+		{name: "older branch", offset: &models.Offset{VbUUID: 200, SeqNo: 60}},
+		{name: "branch start", offset: &models.Offset{VbUUID: 100, SeqNo: 0}},
+		{name: "after branch end", offset: &models.Offset{VbUUID: 100, SeqNo: 50}, expected: ErrStartOffsetOutOfBranch},
+		{name: "unknown vbUUID", offset: &models.Offset{VbUUID: 400, SeqNo: 10}, expected: ErrStartOffsetUnknownVbUUID},
+		{name: "ahead of vbucket", offset: &models.Offset{VbUUID: 300, SeqNo: 120}, expected: ErrStartOffsetAheadOfVBucket},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateStartOffset(0, tt.offset, failoverLogs, 100)
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("expected: %v, got: %v", tt.expected, err)
+			}
+		})
+	}
+}
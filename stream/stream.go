@@ -1,9 +1,12 @@
 package stream
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"maps"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/asaskevich/EventBus"
@@ -22,24 +25,56 @@ import (
 	"github.com/Trendyol/go-dcp/logger"
 
 	"github.com/Trendyol/go-dcp/helpers"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Stream interface {
-	Open()
+	Open() error
 	Rebalance()
+	Reconnect(connect func() error) error
+	Pause()
+	Resume() error
 	Save()
+	SaveAndWait(ctx context.Context) error
 	Close(bool)
 	GetOffsets() (*wrapper.ConcurrentSwissMap[uint16, *models.Offset], *wrapper.ConcurrentSwissMap[uint16, bool], bool)
 	GetObserver() couchbase.Observer
 	GetMetric() (*Metric, int)
 	UnmarkDirtyOffsets()
 	GetCheckpointMetric() *CheckpointMetric
+	PauseCollection(collectionName string) error
+	ResumeCollection(collectionName string) bool
+	GetPausedCollections() []string
+	GetFailedStreamCount() int
+	GetMaxUnsavedOffsetAge() time.Duration
+	GetBlockedVBucketCount() int
+	ResetOffsets(vbIDs []uint16, target string, seqNo uint64) error
+	SetStartOffsets(offsets map[uint16]*models.Offset)
+	Readiness() error
+}
+
+var (
+	ErrStreamNotOpen    = errors.New("stream is not open")
+	ErrStreamPaused     = errors.New("stream is paused")
+	ErrStreamBalancing  = errors.New("stream is rebalancing")
+	ErrStreamsNotOpened = errors.New("some vbucket streams are not open")
+)
+
+type OpenStreamFailure struct {
+	Category string
+	VbID     uint16
 }
 
 type Metric struct {
-	ProcessLatency int64
-	DcpLatency     int64
-	Rebalance      int
+	OpenStreamFailures *wrapper.ConcurrentSwissMap[OpenStreamFailure, int64]
+	ProcessLatency     atomic.Int64
+	DcpLatency         int64
+	Rebalance          int
+	CloseStreamFailure int
+	DedupSuppressed    atomic.Int64
+	ListenerFailure    atomic.Int64
+	MemoryPressure     atomic.Bool
 }
 
 type stream struct {
@@ -51,107 +86,318 @@ type stream struct {
 	vBucketDiscovery             VBucketDiscovery
 	bus                          EventBus.Bus
 	eventHandler                 models.EventHandler
+	tracer                       trace.Tracer
 	config                       *config.Dcp
 	metric                       *Metric
+	checkpointSaveMetric         *CheckpointSaveMetric
 	vbIds                        *wrapper.ConcurrentSwissMap[uint16, struct{}]
 	rebalanceTimer               *time.Timer
 	dirtyOffsets                 *wrapper.ConcurrentSwissMap[uint16, bool]
+	unsavedSince                 atomic.Pointer[wrapper.ConcurrentSwissMap[uint16, time.Time]]
+	deliveredSeqNos              *wrapper.ConcurrentSwissMap[uint16, deliveredSeqNo]
+	blockedVbIds                 *wrapper.ConcurrentSwissMap[uint16, chan struct{}]
+	resetOffsets                 *wrapper.ConcurrentSwissMap[uint16, *models.Offset]
+	reopeningVbIds               *wrapper.ConcurrentSwissMap[uint16, struct{}]
+	startOffsets                 map[uint16]*models.Offset
+	snapshotSeqNos               *wrapper.ConcurrentSwissMap[uint16, uint64]
+	snapshotEndedVbIds           *wrapper.ConcurrentSwissMap[uint16, struct{}]
 	stopCh                       chan struct{}
+	heartbeatStopCh              chan struct{}
+	listenerStopCh               chan struct{}
+	failedRetryStopCh            chan struct{}
+	failedRetryWg                sync.WaitGroup
+	stopOnce                     sync.Once
+	openStreamFailuresLock       sync.Mutex
 	listener                     models.Listener
+	errorListener                models.ErrorListener
+	batchListener                models.BatchListener
+	deadLetterHandler            models.DeadLetterHandler
 	version                      *couchbase.Version
 	bucketInfo                   *couchbase.BucketInfo
+	bucketUUID                   string
 	finishStreamWithEndEventCh   chan struct{}
 	finishStreamWithCloseCh      chan struct{}
 	offsets                      *wrapper.ConcurrentSwissMap[uint16, *models.Offset]
+	failedVbIds                  *wrapper.ConcurrentSwissMap[uint16, struct{}]
+	memoryMonitor                *memoryMonitor
+	dispatcher                   *parallelDispatcher
+	batcher                      *batchDispatcher
+	collectionPause              *collectionPause
+	keyFilter                    *keyFilter
 	collectionIDs                map[uint32]string
-	activeStreams                int
+	droppedCollectionIDs         map[uint32]struct{}
+	activeStreams                atomic.Int32
 	rebalanceLock                sync.Mutex
+	collectionIDsLock            sync.RWMutex
 	streamFinishedWithCloseCh    bool
 	streamFinishedWithEndEventCh bool
-	anyDirtyOffset               bool
-	balancing                    bool
+	anyDirtyOffset               atomic.Bool
+	balancing                    atomic.Bool
 	closeWithCancel              bool
+	snapshotCompleted            bool
+	open                         atomic.Bool
+	paused                       atomic.Bool
 }
 
 func (s *stream) setOffset(vbID uint16, offset *models.Offset, dirty bool) {
+	if s.collectionPause.hold(vbID, offset, dirty) {
+		return
+	}
+
+	s.storeOffset(vbID, offset, dirty)
+}
+
+// storeOffset moves the offset without the hold of paused collections.
+func (s *stream) storeOffset(vbID uint16, offset *models.Offset, dirty bool) {
+	if s.isResetting(vbID) {
+		return
+	}
+
 	if _, ok := s.vbIds.Load(vbID); ok {
 		s.offsets.Store(vbID, offset)
 		s.dirtyOffsets.Store(vbID, dirty)
+
+		if dirty {
+			unsavedSince := s.unsavedSince.Load()
+			if _, ok := unsavedSince.Load(vbID); !ok {
+				unsavedSince.Store(vbID, time.Now())
+			}
+
+			s.checkpoint.OffsetAdvanced(vbID)
+		}
 	} else {
 		logger.Log.Warn("vbID: %v not belong our vbId range", vbID)
 	}
 }
 
-func (s *stream) waitAndForward(payload interface{}, offset *models.Offset, vbID uint16, eventTime time.Time) {
-	if helpers.IsMetadata(payload) {
-		s.setOffset(vbID, offset, false)
+// advanceOffset moves the offset for events that are not delivered to the listener, in parallel mode
+// it waits behind the events of the vbucket that are still in flight.
+func (s *stream) advanceOffset(vbID uint16, offset *models.Offset, dirty bool) {
+	if s.dispatcher != nil {
+		s.dispatcher.advance(vbID, offset, dirty)
 		return
 	}
 
-	s.metric.DcpLatency = time.Since(eventTime).Milliseconds()
+	if s.batcher != nil {
+		s.batcher.advance(vbID, offset, dirty)
+		return
+	}
+
+	s.setOffset(vbID, offset, dirty)
+}
+
+func (s *stream) forward(spanCtx context.Context, payload interface{}, vbID uint16, ack func()) {
+	eventAck := newEventAck(ack)
 
 	ctx := &models.ListenerContext{
-		Commit: s.checkpoint.Save,
-		Event:  payload,
-		Ack: func() {
-			s.setOffset(vbID, offset, true)
-			s.anyDirtyOffset = true
-		},
+		Context: spanCtx,
+		Commit:  s.checkpoint.Save,
+		Event:   payload,
+		Ack:     eventAck.Ack,
 	}
 
 	start := time.Now()
 
-	s.listener(ctx)
+	var err error
+	if s.errorListener != nil {
+		err = s.callWithRetry(func() error {
+			return s.errorListener(ctx)
+		}, vbIDTarget(vbID))
+	} else {
+		err = s.callListener(func() error {
+			return recoverListener(func() error {
+				s.listener(ctx)
+				return nil
+			})
+		})
+	}
+
+	s.metric.ProcessLatency.Store(time.Since(start).Milliseconds())
+
+	switch {
+	case err != nil:
+		s.onListenerFailure(ctx, eventAck, vbID, err)
+	case s.errorListener != nil:
+		ctx.Ack()
+	}
+
+	endEventSpan(spanCtx, err)
+}
+
+func (s *stream) waitAndForward(payload interface{}, offset *models.Offset, vbID uint16, eventTime time.Time) {
+	spanCtx, _ := s.startEventSpan(payload, offset, vbID)
+
+	if s.isResetting(vbID) {
+		endSkippedEventSpan(spanCtx, "reset")
+		return
+	}
+
+	if helpers.IsMetadata(payload) || helpers.IsMetadataWithPrefix(payload, s.config.Metadata.Prefix) {
+		s.advanceOffset(vbID, offset, false)
+		endSkippedEventSpan(spanCtx, "metadata")
+		return
+	}
+
+	if s.keyFilter != nil && s.keyFilter.skips(payload) {
+		s.advanceOffset(vbID, offset, true)
+		endSkippedEventSpan(spanCtx, "filtered")
+		return
+	}
+
+	if s.collectionPause.filter(spanCtx, payload, offset, vbID, eventTime) {
+		return
+	}
+
+	if s.config.Dcp.Listener.Dedup.Enabled && s.isRedelivered(vbID, offset) {
+		s.metric.DedupSuppressed.Add(1)
+		s.advanceOffset(vbID, offset, true)
+		endSkippedEventSpan(spanCtx, "redelivered")
+		return
+	}
+
+	s.deliver(spanCtx, payload, offset, vbID, eventTime, nil)
+}
+
+type deliveredSeqNo struct {
+	vbUUID gocbcore.VbUUID
+	seqNo  uint64
+}
+
+// isRedelivered reports events at or below the delivered high-water mark of the vbucket, which are streamed again
+// after the stream is reopened from an older checkpoint. The mark is kept per vbUUID, the events after a failover
+// or a rollback to another branch are not the ones delivered before. Window bounds how far back they are suppressed.
+func (s *stream) isRedelivered(vbID uint16, offset *models.Offset) bool {
+	delivered, ok := s.deliveredSeqNos.Load(vbID)
+	if !ok || delivered.vbUUID != offset.VbUUID || offset.SeqNo > delivered.seqNo {
+		s.deliveredSeqNos.Store(vbID, deliveredSeqNo{vbUUID: offset.VbUUID, seqNo: offset.SeqNo})
+		return false
+	}
+
+	window := s.config.Dcp.Listener.Dedup.Window
+
+	return window == 0 || delivered.seqNo-offset.SeqNo < window
+}
+
+// deliver hands the event to the listener, acked is called after the offset of a replayed event is moved.
+func (s *stream) deliver(
+	spanCtx context.Context, payload interface{}, offset *models.Offset, vbID uint16, eventTime time.Time, acked func(),
+) {
+	s.metric.DcpLatency = time.Since(eventTime).Milliseconds()
+
+	if s.dispatcher != nil {
+		s.dispatcher.dispatch(vbID, offset, func(ack func()) {
+			s.forward(spanCtx, payload, vbID, thenAcked(ack, acked))
+		})
+		return
+	}
+
+	if s.batcher != nil {
+		s.batcher.add(spanCtx, payload, offset, vbID, acked)
+		return
+	}
+
+	s.forward(spanCtx, payload, vbID, thenAcked(func() {
+		s.setOffset(vbID, offset, true)
+		s.anyDirtyOffset.Store(true)
+	}, acked))
+}
+
+func thenAcked(ack func(), acked func()) func() {
+	if acked == nil {
+		return ack
+	}
+
+	return func() {
+		ack()
+		acked()
+	}
+}
+
+// forwardSystemEvent delivers collection and scope events to the listener in seqNo order with the
+// data events when configured, otherwise only their offset is advanced.
+func (s *stream) forwardSystemEvent(payload interface{}, offset *models.Offset, vbID uint16) {
+	if !s.config.Dcp.Listener.SystemEvents {
+		s.advanceOffset(vbID, offset, true)
+		return
+	}
+
+	s.waitAndForward(payload, offset, vbID, time.Now())
+}
 
-	s.metric.ProcessLatency = time.Since(start).Milliseconds()
+func (s *stream) handleEvent(event interface{}) {
+	switch v := event.(type) {
+	case models.DcpMutation:
+		s.waitAndForward(v, v.Offset, v.VbID, v.EventTime)
+	case models.DcpDeletion:
+		s.waitAndForward(v, v.Offset, v.VbID, v.EventTime)
+	case models.DcpExpiration:
+		s.waitAndForward(v, v.Offset, v.VbID, v.EventTime)
+	case models.DcpSeqNoAdvanced:
+		s.advanceOffset(v.VbID, v.Offset, true)
+	case models.DcpCollectionCreation:
+		s.trackWildcardCollection(v.CollectionID, v.CollectionName)
+		s.forwardSystemEvent(v, v.Offset, v.VbID)
+	case models.DcpCollectionDeletion:
+		s.dropCollection(v.CollectionID, v.ScopeName, v.CollectionName)
+		s.forwardSystemEvent(v, v.Offset, v.VbID)
+	case models.DcpCollectionFlush:
+		s.forwardSystemEvent(v, v.Offset, v.VbID)
+	case models.DcpScopeCreation:
+		s.forwardSystemEvent(v, v.Offset, v.VbID)
+	case models.DcpScopeDeletion:
+		s.forwardSystemEvent(v, v.Offset, v.VbID)
+	case models.DcpCollectionModification:
+		s.forwardSystemEvent(v, v.Offset, v.VbID)
+	case offsetResetApply:
+		s.applyResetOffset(v.vbID)
+	case models.Heartbeat:
+		s.listener(&models.ListenerContext{
+			Commit: s.checkpoint.Save,
+			Event:  v,
+			Ack:    func() {},
+		})
+	default:
+	}
 }
 
 func (s *stream) listen() {
-	for args := range s.observer.Listen() {
-		event := args.Event
-
-		switch v := event.(type) {
-		case models.DcpMutation:
-			s.waitAndForward(v, v.Offset, v.VbID, v.EventTime)
-		case models.DcpDeletion:
-			s.waitAndForward(v, v.Offset, v.VbID, v.EventTime)
-		case models.DcpExpiration:
-			s.waitAndForward(v, v.Offset, v.VbID, v.EventTime)
-		case models.DcpSeqNoAdvanced:
-			s.setOffset(v.VbID, v.Offset, true)
-		case models.DcpCollectionCreation:
-			s.setOffset(v.VbID, v.Offset, true)
-		case models.DcpCollectionDeletion:
-			s.setOffset(v.VbID, v.Offset, true)
-		case models.DcpCollectionFlush:
-			s.setOffset(v.VbID, v.Offset, true)
-		case models.DcpScopeCreation:
-			s.setOffset(v.VbID, v.Offset, true)
-		case models.DcpScopeDeletion:
-			s.setOffset(v.VbID, v.Offset, true)
-		case models.DcpCollectionModification:
-			s.setOffset(v.VbID, v.Offset, true)
-		default:
+	listenCh := s.observer.Listen()
+
+	for {
+		select {
+		case args, ok := <-listenCh:
+			if !ok {
+				return
+			}
+
+			s.handleEvent(args.Event)
+		case <-s.collectionPause.resumeCh:
+			s.collectionPause.drain()
 		}
 	}
 }
 
 func (s *stream) reopenStream(vbID uint16) {
+	reopeningVbIds := s.reopeningVbIds
+	reopeningVbIds.Store(vbID, struct{}{})
+
 	go func(innerVbID uint16) {
 		retry := 3
 
 		for {
 			err := s.openStream(innerVbID)
 			if err == nil {
-				logger.Log.Info("re-open stream, vbID: %d", innerVbID)
+				reopeningVbIds.Delete(innerVbID)
+				logger.Infow("re-open stream", "vbID", innerVbID)
 				break
 			} else {
-				logger.Log.Warn("cannot re-open stream, vbID: %d, err: %v", innerVbID, err)
+				s.recordOpenStreamFailure(innerVbID, err)
+				logger.Warnw("cannot re-open stream", "vbID", innerVbID, "err", err)
 			}
 
 			retry--
 			if retry == 0 {
-				logger.Log.Error("error while re-open stream, vbID: %d, err: give up after few retry", innerVbID)
+				logger.Errorw("error while re-open stream, give up after few retry", "vbID", innerVbID, "err", err)
 				panic(err)
 			}
 
@@ -160,18 +406,154 @@ func (s *stream) reopenStream(vbID uint16) {
 	}(vbID)
 }
 
+// reopenFilterEmptyStream resolves the configured collections again, since a dropped collection
+// may have been recreated with a new id, and reopens the stream if any of them still exists.
+func (s *stream) reopenFilterEmptyStream(vbID uint16) bool {
+	collectionIDs, err := s.client.ResolveCollectionIDs(s.config.ScopeName, s.config.CollectionNames)
+	if err != nil {
+		logger.Errorw("error while resolving collections for filter empty stream", "vbID", vbID, "err", err)
+		return false
+	}
+
+	if len(collectionIDs) == 0 {
+		logger.Warnw("no remaining collection to reopen filter empty stream", "vbID", vbID)
+		return false
+	}
+
+	s.collectionIDsLock.Lock()
+	s.collectionIDs = collectionIDs
+	s.collectionIDsLock.Unlock()
+
+	logger.Infow("reopening filter empty stream with remaining collections", "vbID", vbID, "collections", collectionIDs)
+	s.reopenStream(vbID)
+
+	return true
+}
+
+// currentCollectionIDs returns the collection filter of the streams, the map is replaced instead of
+// modified so it can be used after the lock is released.
+func (s *stream) currentCollectionIDs() map[uint32]string {
+	s.collectionIDsLock.RLock()
+	defer s.collectionIDsLock.RUnlock()
+
+	return s.collectionIDs
+}
+
+// trackWildcardCollection keeps the collections of the scope up to date from the manifest changes streamed
+// with the scope filter, so the observer of a reopened stream still knows the names of the new collections.
+func (s *stream) trackWildcardCollection(collectionID uint32, collectionName string) {
+	if !s.config.IsCollectionWildcard() {
+		return
+	}
+
+	s.collectionIDsLock.Lock()
+	defer s.collectionIDsLock.Unlock()
+
+	if _, ok := s.collectionIDs[collectionID]; ok {
+		return
+	}
+
+	collectionIDs := maps.Clone(s.collectionIDs)
+	collectionIDs[collectionID] = collectionName
+	s.collectionIDs = collectionIDs
+
+	logger.Log.Info("collection created in scope %v, streaming collection: %v", s.config.ScopeName, collectionName)
+}
+
+// dropCollection removes a dropped collection from the stream filter the first time one of the vbuckets
+// streams its deletion, so reopened streams continue with the remaining collections. The last collection
+// is kept since the server ends those streams as filter empty, see dcp.config.filterEmptyStrategy.
+func (s *stream) dropCollection(collectionID uint32, scopeName string, collectionName string) {
+	s.collectionIDsLock.Lock()
+
+	if _, ok := s.collectionIDs[collectionID]; !ok {
+		s.collectionIDsLock.Unlock()
+		return
+	}
+
+	if _, ok := s.droppedCollectionIDs[collectionID]; ok {
+		s.collectionIDsLock.Unlock()
+		return
+	}
+
+	s.droppedCollectionIDs[collectionID] = struct{}{}
+
+	if len(s.collectionIDs) > 1 || s.config.IsCollectionWildcard() {
+		collectionIDs := maps.Clone(s.collectionIDs)
+		delete(collectionIDs, collectionID)
+		s.collectionIDs = collectionIDs
+	}
+
+	s.collectionIDsLock.Unlock()
+
+	logger.Log.Warn("collection dropped in scope %v, collection: %v", scopeName, collectionName)
+
+	if handler, ok := s.eventHandler.(models.CollectionDroppedHandler); ok {
+		handler.CollectionDropped(models.CollectionDroppedEvent{
+			ScopeName:      scopeName,
+			CollectionName: collectionName,
+			CollectionID:   collectionID,
+		})
+	}
+}
+
+func (s *stream) startHeartbeat() {
+	s.heartbeatStopCh = make(chan struct{})
+
+	go func(stopCh chan struct{}, observer couchbase.Observer) {
+		ticker := time.NewTicker(s.config.Dcp.Listener.HeartbeatInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				observer.Heartbeat(now)
+			case <-stopCh:
+				return
+			}
+		}
+	}(s.heartbeatStopCh, s.observer)
+
+	logger.Log.Debug("started heartbeat, interval: %v", s.config.Dcp.Listener.HeartbeatInterval)
+}
+
 func (s *stream) listenEnd() {
-	for endContext := range s.observer.ListenEnd() {
-		if !s.closeWithCancel && endContext.Err != nil {
+	observer := s.observer
+
+	for endContext := range observer.ListenEnd() {
+		if !s.closeWithCancel && s.queueResetOffset(observer, endContext.Event.VbID) {
+			continue
+		}
+
+		filterEmpty := errors.Is(endContext.Err, gocbcore.ErrDCPStreamFilterEmpty)
+
+		if !s.closeWithCancel && filterEmpty {
+			logger.Warnw(
+				"end stream, collections in the stream filter are dropped",
+				"vbID", endContext.Event.VbID, "strategy", s.config.Dcp.Config.FilterEmptyStrategy,
+			)
+		} else if !s.closeWithCancel && endContext.Err != nil {
 			if !errors.Is(endContext.Err, gocbcore.ErrDCPStreamClosed) {
-				logger.Log.Error("end stream vbID: %v got error: %v", endContext.Event.VbID, endContext.Err)
+				logger.Errorw("end stream got error", "vbID", endContext.Event.VbID, "err", endContext.Err)
 			} else {
-				logger.Log.Debug("end stream vbID: %v got error: %v", endContext.Event.VbID, endContext.Err)
+				logger.Debugw("end stream got error", "vbID", endContext.Event.VbID, "err", endContext.Err)
 			}
 		}
 
 		if endContext.Err == nil {
-			logger.Log.Debug("end stream vbID: %v", endContext.Event.VbID)
+			logger.Debugw("end stream", "vbID", endContext.Event.VbID)
+
+			if s.config.IsSnapshotMode() && s.open.Load() {
+				s.markSnapshotEnd(endContext.Event.VbID)
+			}
+		}
+
+		if handler, ok := s.eventHandler.(models.StreamEndHandler); ok && !s.closeWithCancel {
+			handler.StreamEnd(models.StreamEndEvent{
+				Err:    endContext.Err,
+				VbID:   endContext.Event.VbID,
+				Status: endContext.Status,
+			})
 		}
 
 		if !s.closeWithCancel && endContext.Err != nil &&
@@ -181,16 +563,19 @@ func (s *stream) listenEnd() {
 				errors.Is(endContext.Err, gocbcore.ErrDCPStreamTooSlow) ||
 				errors.Is(endContext.Err, gocbcore.ErrDCPStreamDisconnected)) {
 			s.reopenStream(endContext.Event.VbID)
+		} else if !s.closeWithCancel && filterEmpty &&
+			s.config.Dcp.Config.FilterEmptyStrategy == config.FilterEmptyStrategyReopen &&
+			s.reopenFilterEmptyStream(endContext.Event.VbID) {
+			continue
 		} else {
-			s.activeStreams--
-			if s.activeStreams == 0 && !s.streamFinishedWithCloseCh {
+			if s.activeStreams.Add(-1) == 0 && !s.streamFinishedWithCloseCh {
 				s.finishStreamWithEndEventCh <- struct{}{}
 			}
 		}
 	}
 }
 
-func (s *stream) Open() {
+func (s *stream) Open() error {
 	s.streamFinishedWithCloseCh = false
 	s.streamFinishedWithEndEventCh = false
 
@@ -198,6 +583,19 @@ func (s *stream) Open() {
 
 	vbIds := s.vBucketDiscovery.Get()
 
+	s.checkpoint = NewCheckpoint(s, vbIds, s.client, s.metadata, s.config, s.bucketUUID, s.checkpointSaveMetric)
+
+	offsets, dirtyOffsets, anyDirtyOffset, err := s.loadOffsets(vbIds)
+	if err != nil {
+		return err
+	}
+
+	if s.config.IsSnapshotMode() {
+		if err := s.recordSnapshotSeqNos(); err != nil {
+			return err
+		}
+	}
+
 	if !s.config.RollbackMitigation.Disabled {
 		if s.bucketInfo.IsEphemeral() {
 			logger.Log.Info("rollback mitigation is disabled for ephemeral bucket")
@@ -208,31 +606,114 @@ func (s *stream) Open() {
 		}
 	}
 
-	s.activeStreams = len(vbIds)
+	s.activeStreams.Store(int32(len(vbIds)))
+
+	if s.config.IsSnapshotMode() {
+		s.resetSnapshotCompletion(vbIds)
+	}
 
-	s.checkpoint = NewCheckpoint(s, vbIds, s.client, s.metadata, s.config)
 	s.vbIds = wrapper.CreateConcurrentSwissMap[uint16, struct{}](1024)
 	for _, vbID := range vbIds {
 		s.vbIds.Store(vbID, struct{}{})
 	}
-	s.offsets, s.dirtyOffsets, s.anyDirtyOffset = s.checkpoint.Load()
-	s.observer = couchbase.NewObserver(s.config, s.collectionIDs, s.bus)
+	s.offsets, s.dirtyOffsets = offsets, dirtyOffsets
+	s.anyDirtyOffset.Store(anyDirtyOffset)
+	s.resetUnsavedSince()
+	s.deliveredSeqNos = wrapper.CreateConcurrentSwissMap[uint16, deliveredSeqNo](1024)
+	s.collectionPause.reset()
+	s.blockedVbIds = wrapper.CreateConcurrentSwissMap[uint16, chan struct{}](1024)
+	s.resetOffsets = wrapper.CreateConcurrentSwissMap[uint16, *models.Offset](1024)
+	s.reopeningVbIds = wrapper.CreateConcurrentSwissMap[uint16, struct{}](1024)
+	s.observer = couchbase.NewObserver(s.config, s.currentCollectionIDs(), s.bus)
+	s.failedVbIds = wrapper.CreateConcurrentSwissMap[uint16, struct{}](1024)
+	s.snapshotEndedVbIds = wrapper.CreateConcurrentSwissMap[uint16, struct{}](1024)
+
+	if s.config.MemoryPressure.Enabled {
+		s.memoryMonitor = newMemoryMonitor(s)
+		s.memoryMonitor.Start()
+	}
+
+	s.listenerStopCh = make(chan struct{})
+	s.dispatcher, s.batcher = nil, nil
+	concurrency, _ := s.config.ListenerWorkers()
+	switch {
+	case s.batchListener != nil:
+		if s.config.Dcp.Listener.Parallelism > 1 || concurrency > 1 {
+			logger.Log.Warn("dcp.listener.parallelism and dcp.listener.concurrency are ignored with the batch listener")
+		}
+		s.batcher = newBatchDispatcher(s)
+	case s.errorListener != nil || s.config.Dcp.Listener.Parallelism > 1 || concurrency > 1:
+		s.dispatcher = newParallelDispatcher(s)
+	}
 
-	s.openAllStreams(vbIds)
+	openVbIds := vbIds
+	if s.config.IsSnapshotMode() {
+		openVbIds = s.pendingSnapshotVbIds(vbIds)
+	}
+
+	s.openAllStreams(openVbIds)
+	s.open.Store(true)
+
+	if s.config.IsSnapshotMode() && len(openVbIds) == 0 {
+		s.completeSnapshot()
+		s.finishStreamWithEndEventCh <- struct{}{}
+	}
 
 	go s.listenEnd()
 	go s.listen()
 
+	if s.config.Dcp.Listener.HeartbeatInterval > 0 {
+		s.startHeartbeat()
+	}
+
 	logger.Log.Info("stream started")
 	s.eventHandler.AfterStreamStart()
 
 	s.checkpoint.StartSchedule()
 
 	go s.wait()
+
+	return nil
+}
+
+// loadCheckpoint retries failed checkpoint loads with exponential backoff, a checkpoint ahead of
+// its vBucket is returned at once since loading it again gives the same result.
+func (s *stream) loadCheckpoint() (
+	*wrapper.ConcurrentSwissMap[uint16, *models.Offset], *wrapper.ConcurrentSwissMap[uint16, bool], bool, error,
+) {
+	backoff := s.config.Checkpoint.LoadRetry.Backoff
+
+	for attempt := 1; ; attempt++ {
+		offsets, dirtyOffsets, anyDirtyOffset, err := s.checkpoint.Load()
+		if err == nil || errors.Is(err, ErrCheckpointAheadOfVBucket) || attempt >= s.config.Checkpoint.LoadRetry.Attempts {
+			return offsets, dirtyOffsets, anyDirtyOffset, err
+		}
+
+		logger.Log.Warn("error while load checkpoint, attempt: %d, retry in: %v, err: %v", attempt, backoff, err)
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
 }
 
+// Rebalance closes the streams and opens them with the vbuckets of the member once no membership change
+// comes in for the rebalance delay. The lock is only held while the streams are closed and opened, so
+// Pause, Resume and Reconnect do not wait for the delay.
 func (s *stream) Rebalance() {
-	if s.balancing && s.rebalanceTimer != nil {
+	if s.paused.Load() {
+		logger.Log.Info("stream is paused, vbuckets will be reassigned on resume")
+		return
+	}
+
+	s.rebalanceLock.Lock()
+	defer s.rebalanceLock.Unlock()
+
+	if s.paused.Load() {
+		logger.Log.Info("stream is paused, vbuckets will be reassigned on resume")
+		return
+	}
+
+	if s.balancing.Load() && s.rebalanceTimer != nil {
 		// Is rebalance timer triggered already
 		if s.rebalanceTimer.Stop() {
 			s.rebalanceTimer.Reset(s.config.Dcp.Group.Membership.RebalanceDelay)
@@ -244,12 +725,11 @@ func (s *stream) Rebalance() {
 		return
 	}
 	logger.Log.Info("rebalance starting")
-	s.rebalanceLock.Lock()
 
 	s.eventHandler.BeforeRebalanceStart()
 
-	if !s.balancing {
-		s.balancing = true
+	if !s.balancing.Load() {
+		s.balancing.Store(true)
 		s.Close(false)
 	}
 
@@ -261,23 +741,134 @@ func (s *stream) Rebalance() {
 }
 
 func (s *stream) rebalance() {
-	logger.Log.Info("reassigning vbuckets and opening stream is starting")
-
+	s.rebalanceLock.Lock()
 	defer s.rebalanceLock.Unlock()
 
+	if s.paused.Load() {
+		s.balancing.Store(false)
+		logger.Log.Info("stream is paused during rebalance, vbuckets will be reassigned on resume")
+		return
+	}
+
+	logger.Log.Info("reassigning vbuckets and opening stream is starting")
+
 	s.eventHandler.BeforeRebalanceEnd()
-	s.Open()
+	if err := s.Open(); err != nil {
+		logger.Log.Error("error while open stream on rebalance, err: %v", err)
+		panic(err)
+	}
 	s.metric.Rebalance++
 
 	logger.Log.Info("rebalance is finished")
-	s.balancing = false
+	s.balancing.Store(false)
 	s.eventHandler.AfterRebalanceEnd()
 }
 
+// Reconnect closes the streams, replaces the dcp connections through connect and opens the streams
+// again from the saved offsets. The streams stay closed when connect fails.
+func (s *stream) Reconnect(connect func() error) error {
+	s.rebalanceLock.Lock()
+	defer s.rebalanceLock.Unlock()
+
+	if s.paused.Load() {
+		logger.Log.Info("stream is paused, reconnecting without opening the streams")
+		return connect()
+	}
+
+	if s.balancing.Load() {
+		logger.Log.Info("stream is rebalancing, reconnecting without opening the streams")
+		return connect()
+	}
+
+	logger.Log.Info("reconnect starting")
+
+	s.balancing.Store(true)
+	defer s.balancing.Store(false)
+
+	if s.config.Checkpoint.ShouldSaveOnClose() {
+		s.Save()
+	}
+
+	s.Close(false)
+
+	if err := connect(); err != nil {
+		return err
+	}
+
+	if err := s.Open(); err != nil {
+		return err
+	}
+
+	logger.Log.Info("reconnect is finished")
+
+	return nil
+}
+
+// Pause closes the vbucket streams while the dcp connections stay open, the stream does not stop and
+// membership changes are only applied by Resume. A rebalance waiting for its delay leaves the streams closed.
+func (s *stream) Pause() {
+	s.rebalanceLock.Lock()
+	defer s.rebalanceLock.Unlock()
+
+	if s.paused.Load() {
+		return
+	}
+
+	if s.balancing.Load() {
+		s.paused.Store(true)
+		logger.Log.Info("stream paused during rebalance")
+		return
+	}
+
+	logger.Log.Info("pause starting")
+
+	if s.config.Checkpoint.ShouldSaveOnClose() {
+		s.Save()
+	}
+
+	s.paused.Store(true)
+	s.Close(false)
+
+	logger.Log.Info("stream paused")
+}
+
+// Resume opens the vbucket streams of the member again from the saved offsets, the stream stays paused
+// when they can not be opened. A rebalance waiting for its delay opens them instead.
+func (s *stream) Resume() error {
+	s.rebalanceLock.Lock()
+	defer s.rebalanceLock.Unlock()
+
+	if !s.paused.Load() {
+		return nil
+	}
+
+	if s.balancing.Load() {
+		s.paused.Store(false)
+		logger.Log.Info("stream resumed during rebalance")
+		return nil
+	}
+
+	logger.Log.Info("resume starting")
+
+	if err := s.Open(); err != nil {
+		return err
+	}
+
+	s.paused.Store(false)
+
+	logger.Log.Info("stream resumed")
+
+	return nil
+}
+
 func (s *stream) Save() {
 	s.checkpoint.Save()
 }
 
+func (s *stream) SaveAndWait(ctx context.Context) error {
+	return s.checkpoint.SaveAndWait(ctx)
+}
+
 func (s *stream) openStream(vbID uint16) error {
 	offset, exist := s.offsets.Load(vbID)
 	if !exist {
@@ -285,41 +876,206 @@ func (s *stream) openStream(vbID uint16) error {
 		logger.Log.Error("error while opening stream, err: %v", err)
 		return err
 	}
-	return s.client.OpenStream(vbID, s.collectionIDs, offset, s.observer)
+	collectionIDs := s.currentCollectionIDs()
+
+	var err error
+	if s.config.IsSnapshotMode() {
+		err = s.openSnapshotStream(vbID, collectionIDs, offset)
+	} else {
+		err = s.client.OpenStream(vbID, collectionIDs, offset, s.observer)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	logger.Debugw("stream opened", "vbID", vbID, "seqNo", offset.SeqNo)
+
+	if handler, ok := s.eventHandler.(models.StreamEventHandler); ok {
+		handler.StreamOpen(models.StreamOpenEvent{VbID: vbID, Offset: offset})
+	}
+
+	return nil
+}
+
+func openStreamErrorCategory(err error) string {
+	switch {
+	case errors.Is(err, gocbcore.ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, gocbcore.ErrNotMyVBucket):
+		return "not_my_vbucket"
+	case errors.Is(err, gocbcore.ErrSocketClosed):
+		return "socket_closed"
+	case errors.Is(err, gocbcore.ErrDCPBackfillFailed):
+		return "backfill_failed"
+	case errors.Is(err, gocbcore.ErrDCPStreamFilterEmpty):
+		return "filter_empty"
+	default:
+		return "unknown"
+	}
+}
+
+func (s *stream) recordOpenStreamFailure(vbID uint16, err error) {
+	key := OpenStreamFailure{VbID: vbID, Category: openStreamErrorCategory(err)}
+
+	s.openStreamFailuresLock.Lock()
+	defer s.openStreamFailuresLock.Unlock()
+
+	count, _ := s.metric.OpenStreamFailures.Load(key)
+	s.metric.OpenStreamFailures.Store(key, count+1)
+}
+
+func isTransientOpenStreamError(err error) bool {
+	return errors.Is(err, gocbcore.ErrTimeout) ||
+		errors.Is(err, gocbcore.ErrTemporaryFailure) ||
+		errors.Is(err, gocbcore.ErrBusy) ||
+		errors.Is(err, gocbcore.ErrOverload) ||
+		errors.Is(err, gocbcore.ErrServiceNotAvailable) ||
+		errors.Is(err, gocbcore.ErrSocketClosed) ||
+		errors.Is(err, gocbcore.ErrNotMyVBucket) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+// openStreamWithRetry retries transient errors with exponential backoff,
+// permanent errors like authentication or unknown collection are returned at once.
+func (s *stream) openStreamWithRetry(vbID uint16) error {
+	backoff := s.config.Dcp.OpenStream.RetryBackoff
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = s.openStream(vbID)
+		if err == nil || !isTransientOpenStreamError(err) || attempt >= s.config.Dcp.OpenStream.RetryAttempts {
+			return err
+		}
+
+		logger.Warnw("transient error while open stream", "vbID", vbID, "attempt", attempt, "retryIn", backoff, "err", err)
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
 }
 
 func (s *stream) openAllStreams(vbIds []uint16) {
 	openWg := &sync.WaitGroup{}
 	openWg.Add(len(vbIds))
 
+	var failed atomic.Int32
+
 	for _, vbID := range vbIds {
 		go func(innerVbId uint16) {
-			err := s.openStream(innerVbId)
+			defer openWg.Done()
+
+			err := s.openStreamWithRetry(innerVbId)
 			if err != nil {
-				logger.Log.Error("error while open stream, vbID: %d, err: %v", innerVbId, err)
-				panic(err)
+				logger.Errorw("error while open stream", "vbID", innerVbId, "err", err)
+				s.recordOpenStreamFailure(innerVbId, err)
+				s.failedVbIds.Store(innerVbId, struct{}{})
+				failed.Add(1)
 			}
-			openWg.Done()
 		}(vbID)
 	}
 
 	openWg.Wait()
+
+	if failed.Load() == 0 {
+		return
+	}
+
+	s.activeStreams.Add(-failed.Load())
+	logger.Log.Warn(
+		"%d of %d streams could not be opened, continuing with the rest and retrying them every %v",
+		failed.Load(), len(vbIds), s.config.Dcp.OpenStream.FailedRetryInterval,
+	)
+
+	s.startFailedStreamRetry()
+}
+
+// startFailedStreamRetry opens the streams that could not be opened again until all of them are open
+// or the stream is closed.
+func (s *stream) startFailedStreamRetry() {
+	s.failedRetryStopCh = make(chan struct{})
+	s.failedRetryWg.Add(1)
+
+	go func(stopCh chan struct{}) {
+		defer s.failedRetryWg.Done()
+
+		ticker := time.NewTicker(s.config.Dcp.OpenStream.FailedRetryInterval)
+		defer ticker.Stop()
+
+		for s.failedVbIds.Count() > 0 {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				s.retryFailedStreams(stopCh)
+			}
+		}
+	}(s.failedRetryStopCh)
+}
+
+func (s *stream) retryFailedStreams(stopCh chan struct{}) {
+	var vbIds []uint16
+	s.failedVbIds.Range(func(vbID uint16, _ struct{}) bool {
+		vbIds = append(vbIds, vbID)
+		return true
+	})
+
+	for _, vbID := range vbIds {
+		select {
+		case <-stopCh:
+			return
+		default:
+		}
+
+		if err := s.openStreamWithRetry(vbID); err != nil {
+			logger.Warnw("error while retrying failed stream", "vbID", vbID, "err", err)
+			s.recordOpenStreamFailure(vbID, err)
+			continue
+		}
+
+		s.activeStreams.Add(1)
+		s.failedVbIds.Delete(vbID)
+		logger.Infow("failed stream is opened", "vbID", vbID)
+	}
+}
+
+func (s *stream) stopFailedStreamRetry() {
+	if s.failedRetryStopCh != nil {
+		close(s.failedRetryStopCh)
+		s.failedRetryStopCh = nil
+	}
+
+	// an open in progress must finish before the streams are closed
+	s.failedRetryWg.Wait()
 }
 
 func (s *stream) closeAllStreams(internal bool) {
 	var wg sync.WaitGroup
 	wg.Add(s.offsets.Count())
 
+	abandonedVbIds := wrapper.CreateConcurrentSwissMap[uint16, struct{}](1024)
+
 	s.offsets.Range(func(vbID uint16, _ *models.Offset) bool {
 		go func(vbID uint16) {
 			defer wg.Done()
+			if _, failed := s.failedVbIds.Load(vbID); failed || s.isSnapshotEnded(vbID) {
+				return
+			}
 			if internal {
 				// todo: this is not a good way to close stream
 				s.observer.End(models.DcpStreamEnd{VbID: vbID}, nil)
 			} else {
-				err := s.client.CloseStream(vbID)
+				err := helpers.Retry(func() error {
+					return s.client.CloseStream(vbID)
+				}, s.config.Dcp.CloseStream.RetryAttempts, s.config.Dcp.CloseStream.RetryInterval)
+				if handler, ok := s.eventHandler.(models.StreamEventHandler); ok {
+					handler.StreamClose(models.StreamCloseEvent{VbID: vbID, Err: err})
+				}
 				if err != nil {
-					logger.Log.Error("cannot close stream, vbID: %d, err: %v", vbID, err)
+					logger.Errorw("cannot close stream, abandoning local stream state", "vbID", vbID, "err", err)
+					abandonedVbIds.Store(vbID, struct{}{})
+					// end the stream locally so rebalance does not wait for a stream end that will not come
+					s.observer.End(models.DcpStreamEnd{VbID: vbID}, nil)
 				}
 			}
 		}(vbID)
@@ -327,6 +1083,17 @@ func (s *stream) closeAllStreams(internal bool) {
 	})
 
 	wg.Wait()
+
+	if abandonedVbIds.Count() > 0 {
+		vbIds := make([]uint16, 0, abandonedVbIds.Count())
+		abandonedVbIds.Range(func(vbID uint16, _ struct{}) bool {
+			vbIds = append(vbIds, vbID)
+			return true
+		})
+
+		s.metric.CloseStreamFailure += len(vbIds)
+		logger.Log.Warn("streams could not be closed cleanly, vbIDs: %v", vbIds)
+	}
 }
 
 func (s *stream) wait() {
@@ -337,13 +1104,28 @@ func (s *stream) wait() {
 		s.streamFinishedWithEndEventCh = true
 	}
 
-	if !s.balancing {
-		close(s.stopCh)
+	if !s.balancing.Load() && !s.paused.Load() {
+		s.stop()
 	}
 }
 
+// stop signals the end of the stream once, both the stream end and Close may signal it.
+func (s *stream) stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+	})
+}
+
 func (s *stream) Close(closeWithCancel bool) {
+	if s.observer == nil {
+		// the vbucket streams were already closed by Pause or a reconnect that could not open them again
+		s.paused.Store(false)
+		s.stop()
+		return
+	}
+
 	s.closeWithCancel = closeWithCancel
+	s.open.Store(false)
 
 	s.eventHandler.BeforeStreamStop()
 
@@ -351,7 +1133,37 @@ func (s *stream) Close(closeWithCancel bool) {
 		s.rollbackMitigation.Stop()
 	}
 
+	if s.memoryMonitor != nil {
+		s.memoryMonitor.Stop()
+		s.memoryMonitor = nil
+	}
+
+	if s.heartbeatStopCh != nil {
+		close(s.heartbeatStopCh)
+		s.heartbeatStopCh = nil
+	}
+
+	s.stopFailedStreamRetry()
+
+	// blocked events stop waiting for their acknowledgement, they are streamed again from the checkpoint
+	if s.listenerStopCh != nil {
+		select {
+		case <-s.listenerStopCh:
+		default:
+			close(s.listenerStopCh)
+		}
+	}
+
 	s.observer.Close()
+	s.collectionPause.reset()
+
+	if s.dispatcher != nil {
+		s.dispatcher.Close()
+	}
+
+	if s.batcher != nil {
+		s.batcher.Close()
+	}
 
 	if s.checkpoint != nil {
 		s.checkpoint.StopSchedule()
@@ -369,13 +1181,36 @@ func (s *stream) Close(closeWithCancel bool) {
 
 	s.offsets = wrapper.CreateConcurrentSwissMap[uint16, *models.Offset](1024)
 	s.dirtyOffsets = wrapper.CreateConcurrentSwissMap[uint16, bool](1024)
+	s.resetUnsavedSince()
 
 	logger.Log.Info("stream stopped")
 	s.eventHandler.AfterStreamStop()
 }
 
+// GetOffsets leaves out the vbuckets whose offset reset is not applied yet, their checkpoints are cleared and
+// must not be saved again before the reset offset is written.
 func (s *stream) GetOffsets() (*wrapper.ConcurrentSwissMap[uint16, *models.Offset], *wrapper.ConcurrentSwissMap[uint16, bool], bool) {
-	return s.offsets, s.dirtyOffsets, s.anyDirtyOffset
+	if s.resetOffsets.Count() == 0 {
+		return s.offsets, s.dirtyOffsets, s.anyDirtyOffset.Load()
+	}
+
+	offsets := wrapper.CreateConcurrentSwissMap[uint16, *models.Offset](1024)
+	s.offsets.Range(func(vbID uint16, offset *models.Offset) bool {
+		if !s.isResetting(vbID) {
+			offsets.Store(vbID, offset)
+		}
+		return true
+	})
+
+	dirtyOffsets := wrapper.CreateConcurrentSwissMap[uint16, bool](1024)
+	s.dirtyOffsets.Range(func(vbID uint16, dirty bool) bool {
+		if !s.isResetting(vbID) {
+			dirtyOffsets.Store(vbID, dirty)
+		}
+		return true
+	})
+
+	return offsets, dirtyOffsets, s.anyDirtyOffset.Load()
 }
 
 func (s *stream) GetObserver() couchbase.Observer {
@@ -383,16 +1218,105 @@ func (s *stream) GetObserver() couchbase.Observer {
 }
 
 func (s *stream) GetMetric() (*Metric, int) {
-	return s.metric, s.activeStreams
+	return s.metric, int(s.activeStreams.Load())
+}
+
+// GetMaxUnsavedOffsetAge returns the age of the oldest offset that is not saved to the checkpoint yet.
+func (s *stream) GetMaxUnsavedOffsetAge() time.Duration {
+	var maxUnsavedOffsetAge time.Duration
+
+	s.unsavedSince.Load().Range(func(_ uint16, since time.Time) bool {
+		if age := time.Since(since); age > maxUnsavedOffsetAge {
+			maxUnsavedOffsetAge = age
+		}
+		return true
+	})
+
+	return maxUnsavedOffsetAge
+}
+
+// GetBlockedVBucketCount returns the number of vbuckets blocked until a failed event is acknowledged.
+func (s *stream) GetBlockedVBucketCount() int {
+	return s.blockedVbIds.Count()
 }
 
 func (s *stream) GetCheckpointMetric() *CheckpointMetric {
 	return s.checkpoint.GetMetric()
 }
 
+func (s *stream) PauseCollection(collectionName string) error {
+	collectionNames := s.config.CollectionNames
+	if s.config.IsCollectionWildcard() {
+		collectionIDs := s.currentCollectionIDs()
+		collectionNames = make([]string, 0, len(collectionIDs))
+		for _, name := range collectionIDs {
+			collectionNames = append(collectionNames, name)
+		}
+	}
+
+	for _, name := range collectionNames {
+		if name == collectionName {
+			s.collectionPause.Pause(collectionName)
+			return nil
+		}
+	}
+
+	return ErrCollectionNotConfigured
+}
+
+func (s *stream) ResumeCollection(collectionName string) bool {
+	return s.collectionPause.Resume(collectionName)
+}
+
+func (s *stream) GetPausedCollections() []string {
+	return s.collectionPause.Paused()
+}
+
+// GetFailedStreamCount returns the number of vbuckets whose stream could not be opened.
+func (s *stream) GetFailedStreamCount() int {
+	if s.failedVbIds == nil {
+		return 0
+	}
+
+	return s.failedVbIds.Count()
+}
+
+// Readiness returns nil once every vbucket stream of the member is open, no rebalance is in progress
+// and the stream is not paused. Streams that could not be opened, ended streams that are being opened again,
+// vbuckets whose offset reset is not applied yet and vbuckets blocked on a failed event are not ready.
+func (s *stream) Readiness() error {
+	if s.paused.Load() {
+		return ErrStreamPaused
+	}
+
+	if s.balancing.Load() {
+		return ErrStreamBalancing
+	}
+
+	if !s.open.Load() {
+		return ErrStreamNotOpen
+	}
+
+	failed, reopening, resetting, blocked := s.GetFailedStreamCount(), s.reopeningVbIds.Count(), s.resetOffsets.Count(),
+		s.GetBlockedVBucketCount()
+	if failed > 0 || reopening > 0 || resetting > 0 || blocked > 0 {
+		return fmt.Errorf(
+			"%w, failed: %v, reopening: %v, resetting: %v, blocked: %v", ErrStreamsNotOpened, failed, reopening, resetting, blocked,
+		)
+	}
+
+	return nil
+}
+
+// resetUnsavedSince swaps the unsaved offset timestamps, the metric collector reads them through GetMaxUnsavedOffsetAge.
+func (s *stream) resetUnsavedSince() {
+	s.unsavedSince.Store(wrapper.CreateConcurrentSwissMap[uint16, time.Time](1024))
+}
+
 func (s *stream) UnmarkDirtyOffsets() {
-	s.anyDirtyOffset = false
+	s.anyDirtyOffset.Store(false)
 	s.dirtyOffsets = wrapper.CreateConcurrentSwissMap[uint16, bool](1024)
+	s.resetUnsavedSince()
 }
 
 func NewStream(client couchbase.Client,
@@ -400,27 +1324,50 @@ func NewStream(client couchbase.Client,
 	config *config.Dcp,
 	version *couchbase.Version,
 	bucketInfo *couchbase.BucketInfo,
+	bucketUUID string,
 	vBucketDiscovery VBucketDiscovery,
 	listener models.Listener,
+	errorListener models.ErrorListener,
+	batchListener models.BatchListener,
+	deadLetterHandler models.DeadLetterHandler,
 	collectionIDs map[uint32]string,
 	stopCh chan struct{},
 	bus EventBus.Bus,
 	eventHandler models.EventHandler,
+	tracer trace.Tracer,
 ) Stream {
-	return &stream{
+	s := &stream{
 		client:                     client,
 		metadata:                   metadata,
 		listener:                   listener,
+		errorListener:              errorListener,
+		batchListener:              batchListener,
+		deadLetterHandler:          deadLetterHandler,
 		config:                     config,
 		version:                    version,
 		bucketInfo:                 bucketInfo,
+		bucketUUID:                 bucketUUID,
 		vBucketDiscovery:           vBucketDiscovery,
 		collectionIDs:              collectionIDs,
+		droppedCollectionIDs:       map[uint32]struct{}{},
 		finishStreamWithCloseCh:    make(chan struct{}, 1),
 		finishStreamWithEndEventCh: make(chan struct{}, 1),
 		stopCh:                     stopCh,
 		bus:                        bus,
 		eventHandler:               eventHandler,
-		metric:                     &Metric{},
+		tracer:                     tracer,
+		metric: &Metric{
+			OpenStreamFailures: wrapper.CreateConcurrentSwissMap[OpenStreamFailure, int64](1024),
+		},
+		checkpointSaveMetric: NewCheckpointSaveMetric(),
+		deliveredSeqNos:      wrapper.CreateConcurrentSwissMap[uint16, deliveredSeqNo](1024),
+		blockedVbIds:         wrapper.CreateConcurrentSwissMap[uint16, chan struct{}](1024),
+		resetOffsets:         wrapper.CreateConcurrentSwissMap[uint16, *models.Offset](1024),
+		reopeningVbIds:       wrapper.CreateConcurrentSwissMap[uint16, struct{}](1024),
 	}
+	s.resetUnsavedSince()
+	s.collectionPause = newCollectionPause(s)
+	s.keyFilter = newKeyFilter(config.Dcp.Filter)
+
+	return s
 }
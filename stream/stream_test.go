@@ -0,0 +1,605 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Trendyol/go-dcp/config"
+	"github.com/Trendyol/go-dcp/couchbase"
+	"github.com/Trendyol/go-dcp/helpers"
+	"github.com/Trendyol/go-dcp/models"
+	"github.com/Trendyol/go-dcp/wrapper"
+
+	"github.com/asaskevich/EventBus"
+	"github.com/couchbase/gocbcore/v10"
+	"github.com/couchbase/gocbcore/v10/memd"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+type fakeObserver struct {
+	couchbase.Observer
+	endCh models.ListenerEndCh
+}
+
+func (o *fakeObserver) ListenEnd() models.ListenerEndCh {
+	return o.endCh
+}
+
+type fakeClient struct {
+	couchbase.Client
+	resolved  map[uint32]string
+	openedIDs chan map[uint32]string
+}
+
+func (c *fakeClient) ResolveCollectionIDs(_ string, _ []string) (map[uint32]string, error) {
+	return c.resolved, nil
+}
+
+func (c *fakeClient) OpenStream(_ uint16, collectionIDs map[uint32]string, _ *models.Offset, _ couchbase.Observer) error {
+	c.openedIDs <- collectionIDs
+	return nil
+}
+
+type recordingEventHandler struct {
+	models.EmptyEventHandler
+	streamEnds []models.StreamEndEvent
+	dropped    []models.CollectionDroppedEvent
+	opened     []models.StreamOpenEvent
+	lock       sync.Mutex
+}
+
+func (h *recordingEventHandler) StreamEnd(event models.StreamEndEvent) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.streamEnds = append(h.streamEnds, event)
+}
+
+func (h *recordingEventHandler) CollectionDropped(event models.CollectionDroppedEvent) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.dropped = append(h.dropped, event)
+}
+
+func (h *recordingEventHandler) StreamOpen(event models.StreamOpenEvent) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.opened = append(h.opened, event)
+}
+
+func newCollectionDropTestStream(filterEmptyStrategy string) (*stream, *fakeClient, *fakeObserver, *recordingEventHandler) {
+	c := &config.Dcp{CollectionNames: []string{"orders", "products"}}
+	c.Dcp.Config.FilterEmptyStrategy = filterEmptyStrategy
+
+	client := &fakeClient{openedIDs: make(chan map[uint32]string, 1)}
+	observer := &fakeObserver{endCh: make(models.ListenerEndCh, 1)}
+	eventHandler := &recordingEventHandler{}
+
+	s := NewStream(
+		client, nil, c, nil, nil, "", nil, nil, nil, nil, nil,
+		map[uint32]string{8: "orders", 9: "products"}, nil, nil, eventHandler, nil,
+	).(*stream)
+	s.observer = observer
+	s.activeStreams.Store(1)
+	s.vbIds = wrapper.CreateConcurrentSwissMap[uint16, struct{}](1)
+	s.offsets = wrapper.CreateConcurrentSwissMap[uint16, *models.Offset](1)
+	s.offsets.Store(0, &models.Offset{SnapshotMarker: &models.SnapshotMarker{}})
+	s.resetOffsets = wrapper.CreateConcurrentSwissMap[uint16, *models.Offset](1)
+
+	return s, client, observer, eventHandler
+}
+
+func collectionDeletion(vbID uint16, collectionID uint32, collectionName string) models.DcpCollectionDeletion {
+	return models.DcpCollectionDeletion{
+		DcpCollectionDeletion: &gocbcore.DcpCollectionDeletion{VbID: vbID, CollectionID: collectionID},
+		Offset:                &models.Offset{SnapshotMarker: &models.SnapshotMarker{}},
+		CollectionName:        collectionName,
+		ScopeName:             "_default",
+	}
+}
+
+func TestStreamDropCollectionContinuesWithRemainingCollections(t *testing.T) {
+	s, _, _, eventHandler := newCollectionDropTestStream(config.FilterEmptyStrategyClose)
+
+	s.handleEvent(collectionDeletion(0, 8, "orders"))
+	s.handleEvent(collectionDeletion(1, 8, "orders"))
+
+	if len(s.collectionIDs) != 1 || s.collectionIDs[9] != "products" {
+		t.Fatalf("collectionIDs is expected to only contain products, got: %v", s.collectionIDs)
+	}
+
+	if len(eventHandler.dropped) != 1 || eventHandler.dropped[0].CollectionName != "orders" {
+		t.Fatalf("CollectionDropped is expected once for orders, got: %v", eventHandler.dropped)
+	}
+
+	s.handleEvent(collectionDeletion(0, 9, "products"))
+
+	if len(s.collectionIDs) != 1 {
+		t.Errorf("last collection is expected to stay in the stream filter, got: %v", s.collectionIDs)
+	}
+
+	if len(eventHandler.dropped) != 2 || eventHandler.dropped[1].CollectionID != 9 {
+		t.Errorf("CollectionDropped is expected for products, got: %v", eventHandler.dropped)
+	}
+}
+
+func TestStreamFilterEmptyEndClosesStream(t *testing.T) {
+	s, _, observer, eventHandler := newCollectionDropTestStream(config.FilterEmptyStrategyClose)
+
+	observer.endCh <- models.DcpStreamEndContext{
+		Event:  models.DcpStreamEnd{VbID: 0},
+		Err:    gocbcore.ErrDCPStreamFilterEmpty,
+		Status: memd.StreamEndFilterEmpty,
+	}
+	close(observer.endCh)
+
+	s.listenEnd()
+
+	if len(eventHandler.streamEnds) != 1 || eventHandler.streamEnds[0].Status != memd.StreamEndFilterEmpty {
+		t.Fatalf("StreamEnd is expected with filter empty status, got: %v", eventHandler.streamEnds)
+	}
+
+	select {
+	case <-s.finishStreamWithEndEventCh:
+	default:
+		t.Errorf("stream is expected to finish once its last vbucket stream ended")
+	}
+}
+
+func TestStreamFilterEmptyEndReopensWithRemainingCollections(t *testing.T) {
+	s, client, observer, _ := newCollectionDropTestStream(config.FilterEmptyStrategyReopen)
+	client.resolved = map[uint32]string{9: "products"}
+
+	observer.endCh <- models.DcpStreamEndContext{
+		Event:  models.DcpStreamEnd{VbID: 0},
+		Err:    gocbcore.ErrDCPStreamFilterEmpty,
+		Status: memd.StreamEndFilterEmpty,
+	}
+	close(observer.endCh)
+
+	s.listenEnd()
+
+	select {
+	case collectionIDs := <-client.openedIDs:
+		if len(collectionIDs) != 1 || collectionIDs[9] != "products" {
+			t.Errorf("stream is expected to reopen with products, got: %v", collectionIDs)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("stream is expected to reopen")
+	}
+
+	if s.activeStreams.Load() != 1 {
+		t.Errorf("reopened stream is expected to stay active, got: %v", s.activeStreams.Load())
+	}
+}
+
+func TestStreamSnapshotModeCompletesOnceAllVBucketsEnded(t *testing.T) {
+	c := &config.Dcp{}
+	c.Dcp.Mode = config.DcpModeSnapshot
+
+	bus := EventBus.New()
+	completed := make(chan bool, 3)
+	if err := bus.Subscribe(helpers.SnapshotCompletedBusEventName, func(done bool) { completed <- done }); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewStream(nil, nil, c, nil, nil, "", nil, nil, nil, nil, nil, nil, nil, bus, nil, nil).(*stream)
+	s.vbIds = wrapper.CreateConcurrentSwissMap[uint16, struct{}](3)
+	s.offsets = wrapper.CreateConcurrentSwissMap[uint16, *models.Offset](3)
+	s.snapshotSeqNos = wrapper.CreateConcurrentSwissMap[uint16, uint64](3)
+	s.snapshotEndedVbIds = wrapper.CreateConcurrentSwissMap[uint16, struct{}](3)
+
+	for vbID, seqNo := range []uint64{10, 20, 30} {
+		s.vbIds.Store(uint16(vbID), struct{}{})
+		s.offsets.Store(uint16(vbID), &models.Offset{SnapshotMarker: &models.SnapshotMarker{}, SeqNo: 20})
+		s.snapshotSeqNos.Store(uint16(vbID), seqNo)
+	}
+	s.activeStreams.Store(3)
+
+	pending := s.pendingSnapshotVbIds([]uint16{0, 1, 2})
+	if len(pending) != 1 || pending[0] != 2 || s.activeStreams.Load() != 1 {
+		t.Fatalf("only vbID 2 is expected to be opened, got: %v, active streams: %v", pending, s.activeStreams.Load())
+	}
+
+	s.markSnapshotEnd(2)
+	s.markSnapshotEnd(2)
+
+	if len(completed) != 1 || !<-completed {
+		t.Errorf("snapshot completed is expected to be published once, got: %v", len(completed))
+	}
+
+	s.resetSnapshotCompletion([]uint16{0, 1, 2})
+	if len(completed) != 0 {
+		t.Errorf("snapshot completion is expected to be kept for the same vbuckets, got: %v", len(completed))
+	}
+
+	s.resetSnapshotCompletion([]uint16{0, 1, 2, 3})
+	if len(completed) != 1 || <-completed || s.snapshotCompleted {
+		t.Errorf("snapshot completion is expected to be withdrawn for reassigned vbuckets, completed: %v", s.snapshotCompleted)
+	}
+}
+
+func TestStreamOpenStreamSendsStreamOpen(t *testing.T) {
+	s, _, _, eventHandler := newCollectionDropTestStream(config.FilterEmptyStrategyClose)
+
+	if err := s.openStream(0); err != nil {
+		t.Fatalf("openStream is expected to succeed, err: %v", err)
+	}
+
+	if len(eventHandler.opened) != 1 || eventHandler.opened[0].VbID != 0 || eventHandler.opened[0].Offset == nil {
+		t.Errorf("StreamOpen is expected once with the offset of vbID 0, got: %v", eventHandler.opened)
+	}
+
+	if err := s.openStream(1); err == nil || len(eventHandler.opened) != 1 {
+		t.Errorf("StreamOpen is not expected when the stream could not be opened, got: %v", eventHandler.opened)
+	}
+}
+
+// lifecycleEventHandler only has the methods of models.EventHandler, like handlers written before the optional ones.
+type lifecycleEventHandler struct {
+	models.EventHandler
+}
+
+func TestStreamOpenStreamWithoutStreamEventHandler(t *testing.T) {
+	s, _, _, _ := newCollectionDropTestStream(config.FilterEmptyStrategyClose)
+	s.eventHandler = lifecycleEventHandler{EventHandler: models.DefaultEventHandler}
+
+	if err := s.openStream(0); err != nil {
+		t.Fatalf("openStream is expected to succeed, err: %v", err)
+	}
+}
+
+type failingOpenClient struct {
+	couchbase.Client
+	failures map[uint16]int
+	lock     sync.Mutex
+}
+
+func (c *failingOpenClient) OpenStream(vbID uint16, _ map[uint32]string, _ *models.Offset, _ couchbase.Observer) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.failures[vbID] > 0 {
+		c.failures[vbID]--
+		return gocbcore.ErrAuthenticationFailure
+	}
+
+	return nil
+}
+
+func TestStreamRetriesFailedStreamsWithoutPanicking(t *testing.T) {
+	c := &config.Dcp{}
+	c.Dcp.OpenStream.RetryAttempts = 1
+	c.Dcp.OpenStream.FailedRetryInterval = 10 * time.Millisecond
+
+	client := &failingOpenClient{failures: map[uint16]int{0: 2, 1: 1}}
+
+	s := NewStream(
+		client, nil, c, nil, nil, "", nil, nil, nil, nil, nil, nil, nil, nil, &recordingEventHandler{}, nil,
+	).(*stream)
+	s.offsets = wrapper.CreateConcurrentSwissMap[uint16, *models.Offset](2)
+	s.failedVbIds = wrapper.CreateConcurrentSwissMap[uint16, struct{}](2)
+	s.offsets.Store(0, &models.Offset{SnapshotMarker: &models.SnapshotMarker{}})
+	s.offsets.Store(1, &models.Offset{SnapshotMarker: &models.SnapshotMarker{}})
+	s.activeStreams.Store(2)
+
+	// every vbucket fails on the first attempt
+	s.openAllStreams([]uint16{0, 1})
+	defer s.stopFailedStreamRetry()
+
+	if s.GetFailedStreamCount() != 2 || s.activeStreams.Load() != 0 {
+		t.Fatalf("expected 2 failed streams, got: %v, active streams: %v", s.GetFailedStreamCount(), s.activeStreams.Load())
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for s.GetFailedStreamCount() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("failed streams are expected to be opened again, failed: %v", s.GetFailedStreamCount())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if s.activeStreams.Load() != 2 {
+		t.Errorf("expected 2 active streams, got: %v", s.activeStreams.Load())
+	}
+
+	s.openStreamFailuresLock.Lock()
+	defer s.openStreamFailuresLock.Unlock()
+
+	if count, _ := s.metric.OpenStreamFailures.Load(OpenStreamFailure{VbID: 0, Category: "unknown"}); count != 2 {
+		t.Errorf("expected 2 open failures of vbID 0, got: %v", count)
+	}
+}
+
+func TestStreamCollectionFilterIsReadUnderLock(t *testing.T) {
+	s, client, _, _ := newCollectionDropTestStream(config.FilterEmptyStrategyClose)
+	s.config.CollectionNames = []string{config.CollectionNameWildcard}
+	client.openedIDs = make(chan map[uint32]string, 100)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(3)
+
+		go func(collectionID uint32) {
+			defer wg.Done()
+			s.trackWildcardCollection(collectionID, fmt.Sprintf("collection-%v", collectionID))
+		}(uint32(100 + i))
+
+		go func() {
+			defer wg.Done()
+			_ = s.openStream(0)
+		}()
+
+		go func() {
+			defer wg.Done()
+			_ = s.PauseCollection("orders")
+		}()
+	}
+	wg.Wait()
+
+	if collectionIDs := s.currentCollectionIDs(); len(collectionIDs) != 52 {
+		t.Fatalf("expected 52 collections in the stream filter, got: %v", len(collectionIDs))
+	}
+
+	for i := 0; i < 50; i++ {
+		if collectionIDs := <-client.openedIDs; collectionIDs[9] != "products" {
+			t.Fatalf("unexpected collection filter: %v", collectionIDs)
+		}
+	}
+}
+
+type scriptedOpenClient struct {
+	couchbase.Client
+	errs     []error
+	attempts int
+}
+
+func (c *scriptedOpenClient) OpenStream(_ uint16, _ map[uint32]string, _ *models.Offset, _ couchbase.Observer) error {
+	c.attempts++
+
+	if len(c.errs) == 0 {
+		return nil
+	}
+
+	err := c.errs[0]
+	c.errs = c.errs[1:]
+
+	return err
+}
+
+func TestStreamOpenStreamWithRetry(t *testing.T) {
+	tests := []struct {
+		expected error
+		name     string
+		errs     []error
+		attempts int
+	}{
+		{
+			name:     "transient errors are retried until the stream opens",
+			errs:     []error{gocbcore.ErrTimeout, gocbcore.ErrNotMyVBucket},
+			attempts: 3,
+		},
+		{
+			name:     "transient errors are returned after the last attempt",
+			errs:     []error{gocbcore.ErrTemporaryFailure, gocbcore.ErrBusy, gocbcore.ErrSocketClosed},
+			attempts: 3,
+			expected: gocbcore.ErrSocketClosed,
+		},
+		{
+			name:     "permanent errors are returned at once",
+			errs:     []error{gocbcore.ErrCollectionNotFound},
+			attempts: 1,
+			expected: gocbcore.ErrCollectionNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &config.Dcp{}
+			c.Dcp.OpenStream.RetryAttempts = 3
+			c.Dcp.OpenStream.RetryBackoff = time.Millisecond
+
+			client := &scriptedOpenClient{errs: tt.errs}
+
+			s := NewStream(
+				client, nil, c, nil, nil, "", nil, nil, nil, nil, nil, nil, nil, nil, &recordingEventHandler{}, nil,
+			).(*stream)
+			s.offsets = wrapper.CreateConcurrentSwissMap[uint16, *models.Offset](1)
+			s.offsets.Store(0, &models.Offset{SnapshotMarker: &models.SnapshotMarker{}})
+
+			err := s.openStreamWithRetry(0)
+			if !errors.Is(err, tt.expected) || (tt.expected == nil && err != nil) {
+				t.Errorf("expected error: %v, got: %v", tt.expected, err)
+			}
+
+			if client.attempts != tt.attempts {
+				t.Errorf("expected %v attempts, got: %v", tt.attempts, client.attempts)
+			}
+		})
+	}
+}
+
+func TestStreamForwardsSystemEventsWhenEnabled(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		t.Run(fmt.Sprintf("systemEvents=%v", enabled), func(t *testing.T) {
+			s, _, _, _ := newCollectionDropTestStream(config.FilterEmptyStrategyClose)
+			s.config.Dcp.Listener.SystemEvents = enabled
+			s.checkpoint = NewCheckpoint(s, []uint16{0}, nil, nil, s.config, "", NewCheckpointSaveMetric())
+			s.tracer = noop.NewTracerProvider().Tracer("test")
+			s.config.Metadata.Prefix = helpers.Prefix
+			s.vbIds.Store(0, struct{}{})
+			s.dirtyOffsets = wrapper.CreateConcurrentSwissMap[uint16, bool](1)
+
+			var events []interface{}
+			s.listener = func(ctx *models.ListenerContext) {
+				events = append(events, ctx.Event)
+				ctx.Ack()
+			}
+
+			creation := models.DcpCollectionCreation{
+				DcpCollectionCreation: &gocbcore.DcpCollectionCreation{VbID: 0, SeqNo: 2, CollectionID: 10},
+				Offset:                &models.Offset{SnapshotMarker: &models.SnapshotMarker{}, SeqNo: 2},
+			}
+			s.handleEvent(creation)
+
+			if enabled && (len(events) != 1 || events[0] != creation) {
+				t.Fatalf("collection creation is expected to reach the listener, got: %v", events)
+			}
+
+			if !enabled && len(events) != 0 {
+				t.Fatalf("collection creation is not expected to reach the listener, got: %v", events)
+			}
+
+			if offset, _ := s.offsets.Load(0); offset.SeqNo != 2 {
+				t.Errorf("offset is expected to advance to 2, got: %v", offset.SeqNo)
+			}
+		})
+	}
+}
+
+func TestStreamUnsavedSinceIsSwappedSafely(t *testing.T) {
+	s, _, _, _ := newCollectionDropTestStream(config.FilterEmptyStrategyClose)
+	s.unsavedSince.Load().Store(0, time.Now().Add(-time.Minute))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			s.UnmarkDirtyOffsets()
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		s.GetMaxUnsavedOffsetAge()
+	}
+	<-done
+
+	if age := s.GetMaxUnsavedOffsetAge(); age != 0 {
+		t.Errorf("unsaved offset age is expected to reset, got: %v", age)
+	}
+}
+
+func TestStreamDedupSuppressesRedeliveredEventsOfTheSameBranch(t *testing.T) {
+	s, delivered := newPauseTestStream(config.PausedCollectionStrategyBuffer)
+	s.config.Dcp.Listener.Dedup.Enabled = true
+
+	mutation := func(vbUUID gocbcore.VbUUID, seqNo uint64) models.DcpMutation {
+		event := pauseTestMutation("products", 0, seqNo)
+		event.Offset.VbUUID = vbUUID
+		return event
+	}
+
+	s.handleEvent(mutation(100, 1))
+	s.handleEvent(mutation(100, 2))
+	// streamed again from an older checkpoint
+	s.handleEvent(mutation(100, 2))
+	// rolled back to another branch after a failover
+	s.handleEvent(mutation(200, 2))
+
+	if len(*delivered) != 3 || s.metric.DedupSuppressed.Load() != 1 {
+		t.Errorf("only the event of the same branch is expected to be suppressed, delivered: %v, suppressed: %v",
+			*delivered, s.metric.DedupSuppressed.Load())
+	}
+}
+
+func TestStreamReadinessReportsVBucketsThatAreNotStreaming(t *testing.T) {
+	s := newDispatchTestStream(config.DCPListener{})
+	s.open.Store(true)
+
+	if err := s.Readiness(); err != nil {
+		t.Fatalf("stream is expected to be ready, err: %v", err)
+	}
+
+	states := map[string]func(restore bool){
+		"reopening": func(restore bool) {
+			s.reopeningVbIds.Store(0, struct{}{})
+			if restore {
+				s.reopeningVbIds.Delete(0)
+			}
+		},
+		"resetting": func(restore bool) {
+			s.resetOffsets.Store(0, testOffset(0))
+			if restore {
+				s.resetOffsets.Delete(0)
+			}
+		},
+		"blocked": func(restore bool) {
+			s.blockedVbIds.Store(0, make(chan struct{}))
+			if restore {
+				s.blockedVbIds.Delete(0)
+			}
+		},
+	}
+
+	for name, set := range states {
+		set(false)
+		if err := s.Readiness(); !errors.Is(err, ErrStreamsNotOpened) {
+			t.Errorf("stream is expected not to be ready while a vbucket is %v, err: %v", name, err)
+		}
+		set(true)
+	}
+
+	s.balancing.Store(true)
+	if err := s.Readiness(); !errors.Is(err, ErrStreamBalancing) {
+		t.Errorf("stream is expected not to be ready while balancing, err: %v", err)
+	}
+}
+
+func TestStreamPauseAndResumeDoNotWaitForRebalanceDelay(t *testing.T) {
+	s := newDispatchTestStream(config.DCPListener{})
+	s.observer = nil
+
+	// the streams are closed and the rebalance waits for its delay
+	s.balancing.Store(true)
+
+	done := make(chan struct{})
+	go func() {
+		s.Pause()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected pause to return while the rebalance waits for its delay")
+	}
+
+	if !s.paused.Load() {
+		t.Fatal("expected the stream to be paused")
+	}
+
+	// the rebalance leaves the streams closed, Open is not called
+	s.rebalance()
+
+	if s.balancing.Load() || !s.paused.Load() {
+		t.Fatalf("expected the rebalance to end paused, balancing: %v, paused: %v", s.balancing.Load(), s.paused.Load())
+	}
+
+	s.balancing.Store(true)
+	s.paused.Store(true)
+
+	// the rebalance opens the streams instead
+	if err := s.Resume(); err != nil || s.paused.Load() {
+		t.Fatalf("expected resume to leave the streams to the rebalance, err: %v, paused: %v", err, s.paused.Load())
+	}
+}
+
+func TestStreamCloseWithoutObserverStopsOnce(t *testing.T) {
+	s := newDispatchTestStream(config.DCPListener{})
+	s.observer = nil
+	s.stopCh = make(chan struct{})
+
+	s.Close(false)
+	s.Close(false)
+
+	select {
+	case <-s.stopCh:
+	default:
+		t.Fatal("expected the stream to be stopped")
+	}
+}
@@ -0,0 +1,62 @@
+package stream
+
+import (
+	"context"
+
+	"github.com/Trendyol/go-dcp/models"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func eventSpanName(payload interface{}) string {
+	switch payload.(type) {
+	case models.DcpMutation:
+		return "dcp.mutation"
+	case models.DcpDeletion:
+		return "dcp.deletion"
+	case models.DcpExpiration:
+		return "dcp.expiration"
+	default:
+		return "dcp.system_event"
+	}
+}
+
+// startEventSpan starts the span of an event taken from the observer, it ends once the listener returns.
+// Attributes are only built for recording spans, so the noop tracer costs nothing beyond the Start call.
+func (s *stream) startEventSpan(payload interface{}, offset *models.Offset, vbID uint16) (context.Context, trace.Span) {
+	ctx, span := s.tracer.Start(context.Background(), eventSpanName(payload), trace.WithSpanKind(trace.SpanKindConsumer))
+
+	if span.IsRecording() {
+		span.SetAttributes(
+			attribute.Int("dcp.vbucket", int(vbID)),
+			attribute.Int64("dcp.seqno", int64(offset.SeqNo)),
+			attribute.String("dcp.group", s.config.Dcp.Group.Name),
+		)
+	}
+
+	return ctx, span
+}
+
+// endSkippedEventSpan ends the span of an event that is not delivered to the listener.
+func endSkippedEventSpan(ctx context.Context, reason string) {
+	span := trace.SpanFromContext(ctx)
+
+	if span.IsRecording() {
+		span.SetAttributes(attribute.String("dcp.skipped", reason))
+	}
+
+	span.End()
+}
+
+func endEventSpan(ctx context.Context, err error) {
+	span := trace.SpanFromContext(ctx)
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
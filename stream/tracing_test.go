@@ -0,0 +1,136 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/Trendyol/go-dcp/config"
+	"github.com/Trendyol/go-dcp/helpers"
+	"github.com/Trendyol/go-dcp/models"
+
+	"github.com/couchbase/gocbcore/v10"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+type recordedSpan struct {
+	noop.Span
+	attributes map[attribute.Key]attribute.Value
+	name       string
+	status     codes.Code
+	ended      bool
+}
+
+func (s *recordedSpan) IsRecording() bool {
+	return true
+}
+
+func (s *recordedSpan) SetAttributes(kv ...attribute.KeyValue) {
+	for _, attr := range kv {
+		s.attributes[attr.Key] = attr.Value
+	}
+}
+
+func (s *recordedSpan) SetStatus(code codes.Code, _ string) {
+	s.status = code
+}
+
+func (s *recordedSpan) RecordError(_ error, _ ...trace.EventOption) {}
+
+func (s *recordedSpan) End(_ ...trace.SpanEndOption) {
+	s.ended = true
+}
+
+type recordingTracer struct {
+	noop.Tracer
+	spans []*recordedSpan
+	lock  sync.Mutex
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, _ ...trace.SpanStartOption) (context.Context, trace.Span) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	span := &recordedSpan{name: name, attributes: map[attribute.Key]attribute.Value{}}
+	t.spans = append(t.spans, span)
+
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+func newTracingTestStream() (*stream, *recordingTracer) {
+	s := newDispatchTestStream(config.DCPListener{})
+	s.config.Dcp.Group.Name = "group"
+	s.config.Metadata.Prefix = helpers.Prefix
+
+	tracer := &recordingTracer{}
+	s.tracer = tracer
+
+	return s, tracer
+}
+
+func tracingMutation(key string, seqNo uint64) models.DcpMutation {
+	return models.DcpMutation{
+		DcpMutation: &gocbcore.DcpMutation{VbID: 1, SeqNo: seqNo, Key: []byte(key)},
+		Offset:      testOffset(seqNo),
+	}
+}
+
+func TestEventSpanCoversTheListener(t *testing.T) {
+	s, tracer := newTracingTestStream()
+
+	var ended bool
+	s.listener = func(ctx *models.ListenerContext) {
+		ended = trace.SpanFromContext(ctx.Context).(*recordedSpan).ended
+		ctx.Ack()
+	}
+
+	s.handleEvent(tracingMutation("user:1", 5))
+
+	if len(tracer.spans) != 1 {
+		t.Fatalf("expected a span for the mutation, got: %v", len(tracer.spans))
+	}
+
+	span := tracer.spans[0]
+	if span.name != "dcp.mutation" || ended || !span.ended {
+		t.Errorf("expected a dcp.mutation span that ends after the listener, got name: %v, ended in listener: %v, ended: %v",
+			span.name, ended, span.ended)
+	}
+
+	if span.attributes["dcp.vbucket"].AsInt64() != 1 || span.attributes["dcp.seqno"].AsInt64() != 5 ||
+		span.attributes["dcp.group"].AsString() != "group" {
+		t.Errorf("unexpected span attributes: %v", span.attributes)
+	}
+}
+
+func TestEventSpanRecordsListenerError(t *testing.T) {
+	s, tracer := newTracingTestStream()
+	s.config.Dcp.Listener.OnError = config.ListenerOnErrorSkip
+	s.config.Dcp.Listener.Retry.Attempts = 1
+	s.errorListener = func(_ *models.ListenerContext) error {
+		return errors.New("sink is down")
+	}
+
+	s.handleEvent(tracingMutation("user:1", 5))
+
+	if len(tracer.spans) != 1 || tracer.spans[0].status != codes.Error || !tracer.spans[0].ended {
+		t.Fatalf("expected an ended span with error status, got: %v", tracer.spans)
+	}
+}
+
+func TestEventSpanOfFilteredEvent(t *testing.T) {
+	s, tracer := newTracingTestStream()
+	s.keyFilter = newKeyFilter(config.DCPFilter{KeyPrefixes: []string{"order:"}})
+	s.listener = func(_ *models.ListenerContext) {
+		t.Error("filtered event is not expected to reach the listener")
+	}
+
+	s.handleEvent(tracingMutation("user:1", 5))
+
+	if len(tracer.spans) != 1 || tracer.spans[0].attributes["dcp.skipped"].AsString() != "filtered" || !tracer.spans[0].ended {
+		t.Fatalf("expected an ended span skipped by the filter, got: %v", tracer.spans)
+	}
+}
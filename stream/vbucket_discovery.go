@@ -37,16 +37,26 @@ type VBucketDiscoveryMetric struct {
 	VBucketRangeEnd   uint16
 }
 
-func (s *vBucketDiscovery) Get() []uint16 {
-	vBuckets := make([]uint16, 0, s.vBucketNumber)
+// AssignedVBuckets returns the vbuckets the member streams with the given membership info.
+func AssignedVBuckets(vBucketNumber int, info *membership.Model) []uint16 {
+	vBuckets := make([]uint16, 0, vBucketNumber)
 
-	for i := 0; i < s.vBucketNumber; i++ {
+	for i := 0; i < vBucketNumber; i++ {
 		vBuckets = append(vBuckets, uint16(i))
 	}
 
+	chunks := helpers.ChunkSlice[uint16](vBuckets, info.TotalMembers)
+	if info.MemberNumber < 1 || info.MemberNumber > len(chunks) {
+		return []uint16{}
+	}
+
+	return chunks[info.MemberNumber-1]
+}
+
+func (s *vBucketDiscovery) Get() []uint16 {
 	receivedInfo := s.membership.GetInfo()
 
-	readyToStreamVBuckets := helpers.ChunkSlice[uint16](vBuckets, receivedInfo.TotalMembers)[receivedInfo.MemberNumber-1]
+	readyToStreamVBuckets := AssignedVBuckets(s.vBucketNumber, receivedInfo)
 
 	start := readyToStreamVBuckets[0]
 	end := readyToStreamVBuckets[len(readyToStreamVBuckets)-1]